@@ -0,0 +1,601 @@
+// Package acmetest is a minimal ACME (RFC 8555) server standing in for Let's
+// Encrypt in tests and local development, in the spirit of Pebble: it serves
+// a directory, accounts, orders, HTTP-01 authorizations and finalization, and
+// issues certificates from its own throwaway CA.
+//
+// It is not a CA: it does not verify JWS signatures or nonces, and it
+// validates every HTTP-01 challenge against one address (ChallengeAddr)
+// instead of resolving the identifier, so tests can point it at the server
+// under test.
+package acmetest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// Server is a running stand-in ACME server.
+type Server struct {
+	// URL is the server's base URL; the directory is URL + "/directory".
+	URL string
+	// CA issues the certificates; tests add it to their roots.
+	CA *x509.Certificate
+
+	// ChallengeAddr is the host:port every HTTP-01 challenge is fetched from,
+	// with the identifier as the Host. Set before a challenge is accepted.
+	ChallengeAddr string
+	// CertValidity is the lifetime of issued certificates (default 90 days).
+	CertValidity time.Duration
+
+	srv   *httptest.Server
+	caKey *ecdsa.PrivateKey
+
+	mu       sync.Mutex
+	seq      int
+	accounts map[string]*account // by URL
+	byKey    map[string]string   // account URL by JWK thumbprint
+	orders   map[string]*order
+	authzs   map[string]*authz
+	certs    map[string][]byte // PEM chain by URL
+	issued   int
+}
+
+type account struct {
+	url        string
+	thumbprint string
+	contact    []string
+}
+
+type order struct {
+	url         string
+	account     string
+	status      string
+	identifiers []string
+	authzs      []string
+	certificate string
+}
+
+type authz struct {
+	url        string
+	identifier string
+	status     string
+	token      string
+	chalURL    string
+	chalStatus string
+	problem    string
+	thumbprint string
+}
+
+// New starts a server; Close stops it.
+func New() (*Server, error) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "acmetest root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(10 * 365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		CA:           ca,
+		CertValidity: 90 * 24 * time.Hour,
+		caKey:        caKey,
+		accounts:     make(map[string]*account),
+		byKey:        make(map[string]string),
+		orders:       make(map[string]*order),
+		authzs:       make(map[string]*authz),
+		certs:        make(map[string][]byte),
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.srv.URL
+	return s, nil
+}
+
+// DirectoryURL is the URL an ACME client is configured with.
+func (s *Server) DirectoryURL() string {
+	return s.URL + "/directory"
+}
+
+// Issued returns how many certificates the server has issued.
+func (s *Server) Issued() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.issued
+}
+
+// Close shuts the server down.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// request is a decoded JWS POST.
+type request struct {
+	account    *account // nil for newAccount
+	jwk        crypto.PublicKey
+	payload    []byte
+	postAsGet  bool
+	thumbprint string
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Replay-Nonce", s.nonce())
+	w.Header().Set("Cache-Control", "no-store")
+
+	switch {
+	case r.URL.Path == "/directory":
+		writeJSON(w, http.StatusOK, map[string]any{
+			"newNonce":   s.URL + "/new-nonce",
+			"newAccount": s.URL + "/new-account",
+			"newOrder":   s.URL + "/new-order",
+			"revokeCert": s.URL + "/revoke-cert",
+			"keyChange":  s.URL + "/key-change",
+		})
+		return
+	case r.URL.Path == "/new-nonce":
+		w.WriteHeader(http.StatusOK)
+		return
+	case r.Method != http.MethodPost:
+		problem(w, http.StatusMethodNotAllowed, "malformed", "POST required")
+		return
+	}
+
+	req, err := s.decode(r)
+	if err != nil {
+		problem(w, http.StatusBadRequest, "malformed", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := r.URL.Path
+	switch {
+	case path == "/new-account":
+		s.newAccount(w, req)
+	case req.account == nil:
+		problem(w, http.StatusUnauthorized, "accountDoesNotExist", "unknown account")
+	case path == "/new-order":
+		s.newOrder(w, req)
+	case strings.HasPrefix(path, "/order/"):
+		s.getOrder(w, req, s.URL+path)
+	case strings.HasPrefix(path, "/finalize/"):
+		s.finalize(w, req, s.URL+"/order/"+strings.TrimPrefix(path, "/finalize/"))
+	case strings.HasPrefix(path, "/authz/"):
+		s.getAuthz(w, s.URL+path)
+	case strings.HasPrefix(path, "/chal/"):
+		s.acceptChallenge(w, req, s.URL+"/authz/"+strings.TrimPrefix(path, "/chal/"))
+	case strings.HasPrefix(path, "/cert/"):
+		s.getCert(w, s.URL+path)
+	default:
+		problem(w, http.StatusNotFound, "malformed", "not found")
+	}
+}
+
+// decode reads a flattened JWS, without verifying its signature.
+func (s *Server) decode(r *http.Request) (*request, error) {
+	var jws struct {
+		Protected string `json:"protected"`
+		Payload   string `json:"payload"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&jws); err != nil {
+		return nil, err
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(jws.Protected)
+	if err != nil {
+		return nil, err
+	}
+	var header struct {
+		JWK json.RawMessage `json:"jwk"`
+		KID string          `json:"kid"`
+	}
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return nil, err
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(jws.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &request{payload: payload, postAsGet: jws.Payload == ""}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if header.KID != "" {
+		req.account = s.accounts[header.KID]
+		if req.account == nil {
+			return nil, errors.New("unknown kid")
+		}
+		req.thumbprint = req.account.thumbprint
+		return req, nil
+	}
+	if req.jwk, err = parseJWK(header.JWK); err != nil {
+		return nil, err
+	}
+	if req.thumbprint, err = acme.JWKThumbprint(req.jwk); err != nil {
+		return nil, err
+	}
+	if u, ok := s.byKey[req.thumbprint]; ok {
+		req.account = s.accounts[u]
+	}
+	return req, nil
+}
+
+func (s *Server) newAccount(w http.ResponseWriter, req *request) {
+	if req.account != nil {
+		w.Header().Set("Location", req.account.url)
+		writeJSON(w, http.StatusOK, map[string]any{"status": "valid", "contact": req.account.contact})
+		return
+	}
+	if req.jwk == nil {
+		problem(w, http.StatusBadRequest, "malformed", "newAccount needs a jwk")
+		return
+	}
+	var p struct {
+		Contact []string `json:"contact"`
+	}
+	_ = json.Unmarshal(req.payload, &p)
+	a := &account{url: s.next("/account/"), thumbprint: req.thumbprint, contact: p.Contact}
+	s.accounts[a.url] = a
+	s.byKey[a.thumbprint] = a.url
+	w.Header().Set("Location", a.url)
+	writeJSON(w, http.StatusCreated, map[string]any{"status": "valid", "contact": a.contact})
+}
+
+func (s *Server) newOrder(w http.ResponseWriter, req *request) {
+	var p struct {
+		Identifiers []struct {
+			Type  string `json:"type"`
+			Value string `json:"value"`
+		} `json:"identifiers"`
+	}
+	if err := json.Unmarshal(req.payload, &p); err != nil || len(p.Identifiers) == 0 {
+		problem(w, http.StatusBadRequest, "malformed", "identifiers required")
+		return
+	}
+	o := &order{url: s.next("/order/"), account: req.account.url, status: acme.StatusPending}
+	for _, id := range p.Identifiers {
+		if id.Type != "dns" || strings.HasPrefix(id.Value, "*.") {
+			problem(w, http.StatusBadRequest, "rejectedIdentifier", "only non-wildcard dns identifiers")
+			return
+		}
+		o.identifiers = append(o.identifiers, id.Value)
+		z := &authz{
+			url:        s.next("/authz/"),
+			identifier: id.Value,
+			status:     acme.StatusPending,
+			token:      randomToken(),
+			chalStatus: acme.StatusPending,
+			thumbprint: req.account.thumbprint,
+		}
+		z.chalURL = s.URL + "/chal/" + strings.TrimPrefix(z.url, s.URL+"/authz/")
+		s.authzs[z.url] = z
+		o.authzs = append(o.authzs, z.url)
+	}
+	s.orders[o.url] = o
+	w.Header().Set("Location", o.url)
+	writeJSON(w, http.StatusCreated, s.orderJSON(o))
+}
+
+func (s *Server) getOrder(w http.ResponseWriter, req *request, url string) {
+	o := s.orders[url]
+	if o == nil || o.account != req.account.url {
+		problem(w, http.StatusNotFound, "malformed", "no such order")
+		return
+	}
+	s.updateOrder(o)
+	w.Header().Set("Location", o.url)
+	writeJSON(w, http.StatusOK, s.orderJSON(o))
+}
+
+func (s *Server) getAuthz(w http.ResponseWriter, url string) {
+	z := s.authzs[url]
+	if z == nil {
+		problem(w, http.StatusNotFound, "malformed", "no such authorization")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.authzJSON(z))
+}
+
+// acceptChallenge validates the challenge right away: the client's next
+// poll sees the outcome.
+func (s *Server) acceptChallenge(w http.ResponseWriter, req *request, authzURL string) {
+	z := s.authzs[authzURL]
+	if z == nil {
+		problem(w, http.StatusNotFound, "malformed", "no such challenge")
+		return
+	}
+	if z.status == acme.StatusPending {
+		addr := s.ChallengeAddr
+		s.mu.Unlock()
+		err := validateHTTP01(addr, z.identifier, z.token, z.token+"."+z.thumbprint)
+		s.mu.Lock()
+		if err != nil {
+			z.status, z.chalStatus, z.problem = acme.StatusInvalid, acme.StatusInvalid, err.Error()
+		} else {
+			z.status, z.chalStatus = acme.StatusValid, acme.StatusValid
+		}
+	}
+	writeJSON(w, http.StatusOK, s.challengeJSON(z))
+}
+
+func validateHTTP01(addr, host, token, want string) error {
+	if addr == "" {
+		return errors.New("acmetest: no ChallengeAddr")
+	}
+	r, err := http.NewRequest(http.MethodGet, "http://"+addr+"/.well-known/acme-challenge/"+token, nil)
+	if err != nil {
+		return err
+	}
+	r.Host = host
+	client := http.Client{
+		Timeout:       5 * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<12))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("challenge answered %d", resp.StatusCode)
+	}
+	if got := strings.TrimSpace(string(b)); got != want {
+		return fmt.Errorf("challenge answered %q, want %q", got, want)
+	}
+	return nil
+}
+
+func (s *Server) finalize(w http.ResponseWriter, req *request, orderURL string) {
+	o := s.orders[orderURL]
+	if o == nil || o.account != req.account.url {
+		problem(w, http.StatusNotFound, "malformed", "no such order")
+		return
+	}
+	s.updateOrder(o)
+	if o.status != acme.StatusReady {
+		problem(w, http.StatusForbidden, "orderNotReady", "order is "+o.status)
+		return
+	}
+	var p struct {
+		CSR string `json:"csr"`
+	}
+	if err := json.Unmarshal(req.payload, &p); err != nil {
+		problem(w, http.StatusBadRequest, "malformed", err.Error())
+		return
+	}
+	der, err := base64.RawURLEncoding.DecodeString(p.CSR)
+	if err != nil {
+		problem(w, http.StatusBadRequest, "badCSR", err.Error())
+		return
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err == nil {
+		err = csr.CheckSignature()
+	}
+	if err != nil {
+		problem(w, http.StatusBadRequest, "badCSR", err.Error())
+		return
+	}
+	names := slices.Clone(csr.DNSNames)
+	want := slices.Clone(o.identifiers)
+	slices.Sort(names)
+	slices.Sort(want)
+	if !slices.Equal(slices.Compact(names), slices.Compact(want)) {
+		problem(w, http.StatusBadRequest, "badCSR", "CSR names don't match the order")
+		return
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(int64(s.seq + 1000)),
+		Subject:      pkix.Name{CommonName: want[0]},
+		DNSNames:     want,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(s.CertValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	leaf, err := x509.CreateCertificate(rand.Reader, tmpl, s.CA, csr.PublicKey, s.caKey)
+	if err != nil {
+		problem(w, http.StatusInternalServerError, "serverInternal", err.Error())
+		return
+	}
+	chain := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf})
+	chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.CA.Raw})...)
+	o.certificate = s.next("/cert/")
+	s.certs[o.certificate] = chain
+	o.status = acme.StatusValid
+	s.issued++
+	w.Header().Set("Location", o.url)
+	writeJSON(w, http.StatusOK, s.orderJSON(o))
+}
+
+func (s *Server) getCert(w http.ResponseWriter, url string) {
+	chain, ok := s.certs[url]
+	if !ok {
+		problem(w, http.StatusNotFound, "malformed", "no such certificate")
+		return
+	}
+	w.Header().Set("Content-Type", "application/pem-certificate-chain")
+	w.Write(chain)
+}
+
+// updateOrder moves a pending order on from its authorizations.
+func (s *Server) updateOrder(o *order) {
+	if o.status != acme.StatusPending {
+		return
+	}
+	ready := true
+	for _, u := range o.authzs {
+		switch s.authzs[u].status {
+		case acme.StatusInvalid:
+			o.status = acme.StatusInvalid
+			return
+		case acme.StatusValid:
+		default:
+			ready = false
+		}
+	}
+	if ready {
+		o.status = acme.StatusReady
+	}
+}
+
+func (s *Server) orderJSON(o *order) map[string]any {
+	ids := make([]map[string]string, len(o.identifiers))
+	for i, v := range o.identifiers {
+		ids[i] = map[string]string{"type": "dns", "value": v}
+	}
+	v := map[string]any{
+		"status":         o.status,
+		"expires":        time.Now().Add(24 * time.Hour).Format(time.RFC3339),
+		"identifiers":    ids,
+		"authorizations": o.authzs,
+		"finalize":       s.URL + "/finalize/" + strings.TrimPrefix(o.url, s.URL+"/order/"),
+	}
+	if o.certificate != "" {
+		v["certificate"] = o.certificate
+	}
+	return v
+}
+
+func (s *Server) authzJSON(z *authz) map[string]any {
+	return map[string]any{
+		"status":     z.status,
+		"expires":    time.Now().Add(24 * time.Hour).Format(time.RFC3339),
+		"identifier": map[string]string{"type": "dns", "value": z.identifier},
+		"challenges": []map[string]any{s.challengeJSON(z)},
+	}
+}
+
+func (s *Server) challengeJSON(z *authz) map[string]any {
+	v := map[string]any{
+		"type":   "http-01",
+		"url":    z.chalURL,
+		"token":  z.token,
+		"status": z.chalStatus,
+	}
+	if z.problem != "" {
+		v["error"] = map[string]any{"type": "urn:ietf:params:acme:error:unauthorized", "detail": z.problem}
+	}
+	return v
+}
+
+func (s *Server) next(prefix string) string {
+	s.seq++
+	return fmt.Sprintf("%s%s%d", s.URL, prefix, s.seq)
+}
+
+func (s *Server) nonce() string {
+	return randomToken()
+}
+
+func randomToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// parseJWK decodes an EC (P-256/P-384) or RSA public JWK.
+func parseJWK(raw json.RawMessage) (crypto.PublicKey, error) {
+	var k struct {
+		Kty string `json:"kty"`
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	}
+	if err := json.Unmarshal(raw, &k); err != nil {
+		return nil, err
+	}
+	num := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+	switch k.Kty {
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := num(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := num(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "RSA":
+		n, err := num(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := num(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func problem(w http.ResponseWriter, status int, typ, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"type":   "urn:ietf:params:acme:error:" + typ,
+		"detail": detail,
+		"status": status,
+	})
+}
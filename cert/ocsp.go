@@ -0,0 +1,212 @@
+package cert
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	// ocspInterval is how often StapleOCSP looks for staples due a refresh;
+	// a Set looks right away.
+	ocspInterval = 5 * time.Minute
+	// ocspRetry is the wait before refetching after a failed fetch.
+	ocspRetry = 10 * time.Minute
+	// ocspDefaultValidity stands in for a response without a nextUpdate.
+	ocspDefaultValidity = time.Hour
+	// ocspFetchTimeout bounds one responder round trip.
+	ocspFetchTimeout = 10 * time.Second
+)
+
+// staple is a certificate's last good OCSP response, and when to fetch the
+// next one.
+type staple struct {
+	raw        []byte
+	nextUpdate time.Time // the response is not served past it
+	refresh    time.Time // next fetch
+}
+
+// StapleOCSP fetches the OCSP responses of the Table's certificates from their
+// issuers' responders and staples them to the handshake, until ctx is done. A
+// response is refetched halfway through its validity; a failed fetch keeps
+// the last good response until its nextUpdate, then the certificate is served
+// without one. Only a Good response is stapled. A certificate needs its
+// issuer in the chain (the second certificate) and an OCSP server in its AIA;
+// others are served as they are. client nil uses http.DefaultClient.
+func (t *Table) StapleOCSP(ctx context.Context, client *http.Client) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	ticker := time.NewTicker(ocspInterval)
+	defer ticker.Stop()
+	kick := t.ocspKickChan()
+	for {
+		t.refreshOCSP(ctx, client, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-kick:
+		}
+	}
+}
+
+func (t *Table) ocspKickChan() chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.ocspKick == nil {
+		t.ocspKick = make(chan struct{}, 1)
+	}
+	return t.ocspKick
+}
+
+// kickOCSP asks StapleOCSP, if running, to look for work now.
+func (t *Table) kickOCSP() {
+	select {
+	case t.ocspKickChan() <- struct{}{}:
+	default:
+	}
+}
+
+// refreshOCSP fetches the staples due at now, then serves the new ones.
+func (t *Table) refreshOCSP(ctx context.Context, client *http.Client, now time.Time) {
+	t.mu.RLock()
+	certs := t.certs
+	staples := t.staples
+	t.mu.RUnlock()
+
+	next := make(map[[32]byte]*staple, len(certs))
+	changed := false
+	for _, cert := range certs {
+		if len(cert.Certificate) < 2 || len(cert.Leaf.OCSPServer) == 0 {
+			continue
+		}
+		fp := sha256.Sum256(cert.Certificate[0])
+		if _, ok := next[fp]; ok {
+			continue
+		}
+		st := staples[fp]
+		if st != nil && now.Before(st.refresh) {
+			next[fp] = st
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		changed = true
+		resp, raw, err := fetchOCSP(ctx, client, cert)
+		if err != nil {
+			slog.Warn("cert: fetch ocsp response failed", "cn", cert.Leaf.Subject.CommonName, "responder", cert.Leaf.OCSPServer[0], "error", err)
+			if st == nil {
+				st = &staple{}
+			} else {
+				st = &staple{raw: st.raw, nextUpdate: st.nextUpdate}
+			}
+			st.refresh = now.Add(ocspRetry)
+			next[fp] = st
+			continue
+		}
+		if resp.Status != ocsp.Good {
+			status := "revoked"
+			if resp.Status == ocsp.Unknown {
+				status = "unknown"
+			}
+			slog.Error("cert: ocsp status not good, not stapling", "cn", cert.Leaf.Subject.CommonName, "status", status)
+			next[fp] = &staple{refresh: now.Add(ocspRetry)}
+			continue
+		}
+		nextUpdate := resp.NextUpdate
+		if nextUpdate.IsZero() {
+			nextUpdate = now.Add(ocspDefaultValidity)
+		}
+		next[fp] = &staple{
+			raw:        raw,
+			nextUpdate: nextUpdate,
+			refresh:    resp.ThisUpdate.Add(nextUpdate.Sub(resp.ThisUpdate) / 2),
+		}
+	}
+	if !changed && len(next) == len(staples) { // nothing fetched, no certificate gone
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.staples = next
+	t.rebuildLocked(now)
+}
+
+// fetchOCSP asks cert's responder for its status, verified against its issuer.
+func fetchOCSP(ctx context.Context, client *http.Client, cert *tls.Certificate) (*ocsp.Response, []byte, error) {
+	issuer, err := x509.ParseCertificate(cert.Certificate[1])
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := ocsp.CreateRequest(cert.Leaf, issuer, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ocspFetchTimeout)
+	defer cancel()
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, cert.Leaf.OCSPServer[0], bytes.NewReader(req))
+	if err != nil {
+		return nil, nil, err
+	}
+	r.Header.Set("Content-Type", "application/ocsp-request")
+	r.Header.Set("Accept", "application/ocsp-response")
+	resp, err := client.Do(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("responder answered %d", resp.StatusCode)
+	}
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(raw) == 0 {
+		return nil, nil, errors.New("empty response")
+	}
+	parsed, err := ocsp.ParseResponseForCert(raw, cert.Leaf, issuer)
+	if err != nil {
+		return nil, nil, err
+	}
+	return parsed, raw, nil
+}
+
+// rebuildLocked indexes t.certs, each with its staple when one is valid at
+// now. The certificates are copied to carry it: a handshake may be reading
+// the previous ones.
+func (t *Table) rebuildLocked(now time.Time) {
+	certs := t.certs
+	if len(t.staples) > 0 {
+		certs = make([]*tls.Certificate, len(t.certs))
+		for i, cert := range t.certs {
+			certs[i] = cert
+			if len(cert.Certificate) == 0 {
+				continue
+			}
+			st := t.staples[sha256.Sum256(cert.Certificate[0])]
+			if st == nil || st.raw == nil || !now.Before(st.nextUpdate) {
+				continue
+			}
+			stapled := *cert
+			stapled.OCSPStaple = st.raw
+			certs[i] = &stapled
+		}
+	}
+	t.nameToCertificate = buildNameToCertificate(certs)
+}
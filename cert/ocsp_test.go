@@ -0,0 +1,125 @@
+package cert
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestStapleOCSP(t *testing.T) {
+	t.Parallel()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	var status atomic.Int64 // ocsp.Good, Revoked, or -1 to fail
+	var fetches atomic.Int64
+	now := time.Now()
+	responder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		req, err := ocsp.ParseRequest(body)
+		if err != nil || status.Load() < 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		resp, _ := ocsp.CreateResponse(ca, ca, ocsp.Response{
+			Status:       int(status.Load()),
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   now,
+			NextUpdate:   now.Add(4 * time.Hour),
+			RevokedAt:    now,
+		}, caKey)
+		w.Write(resp)
+	}))
+	defer responder.Close()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	leafDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "ocsp.example.com"},
+		DNSNames:     []string{"ocsp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		OCSPServer:   []string{responder.URL},
+	}, ca, &key.PublicKey, caKey)
+	require.NoError(t, err)
+	cert := &tls.Certificate{Certificate: [][]byte{leafDER, caDER}, PrivateKey: key}
+	noOCSP := &tls.Certificate{Certificate: [][]byte{genCertDER(t, "plain.example.com")}}
+
+	table := Table{}
+	table.Set([]*tls.Certificate{cert, noOCSP})
+	hello := func(name string) *tls.ClientHelloInfo {
+		return &tls.ClientHelloInfo{ServerName: name, SupportedVersions: []uint16{tls.VersionTLS13}}
+	}
+	served := func(name string) *tls.Certificate {
+		t.Helper()
+		got, err := table.Get(hello(name))
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		return got
+	}
+	ctx := context.Background()
+
+	status.Store(ocsp.Good)
+	table.refreshOCSP(ctx, http.DefaultClient, now)
+	assert.EqualValues(t, 1, fetches.Load(), "a certificate without an OCSP server is not fetched")
+	got := served("ocsp.example.com")
+	if assert.NotEmpty(t, got.OCSPStaple) {
+		resp, err := ocsp.ParseResponse(got.OCSPStaple, ca)
+		require.NoError(t, err)
+		assert.Equal(t, ocsp.Good, resp.Status)
+	}
+	assert.Empty(t, cert.OCSPStaple, "the Set certificate is never written")
+	assert.Same(t, noOCSP, served("plain.example.com"))
+
+	table.refreshOCSP(ctx, http.DefaultClient, now.Add(time.Hour))
+	assert.EqualValues(t, 1, fetches.Load(), "not due before half its validity")
+
+	status.Store(-1)
+	table.refreshOCSP(ctx, http.DefaultClient, now.Add(3*time.Hour))
+	assert.EqualValues(t, 2, fetches.Load())
+	assert.NotEmpty(t, served("ocsp.example.com").OCSPStaple, "a failed fetch keeps the last good response")
+
+	table.refreshOCSP(ctx, http.DefaultClient, now.Add(5*time.Hour))
+	assert.Empty(t, served("ocsp.example.com").OCSPStaple, "an expired response is dropped")
+
+	status.Store(ocsp.Revoked)
+	table.refreshOCSP(ctx, http.DefaultClient, now.Add(6*time.Hour))
+	assert.Empty(t, served("ocsp.example.com").OCSPStaple, "only a good response is stapled")
+
+	// a Set keeps the staples of the certificates it still holds
+	status.Store(ocsp.Good)
+	table.refreshOCSP(ctx, http.DefaultClient, now.Add(7*time.Hour))
+	table.Set([]*tls.Certificate{cert})
+	assert.NotEmpty(t, served("ocsp.example.com").OCSPStaple)
+}
@@ -5,19 +5,42 @@ import (
 	"crypto/x509"
 	"strings"
 	"sync"
+	"time"
 )
 
+// Table resolves the certificate for a TLS client's SNI. The zero Table is
+// empty and ready to use; StapleOCSP adds OCSP staples to what it serves.
 type Table struct {
 	mu                sync.RWMutex
 	nameToCertificate map[string][]*tls.Certificate
+
+	// certs are the certificates as Set, without staples; staples holds the
+	// OCSP responses by leaf fingerprint. Both guarded by mu.
+	certs    []*tls.Certificate
+	staples  map[[32]byte]*staple
+	ocspKick chan struct{}
 }
 
 func (t *Table) Set(certs []*tls.Certificate) {
-	nameToCert := buildNameToCertificate(certs)
+	parsed := make([]*tls.Certificate, 0, len(certs))
+	for _, cert := range certs {
+		if cert.Leaf == nil {
+			x509Cert, err := x509.ParseCertificate(cert.Certificate[0])
+			if err != nil {
+				continue
+			}
+			// cache the parsed leaf so SupportsCertificate (called per TLS
+			// handshake in findSupportCert) doesn't re-parse the DER each time
+			cert.Leaf = x509Cert
+		}
+		parsed = append(parsed, cert)
+	}
 
 	t.mu.Lock()
-	t.nameToCertificate = nameToCert
+	t.certs = parsed
+	t.rebuildLocked(time.Now())
 	t.mu.Unlock()
+	t.kickOCSP()
 }
 
 func (t *Table) Get(clientHello *tls.ClientHelloInfo) (*tls.Certificate, error) {
@@ -66,19 +89,8 @@ func findSupportCert(certs []*tls.Certificate, clientHello *tls.ClientHelloInfo)
 func buildNameToCertificate(certs []*tls.Certificate) map[string][]*tls.Certificate {
 	m := make(map[string][]*tls.Certificate, len(certs))
 	for _, cert := range certs {
-		var err error
-		x509Cert := cert.Leaf
-		if x509Cert == nil {
-			x509Cert, err = x509.ParseCertificate(cert.Certificate[0])
-			if err != nil {
-				continue
-			}
-			// cache the parsed leaf so SupportsCertificate (called per TLS
-			// handshake in findSupportCert) doesn't re-parse the DER each time
-			cert.Leaf = x509Cert
-		}
 		// use only SAN, CN already deprecated
-		for _, san := range x509Cert.DNSNames {
+		for _, san := range cert.Leaf.DNSNames {
 			m[san] = append(m[san], cert)
 		}
 	}
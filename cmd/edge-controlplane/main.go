@@ -377,8 +377,16 @@ func main() {
 		server = server.WithHosts(hostsStore)
 		slog.Info("edge control plane: hosts distribution enabled")
 	}
-	if wafStore != nil || corazaStore != nil || rlStore != nil || cacheStore != nil || hostsStore != nil {
-		ingReloader := edgecp.NewIngressReloader(wafStore, watchNamespace).WithCoraza(corazaStore).WithRateLimit(rlStore).WithCache(cacheStore).WithHosts(hostsStore)
+	// Per-host TLS policy (ssl-policy), served with each host's certificate on
+	// /v1/certs so the edge enforces the controller's. On by default; it only
+	// rides the same Ingress watch.
+	var tlsPolicyStore *edgecp.CertStore
+	if envOr("CP_TLS_POLICY_ENABLED", "true") == "true" {
+		tlsPolicyStore = store
+		slog.Info("edge control plane: tls policy distribution enabled")
+	}
+	if wafStore != nil || corazaStore != nil || rlStore != nil || cacheStore != nil || hostsStore != nil || tlsPolicyStore != nil {
+		ingReloader := edgecp.NewIngressReloader(wafStore, watchNamespace).WithCoraza(corazaStore).WithRateLimit(rlStore).WithCache(cacheStore).WithHosts(hostsStore).WithTLSPolicy(tlsPolicyStore)
 		if err := ingReloader.LoadOnce(ctx); err != nil {
 			slog.Error("edgecp: initial ingress load failed", "err", err)
 		}
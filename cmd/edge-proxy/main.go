@@ -33,6 +33,7 @@ import (
 
 	"github.com/moonrhythm/parapet-ingress-controller/edge"
 	"github.com/moonrhythm/parapet-ingress-controller/geoip"
+	"github.com/moonrhythm/parapet-ingress-controller/ratelimitrule"
 	"github.com/moonrhythm/parapet-ingress-controller/trustcidr"
 	"github.com/moonrhythm/parapet-ingress-controller/wsh2"
 )
@@ -249,6 +250,9 @@ func main() {
 		slog.Info("edge: initial cert load", "loaded", loaded, "total", len(domains))
 	}
 	go edge.RunCertRefresh(ctx, cp, store, domains, refreshInterval, remintCoord, certPoke)
+	if envOr("EDGE_OCSP_STAPLING", "false") == "true" {
+		go store.StapleOCSP(ctx)
+	}
 
 	if dataplaneMTLS {
 		// Startup mint is direct + UN-jittered (readiness needs it fast); the periodic
@@ -303,6 +307,19 @@ func main() {
 	var erl *edge.EdgeRateLimit
 	if ratelimitEnabled {
 		erl = edge.NewEdgeRateLimit(country, asn)
+		// Edges share `backend: shared` counters among themselves, under their
+		// own prefix: a request the edge counted must not count again against
+		// the controllers' budget.
+		if u := os.Getenv("EDGE_RATELIMIT_REDIS_URL"); u != "" {
+			shared, err := ratelimitrule.NewSharedStore(u)
+			if err != nil {
+				slog.Error("edge: invalid EDGE_RATELIMIT_REDIS_URL", "error", err)
+				os.Exit(1)
+			}
+			shared.Prefix = envOr("EDGE_RATELIMIT_REDIS_PREFIX", "parapet:edge-ratelimit:")
+			shared.Interval = time.Duration(envInt64("EDGE_RATELIMIT_SHARED_SYNC_INTERVAL_MS", ratelimitrule.DefaultSharedInterval.Milliseconds())) * time.Millisecond
+			erl.SetSharedStore(shared)
+		}
 		edge.RefreshRateLimitOnce(cp, erl)
 		if eventsEnabled {
 			rlPoke = make(chan struct{}, 1)
@@ -585,11 +602,15 @@ func main() {
 			WaitBeforeShutdown: waitBeforeShutdown,
 			Handler:            http.NotFoundHandler(),
 			ShareProtoSlice:    true,
-			TLSConfig: &tls.Config{
+			// Per-host TLS policy (ssl-policy) as the control plane sends it with
+			// each cert. NextProtos is set explicitly: a per-host config is cloned
+			// from this one, not from the server's copy, which alone gets the defaults.
+			TLSConfig: store.TLSPolicyConfig(&tls.Config{
 				MinVersion:     tls.VersionTLS12,
 				Certificates:   []tls.Certificate{fallback},
 				GetCertificate: store.GetCertificate,
-			},
+				NextProtos:     []string{"h2", "http/1.1"},
+			}),
 		}
 		prom.Connections(s)
 		prom.Networks(s)
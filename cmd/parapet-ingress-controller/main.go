@@ -29,6 +29,7 @@ import (
 	"github.com/moonrhythm/parapet-ingress-controller/metric/observe"
 	"github.com/moonrhythm/parapet-ingress-controller/plugin"
 	"github.com/moonrhythm/parapet-ingress-controller/proxy"
+	"github.com/moonrhythm/parapet-ingress-controller/ratelimitrule"
 	"github.com/moonrhythm/parapet-ingress-controller/state"
 	"github.com/moonrhythm/parapet-ingress-controller/trust"
 	"github.com/moonrhythm/parapet-ingress-controller/trustcidr"
@@ -50,6 +51,19 @@ func main() {
 	waitBeforeShutdown := config.DurationDefault("WAIT_BEFORE_SHUTDOWN", 30*time.Second)
 	httpServerMaxHeaderBytes := config.IntDefault("HTTP_SERVER_MAX_HEADER_BYTES", 1<<14) // 16K
 	loadAllCerts := config.Bool("LOAD_ALL_CERTS")
+	ocspStapling := config.Bool("OCSP_STAPLING")
+	defaultBackend := config.String("DEFAULT_BACKEND")
+	affinitySecret := config.String("AFFINITY_COOKIE_SECRET")
+	statusPublishService := config.String("STATUS_PUBLISH_SERVICE")
+	statusAddresses := config.String("STATUS_ADDRESSES")
+	statusLeaseName := config.StringDefault("STATUS_LEASE_NAME", "parapet-ingress-controller-status")
+	gatewayAPI := config.Bool("GATEWAY_API")
+	acmeDirectory := config.String("ACME_DIRECTORY")
+	acmeEmail := config.String("ACME_EMAIL")
+	acmeAccountSecret := config.StringDefault("ACME_ACCOUNT_SECRET", "parapet-acme-account")
+	acmeLeaseName := config.StringDefault("ACME_LEASE_NAME", "parapet-ingress-controller-acme")
+	acmeRenewBefore := config.DurationDefault("ACME_RENEW_BEFORE", 30*24*time.Hour)
+	gatewayControllerName := config.StringDefault("GATEWAY_CONTROLLER_NAME", controller.DefaultGatewayControllerName)
 	autoH2C := config.Bool("UPSTREAM_AUTO_H2C")
 	autoH2CTTL := config.DurationDefault("UPSTREAM_AUTO_H2C_TTL", 10*time.Minute)
 	// UPSTREAM_WS_H2C (default true, kill switch): tunnel WebSocket to h2c pods via
@@ -165,6 +179,11 @@ func main() {
 		"profiler", enableProfiler,
 		"http_server_max_header_bytes", httpServerMaxHeaderBytes,
 		"load_all_certs", loadAllCerts,
+		"ocsp_stapling", ocspStapling,
+		"default_backend", defaultBackend,
+		"affinity_cookie_secret_set", affinitySecret != "",
+		"status_publish_service", statusPublishService,
+		"status_addresses", statusAddresses,
 		"waf_enabled", wafConfig.Enabled,
 		"waf_validated_proxy", config.String("WAF_VALIDATED_PROXY"),
 		"ratelimit_enabled", rateLimitEnabled,
@@ -204,7 +223,17 @@ func main() {
 		os.Exit(1)
 	}
 
-	go prom.Start(":9187")
+	// The metrics port also carries read-only debug endpoints, registered as
+	// their features come up below. Everything else is Prometheus, as before.
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("/", prom.Handler())
+	go (&http.Server{
+		Addr:         ":9187",
+		ReadTimeout:  30 * time.Second,
+		IdleTimeout:  120 * time.Second,
+		WriteTimeout: 30 * time.Second,
+		Handler:      metricsMux,
+	}).ListenAndServe()
 
 	// Edge auto-trust (CA-only mTLS). When EDGE_TRUST_CP_ENDPOINT is set, the core
 	// pulls the edge CA from the control plane (GET /v1/trust-bundle, tokenless,
@@ -303,9 +332,66 @@ func main() {
 
 	ctrl := controller.New(watchNamespace, proxy)
 	ctrl.LoadAllCerts = loadAllCerts
+	ctrl.OCSPStapling = ocspStapling
+	if defaultBackend != "" {
+		// A typo'd fallback would silently leave unmatched hosts on the bare 404,
+		// so a bad spec is fatal like WAF_VALIDATED_PROXY.
+		db, err := controller.ParseDefaultBackend(defaultBackend)
+		if err != nil {
+			slog.Error("DEFAULT_BACKEND rejected", "spec", defaultBackend, "error", err)
+			os.Exit(1)
+		}
+		ctrl.DefaultBackend = db
+	}
+	ctrl.AffinitySecret = affinitySecret
 	ctrl.PodNamespace = podNamespace
+	ctrl.StatusConfig = controller.StatusConfig{
+		PublishService: statusPublishService,
+		LeaseName:      statusLeaseName,
+		Identity:       config.StringDefault("POD_NAME", hostname),
+	}
+	for _, a := range strings.Split(statusAddresses, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			ctrl.StatusConfig.Addresses = append(ctrl.StatusConfig.Addresses, a)
+		}
+	}
+	ctrl.GatewayConfig = controller.GatewayConfig{
+		Enabled:        gatewayAPI,
+		ControllerName: gatewayControllerName,
+	}
+	if (ctrl.StatusConfig.Enabled() || gatewayAPI) && podNamespace == "" {
+		// the status Lease lives in the controller's own namespace
+		slog.Error("STATUS_PUBLISH_SERVICE / STATUS_ADDRESSES / GATEWAY_API require POD_NAMESPACE")
+		os.Exit(1)
+	}
+	ctrl.ACMEConfig = controller.ACMEConfig{
+		Directory:     acmeDirectory,
+		Email:         acmeEmail,
+		AccountSecret: acmeAccountSecret,
+		LeaseName:     acmeLeaseName,
+		Identity:      config.StringDefault("POD_NAME", hostname),
+		RenewBefore:   acmeRenewBefore,
+	}
+	if ctrl.ACMEConfig.Enabled() && podNamespace == "" {
+		// the account Secret and the issuer Lease live in the controller's own namespace
+		slog.Error("ACME_DIRECTORY requires POD_NAMESPACE")
+		os.Exit(1)
+	}
 	ctrl.WAFConfig = wafConfig
 	ctrl.InitWAF()
+	// Shared counters for `backend: shared` limits (see RATELIMIT.md); a bad
+	// URL is fatal so a typo can't silently turn shared limits into rejections.
+	var rateLimitShared *ratelimitrule.SharedStore
+	if u := config.String("RATELIMIT_REDIS_URL"); rateLimitEnabled && u != "" {
+		var err error
+		rateLimitShared, err = ratelimitrule.NewSharedStore(u)
+		if err != nil {
+			slog.Error("invalid RATELIMIT_REDIS_URL", "error", err)
+			os.Exit(1)
+		}
+		rateLimitShared.Prefix = config.StringDefault("RATELIMIT_REDIS_PREFIX", ratelimitrule.DefaultSharedPrefix)
+		rateLimitShared.Interval = config.DurationDefault("RATELIMIT_SHARED_SYNC_INTERVAL", ratelimitrule.DefaultSharedInterval)
+	}
 	ctrl.RateLimitConfig = controller.RateLimitConfig{
 		Enabled: rateLimitEnabled,
 		// The WAF's GeoIP resolvers double as the ratelimit country/asn key
@@ -319,8 +405,10 @@ func main() {
 		// WAF_DISABLE_MACROS feed both).
 		FilterCostLimit:     wafConfig.CostLimit,
 		FilterDisableMacros: wafConfig.DisableMacros,
+		Shared:              rateLimitShared,
 	}
 	ctrl.InitRateLimit()
+	metricsMux.Handle("/debug/ratelimit", ctrl.RateLimitUsage())
 	ctrl.CorazaConfig = corazaConfig
 	ctrl.InitCoraza()
 	ctrl.TransformConfig = controller.TransformConfig{
@@ -339,6 +427,11 @@ func main() {
 	ctrl.InitTransform()
 	ctrl.Use(plugin.InjectStateIngress)
 	ctrl.Use(plugin.AllowRemote)
+	// JWTAuth verifies the token before the zone WAF, rate limits and transform
+	// so their CEL sees its claims (request.jwt); its claimHeaders are stamped
+	// later, by JWTClaimHeaders. A request it rejects is answered before those
+	// per-ingress steps, after the global WAF and rate limits.
+	ctrl.Use(plugin.JWTAuth(ctrl.LookupJWTKeys))
 	if wafConfig.Enabled {
 		ctrl.Use(plugin.WAFZone(ctrl.LookupZone, wafConfig.SkipValidated))
 	}
@@ -379,8 +472,20 @@ func main() {
 	ctrl.Use(plugin.UpstreamHost)
 	ctrl.Use(plugin.UpstreamPath)
 	ctrl.Use(plugin.OperationsTrace)
+	var isEdgeCert func(*tls.ConnectionState) bool
+	if trustMgr != nil {
+		isEdgeCert = trustMgr.VerifyClientCert
+	}
+	ctrl.Use(plugin.ClientCertAuth(ctrl.LookupClientCA, isEdgeCert))
+	// JWTClaimHeaders and OIDCAuth, like ForwardAuth, delete and re-stamp
+	// their identity headers, so a transform running before them can't forge
+	// them either.
+	ctrl.Use(plugin.JWTClaimHeaders)
+	ctrl.Use(plugin.OIDCAuth(ctrl.LookupOIDCSecret))
 	ctrl.Use(plugin.BasicAuth)
+	ctrl.Use(plugin.BasicAuthSecret(ctrl.LookupHtpasswd))
 	ctrl.Use(plugin.ForwardAuth)
+	ctrl.Use(plugin.ExtAuthz(wafConfig.Country, wafConfig.ASN))
 	ctrl.Use(plugin.StripPrefix)
 	// Watch starts below, AFTER the edge-trust readiness hook is wired — firstReload
 	// reads ctrl.WaitTrustReady, so it must be installed before Watch runs.
@@ -403,6 +508,12 @@ func main() {
 	}
 	m.Use(state.Middleware(!disableLog))
 	m.Use(metric.Requests(ctrl.IsKnownHost))
+	if ctrl.ACMEConfig.Enabled() {
+		// ACME HTTP-01 challenges are answered before the global firewalls and
+		// rate limits and before routing (so before an Ingress's https
+		// redirect): the CA's validation requests must get through.
+		m.Use(ctrl.ACMEChallenge())
+	}
 	m.Use(compress.Gzip())
 	m.Use(compress.Zstd())
 	if wafConfig.Enabled {
@@ -558,6 +669,15 @@ func main() {
 		if trustMgr != nil {
 			tlsConfig = trustMgr.ServerTLSConfig(ctrl.GetCertificate, []tls.Certificate{cert})
 		}
+		// Per-Ingress client certificates (auth-tls-secret): requested on their
+		// hosts only, on top of the edge trust request; see ClientAuthConfig.
+		tlsConfig = ctrl.ClientAuthConfig(tlsConfig)
+		// Per-Ingress TLS policy (ssl-policy): minimum version, suites and ALPN
+		// by host; see TLSPolicyConfig.
+		tlsConfig = ctrl.TLSPolicyConfig(tlsConfig)
+		// Set explicitly: a per-host config is cloned from this one, not from
+		// the server's copy, which alone gets http.Server's defaults.
+		tlsConfig.NextProtos = []string{"h2", "http/1.1"}
 
 		s := &parapet.Server{
 			Addr:               ":" + httpsPort,
@@ -2,8 +2,10 @@ package controller
 
 import (
 	"context"
+	"crypto/cipher"
 	"crypto/tls"
 	"log/slog"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
@@ -11,6 +13,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/go-jose/go-jose/v4"
 	"github.com/moonrhythm/parapet"
 	"github.com/moonrhythm/parapet/pkg/healthz"
 	"github.com/moonrhythm/parapet/pkg/waf"
@@ -26,11 +29,13 @@ import (
 	"github.com/moonrhythm/parapet-ingress-controller/debounce"
 	"github.com/moonrhythm/parapet-ingress-controller/k8s"
 	"github.com/moonrhythm/parapet-ingress-controller/metric"
+	"github.com/moonrhythm/parapet-ingress-controller/metric/observe"
 	"github.com/moonrhythm/parapet-ingress-controller/plugin"
 	"github.com/moonrhythm/parapet-ingress-controller/proxy"
 	"github.com/moonrhythm/parapet-ingress-controller/ratelimitrule"
 	"github.com/moonrhythm/parapet-ingress-controller/route"
 	"github.com/moonrhythm/parapet-ingress-controller/state"
+	"github.com/moonrhythm/parapet-ingress-controller/tlspolicy"
 	"github.com/moonrhythm/parapet-ingress-controller/transformrule"
 )
 
@@ -49,9 +54,102 @@ const (
 // instead of taking a per-request RWMutex. knownHosts bounds host-labeled metric
 // cardinality — a Host the router doesn't serve collapses to a sentinel label
 // instead of minting unbounded series under a random-Host flood.
+//
+// wildcards indexes the single-label wildcard hosts ("*.example.com") the mux
+// holds routes for by their suffix (".example.com"), so a request host can be
+// checked against them without allocating; see handler. regexes holds the
+// path-regex routes, which the mux can't match.
 type routeState struct {
 	mux        *http.ServeMux
 	knownHosts map[string]struct{}
+	wildcards  map[string]struct{}
+	regexes    regexRoutes
+	clientCAs  clientCAHosts
+	// tlsPolicies are the ssl-policy annotations by host; see TLSPolicyConfig.
+	tlsPolicies tlspolicy.Hosts
+}
+
+// handler returns the handler for a request whose host falls under a wildcard
+// rule or has regex paths, or nil to let the mux serve it directly. An
+// http.ServeMux treats "*" in a pattern's host literally, so a wildcard rule is
+// registered under its literal "*.example.com" host and matched here by looking
+// the request up again with that host. Precedence mirrors the mux's own
+// host-before-host-less rule, one level deeper: a route on the exact host wins,
+// then a route on the wildcard host (see hostRoute within each), then the
+// host-less routes (see hostlessRoute).
+func (rs *routeState) handler(r *http.Request) http.Handler {
+	if len(rs.wildcards) == 0 && len(rs.regexes) == 0 {
+		return nil
+	}
+	_, regex := rs.regexes[r.Host]
+	suffix := wildcardSuffix(r.Host)
+	_, wildcard := rs.wildcards[suffix]
+	_, hostless := rs.regexes[""]
+	if !regex && !wildcard && !hostless {
+		return nil
+	}
+	if h := rs.hostRoute(r, r.Host); h != nil {
+		return h // exact host wins
+	}
+	if wildcard {
+		if h := rs.hostRoute(r, "*"+suffix); h != nil {
+			return h
+		}
+	}
+	if hostless {
+		return rs.hostlessRoute(r)
+	}
+	return nil
+}
+
+// hostRoute returns the handler of host's route for r, or nil when host has
+// none: its exact and prefix paths (longest wins, as usual) except the
+// catch-all "host/", then its regex paths, then the catch-all.
+func (rs *routeState) hostRoute(r *http.Request, host string) http.Handler {
+	lr := r
+	if host != r.Host {
+		wr := *r
+		wr.Host = host
+		lr = &wr
+	}
+	h, pattern := rs.mux.Handler(lr)
+	if !isHostPattern(pattern) {
+		h = nil
+	} else if pattern[strings.IndexByte(pattern, '/'):] != "/" {
+		return h
+	}
+	if rh := rs.regexes.handler(host, r); rh != nil {
+		return rh
+	}
+	return h
+}
+
+// hostlessRoute returns the handler of the host-less route for a request no
+// host route serves, or nil to let the mux serve it: host-less exact and
+// prefix paths except the catch-all "/", then host-less regex paths.
+func (rs *routeState) hostlessRoute(r *http.Request) http.Handler {
+	h, pattern := rs.mux.Handler(r)
+	if pattern != "" && pattern[strings.IndexByte(pattern, '/'):] != "/" {
+		return h
+	}
+	return rs.regexes.handler("", r)
+}
+
+// wildcardSuffix returns host without its first label (".example.com" for
+// "a.example.com"), the key a single-label wildcard rule covering host is
+// indexed under, or "" when host has no first label to strip.
+func wildcardSuffix(host string) string {
+	i := strings.IndexByte(host, '.')
+	if i <= 0 {
+		return ""
+	}
+	return host[i:]
+}
+
+// isHostPattern reports whether a mux pattern is host-specific. The empty
+// pattern (no match) and host-less patterns start without a host.
+func isHostPattern(pattern string) bool {
+	return pattern != "" && pattern[0] != '/'
 }
 
 // Controller is the parapet ingress controller
@@ -72,6 +170,57 @@ type Controller struct {
 	// matching secret into each ingress. Off by default to preserve behavior.
 	LoadAllCerts bool
 
+	// OCSPStapling, when true, staples the certificates' OCSP responses,
+	// fetched in the background by cert.Table.StapleOCSP. Set before Watch().
+	OCSPStapling bool
+
+	// DefaultBackend, when set, serves requests for hosts no Ingress serves
+	// (neither a rule nor a spec.defaultBackend) instead of a bare 404. Set
+	// before Watch(). See controller_defaultbackend.go.
+	DefaultBackend *DefaultBackend
+
+	// AffinitySecret keys the session affinity cookies (`affinity: cookie`).
+	// Replicas sharing it honor each other's cookies; empty uses a random
+	// per-process key. Set before Watch(). See controller_affinity.go.
+	AffinitySecret string
+	affinityOnce   sync.Once
+	affinityCipher cipher.AEAD
+
+	// StatusConfig configures the Ingress status publisher; the Lease it elects
+	// a writer by lives in PodNamespace. Set before Watch(). See
+	// controller_status.go.
+	StatusConfig StatusConfig
+	statusKick   chan struct{}
+
+	// GatewayConfig configures the Gateway API support; gatewayStatus is the
+	// status its last compile computed, written by the status publisher. Set
+	// before Watch(). See controller_gateway.go.
+	GatewayConfig GatewayConfig
+	gatewayStatus atomic.Pointer[gatewayStatus]
+
+	// ACMEConfig configures the built-in ACME issuer; acmeChallenges indexes
+	// the challenge answers of its pending orders by token. Set before Watch().
+	// See controller_acme.go.
+	ACMEConfig     ACMEConfig
+	acmeKick       chan struct{}
+	acmeChallenges atomic.Pointer[map[string]acmeChallenge]
+
+	// clientCAs, jwtKeys, oidcSecrets and htpasswds cache what the auth
+	// plugins read from Secrets: the client certificate CA pools, the jwt-auth
+	// key sets, the oidc-auth client and cookie secrets and the
+	// basic-auth-secret users. See controller_secretcache.go.
+	clientCAs   *secretCache[*clientCA]
+	jwtKeys     *secretCache[*jose.JSONWebKeySet]
+	oidcSecrets *secretCache[*plugin.OIDCSecret]
+	htpasswds   *secretCache[*plugin.Htpasswd]
+
+	// upstreamTLS holds the verified upstream TLS configurations the routes
+	// use; an Ingress reload collects the ones it uses in nextUpstreamTLS. See
+	// controller_upstreamtls.go.
+	upstreamTLSMu   sync.Mutex
+	upstreamTLS     map[upstreamTLSSpec]*upstreamTLSEntry
+	nextUpstreamTLS map[upstreamTLSSpec]*upstreamTLSEntry
+
 	// WAFConfig configures the web application firewall; PodNamespace is the
 	// controller's own namespace, which bounds where the global ruleset may be
 	// defined. Both are set before Watch(). See controller_waf.go.
@@ -192,6 +341,9 @@ type Controller struct {
 	watchedRLConfigMaps        sync.Map
 	watchedCorazaConfigMaps    sync.Map
 	watchedTransformConfigMaps sync.Map
+	watchedGatewayClasses      sync.Map
+	watchedGateways            sync.Map
+	watchedHTTPRoutes          sync.Map
 
 	certTable  cert.Table
 	routeTable route.Table
@@ -215,7 +367,7 @@ func New(watchNamespace string, proxy *proxy.Proxy) *Controller {
 	ctrl := &Controller{}
 	// Seed an empty routing snapshot so the request path never observes a nil
 	// pointer if a request lands before the first reload completes.
-	ctrl.routes.Store(&routeState{mux: http.NewServeMux(), knownHosts: map[string]struct{}{}})
+	ctrl.routes.Store(&routeState{mux: http.NewServeMux(), knownHosts: map[string]struct{}{}, wildcards: map[string]struct{}{}})
 	ctrl.health = healthz.New()
 	ctrl.health.SetReady(false)
 	ctrl.watchNamespace = watchNamespace
@@ -226,8 +378,16 @@ func New(watchNamespace string, proxy *proxy.Proxy) *Controller {
 	ctrl.reloadRateLimitDebounce = debounce.New(ctrl.reloadRateLimitDebounced, 300*time.Millisecond)
 	ctrl.reloadCorazaDebounce = debounce.New(ctrl.reloadCorazaDebounced, 300*time.Millisecond)
 	ctrl.reloadTransformDebounce = debounce.New(ctrl.reloadTransformDebounced, 300*time.Millisecond)
+	ctrl.statusKick = make(chan struct{}, 1)
+	ctrl.acmeKick = make(chan struct{}, 1)
+	ctrl.clientCAs = newSecretCache("client ca secret not found, rejecting client certificates", parseClientCA)
+	ctrl.jwtKeys = newSecretCache("jwt key secret not found, rejecting tokens", parseJWTKeySecret)
+	ctrl.oidcSecrets = newSecretCache("oidc secret not found, rejecting requests", parseOIDCSecret)
+	ctrl.htpasswds = newSecretCache("basic auth secret not found, rejecting requests", parseHtpasswdSecret)
 	ctrl.proxy = proxy
 	ctrl.proxy.OnDialError = ctrl.routeTable.MarkBad
+	ctrl.proxy.OnResponse = ctrl.observeResponse
+	ctrl.routeTable.OnEjected = reportEjected
 	return ctrl
 }
 
@@ -239,7 +399,12 @@ func (ctrl *Controller) Use(m plugin.Plugin) {
 // ServeHandler implements parapet.Middleware
 func (ctrl *Controller) ServeHandler(_ http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctrl.routes.Load().mux.ServeHTTP(w, r)
+		rs := ctrl.routes.Load()
+		if h := rs.handler(r); h != nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		rs.mux.ServeHTTP(w, r)
 	})
 }
 
@@ -267,6 +432,18 @@ func (ctrl *Controller) Watch() {
 	if ctrl.TransformConfig.Enabled {
 		go ctrl.watchTransformConfigMaps(ctx)
 	}
+	if ctrl.GatewayConfig.Enabled {
+		ctrl.watchGatewayResources(ctx)
+	}
+	if ctrl.StatusConfig.Enabled() || ctrl.GatewayConfig.Enabled {
+		go ctrl.runStatusPublisher(ctx)
+	}
+	if ctrl.ACMEConfig.Enabled() {
+		go ctrl.runACME(ctx)
+	}
+	if ctrl.OCSPStapling {
+		go ctrl.certTable.StapleOCSP(ctx, nil)
+	}
 }
 
 // preloadResources lists every watched resource into the store before the first
@@ -378,6 +555,10 @@ func (ctrl *Controller) preloadResources(ctx context.Context) {
 			return nil
 		})
 	}
+
+	if ctrl.GatewayConfig.Enabled {
+		ctrl.preloadGatewayResources(ctx)
+	}
 }
 
 // preloadList runs fn, retrying with capped exponential backoff on error until it
@@ -639,7 +820,13 @@ func (ctrl *Controller) reloadIngressDebounced() {
 		metric.Reload(true)
 	}()
 
+	ctrl.beginUpstreamTLS()
 	routes := make(map[string]http.Handler, routeSizeHint)
+	defaults := make(map[string]defaultRoute)
+	regexes := make(regexRoutes)
+	clientCAs := make(clientCAHosts)
+	var tlsPolicies tlspolicy.Builder
+	canaries := ctrl.collectCanaries()
 	var loaded, skipped int
 
 	ctrl.watchedIngresses.Range(func(_, value any) bool {
@@ -654,32 +841,30 @@ func (ctrl *Controller) reloadIngressDebounced() {
 		slog.Debug("load ingress", "namespace", ing.Namespace, "name", ing.Name)
 		loaded++
 
-		var h parapet.Middlewares
-		for _, m := range ctrl.plugins {
-			m(plugin.Context{
-				Middlewares: &h,
-				Routes:      routes,
-				Ingress:     ing,
-			})
+		if isCanaryIngress(ing) { // merged into its primary's routes
+			return true
 		}
-		h.Use(parapet.MiddlewareFunc(retryMiddleware))
+
+		h := ctrl.ingressChain(ing, routes)
+		matches := ctrl.ingressMatchRules(ing)
+		pathRegex := isPathRegex(ing)
+		tlsPolicy := ingressTLSPolicy(ing)
+		var index int
 
 		if ing.Spec.DefaultBackend != nil {
-			slog.Warn("ingress spec.defaultBackend not support", "namespace", ing.Namespace, "name", ing.Name)
+			ctrl.addIngressDefaultBackend(defaults, ing, h)
 		}
 
 		for _, rule := range ing.Spec.Rules {
+			if rule.Host != "" {
+				tlsPolicies.Add(ing.Namespace+"/"+ing.Name, rule.Host, tlsPolicy)
+			}
 			if rule.HTTP == nil {
 				continue
 			}
 
 			for _, httpPath := range rule.HTTP.Paths {
-				backend := httpPath.Backend
-				if backend.Service == nil {
-					slog.Warn("ingress backend service empty", "namespace", ing.Namespace, "name", ing.Name)
-					continue
-				}
-
+				index++
 				path := httpPath.Path
 				if path == "" { // path can not be empty
 					path = "/"
@@ -693,37 +878,23 @@ func (ctrl *Controller) reloadIngressDebounced() {
 					pathType = *httpPath.PathType
 				}
 
-				svcKey := ing.Namespace + "/" + backend.Service.Name
-
-				v, ok := ctrl.watchedServices.Load(svcKey)
-				if !ok {
-					slog.Error("service not found", "namespace", ing.Namespace, "name", backend.Service.Name)
-					continue
-				}
-				svc := v.(*v1.Service)
-
-				// find port
-				config, ok := getBackendConfig(&backend, svc)
+				handler, target, ok := ctrl.resolveBackend(ing, &httpPath.Backend)
 				if !ok {
-					slog.Error("port not found", "namespace", ing.Namespace, "name", backend.Service.Name, "port", backend.Service.Port.Name)
 					continue
 				}
-				if config.PortNumber <= 0 { // missing port
-					continue
-				}
-
-				target := buildHostPort(ing.Namespace, backend.Service.Name, config.PortNumber)
-				handler := ctrl.makeHandler(ing, svc, config, target)
 				host := strings.ToLower(rule.Host)
+				clientCAs.add(ing, host)
+				handler = h.ServeHandler(matches.wrap(canaries.wrap(ing, host, httpPath, handler)))
+
 				switch pathType {
 				case networking.PathTypePrefix:
 					// register path as prefix
 					src := host + strings.TrimSuffix(path, "/")
 					if path != "/" {
-						routes[src] = h.ServeHandler(handler)
+						routes[src] = handler
 					}
 					src += "/"
-					routes[src] = h.ServeHandler(handler)
+					routes[src] = handler
 					slog.Debug("registered path", "type", "prefix", "path", src, "target", target)
 				case networking.PathTypeExact:
 					src := host + strings.TrimSuffix(path, "/")
@@ -731,11 +902,17 @@ func (ctrl *Controller) reloadIngressDebounced() {
 						slog.Warn("register path type exact at root path is not supported, switch to prefix", "path", src, "target", target)
 						src = host + path
 					}
-					routes[src] = h.ServeHandler(handler)
+					routes[src] = handler
 					slog.Debug("registered path", "type", "exact", "path", src, "target", target)
 				case networking.PathTypeImplementationSpecific:
+					if pathRegex {
+						if regexes.add(ing, host, path, index, handler) {
+							slog.Debug("registered path", "type", "regex", "path", host+path, "target", target)
+						}
+						continue
+					}
 					src := host + path
-					routes[src] = h.ServeHandler(handler)
+					routes[src] = handler
 					slog.Debug("registered path", "type", "specific", "path", src, "target", target)
 				}
 			}
@@ -744,11 +921,27 @@ func (ctrl *Controller) reloadIngressDebounced() {
 		return true
 	})
 
+	if ctrl.GatewayConfig.Enabled {
+		ctrl.compileGateways(routes)
+	}
+	ctrl.registerDefaultBackends(routes, defaults)
+	canaries.warnUnused()
+	regexes.sort()
+	ctrl.commitUpstreamTLS()
+
 	mux := buildRoutes(routes)
 	knownHosts := buildKnownHosts(routes)
-	ctrl.routes.Store(&routeState{mux: mux, knownHosts: knownHosts})
+	for host := range regexes {
+		if host == "" {
+			continue // host-less rules serve any Host; "" is no host to know
+		}
+		knownHosts[host] = struct{}{}
+	}
+	ctrl.routes.Store(&routeState{mux: mux, knownHosts: knownHosts, wildcards: buildWildcards(knownHosts), regexes: regexes, clientCAs: clientCAs, tlsPolicies: tlsPolicies.Hosts()})
 	slog.Info("reloaded ingresses", "loaded", loaded, "skipped", skipped, "routes", len(routes))
 	ctrl.reloadSecret()
+	ctrl.kickStatus() // a new Ingress (or HTTPRoute) gets its status without waiting for the resync
+	ctrl.kickACME()   // likewise its certificate
 }
 
 // currentMux returns the live routing mux. Internal/test accessor for the
@@ -770,10 +963,33 @@ func buildKnownHosts(routes map[string]http.Handler) map[string]struct{} {
 	return hosts
 }
 
+// buildWildcards indexes the wildcard hosts ("*.example.com") among knownHosts
+// by their suffix (".example.com"). As in the Ingress spec, the "*" is a whole
+// leading label and matches exactly one label.
+func buildWildcards(knownHosts map[string]struct{}) map[string]struct{} {
+	wildcards := make(map[string]struct{})
+	for host := range knownHosts {
+		if strings.HasPrefix(host, "*.") {
+			wildcards[host[1:]] = struct{}{}
+		}
+	}
+	return wildcards
+}
+
 // IsKnownHost reports whether the current routes serve host (already lowercased
 // and port-stripped by the upstream middleware, matching the registered keys).
+// A host covered by a wildcard rule is known, so each subdomain keeps its own
+// metric label: a wildcard host trades the cardinality bound for that suffix
+// for per-subdomain series.
 func (ctrl *Controller) IsKnownHost(host string) bool {
-	_, ok := ctrl.routes.Load().knownHosts[host]
+	rs := ctrl.routes.Load()
+	if _, ok := rs.knownHosts[host]; ok {
+		return true
+	}
+	if len(rs.wildcards) == 0 {
+		return false
+	}
+	_, ok := rs.wildcards[wildcardSuffix(host)]
 	return ok
 }
 
@@ -790,6 +1006,7 @@ func (ctrl *Controller) reloadServiceDebounced() {
 
 	addrToPort := make(map[string]string, endpointSizeHint)
 	externalNames := make(map[string]string)
+	healthChecks := make(map[string]route.HealthCheck)
 
 	ctrl.watchedServices.Range(func(_, value any) bool {
 		s := value.(*v1.Service)
@@ -827,12 +1044,17 @@ func (ctrl *Controller) reloadServiceDebounced() {
 			addrToPort[addr] = target
 		}
 
+		if hc, ok := ctrl.serviceHealthCheck(s); ok {
+			healthChecks[buildHost(s.Namespace, s.Name)] = hc
+		}
+
 		return true
 	})
 
 	ctrl.routeTable.SetPortRoutes(addrToPort)
 	ctrl.routeTable.SetExternalNameRoutes(externalNames)
-	slog.Info("reloaded services", "ports", len(addrToPort), "externalNames", len(externalNames))
+	ctrl.routeTable.SetHealthChecks(healthChecks)
+	slog.Info("reloaded services", "ports", len(addrToPort), "externalNames", len(externalNames), "healthChecks", len(healthChecks))
 }
 
 // resolveTargetPort returns the concrete numeric pod port (as a string) a
@@ -907,7 +1129,13 @@ func (ctrl *Controller) reloadSecretDebounced() {
 		}
 	}()
 
+	ctrl.reloadUpstreamTLS()
+	if ctrl.ACMEConfig.Enabled() {
+		ctrl.reloadACMEChallenges()
+	}
+
 	var certs []*tls.Certificate
+	var served []observe.ServedCertificate
 
 	if ctrl.LoadAllCerts {
 		// Load every TLS-typed secret in the watch namespace. The cert table
@@ -916,7 +1144,7 @@ func (ctrl *Controller) reloadSecretDebounced() {
 		// foo.example.com without any ingress wiring.
 		ctrl.watchedSecrets.Range(func(_, value any) bool {
 			s := value.(*v1.Secret)
-			if s.Type != v1.SecretTypeTLS {
+			if s.Type != v1.SecretTypeTLS || isACMEPending(s) {
 				return true
 			}
 			crt, err := tls.X509KeyPair(s.Data["tls.crt"], s.Data["tls.key"])
@@ -925,9 +1153,11 @@ func (ctrl *Controller) reloadSecretDebounced() {
 				return true
 			}
 			certs = append(certs, &crt)
+			served = append(served, observe.ServedCertificate{Secret: s.Name, Namespace: s.Namespace, Leaf: crt.Leaf})
 			return true
 		})
 		ctrl.certTable.Set(certs)
+		observe.SetCertificates(served)
 		slog.Info("reloaded secrets", "certs", len(certs))
 		return
 	}
@@ -942,6 +1172,9 @@ func (ctrl *Controller) reloadSecretDebounced() {
 		}
 		return true
 	})
+	if ctrl.GatewayConfig.Enabled {
+		ctrl.addGatewaySecrets(secretToBuild)
+	}
 
 	// build certs
 	for key := range secretToBuild {
@@ -951,15 +1184,20 @@ func (ctrl *Controller) reloadSecretDebounced() {
 			continue
 		}
 		s := v.(*v1.Secret)
+		if isACMEPending(s) {
+			continue
+		}
 		crt, err := tls.X509KeyPair(s.Data["tls.crt"], s.Data["tls.key"])
 		if err != nil {
 			slog.Error("can not load x509 certificate", "namespace", s.Namespace, "name", s.Name, "error", err)
 			continue
 		}
 		certs = append(certs, &crt)
+		served = append(served, observe.ServedCertificate{Secret: s.Name, Namespace: s.Namespace, Leaf: crt.Leaf})
 	}
 
 	ctrl.certTable.Set(certs)
+	observe.SetCertificates(served)
 	slog.Info("reloaded secrets", "certs", len(certs))
 }
 
@@ -1191,6 +1429,58 @@ func getBackendConfig(backend *networking.IngressBackend, svc *v1.Service) (conf
 	return
 }
 
+// ingressChain builds the per-Ingress middleware chain — every plugin run
+// against ing, then the retry middleware — that wraps each of the Ingress's
+// backend handlers (its rule paths and its spec.defaultBackend alike).
+func (ctrl *Controller) ingressChain(ing *networking.Ingress, routes map[string]http.Handler) *parapet.Middlewares {
+	var h parapet.Middlewares
+	for _, m := range ctrl.plugins {
+		m(plugin.Context{
+			Middlewares: &h,
+			Routes:      routes,
+			Ingress:     ing,
+		})
+	}
+	if p := ingressRetryPolicy(ing); p != nil {
+		h.Use(parapet.MiddlewareFunc(p.middleware))
+	} else {
+		h.Use(parapet.MiddlewareFunc(retryMiddleware))
+	}
+	return &h
+}
+
+// resolveBackend resolves an Ingress backend (a rule path's or the Ingress's
+// spec.defaultBackend) to its proxy handler and Service target
+// (service.namespace.svc.cluster.local:port). ok=false — logged here — means
+// the backend can't be routed (no Service backend, Service not watched, port not
+// exposed) and the caller registers nothing for it.
+func (ctrl *Controller) resolveBackend(ing *networking.Ingress, backend *networking.IngressBackend) (handler http.Handler, target string, ok bool) {
+	if backend.Service == nil {
+		slog.Warn("ingress backend service empty", "namespace", ing.Namespace, "name", ing.Name)
+		return nil, "", false
+	}
+
+	v, found := ctrl.watchedServices.Load(ing.Namespace + "/" + backend.Service.Name)
+	if !found {
+		slog.Error("service not found", "namespace", ing.Namespace, "name", backend.Service.Name)
+		return nil, "", false
+	}
+	svc := v.(*v1.Service)
+
+	// find port
+	config, found := getBackendConfig(backend, svc)
+	if !found {
+		slog.Error("port not found", "namespace", ing.Namespace, "name", backend.Service.Name, "port", backend.Service.Port.Name)
+		return nil, "", false
+	}
+	if config.PortNumber <= 0 { // missing port
+		return nil, "", false
+	}
+
+	target = buildHostPort(ing.Namespace, backend.Service.Name, config.PortNumber)
+	return ctrl.makeHandler(ing, svc, config, target), target, true
+}
+
 func (ctrl *Controller) makeHandler(ing *networking.Ingress, svc *v1.Service, config backendConfig, target string) http.Handler {
 	// Precompute the per-Service auto-h2c cache key once at route-build time — it's
 	// constant for this route. Only built when auto-h2c is enabled, so disabled
@@ -1210,6 +1500,11 @@ func (ctrl *Controller) makeHandler(ing *networking.Ingress, svc *v1.Service, co
 	serviceType := string(svc.Spec.Type)
 	serviceName := svc.Name
 	namespace := svc.Namespace
+	serviceHost := buildHost(namespace, serviceName)
+	lb := ingressLoadBalancer(ing)
+	aff := ctrl.ingressAffinity(ing)
+	upstreamTLS := ctrl.upstreamTLSFor(ing, svc)
+	timeouts, hasTimeouts := ingressTimeouts(ing)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		s := state.Get(r.Context())
 		s["serviceType"] = serviceType
@@ -1218,11 +1513,29 @@ func (ctrl *Controller) makeHandler(ing *networking.Ingress, svc *v1.Service, co
 			s["upstreamKey"] = upstreamKey
 		}
 
-		target := ctrl.routeTable.Lookup(target)
+		var key string
+		if lb.key != nil {
+			key = lb.key(r)
+		}
+		var pinned string
+		if aff != nil {
+			pinned = aff.pinned(r, serviceHost)
+		}
+		target, done := ctrl.routeTable.PickPinned(target, pinned, lb.algorithm, key)
 		if target == "" { // fail fast
 			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
 			return
 		}
+		if done != nil {
+			// deferred so a retryable dial error's panic still ends the request
+			defer done()
+		}
+		if aff != nil {
+			// pod-backed targets only: an ExternalName target is a DNS name
+			if ip, _, _ := net.SplitHostPort(target); ip != pinned && net.ParseIP(ip) != nil {
+				aff.pin(w, r, serviceHost, ip)
+			}
+		}
 
 		if config.Protocol != "" {
 			r.URL.Scheme = config.Protocol
@@ -1232,7 +1545,14 @@ func (ctrl *Controller) makeHandler(ing *networking.Ingress, svc *v1.Service, co
 
 		s["serviceTarget"] = target
 
-		r = r.WithContext(proxy.WithBackendAttr(r.Context(), serviceType, namespace, serviceName))
+		ctx := proxy.WithBackendAttr(r.Context(), serviceType, namespace, serviceName)
+		if upstreamTLS != nil {
+			ctx = proxy.WithUpstreamTLS(ctx, upstreamTLS)
+		}
+		if hasTimeouts {
+			ctx = proxy.WithTimeouts(ctx, timeouts)
+		}
+		r = r.WithContext(ctx)
 
 		ctrl.proxy.ServeHTTP(w, r)
 	})
@@ -0,0 +1,582 @@
+package controller
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/moonrhythm/parapet"
+	"golang.org/x/crypto/acme"
+	v1 "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/moonrhythm/parapet-ingress-controller/k8s"
+)
+
+// tlsACMEAnnotation opts an Ingress into ACME issuance. The issuer also marks
+// the Secrets it creates with it, and writes only into Secrets so marked.
+const tlsACMEAnnotation = "parapet.moonrhythm.io/tls-acme"
+
+// errACMENotOwned refuses to issue into an existing Secret the issuer didn't
+// create: it may hold a certificate managed some other way.
+var errACMENotOwned = errors.New("secret exists without the " + tlsACMEAnnotation + ` annotation; annotate it "true" to let the issuer overwrite it`)
+
+const (
+	// acmeChallengePath is where an HTTP-01 challenge is fetched.
+	acmeChallengePath = "/.well-known/acme-challenge/"
+	// acmeChallengeKeyPrefix prefixes a pending challenge's answer in the data
+	// of the Secret being issued (the suffix is the token), so every replica
+	// serves it through its Secret watch.
+	acmeChallengeKeyPrefix = "acme-http01."
+)
+
+// ACMEConfig configures the built-in ACME issuer, which orders certificates
+// for the Ingresses annotated tls-acme: "true" into their spec.tls Secrets,
+// answering the HTTP-01 challenges itself. It is off unless Directory is set.
+type ACMEConfig struct {
+	// Directory is the ACME directory URL, e.g.
+	// https://acme-v02.api.letsencrypt.org/directory.
+	Directory string
+	// Email is the account's contact, optional.
+	Email string
+	// AccountSecret is the Secret, in PodNamespace, holding the account key;
+	// it is created on first use.
+	AccountSecret string
+	// LeaseName is the Lease, in PodNamespace, the replicas elect the one
+	// issuer by; Identity names this replica in it (the pod name).
+	LeaseName string
+	Identity  string
+	// RenewBefore is how long before expiry a certificate is renewed.
+	RenewBefore time.Duration
+}
+
+// Enabled reports whether the issuer runs.
+func (c ACMEConfig) Enabled() bool {
+	return c.Directory != ""
+}
+
+const (
+	// acmeResync is how often the issuer looks for certificates to renew
+	// without an Ingress reload.
+	acmeResync = 10 * time.Minute
+	// acmeMinBackoff and acmeMaxBackoff bound the wait before retrying a
+	// certificate whose order failed, doubling per failure.
+	acmeMinBackoff = 5 * time.Minute
+	acmeMaxBackoff = 24 * time.Hour
+)
+
+// acmePropagationDelay is how long the issuer waits, after publishing a
+// challenge answer, before asking the CA to validate it: the other replicas
+// serve it once their Secret watch delivers it.
+var acmePropagationDelay = 5 * time.Second
+
+// acmeCert is a certificate the issuer keeps valid: the Secret it lives in and
+// the hosts it covers.
+type acmeCert struct {
+	namespace string
+	name      string
+	hosts     []string
+}
+
+func (c *acmeCert) key() string {
+	return c.namespace + "/" + c.name
+}
+
+// acmeCertificates collects, by Secret, the hosts of the Ingresses of this
+// class annotated tls-acme: "true": a spec.tls entry's hosts, or the Ingress's
+// rule hosts when it lists none. Wildcard hosts are left out, HTTP-01 can't
+// prove them.
+func (ctrl *Controller) acmeCertificates() map[string]*acmeCert {
+	certs := make(map[string]*acmeCert)
+	ctrl.watchedIngresses.Range(func(_, value any) bool {
+		ing := value.(*networking.Ingress)
+		if getIngressClass(ing) != IngressClass || ing.Annotations[tlsACMEAnnotation] != "true" {
+			return true
+		}
+		for _, t := range ing.Spec.TLS {
+			if t.SecretName == "" {
+				continue
+			}
+			hosts := t.Hosts
+			if len(hosts) == 0 {
+				for _, rule := range ing.Spec.Rules {
+					hosts = append(hosts, rule.Host)
+				}
+			}
+			c := certs[ing.Namespace+"/"+t.SecretName]
+			if c == nil {
+				c = &acmeCert{namespace: ing.Namespace, name: t.SecretName}
+			}
+			for _, h := range hosts {
+				h = strings.ToLower(strings.TrimSpace(h))
+				if h == "" || strings.HasPrefix(h, "*") || slices.Contains(c.hosts, h) {
+					continue
+				}
+				c.hosts = append(c.hosts, h)
+			}
+			if len(c.hosts) > 0 {
+				sort.Strings(c.hosts)
+				certs[c.key()] = c
+			}
+		}
+		return true
+	})
+	return certs
+}
+
+// acmeChallenge is a pending challenge's answer, and the hosts it may be
+// fetched on.
+type acmeChallenge struct {
+	keyAuth string
+	hosts   []string
+}
+
+// reloadACMEChallenges indexes by token the challenge answers in the Secrets
+// of acmeCertificates. Called on every Secret reload.
+func (ctrl *Controller) reloadACMEChallenges() {
+	challenges := make(map[string]acmeChallenge)
+	for key, c := range ctrl.acmeCertificates() {
+		v, ok := ctrl.watchedSecrets.Load(key)
+		if !ok {
+			continue
+		}
+		for k, b := range v.(*v1.Secret).Data {
+			if token, ok := strings.CutPrefix(k, acmeChallengeKeyPrefix); ok && token != "" {
+				challenges[token] = acmeChallenge{keyAuth: string(b), hosts: c.hosts}
+			}
+		}
+	}
+	ctrl.acmeChallenges.Store(&challenges)
+}
+
+// isACMEOwned reports whether the issuer may write into s: it created it, or
+// it is marked tls-acme: "true" to hand it over.
+func isACMEOwned(s *v1.Secret) bool {
+	return s.Annotations[tlsACMEAnnotation] == "true"
+}
+
+// isACMEPending reports whether s is a Secret the issuer created and has not
+// issued into yet: not a broken certificate, so not worth an error.
+func isACMEPending(s *v1.Secret) bool {
+	return isACMEOwned(s) && len(s.Data["tls.crt"]) == 0
+}
+
+// ACMEChallenge answers the HTTP-01 challenges of the issuer's pending orders,
+// on the hosts being issued for; any other request, including a challenge
+// this controller didn't order, passes through to the routes. Mount it before
+// the firewalls and the routing, so neither a WAF rule nor an https redirect
+// gets in the CA's way.
+func (ctrl *Controller) ACMEChallenge() parapet.Middleware {
+	return parapet.MiddlewareFunc(func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := strings.CutPrefix(r.URL.Path, acmeChallengePath)
+			if !ok || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+				h.ServeHTTP(w, r)
+				return
+			}
+			if challenges := ctrl.acmeChallenges.Load(); challenges != nil {
+				if c, ok := (*challenges)[token]; ok && slices.Contains(c.hosts, acmeHost(r.Host)) {
+					w.Header().Set("Content-Type", "text/plain")
+					io.WriteString(w, c.keyAuth)
+					return
+				}
+			}
+			h.ServeHTTP(w, r)
+		})
+	})
+}
+
+// acmeHost is host as the routes match it: lowercase, without a port.
+func acmeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
+
+// runACME campaigns for the ACME Lease and issues while it leads, so only one
+// replica orders. It returns when ctx is done.
+func (ctrl *Controller) runACME(ctx context.Context) {
+	k8s.RunLeaderElection(ctx, ctrl.PodNamespace, ctrl.ACMEConfig.LeaseName, ctrl.ACMEConfig.Identity, ctrl.acmeLoop)
+}
+
+// acmeLoop renews on every Ingress reload and every acmeResync, until ctx (the
+// leadership) is done.
+func (ctrl *Controller) acmeLoop(ctx context.Context) {
+	slog.Info("acme: issuing certificates", "identity", ctrl.ACMEConfig.Identity, "directory", ctrl.ACMEConfig.Directory)
+	ticker := time.NewTicker(acmeResync)
+	defer ticker.Stop()
+	retry := make(map[string]*acmeRetry)
+	var client *acme.Client
+	for {
+		if client == nil {
+			var err error
+			if client, err = ctrl.acmeClient(ctx); err != nil {
+				slog.Error("acme: register account failed", "error", err)
+			}
+		}
+		if client != nil {
+			ctrl.acmeRenew(ctx, client, retry, time.Now())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-ctrl.acmeKick:
+		}
+	}
+}
+
+// kickACME asks the issuer, if this replica runs it, to look for work now.
+func (ctrl *Controller) kickACME() {
+	select {
+	case ctrl.acmeKick <- struct{}{}:
+	default: // a pass is already pending
+	}
+}
+
+// acmeRetry is when a failed certificate is next tried.
+type acmeRetry struct {
+	next    time.Time
+	backoff time.Duration
+}
+
+// acmeRenew orders every certificate missing, not covering its hosts or
+// expiring within RenewBefore, except those backing off from a failure.
+func (ctrl *Controller) acmeRenew(ctx context.Context, client *acme.Client, retry map[string]*acmeRetry, now time.Time) {
+	certs := ctrl.acmeCertificates()
+	for key := range retry {
+		if certs[key] == nil {
+			delete(retry, key)
+		}
+	}
+	keys := make([]string, 0, len(certs))
+	for key := range certs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if ctx.Err() != nil {
+			return
+		}
+		c := certs[key]
+		if r := retry[key]; r != nil && now.Before(r.next) {
+			continue
+		}
+		if !ctrl.acmeNeedsCert(c, now) {
+			delete(retry, key)
+			continue
+		}
+		slog.Info("acme: ordering certificate", "secret", key, "hosts", c.hosts)
+		if err := ctrl.acmeIssue(ctx, client, c); err != nil {
+			r := retry[key]
+			if r == nil {
+				r = &acmeRetry{backoff: acmeMinBackoff}
+				retry[key] = r
+			} else {
+				r.backoff = min(2*r.backoff, acmeMaxBackoff)
+			}
+			r.next = now.Add(r.backoff)
+			slog.Error("acme: order certificate failed", "secret", key, "retry", r.backoff, "error", err)
+			continue
+		}
+		delete(retry, key)
+		slog.Info("acme: issued certificate", "secret", key, "hosts", c.hosts)
+	}
+}
+
+// acmeNeedsCert reports whether c's Secret lacks a certificate for all its
+// hosts valid past RenewBefore.
+func (ctrl *Controller) acmeNeedsCert(c *acmeCert, now time.Time) bool {
+	v, ok := ctrl.watchedSecrets.Load(c.key())
+	if !ok {
+		return true
+	}
+	s := v.(*v1.Secret)
+	crt, err := tls.X509KeyPair(s.Data["tls.crt"], s.Data["tls.key"])
+	if err != nil {
+		return true
+	}
+	leaf, err := x509.ParseCertificate(crt.Certificate[0])
+	if err != nil || now.Add(ctrl.ACMEConfig.RenewBefore).After(leaf.NotAfter) {
+		return true
+	}
+	for _, h := range c.hosts {
+		if leaf.VerifyHostname(h) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// acmeClient loads (or creates) the account key and registers the account,
+// an existing one included.
+func (ctrl *Controller) acmeClient(ctx context.Context) (*acme.Client, error) {
+	key, err := ctrl.acmeAccountKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	client := &acme.Client{Key: key, DirectoryURL: ctrl.ACMEConfig.Directory}
+	account := &acme.Account{}
+	if ctrl.ACMEConfig.Email != "" {
+		account.Contact = []string{"mailto:" + ctrl.ACMEConfig.Email}
+	}
+	if _, err := client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return nil, err
+	}
+	return client, nil
+}
+
+// acmeAccountKey reads the account key from tls.key of AccountSecret, creating
+// the Secret with a new P-256 key when it is missing. A Secret that exists
+// without a key is an error, never overwritten.
+func (ctrl *Controller) acmeAccountKey(ctx context.Context) (crypto.Signer, error) {
+	ns, name := ctrl.PodNamespace, ctrl.ACMEConfig.AccountSecret
+	for range 3 {
+		s, err := k8s.GetSecret(ctx, ns, name)
+		if err == nil {
+			key, err := parseECKey(s.Data["tls.key"])
+			if err != nil {
+				return nil, fmt.Errorf("account secret %s/%s: %w", ns, name, err)
+			}
+			return key, nil
+		}
+		if !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		keyPEM, err := encodeECKey(key)
+		if err != nil {
+			return nil, err
+		}
+		_, err = k8s.CreateSecret(ctx, ns, &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name},
+			Type:       v1.SecretTypeOpaque,
+			Data:       map[string][]byte{"tls.key": keyPEM},
+		})
+		if apierrors.IsAlreadyExists(err) {
+			continue // another replica won the race; read its key
+		}
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("acme: created account key", "secret", ns+"/"+name)
+		return key, nil
+	}
+	return nil, fmt.Errorf("account secret %s/%s: exhausted retries", ns, name)
+}
+
+// acmeIssue orders c's certificate, answers its HTTP-01 challenges through
+// c's Secret, and writes the issued chain and key into it. The challenge
+// answers are removed again, whether the order succeeds or not.
+func (ctrl *Controller) acmeIssue(ctx context.Context, client *acme.Client, c *acmeCert) (err error) {
+	if v, ok := ctrl.watchedSecrets.Load(c.key()); ok && !isACMEOwned(v.(*v1.Secret)) {
+		return errACMENotOwned // before ordering, not after the CA's work
+	}
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(c.hosts...))
+	if err != nil {
+		return err
+	}
+
+	answers := make(map[string]string)
+	var pending []*acme.Challenge
+	var authzURLs []string
+	for _, u := range order.AuthzURLs {
+		z, err := client.GetAuthorization(ctx, u)
+		if err != nil {
+			return err
+		}
+		if z.Status == acme.StatusValid {
+			continue
+		}
+		var chal *acme.Challenge
+		for _, ch := range z.Challenges {
+			if ch.Type == "http-01" {
+				chal = ch
+				break
+			}
+		}
+		if chal == nil {
+			return fmt.Errorf("no http-01 challenge for %s", z.Identifier.Value)
+		}
+		keyAuth, err := client.HTTP01ChallengeResponse(chal.Token)
+		if err != nil {
+			return err
+		}
+		answers[chal.Token] = keyAuth
+		pending = append(pending, chal)
+		authzURLs = append(authzURLs, z.URI)
+	}
+
+	if len(pending) > 0 {
+		err = ctrl.acmeUpdateSecret(ctx, c, func(s *v1.Secret) {
+			for token, keyAuth := range answers {
+				s.Data[acmeChallengeKeyPrefix+token] = []byte(keyAuth)
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("publish challenges: %w", err)
+		}
+		defer func() {
+			if err == nil {
+				return // the certificate write removed them
+			}
+			if cerr := ctrl.acmeUpdateSecret(context.WithoutCancel(ctx), c, deleteACMEChallenges); cerr != nil {
+				slog.Error("acme: remove challenges failed", "secret", c.key(), "error", cerr)
+			}
+		}()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(acmePropagationDelay):
+		}
+		for i, chal := range pending {
+			if _, err := client.Accept(ctx, chal); err != nil {
+				return err
+			}
+			if _, err := client.WaitAuthorization(ctx, authzURLs[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	if order, err = client.WaitOrder(ctx, order.URI); err != nil {
+		return err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: c.hosts[0]},
+		DNSNames: c.hosts,
+	}, key)
+	if err != nil {
+		return err
+	}
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return err
+	}
+	var crtPEM []byte
+	for _, der := range chain {
+		crtPEM = append(crtPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	keyPEM, err := encodeECKey(key)
+	if err != nil {
+		return err
+	}
+	return ctrl.acmeUpdateSecret(ctx, c, func(s *v1.Secret) {
+		deleteACMEChallenges(s)
+		s.Data["tls.crt"] = crtPEM
+		s.Data["tls.key"] = keyPEM
+	})
+}
+
+func deleteACMEChallenges(s *v1.Secret) {
+	for k := range s.Data {
+		if strings.HasPrefix(k, acmeChallengeKeyPrefix) {
+			delete(s.Data, k)
+		}
+	}
+}
+
+// acmeUpdateSecret applies mutate to c's Secret, creating it (an empty TLS
+// Secret marked tls-acme) when missing, with a compare-and-swap retry. A
+// Secret not marked tls-acme is never written (errACMENotOwned). The
+// written Secret is stored right away, without waiting for the watch, so this
+// replica serves a challenge (or certificate) at once.
+func (ctrl *Controller) acmeUpdateSecret(ctx context.Context, c *acmeCert, mutate func(*v1.Secret)) error {
+	for range 5 {
+		s, err := k8s.GetSecret(ctx, c.namespace, c.name)
+		switch {
+		case apierrors.IsNotFound(err):
+			s = &v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   c.namespace,
+					Name:        c.name,
+					Annotations: map[string]string{tlsACMEAnnotation: "true"},
+				},
+				Type: v1.SecretTypeTLS,
+				Data: map[string][]byte{"tls.crt": {}, "tls.key": {}},
+			}
+			mutate(s)
+			s, err = k8s.CreateSecret(ctx, c.namespace, s)
+			if apierrors.IsAlreadyExists(err) {
+				continue
+			}
+		case err != nil:
+			return err
+		case !isACMEOwned(s):
+			return errACMENotOwned
+		default:
+			if s.Data == nil {
+				s.Data = make(map[string][]byte)
+			}
+			mutate(s)
+			s, err = k8s.UpdateSecret(ctx, c.namespace, s)
+			if apierrors.IsConflict(err) {
+				continue
+			}
+		}
+		if err != nil {
+			return err
+		}
+		ctrl.watchedSecrets.Store(c.key(), s)
+		ctrl.reloadACMEChallenges() // now, not after the reload debounce
+		ctrl.reloadSecret()
+		return nil
+	}
+	return fmt.Errorf("secret %s: exhausted retries", c.key())
+}
+
+func parseECKey(b []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("no key in tls.key")
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	ec, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("tls.key is not an EC key")
+	}
+	return ec, nil
+}
+
+func encodeECKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
@@ -0,0 +1,217 @@
+package controller
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/moonrhythm/parapet-ingress-controller/acmetest"
+	"github.com/moonrhythm/parapet-ingress-controller/k8s"
+	"github.com/moonrhythm/parapet-ingress-controller/proxy"
+)
+
+const acmeFixture = `
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: web
+  namespace: default
+  annotations:
+    parapet.moonrhythm.io/tls-acme: "true"
+spec:
+  ingressClassName: parapet
+  tls:
+  - secretName: web-tls
+  rules:
+  - host: app.example.com
+  - host: www.example.com
+  - host: "*.example.com"
+---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: manual
+  namespace: default
+spec:
+  ingressClassName: parapet
+  tls:
+  - hosts: [manual.example.com]
+    secretName: manual-tls
+`
+
+// acmeController loads acmeFixture into the fs backend, and a controller
+// issuing from srv whose challenges srv fetches from it.
+func acmeController(t *testing.T, srv *acmetest.Server) *Controller {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "fixture.yaml"), []byte(acmeFixture), 0o644))
+	t.Setenv("KUBERNETES_BACKEND", "fs")
+	t.Setenv("KUBERNETES_FS", dir)
+	require.NoError(t, k8s.Init())
+
+	ctrl := New("", proxy.New())
+	ctrl.PodNamespace = "parapet"
+	ctrl.ACMEConfig = ACMEConfig{
+		Directory:     srv.DirectoryURL(),
+		Email:         "ops@example.com",
+		AccountSecret: "acme-account",
+		RenewBefore:   30 * 24 * time.Hour,
+	}
+	ings, err := k8s.GetIngresses(context.Background(), "")
+	require.NoError(t, err)
+	for i := range ings {
+		ctrl.watchedIngresses.Store(ings[i].Namespace+"/"+ings[i].Name, ings[i].DeepCopy())
+	}
+
+	challenges := httptest.NewServer(ctrl.ACMEChallenge().ServeHandler(http.NotFoundHandler()))
+	t.Cleanup(challenges.Close)
+	srv.ChallengeAddr = strings.TrimPrefix(challenges.URL, "http://")
+	return ctrl
+}
+
+func TestACME(t *testing.T) {
+	acmePropagationDelay = 0
+
+	srv, err := acmetest.New()
+	require.NoError(t, err)
+	defer srv.Close()
+	ctx := context.Background()
+
+	t.Run("issues and keeps a valid certificate", func(t *testing.T) {
+		ctrl := acmeController(t, srv)
+		issued := srv.Issued()
+
+		certs := ctrl.acmeCertificates()
+		require.Len(t, certs, 1, "only the annotated Ingress")
+		assert.Equal(t, []string{"app.example.com", "www.example.com"}, certs["default/web-tls"].hosts, "the wildcard host is skipped")
+
+		client, err := ctrl.acmeClient(ctx)
+		require.NoError(t, err)
+		account, err := k8s.GetSecret(ctx, "parapet", "acme-account")
+		require.NoError(t, err)
+		assert.NotEmpty(t, account.Data["tls.key"])
+
+		retry := make(map[string]*acmeRetry)
+		ctrl.acmeRenew(ctx, client, retry, time.Now())
+		assert.Empty(t, retry)
+		assert.Equal(t, issued+1, srv.Issued())
+
+		s, err := k8s.GetSecret(ctx, "default", "web-tls")
+		require.NoError(t, err)
+		assert.Equal(t, v1.SecretTypeTLS, s.Type)
+		assert.Equal(t, "true", s.Annotations[tlsACMEAnnotation])
+		for k := range s.Data {
+			assert.NotContains(t, k, acmeChallengeKeyPrefix, "answers are removed")
+		}
+		block, _ := pem.Decode(s.Data["tls.crt"])
+		require.NotNil(t, block)
+		leaf, err := x509.ParseCertificate(block.Bytes)
+		require.NoError(t, err)
+		roots := x509.NewCertPool()
+		roots.AddCert(srv.CA)
+		_, err = leaf.Verify(x509.VerifyOptions{DNSName: "www.example.com", Roots: roots})
+		assert.NoError(t, err)
+
+		ctrl.acmeRenew(ctx, client, retry, time.Now())
+		assert.Equal(t, issued+1, srv.Issued(), "a valid certificate is kept")
+		ctrl.acmeRenew(ctx, client, retry, time.Now().Add(61*24*time.Hour))
+		assert.Equal(t, issued+2, srv.Issued(), "renewed within RenewBefore of expiry")
+
+		// a second client registers the same account
+		_, err = ctrl.acmeClient(ctx)
+		assert.NoError(t, err)
+	})
+
+	t.Run("failed order backs off", func(t *testing.T) {
+		ctrl := acmeController(t, srv)
+		issued := srv.Issued()
+		srv.ChallengeAddr = "127.0.0.1:1" // nothing answers
+
+		client, err := ctrl.acmeClient(ctx)
+		require.NoError(t, err)
+		retry := make(map[string]*acmeRetry)
+		now := time.Now()
+		ctrl.acmeRenew(ctx, client, retry, now)
+		require.Contains(t, retry, "default/web-tls")
+		assert.Equal(t, acmeMinBackoff, retry["default/web-tls"].backoff)
+		assert.Equal(t, issued, srv.Issued())
+
+		s, err := k8s.GetSecret(ctx, "default", "web-tls")
+		require.NoError(t, err)
+		assert.True(t, isACMEPending(s), "created empty, skipped by the cert table")
+		for k := range s.Data {
+			assert.NotContains(t, k, acmeChallengeKeyPrefix, "answers are removed on failure too")
+		}
+
+		ctrl.acmeRenew(ctx, client, retry, now.Add(time.Minute))
+		assert.Equal(t, acmeMinBackoff, retry["default/web-tls"].backoff, "not retried while backing off")
+		ctrl.acmeRenew(ctx, client, retry, now.Add(acmeMinBackoff+time.Minute))
+		assert.Equal(t, 2*acmeMinBackoff, retry["default/web-tls"].backoff)
+	})
+
+	t.Run("a secret the issuer didn't create is left alone", func(t *testing.T) {
+		ctrl := acmeController(t, srv)
+		issued := srv.Issued()
+		manual := &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web-tls"},
+			Type:       v1.SecretTypeTLS,
+			Data:       map[string][]byte{"tls.crt": []byte("manual"), "tls.key": []byte("manual")},
+		}
+		_, err := k8s.CreateSecret(ctx, "default", manual)
+		require.NoError(t, err)
+
+		// unknown to the watch yet: refused on write
+		c := ctrl.acmeCertificates()["default/web-tls"]
+		err = ctrl.acmeUpdateSecret(ctx, c, func(s *v1.Secret) { s.Data["tls.crt"] = nil })
+		assert.ErrorIs(t, err, errACMENotOwned)
+
+		// known: refused before ordering
+		ctrl.watchedSecrets.Store("default/web-tls", manual)
+		client, err := ctrl.acmeClient(ctx)
+		require.NoError(t, err)
+		retry := make(map[string]*acmeRetry)
+		ctrl.acmeRenew(ctx, client, retry, time.Now())
+		assert.Contains(t, retry, "default/web-tls")
+		assert.Equal(t, issued, srv.Issued())
+
+		s, err := k8s.GetSecret(ctx, "default", "web-tls")
+		require.NoError(t, err)
+		assert.Equal(t, manual.Data, s.Data)
+	})
+
+	t.Run("challenges are answered on their hosts only", func(t *testing.T) {
+		ctrl := acmeController(t, srv)
+		ctrl.watchedSecrets.Store("default/web-tls", &v1.Secret{
+			Data: map[string][]byte{acmeChallengeKeyPrefix + "tok": []byte("tok.thumb")},
+		})
+		ctrl.reloadACMEChallenges()
+		h := ctrl.ACMEChallenge().ServeHandler(http.NotFoundHandler())
+
+		serve := func(method, host, path string) *httptest.ResponseRecorder {
+			r := httptest.NewRequest(method, "http://"+host+path, nil)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			return w
+		}
+		w := serve(http.MethodGet, "app.example.com", "/.well-known/acme-challenge/tok")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "tok.thumb", w.Body.String())
+		assert.Equal(t, "tok.thumb", serve(http.MethodGet, "App.Example.com:80", "/.well-known/acme-challenge/tok").Body.String(), "host normalized like routing")
+
+		assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "manual.example.com", "/.well-known/acme-challenge/tok").Code)
+		assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "app.example.com", "/.well-known/acme-challenge/other").Code)
+		assert.Equal(t, http.StatusNotFound, serve(http.MethodPost, "app.example.com", "/.well-known/acme-challenge/tok").Code)
+	})
+}
@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/moonrhythm/parapet/pkg/header"
+	networking "k8s.io/api/networking/v1"
+)
+
+const (
+	affinityAnnotation       = "parapet.moonrhythm.io/affinity"
+	affinityCookieAnnotation = "parapet.moonrhythm.io/affinity-cookie-"
+
+	defaultAffinityCookieName = "parapet-affinity"
+)
+
+// affinity pins a client to one pod with a cookie (the `affinity: cookie`
+// annotation family). The cookie carries the pod IP sealed with AES-GCM under
+// the controller's affinity key, with the Service host as additional data: it
+// can't be forged, doesn't reveal the pod IP, and a cookie minted for one
+// Service is just a miss on another.
+type affinity struct {
+	aead     cipher.AEAD
+	name     string
+	path     string
+	maxAge   int
+	sameSite http.SameSite
+}
+
+// ingressAffinity reads an Ingress's affinity annotations, nil when affinity is
+// off. A malformed value is logged and its default used; an unknown affinity
+// mode disables affinity (requests are balanced as without it).
+func (ctrl *Controller) ingressAffinity(ing *networking.Ingress) *affinity {
+	mode := strings.TrimSpace(ing.Annotations[affinityAnnotation])
+	if mode == "" {
+		return nil
+	}
+	id := ing.Namespace + "/" + ing.Name
+	if mode != "cookie" {
+		slog.Error("invalid affinity, ignoring", "ingress", id, "value", mode)
+		return nil
+	}
+
+	ann := func(key string) string {
+		return strings.TrimSpace(ing.Annotations[affinityCookieAnnotation+key])
+	}
+	a := &affinity{
+		aead:     ctrl.affinityAEAD(),
+		name:     defaultAffinityCookieName,
+		path:     "/",
+		sameSite: http.SameSiteLaxMode,
+	}
+	if v := ann("name"); v != "" {
+		if (&http.Cookie{Name: v}).Valid() != nil {
+			slog.Error("invalid affinity-cookie-name, using default", "ingress", id, "value", v)
+		} else {
+			a.name = v
+		}
+	}
+	if v := ann("path"); v != "" {
+		a.path = v
+	}
+	if v := ann("ttl"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Second {
+			slog.Error("invalid affinity-cookie-ttl, using a session cookie", "ingress", id, "value", v, "error", err)
+		} else {
+			a.maxAge = int(d / time.Second)
+		}
+	}
+	switch v := strings.ToLower(ann("samesite")); v {
+	case "":
+	case "lax":
+		a.sameSite = http.SameSiteLaxMode
+	case "strict":
+		a.sameSite = http.SameSiteStrictMode
+	case "none":
+		a.sameSite = http.SameSiteNoneMode
+	default:
+		slog.Error("invalid affinity-cookie-samesite, using lax", "ingress", id, "value", v)
+	}
+	return a
+}
+
+// affinityAEAD returns the controller's cookie cipher, keyed by AffinitySecret
+// or, when that is empty, by a random per-process secret (affinity then holds
+// per replica only).
+func (ctrl *Controller) affinityAEAD() cipher.AEAD {
+	ctrl.affinityOnce.Do(func() {
+		secret := []byte(ctrl.AffinitySecret)
+		if len(secret) == 0 {
+			secret = make([]byte, 32)
+			rand.Read(secret)
+		}
+		key := sha256.Sum256(secret)
+		block, err := aes.NewCipher(key[:])
+		if err != nil {
+			panic(err) // a 32-byte key is always valid
+		}
+		ctrl.affinityCipher, err = cipher.NewGCM(block)
+		if err != nil {
+			panic(err)
+		}
+	})
+	return ctrl.affinityCipher
+}
+
+// pinned returns the pod IP r's affinity cookie pins it to for serviceHost, or
+// "" when there is no valid cookie.
+func (a *affinity) pinned(r *http.Request, serviceHost string) string {
+	c, err := r.Cookie(a.name)
+	if err != nil {
+		return ""
+	}
+	b, err := base64.RawURLEncoding.DecodeString(c.Value)
+	ns := a.aead.NonceSize()
+	if err != nil || len(b) < ns+a.aead.Overhead() {
+		return ""
+	}
+	ip, err := a.aead.Open(nil, b[:ns], b[ns:], []byte(serviceHost))
+	if err != nil {
+		return ""
+	}
+	return string(ip)
+}
+
+// pin sets the affinity cookie pinning the client to pod ip. It replaces a
+// cookie an earlier attempt of the same request set (a retried dial re-pins),
+// and is set before the upstream's own headers are copied in.
+func (a *affinity) pin(w http.ResponseWriter, r *http.Request, serviceHost, ip string) {
+	nonce := make([]byte, a.aead.NonceSize(), a.aead.NonceSize()+len(ip)+a.aead.Overhead())
+	rand.Read(nonce)
+	sealed := a.aead.Seal(nonce, nonce, []byte(ip), []byte(serviceHost))
+
+	c := &http.Cookie{
+		Name:     a.name,
+		Value:    base64.RawURLEncoding.EncodeToString(sealed),
+		Path:     a.path,
+		MaxAge:   a.maxAge,
+		HttpOnly: true,
+		// SameSite=None is only honored on a Secure cookie
+		Secure:   a.sameSite == http.SameSiteNoneMode || r.TLS != nil || header.Get(r.Header, header.XForwardedProto) == "https",
+		SameSite: a.sameSite,
+	}
+
+	h := w.Header()
+	prefix := a.name + "="
+	kept := h["Set-Cookie"][:0]
+	for _, v := range h["Set-Cookie"] {
+		if !strings.HasPrefix(v, prefix) {
+			kept = append(kept, v)
+		}
+	}
+	h["Set-Cookie"] = append(kept, c.String())
+}
@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func affinityIngress(ann map[string]string) *networking.Ingress {
+	return &networking.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "ing", Annotations: ann}}
+}
+
+func TestIngressAffinity(t *testing.T) {
+	t.Parallel()
+
+	ctrl := &Controller{}
+	assert.Nil(t, ctrl.ingressAffinity(affinityIngress(nil)))
+	assert.Nil(t, ctrl.ingressAffinity(affinityIngress(map[string]string{affinityAnnotation: "ip"})), "unknown mode disables affinity")
+
+	a := ctrl.ingressAffinity(affinityIngress(map[string]string{affinityAnnotation: "cookie"}))
+	require.NotNil(t, a)
+	assert.Equal(t, defaultAffinityCookieName, a.name)
+	assert.Equal(t, "/", a.path)
+	assert.Zero(t, a.maxAge)
+	assert.Equal(t, http.SameSiteLaxMode, a.sameSite)
+
+	a = ctrl.ingressAffinity(affinityIngress(map[string]string{
+		affinityAnnotation:                    "cookie",
+		affinityCookieAnnotation + "name":     "route",
+		affinityCookieAnnotation + "path":     "/app",
+		affinityCookieAnnotation + "ttl":      "1h",
+		affinityCookieAnnotation + "samesite": "None",
+	}))
+	require.NotNil(t, a)
+	assert.Equal(t, "route", a.name)
+	assert.Equal(t, "/app", a.path)
+	assert.Equal(t, 3600, a.maxAge)
+	assert.Equal(t, http.SameSiteNoneMode, a.sameSite)
+
+	a = ctrl.ingressAffinity(affinityIngress(map[string]string{
+		affinityAnnotation:                    "cookie",
+		affinityCookieAnnotation + "name":     "bad name",
+		affinityCookieAnnotation + "ttl":      "soon",
+		affinityCookieAnnotation + "samesite": "sometimes",
+	}))
+	require.NotNil(t, a)
+	assert.Equal(t, defaultAffinityCookieName, a.name, "invalid values use defaults")
+	assert.Zero(t, a.maxAge)
+	assert.Equal(t, http.SameSiteLaxMode, a.sameSite)
+}
+
+func TestAffinityCookie(t *testing.T) {
+	t.Parallel()
+
+	const svcHost = "api.default.svc.cluster.local"
+	ctrl := &Controller{AffinitySecret: "secret"}
+	a := ctrl.ingressAffinity(affinityIngress(map[string]string{affinityAnnotation: "cookie"}))
+	require.NotNil(t, a)
+
+	// pin returns the request a browser would send back
+	pin := func(ip string) *http.Request {
+		w := httptest.NewRecorder()
+		a.pin(w, httptest.NewRequest(http.MethodGet, "/", nil), svcHost, ip)
+		cookies := w.Result().Cookies()
+		require.Len(t, cookies, 1)
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.AddCookie(cookies[0])
+		return r
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		r := pin("10.0.0.1")
+		c, _ := r.Cookie(defaultAffinityCookieName)
+		assert.NotContains(t, c.Value, "10.0.0.1", "pod IP not revealed")
+		assert.Equal(t, "10.0.0.1", a.pinned(r, svcHost))
+	})
+
+	t.Run("bound to the Service", func(t *testing.T) {
+		assert.Empty(t, a.pinned(pin("10.0.0.1"), "web.default.svc.cluster.local"))
+	})
+
+	t.Run("bound to the secret", func(t *testing.T) {
+		other := (&Controller{AffinitySecret: "other"}).ingressAffinity(affinityIngress(map[string]string{affinityAnnotation: "cookie"}))
+		assert.Empty(t, other.pinned(pin("10.0.0.1"), svcHost))
+	})
+
+	t.Run("tampered or missing", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		assert.Empty(t, a.pinned(r, svcHost))
+		r.AddCookie(&http.Cookie{Name: defaultAffinityCookieName, Value: "10.0.0.1"})
+		assert.Empty(t, a.pinned(r, svcHost))
+	})
+
+	t.Run("re-pin replaces the cookie", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		w.Header().Add("Set-Cookie", "other=1")
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		a.pin(w, r, svcHost, "10.0.0.1")
+		a.pin(w, r, svcHost, "10.0.0.2")
+		cookies := w.Result().Cookies()
+		require.Len(t, cookies, 2)
+		assert.Equal(t, "other", cookies[0].Name)
+		r.AddCookie(cookies[1])
+		assert.Equal(t, "10.0.0.2", a.pinned(r, svcHost))
+	})
+
+	t.Run("secure over https", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		a.pin(w, r, svcHost, "10.0.0.1")
+		assert.False(t, w.Result().Cookies()[0].Secure)
+
+		w = httptest.NewRecorder()
+		r.TLS = &tls.ConnectionState{}
+		a.pin(w, r, svcHost, "10.0.0.1")
+		c := w.Result().Cookies()[0]
+		assert.True(t, c.Secure)
+		assert.True(t, c.HttpOnly)
+	})
+}
@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"log/slog"
+
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/moonrhythm/parapet-ingress-controller/plugin"
+)
+
+// LookupHtpasswd returns the users of the htpasswd file in the auth key of
+// the Secret namespace/name, for plugin.BasicAuthSecret; nil when the Secret
+// is missing or has no usable user. A Secret is parsed again only when it
+// changes.
+func (ctrl *Controller) LookupHtpasswd(namespace, name string) *plugin.Htpasswd {
+	return ctrl.htpasswds.lookup(&ctrl.watchedSecrets, namespace+"/"+name)
+}
+
+// parseHtpasswdSecret reads the users of a basic-auth Secret
+// (secretCache.parse).
+func parseHtpasswdSecret(key string, s *v1.Secret) *plugin.Htpasswd {
+	users, errs := plugin.ParseHtpasswd(s.Data["auth"])
+	for _, err := range errs {
+		slog.Warn("skipping htpasswd entry of basic auth secret", "secret", key, "error", err)
+	}
+	if users.Len() == 0 {
+		slog.Error("no usable user in basic auth secret, rejecting requests", "secret", key)
+		return nil
+	}
+	slog.Debug("loaded basic auth users", "secret", key, "users", users.Len())
+	return users
+}
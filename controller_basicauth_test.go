@@ -0,0 +1,33 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/moonrhythm/parapet-ingress-controller/proxy"
+)
+
+func TestLookupHtpasswd(t *testing.T) {
+	ctrl := New("", proxy.New())
+	assert.Nil(t, ctrl.LookupHtpasswd("default", "users"))
+
+	ctrl.watchedSecrets.Store("default/users", secretFixture("default", "users", "1", map[string][]byte{"auth": []byte("bob:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n")}))
+	users := ctrl.LookupHtpasswd("default", "users")
+	if assert.NotNil(t, users) {
+		assert.True(t, users.Verify("bob", "password"))
+	}
+	assert.Same(t, users, ctrl.LookupHtpasswd("default", "users"), "parsed again only when the Secret changes")
+
+	ctrl.watchedSecrets.Store("default/users", secretFixture("default", "users", "2", map[string][]byte{"auth": []byte("carol:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n")}))
+	users = ctrl.LookupHtpasswd("default", "users")
+	if assert.NotNil(t, users) {
+		assert.False(t, users.Verify("bob", "password"))
+		assert.True(t, users.Verify("carol", "password"))
+	}
+
+	ctrl.watchedSecrets.Store("default/users", secretFixture("default", "users", "3", map[string][]byte{"auth": []byte("dave:plain\n")}))
+	assert.Nil(t, ctrl.LookupHtpasswd("default", "users"))
+	ctrl.watchedSecrets.Delete("default/users")
+	assert.Nil(t, ctrl.LookupHtpasswd("default", "users"))
+}
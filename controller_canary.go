@@ -0,0 +1,198 @@
+package controller
+
+import (
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+
+	networking "k8s.io/api/networking/v1"
+)
+
+const (
+	canaryAnnotation         = "parapet.moonrhythm.io/canary"
+	canaryWeightAnnotation   = "parapet.moonrhythm.io/canary-weight"
+	canaryByHeaderAnnotation = "parapet.moonrhythm.io/canary-by-header"
+	canaryByCookieAnnotation = "parapet.moonrhythm.io/canary-by-cookie"
+)
+
+// isCanaryIngress reports whether ing is a canary (`canary: "true"`): its
+// paths aren't routes of their own but split traffic off the primary
+// Ingress's matching routes.
+func isCanaryIngress(ing *networking.Ingress) bool {
+	return ing.Annotations[canaryAnnotation] == "true"
+}
+
+// canaryRoute is a canary Ingress's backend for one route key, and the rules
+// that send a request to it instead of the primary's backend.
+type canaryRoute struct {
+	handler http.Handler // the canary Service's backend handler
+	target  string
+	weight  int    // percent of the remaining requests, 0-100
+	header  string // canonical header name; "" = off
+	cookie  string // cookie name; "" = off
+	owner   string // namespace/name of the canary Ingress
+	used    bool
+}
+
+// useCanary picks the backend for r: the header, then the cookie, forces it
+// with "always" or "never"; any other value (or none) leaves it to the weight.
+func (c *canaryRoute) useCanary(r *http.Request) bool {
+	if c.header != "" {
+		switch r.Header.Get(c.header) {
+		case "always":
+			return true
+		case "never":
+			return false
+		}
+	}
+	if c.cookie != "" {
+		if ck, err := r.Cookie(c.cookie); err == nil {
+			switch ck.Value {
+			case "always":
+				return true
+			case "never":
+				return false
+			}
+		}
+	}
+	return c.weight >= 100 || c.weight > 0 && rand.IntN(100) < c.weight
+}
+
+// split returns a handler sending each request to either primary or the canary
+// backend. It sits inside the primary Ingress's chain, so both backends are
+// served under the primary's plugins and retry; each backend stamps its own
+// Service into the request state (metrics and access log follow the split).
+func (c *canaryRoute) split(primary http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c.useCanary(r) {
+			c.handler.ServeHTTP(w, r)
+			return
+		}
+		primary.ServeHTTP(w, r)
+	})
+}
+
+// canaryRoutes indexes canary backends by the primary route they split:
+// namespace + " " + route key. A canary only splits a primary in its own
+// namespace, so one tenant can't divert another's traffic.
+type canaryRoutes map[string]*canaryRoute
+
+func canaryKey(namespace, routeKey string) string {
+	return namespace + " " + routeKey
+}
+
+// collectCanaries resolves the backend of every path of every canary Ingress
+// of this controller's class. Two canaries on the same route: the lexically
+// smaller namespace/name wins (logged).
+func (ctrl *Controller) collectCanaries() canaryRoutes {
+	canaries := canaryRoutes{}
+	ctrl.watchedIngresses.Range(func(_, value any) bool {
+		ing := value.(*networking.Ingress)
+		if getIngressClass(ing) != IngressClass || !isCanaryIngress(ing) {
+			return true
+		}
+		owner := ing.Namespace + "/" + ing.Name
+		weight, header, cookie := canaryRules(ing)
+
+		for _, rule := range ing.Spec.Rules {
+			if rule.HTTP == nil {
+				continue
+			}
+			host := strings.ToLower(rule.Host)
+			for _, httpPath := range rule.HTTP.Paths {
+				handler, target, ok := ctrl.resolveBackend(ing, &httpPath.Backend)
+				if !ok {
+					continue
+				}
+				key := canaryKey(ing.Namespace, primaryRouteKey(host, httpPath))
+				if cur, ok := canaries[key]; ok {
+					keep := min(owner, cur.owner)
+					slog.Warn("conflicting canary ingress", "path", host+httpPath.Path, "ingress", owner, "other", cur.owner, "keep", keep)
+					if keep == cur.owner {
+						continue
+					}
+				}
+				canaries[key] = &canaryRoute{
+					handler: handler,
+					target:  target,
+					weight:  weight,
+					header:  header,
+					cookie:  cookie,
+					owner:   owner,
+				}
+			}
+		}
+		return true
+	})
+	return canaries
+}
+
+// canaryRules reads a canary Ingress's split annotations. A malformed weight
+// is logged and treated as 0: the canary then only gets requests that opt in
+// by header or cookie.
+func canaryRules(ing *networking.Ingress) (weight int, header, cookie string) {
+	if a := strings.TrimSpace(ing.Annotations[canaryWeightAnnotation]); a != "" {
+		n, err := strconv.Atoi(a)
+		if err != nil || n < 0 || n > 100 {
+			slog.Error("invalid canary-weight, using 0", "ingress", ing.Namespace+"/"+ing.Name, "value", a)
+		} else {
+			weight = n
+		}
+	}
+	if a := strings.TrimSpace(ing.Annotations[canaryByHeaderAnnotation]); a != "" {
+		header = http.CanonicalHeaderKey(a)
+	}
+	cookie = strings.TrimSpace(ing.Annotations[canaryByCookieAnnotation])
+	return
+}
+
+// wrap puts the canary of a primary route (if any) in front of its backend
+// handler.
+func (canaries canaryRoutes) wrap(ing *networking.Ingress, host string, httpPath networking.HTTPIngressPath, handler http.Handler) http.Handler {
+	c, ok := canaries[canaryKey(ing.Namespace, primaryRouteKey(host, httpPath))]
+	if !ok {
+		return handler
+	}
+	c.used = true
+	slog.Debug("registered canary", "path", host+httpPath.Path, "target", c.target, "weight", c.weight)
+	return c.split(handler)
+}
+
+// warnUnused logs the canaries no primary route matched; they serve nothing.
+func (canaries canaryRoutes) warnUnused() {
+	for key, c := range canaries {
+		if !c.used {
+			_, route, _ := strings.Cut(key, " ")
+			slog.Warn("canary ingress has no primary route in its namespace, ignoring", "ingress", c.owner, "path", route)
+		}
+	}
+}
+
+// primaryRouteKey is the route key a path registers under (for Prefix, the
+// "host/path/" one), identifying the route a canary path splits.
+func primaryRouteKey(host string, httpPath networking.HTTPIngressPath) string {
+	path := httpPath.Path
+	if path == "" {
+		path = "/"
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	pathType := networking.PathTypeImplementationSpecific
+	if httpPath.PathType != nil {
+		pathType = *httpPath.PathType
+	}
+	switch pathType {
+	case networking.PathTypePrefix:
+		return host + strings.TrimSuffix(path, "/") + "/"
+	case networking.PathTypeExact:
+		if path == "/" {
+			return host + path
+		}
+		return host + strings.TrimSuffix(path, "/")
+	default:
+		return host + path
+	}
+}
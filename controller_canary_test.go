@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	networking "k8s.io/api/networking/v1"
+
+	"github.com/moonrhythm/parapet-ingress-controller/proxy"
+	"github.com/moonrhythm/parapet-ingress-controller/state"
+)
+
+func canaryIngress(namespace, name, host, path string, svcName string, ann map[string]string) *networking.Ingress {
+	ing := ingressToService(namespace, name, host, path, networking.PathTypePrefix, svcName, 80)
+	ing.Annotations = map[string]string{canaryAnnotation: "true"}
+	for k, v := range ann {
+		ing.Annotations[k] = v
+	}
+	return ing
+}
+
+// servedServiceFor is servedService for a prepared request.
+func servedServiceFor(ctrl *Controller, r *http.Request) string {
+	s := state.State{}
+	r = r.WithContext(state.NewContext(r.Context(), s))
+	ctrl.ServeHandler(nil).ServeHTTP(httptest.NewRecorder(), r)
+	return s["serviceName"]
+}
+
+func TestPrimaryRouteKey(t *testing.T) {
+	t.Parallel()
+
+	path := func(p string, pt networking.PathType) networking.HTTPIngressPath {
+		return networking.HTTPIngressPath{Path: p, PathType: ptr(pt)}
+	}
+	assert.Equal(t, "a.com/api/", primaryRouteKey("a.com", path("/api", networking.PathTypePrefix)))
+	assert.Equal(t, "a.com/api/", primaryRouteKey("a.com", path("/api/", networking.PathTypePrefix)))
+	assert.Equal(t, "a.com/", primaryRouteKey("a.com", path("/", networking.PathTypePrefix)))
+	assert.Equal(t, "a.com/login", primaryRouteKey("a.com", path("/login/", networking.PathTypeExact)))
+	assert.Equal(t, "a.com/", primaryRouteKey("a.com", path("/", networking.PathTypeExact)))
+	assert.Equal(t, "a.com/raw", primaryRouteKey("a.com", path("raw", networking.PathTypeImplementationSpecific)))
+	assert.Equal(t, "a.com/", primaryRouteKey("a.com", networking.HTTPIngressPath{}))
+}
+
+func TestCanaryUseCanary(t *testing.T) {
+	t.Parallel()
+
+	c := &canaryRoute{header: "X-Canary", cookie: "canary"}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.False(t, c.useCanary(r), "weight 0")
+
+	r.AddCookie(&http.Cookie{Name: "canary", Value: "always"})
+	assert.True(t, c.useCanary(r))
+
+	r.Header.Set("X-Canary", "never")
+	assert.False(t, c.useCanary(r), "header before cookie")
+
+	r.Header.Set("X-Canary", "always")
+	assert.True(t, c.useCanary(r))
+
+	c = &canaryRoute{weight: 100, header: "X-Canary"}
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.True(t, c.useCanary(r))
+	r.Header.Set("X-Canary", "maybe")
+	assert.True(t, c.useCanary(r), "other values fall through to the weight")
+}
+
+func TestReloadIngressCanary(t *testing.T) {
+	newCtrl := func() *Controller {
+		ctrl := New("", proxy.New())
+		ctrl.watchedServices.Store("default/web", clusterIPService("default", "web", 80, 8080))
+		ctrl.watchedServices.Store("default/web-next", clusterIPService("default", "web-next", 80, 8080))
+		ctrl.watchedIngresses.Store("default/web", ingressToService("default", "web", "example.com", "/", networking.PathTypePrefix, "web", 80))
+		return ctrl
+	}
+
+	t.Run("weight splits the primary route", func(t *testing.T) {
+		ctrl := newCtrl()
+		ctrl.watchedIngresses.Store("default/web-canary", canaryIngress("default", "web-canary", "example.com", "/", "web-next",
+			map[string]string{canaryWeightAnnotation: "50"}))
+		ctrl.reloadIngressDebounced()
+
+		seen := map[string]int{}
+		for i := 0; i < 200; i++ {
+			seen[servedService(t, ctrl, "example.com", "/")]++
+		}
+		assert.Len(t, seen, 2)
+		assert.Greater(t, seen["web"], 0)
+		assert.Greater(t, seen["web-next"], 0)
+	})
+
+	t.Run("header forces either backend", func(t *testing.T) {
+		ctrl := newCtrl()
+		ctrl.watchedIngresses.Store("default/web-canary", canaryIngress("default", "web-canary", "example.com", "/", "web-next",
+			map[string]string{canaryWeightAnnotation: "100", canaryByHeaderAnnotation: "x-canary"}))
+		ctrl.reloadIngressDebounced()
+
+		assert.Equal(t, "web-next", servedService(t, ctrl, "example.com", "/"))
+		r := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		r.Header.Set("X-Canary", "never")
+		assert.Equal(t, "web", servedServiceFor(ctrl, r))
+	})
+
+	t.Run("canary without a primary serves nothing", func(t *testing.T) {
+		ctrl := newCtrl()
+		ctrl.watchedIngresses.Store("default/web-canary", canaryIngress("default", "web-canary", "other.com", "/", "web-next",
+			map[string]string{canaryWeightAnnotation: "100"}))
+		ctrl.reloadIngressDebounced()
+
+		assert.Empty(t, servedService(t, ctrl, "other.com", "/"))
+		assert.False(t, ctrl.IsKnownHost("other.com"))
+		assert.Equal(t, "web", servedService(t, ctrl, "example.com", "/"))
+	})
+
+	t.Run("canary in another namespace is ignored", func(t *testing.T) {
+		ctrl := newCtrl()
+		ctrl.watchedServices.Store("other/web-next", clusterIPService("other", "web-next", 80, 8080))
+		ctrl.watchedIngresses.Store("other/web-canary", canaryIngress("other", "web-canary", "example.com", "/", "web-next",
+			map[string]string{canaryWeightAnnotation: "100"}))
+		ctrl.reloadIngressDebounced()
+
+		assert.Equal(t, "web", servedService(t, ctrl, "example.com", "/"))
+	})
+
+	t.Run("invalid weight sends nothing to the canary", func(t *testing.T) {
+		ctrl := newCtrl()
+		ctrl.watchedIngresses.Store("default/web-canary", canaryIngress("default", "web-canary", "example.com", "/", "web-next",
+			map[string]string{canaryWeightAnnotation: "150"}))
+		ctrl.reloadIngressDebounced()
+
+		for i := 0; i < 20; i++ {
+			assert.Equal(t, "web", servedService(t, ctrl, "example.com", "/"))
+		}
+	})
+}
@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"log/slog"
+	"slices"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+)
+
+const (
+	authTLSSecretAnnotation       = "parapet.moonrhythm.io/auth-tls-secret"
+	authTLSVerifyClientAnnotation = "parapet.moonrhythm.io/auth-tls-verify-client"
+)
+
+// clientCAHosts are, by host (as registered: lowercase, a wildcard host
+// literal), the CA Secrets ("namespace/name") of the Ingresses verifying
+// client certificates there; "" for an Ingress taking any certificate.
+type clientCAHosts map[string][]string
+
+// add records the CA Secret of ing, when it verifies client certificates
+// (plugin.ClientCertAuth), for host.
+func (hosts clientCAHosts) add(ing *networking.Ingress, host string) {
+	secret := strings.TrimSpace(ing.Annotations[authTLSSecretAnnotation])
+	if secret == "" && strings.TrimSpace(ing.Annotations[authTLSVerifyClientAnnotation]) == "" {
+		return
+	}
+	if secret != "" {
+		secret = ing.Namespace + "/" + secret
+	}
+	if !slices.Contains(hosts[host], secret) {
+		hosts[host] = append(hosts[host], secret)
+	}
+}
+
+// clientCA is a CA Secret's certificates, and the pool built from them.
+type clientCA struct {
+	certs []*x509.Certificate
+	pool  *x509.CertPool
+}
+
+// LookupClientCA returns the CAs in ca.crt of the Secret namespace/name, for
+// plugin.ClientCertAuth; nil when the Secret is missing or holds none. Pools
+// are rebuilt only when the Secret changes.
+func (ctrl *Controller) LookupClientCA(namespace, name string) *x509.CertPool {
+	e := ctrl.clientCA(namespace + "/" + name)
+	if e == nil {
+		return nil
+	}
+	return e.pool
+}
+
+func (ctrl *Controller) clientCA(key string) *clientCA {
+	return ctrl.clientCAs.lookup(&ctrl.watchedSecrets, key)
+}
+
+// parseClientCA builds the pool of the certificates in ca.crt of a client CA
+// Secret (secretCache.parse).
+func parseClientCA(key string, s *v1.Secret) *clientCA {
+	var e clientCA
+	rest := s.Data["ca.crt"]
+	for {
+		var b *pem.Block
+		b, rest = pem.Decode(rest)
+		if b == nil {
+			break
+		}
+		if b.Type != "CERTIFICATE" {
+			continue
+		}
+		crt, err := x509.ParseCertificate(b.Bytes)
+		if err != nil {
+			continue
+		}
+		e.certs = append(e.certs, crt)
+	}
+	if len(e.certs) == 0 {
+		slog.Error("no certificate in ca.crt of client ca secret, rejecting client certificates", "secret", key)
+		return nil
+	}
+	e.pool = x509.NewCertPool()
+	for _, crt := range e.certs {
+		e.pool.AddCert(crt)
+	}
+	slog.Debug("loaded client ca", "secret", key, "certs", len(e.certs))
+	return &e
+}
+
+// ClientAuthConfig makes base request a client certificate on the hosts whose
+// Ingresses verify one, advertising their CAs, resolved per handshake (SNI)
+// like the edge CA in trust.Manager.ServerTLSConfig, which it composes with.
+// It only requests: a certificate missing or not chaining never fails the
+// handshake, plugin.ClientCertAuth decides per request. Other hosts keep what
+// base (or its GetConfigForClient) asks for, so browsers aren't prompted there.
+func (ctrl *Controller) ClientAuthConfig(base *tls.Config) *tls.Config {
+	next := base.GetConfigForClient
+	base.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		var c *tls.Config
+		if next != nil {
+			var err error
+			if c, err = next(hello); err != nil {
+				return nil, err
+			}
+		}
+		secrets := ctrl.routes.Load().clientCAs.lookup(hello.ServerName)
+		if len(secrets) == 0 {
+			return c, nil
+		}
+		if c == nil {
+			c = base.Clone()
+		}
+		c.ClientAuth = max(c.ClientAuth, tls.RequestClientCert)
+		c.ClientCAs = ctrl.clientCAPool(secrets)
+		return c, nil
+	}
+	return base
+}
+
+// lookup returns the CA Secrets of the host a TLS client names, on its exact
+// host, else on the wildcard host covering it, else on host-less rules, which
+// serve any host the others don't (and clients sending no SNI).
+func (hosts clientCAHosts) lookup(serverName string) []string {
+	if len(hosts) == 0 {
+		return nil
+	}
+	host := strings.TrimSuffix(strings.ToLower(serverName), ".")
+	if secrets, ok := hosts[host]; ok {
+		return secrets
+	}
+	if suffix := wildcardSuffix(host); suffix != "" {
+		if secrets, ok := hosts["*"+suffix]; ok {
+			return secrets
+		}
+	}
+	return hosts[""]
+}
+
+// clientCAPool returns the CAs to advertise for secrets, or nil (any
+// certificate) when one of them takes any.
+func (ctrl *Controller) clientCAPool(secrets []string) *x509.CertPool {
+	if slices.Contains(secrets, "") {
+		return nil
+	}
+	if len(secrets) == 1 {
+		if e := ctrl.clientCA(secrets[0]); e != nil {
+			return e.pool
+		}
+		return nil
+	}
+	pool := x509.NewCertPool()
+	for _, key := range secrets {
+		if e := ctrl.clientCA(key); e != nil {
+			for _, crt := range e.certs {
+				pool.AddCert(crt)
+			}
+		}
+	}
+	return pool
+}
@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/moonrhythm/parapet-ingress-controller/proxy"
+)
+
+func TestClientAuthConfig(t *testing.T) {
+	caPEM, _ := selfSignedCertPEM(t, "client-ca")
+	otherPEM, _ := selfSignedCertPEM(t, "other-ca")
+
+	ctrl := New("", proxy.New())
+	ctrl.watchedServices.Store("default/web", clusterIPService("default", "web", 80, 8080))
+	ctrl.watchedSecrets.Store("default/client-ca", secretFixture("default", "client-ca", "1", map[string][]byte{"ca.crt": caPEM}))
+	gated := ingressToService("default", "gated", "secure.example.com", "/", "Prefix", "web", 80)
+	gated.Annotations = map[string]string{authTLSSecretAnnotation: "client-ca"}
+	wild := ingressToService("default", "wild", "*.example.net", "/", "Prefix", "web", 80)
+	wild.Annotations = map[string]string{authTLSVerifyClientAnnotation: "optional_no_ca"}
+	ctrl.watchedIngresses.Store("default/gated", gated)
+	ctrl.watchedIngresses.Store("default/wild", wild)
+	ctrl.watchedIngresses.Store("default/open", ingressToService("default", "open", "open.example.com", "/", "Prefix", "web", 80))
+	ctrl.reloadIngressDebounced()
+
+	base := ctrl.ClientAuthConfig(&tls.Config{MinVersion: tls.VersionTLS12})
+	config := func(serverName string) *tls.Config {
+		t.Helper()
+		c, err := base.GetConfigForClient(&tls.ClientHelloInfo{ServerName: serverName})
+		require.NoError(t, err)
+		return c
+	}
+
+	c := config("Secure.Example.com")
+	if assert.NotNil(t, c) {
+		assert.Equal(t, tls.RequestClientCert, c.ClientAuth, "requested, never verified in the handshake")
+		assert.True(t, c.ClientCAs.Equal(ctrl.LookupClientCA("default", "client-ca")))
+	}
+	c = config("a.example.net")
+	if assert.NotNil(t, c) {
+		assert.Equal(t, tls.RequestClientCert, c.ClientAuth)
+		assert.Nil(t, c.ClientCAs, "any certificate")
+	}
+	assert.Nil(t, config("open.example.com"), "no prompt on other hosts")
+	assert.Nil(t, config(""))
+
+	t.Run("rebuilt on a Secret change", func(t *testing.T) {
+		pool := ctrl.LookupClientCA("default", "client-ca")
+		assert.Same(t, pool, ctrl.LookupClientCA("default", "client-ca"))
+
+		ctrl.watchedSecrets.Store("default/client-ca", secretFixture("default", "client-ca", "2", map[string][]byte{"ca.crt": otherPEM}))
+		assert.NotSame(t, pool, ctrl.LookupClientCA("default", "client-ca"))
+		assert.True(t, config("secure.example.com").ClientCAs.Equal(ctrl.LookupClientCA("default", "client-ca")))
+
+		ctrl.watchedSecrets.Store("default/client-ca", secretFixture("default", "client-ca", "3", map[string][]byte{"ca.crt": []byte("junk")}))
+		assert.Nil(t, ctrl.LookupClientCA("default", "client-ca"))
+		ctrl.watchedSecrets.Delete("default/client-ca")
+		assert.Nil(t, ctrl.LookupClientCA("default", "client-ca"))
+	})
+
+	t.Run("host-less rule", func(t *testing.T) {
+		ctrl := New("", proxy.New())
+		ctrl.watchedServices.Store("default/web", clusterIPService("default", "web", 80, 8080))
+		ctrl.watchedSecrets.Store("default/client-ca", secretFixture("default", "client-ca", "1", map[string][]byte{"ca.crt": caPEM}))
+		hostless := ingressToService("default", "any", "", "/", "Prefix", "web", 80)
+		hostless.Annotations = map[string]string{authTLSSecretAnnotation: "client-ca"}
+		ctrl.watchedIngresses.Store("default/any", hostless)
+		ctrl.reloadIngressDebounced()
+
+		base := ctrl.ClientAuthConfig(&tls.Config{})
+		for _, serverName := range []string{"app.example.com", ""} {
+			c, err := base.GetConfigForClient(&tls.ClientHelloInfo{ServerName: serverName})
+			require.NoError(t, err)
+			if assert.NotNil(t, c, "requested on any host: %q", serverName) {
+				assert.Equal(t, tls.RequestClientCert, c.ClientAuth)
+				assert.True(t, c.ClientCAs.Equal(ctrl.LookupClientCA("default", "client-ca")))
+			}
+		}
+	})
+
+	t.Run("composes with another request", func(t *testing.T) {
+		edge := &tls.Config{ClientAuth: tls.RequestClientCert}
+		next := &tls.Config{}
+		next.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) { return edge.Clone(), nil }
+		next = ctrl.ClientAuthConfig(next)
+
+		c, err := next.GetConfigForClient(&tls.ClientHelloInfo{ServerName: "open.example.com"})
+		require.NoError(t, err)
+		assert.Equal(t, tls.RequestClientCert, c.ClientAuth, "the edge trust request is kept")
+	})
+}
@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/moonrhythm/parapet"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultBackend is the controller-wide fallback Service (DEFAULT_BACKEND): it
+// serves every request whose Host no Ingress rule — and no per-Ingress
+// spec.defaultBackend — covers, instead of the router's bare 404. The Service
+// must live in the watch scope (it is resolved from the watched Services like
+// any Ingress backend).
+type DefaultBackend struct {
+	Namespace string
+	Service   networking.IngressServiceBackend
+}
+
+// ParseDefaultBackend parses a DEFAULT_BACKEND spec, "<namespace>/<service>:<port>",
+// where port is a Service port number or name.
+func ParseDefaultBackend(spec string) (*DefaultBackend, error) {
+	spec = strings.TrimSpace(spec)
+	ns, rest, ok := strings.Cut(spec, "/")
+	if !ok || ns == "" {
+		return nil, fmt.Errorf("default backend %q: want <namespace>/<service>:<port>", spec)
+	}
+	name, port, ok := strings.Cut(rest, ":")
+	if !ok || name == "" || port == "" || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("default backend %q: want <namespace>/<service>:<port>", spec)
+	}
+
+	b := &DefaultBackend{Namespace: ns, Service: networking.IngressServiceBackend{Name: name}}
+	if n, err := strconv.Atoi(port); err == nil {
+		if n <= 0 || n > 65535 {
+			return nil, fmt.Errorf("default backend %q: port out of range", spec)
+		}
+		b.Service.Port.Number = int32(n)
+	} else {
+		b.Service.Port.Name = port
+	}
+	return b, nil
+}
+
+// defaultRoute is a per-Ingress spec.defaultBackend candidate for one route key,
+// remembered with the Ingress that declared it so a conflict between two
+// Ingresses resolves deterministically.
+type defaultRoute struct {
+	handler http.Handler
+	owner   string // namespace/name of the declaring Ingress
+}
+
+// ingressDefaultHosts returns the route hosts an Ingress's spec.defaultBackend
+// catches: the distinct (lowercased) hosts of its rules — a rule without http
+// paths included, since Kubernetes sends all of that host's traffic to the
+// default backend — plus "" (every host) when the Ingress has a host-less rule
+// or no rules at all.
+func ingressDefaultHosts(ing *networking.Ingress) []string {
+	var hosts []string
+	seen := make(map[string]struct{}, len(ing.Spec.Rules))
+	hostless := len(ing.Spec.Rules) == 0
+	for _, rule := range ing.Spec.Rules {
+		host := strings.ToLower(rule.Host)
+		if host == "" {
+			hostless = true
+			continue
+		}
+		if _, ok := seen[host]; ok {
+			continue
+		}
+		seen[host] = struct{}{}
+		hosts = append(hosts, host)
+	}
+	if hostless {
+		hosts = append(hosts, "")
+	}
+	return hosts
+}
+
+// addIngressDefaultBackend records ing's spec.defaultBackend, wrapped in the
+// Ingress's own chain h, as the catch-all candidate for each of its hosts. When
+// two Ingresses claim the same host the lexically smaller namespace/name wins,
+// so the outcome doesn't depend on the store's iteration order.
+func (ctrl *Controller) addIngressDefaultBackend(defaults map[string]defaultRoute, ing *networking.Ingress, h *parapet.Middlewares) {
+	handler, target, ok := ctrl.resolveBackend(ing, ing.Spec.DefaultBackend)
+	if !ok {
+		return
+	}
+	handler = h.ServeHandler(handler)
+
+	owner := ing.Namespace + "/" + ing.Name
+	for _, host := range ingressDefaultHosts(ing) {
+		src := host + "/"
+		if cur, ok := defaults[src]; ok {
+			keep := cur.owner
+			if owner < cur.owner {
+				keep = owner
+			}
+			slog.Warn("conflicting ingress spec.defaultBackend", "path", src, "ingress", owner, "other", cur.owner, "keep", keep)
+			if keep == cur.owner {
+				continue
+			}
+		}
+		defaults[src] = defaultRoute{handler: handler, owner: owner}
+		slog.Debug("registered path", "type", "default", "path", src, "target", target)
+	}
+}
+
+// registerDefaultBackends adds the catch-all routes once every rule path is
+// registered. Precedence, most specific first: a rule path always keeps its key
+// (a rule's "host/" beats the same host's spec.defaultBackend), then per-Ingress
+// spec.defaultBackend, then the controller-wide DefaultBackend on the host-less
+// "/" (which only catches hosts nothing else serves, since the mux matches a
+// host-specific pattern before a host-less one).
+func (ctrl *Controller) registerDefaultBackends(routes map[string]http.Handler, defaults map[string]defaultRoute) {
+	for src, d := range defaults {
+		if _, ok := routes[src]; ok {
+			continue
+		}
+		routes[src] = d.handler
+	}
+
+	if ctrl.DefaultBackend == nil {
+		return
+	}
+	if _, ok := routes["/"]; ok {
+		slog.Debug("controller default backend shadowed by a host-less route")
+		return
+	}
+
+	// Synthesized, annotation-less Ingress in the backend's namespace, so the
+	// fallback runs the same plugin chain, retry middleware and route.Table
+	// lookup as any Ingress backend (only the annotation-independent plugins,
+	// e.g. InjectStateIngress, have anything to do).
+	ing := &networking.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Namespace: ctrl.DefaultBackend.Namespace},
+		Spec: networking.IngressSpec{
+			DefaultBackend: &networking.IngressBackend{Service: &ctrl.DefaultBackend.Service},
+		},
+	}
+	handler, target, ok := ctrl.resolveBackend(ing, ing.Spec.DefaultBackend)
+	if !ok {
+		return
+	}
+	routes["/"] = ctrl.ingressChain(ing, routes).ServeHandler(handler)
+	slog.Debug("registered path", "type", "default", "path", "/", "target", target)
+}
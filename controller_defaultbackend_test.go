@@ -0,0 +1,197 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	networking "k8s.io/api/networking/v1"
+
+	"github.com/moonrhythm/parapet-ingress-controller/plugin"
+	"github.com/moonrhythm/parapet-ingress-controller/proxy"
+	"github.com/moonrhythm/parapet-ingress-controller/state"
+)
+
+// servedService routes a request for host+path through the live mux and
+// returns the Service name the matched backend handler stamped into the request
+// state ("" when nothing routed it). No endpoints are loaded, so the handler
+// answers 503 right after stamping — the upstream is never dialed.
+func servedService(t *testing.T, ctrl *Controller, host, path string) string {
+	t.Helper()
+	s := state.State{}
+	r := httptest.NewRequest(http.MethodGet, "http://"+host+path, nil)
+	r = r.WithContext(state.NewContext(r.Context(), s))
+	ctrl.ServeHandler(nil).ServeHTTP(httptest.NewRecorder(), r)
+	return s["serviceName"]
+}
+
+func withDefaultBackend(ing *networking.Ingress, svcName string, svcPort int) *networking.Ingress {
+	ing.Spec.DefaultBackend = &networking.IngressBackend{
+		Service: &networking.IngressServiceBackend{
+			Name: svcName,
+			Port: networking.ServiceBackendPort{Number: int32(svcPort)},
+		},
+	}
+	return ing
+}
+
+func TestParseDefaultBackend(t *testing.T) {
+	t.Parallel()
+
+	b, err := ParseDefaultBackend("infra/fallback:80")
+	require.NoError(t, err)
+	assert.Equal(t, "infra", b.Namespace)
+	assert.Equal(t, "fallback", b.Service.Name)
+	assert.EqualValues(t, 80, b.Service.Port.Number)
+	assert.Empty(t, b.Service.Port.Name)
+
+	b, err = ParseDefaultBackend("infra/fallback:http")
+	require.NoError(t, err)
+	assert.Equal(t, "http", b.Service.Port.Name)
+	assert.Zero(t, b.Service.Port.Number)
+
+	for _, spec := range []string{
+		"", "fallback:80", "/fallback:80", "infra/fallback", "infra/:80",
+		"infra/fallback:", "infra/a/b:80", "infra/fallback:0", "infra/fallback:70000",
+	} {
+		_, err := ParseDefaultBackend(spec)
+		assert.Error(t, err, "spec %q", spec)
+	}
+}
+
+func TestReloadIngressDefaultBackend(t *testing.T) {
+	t.Run("catches unmatched paths on the ingress's hosts only", func(t *testing.T) {
+		ctrl := New("", proxy.New())
+		ctrl.watchedServices.Store("default/web", clusterIPService("default", "web", 80, 8080))
+		ctrl.watchedServices.Store("default/fallback", clusterIPService("default", "fallback", 80, 8080))
+		ctrl.watchedIngresses.Store("default/ing", withDefaultBackend(
+			ingressToService("default", "ing", "example.com", "/api", networking.PathTypePrefix, "web", 80),
+			"fallback", 80))
+
+		ctrl.reloadIngressDebounced()
+
+		assert.Equal(t, "web", servedService(t, ctrl, "example.com", "/api/users"))
+		assert.Equal(t, "fallback", servedService(t, ctrl, "example.com", "/other"))
+		assert.Empty(t, servedService(t, ctrl, "other.com", "/other"), "another host is not caught")
+		assert.True(t, ctrl.IsKnownHost("example.com"))
+	})
+
+	t.Run("a rule path wins over the default backend for the same key", func(t *testing.T) {
+		ctrl := New("", proxy.New())
+		ctrl.watchedServices.Store("default/web", clusterIPService("default", "web", 80, 8080))
+		ctrl.watchedServices.Store("default/fallback", clusterIPService("default", "fallback", 80, 8080))
+		// a different ingress's default claims the host root the rule also registers
+		ctrl.watchedIngresses.Store("default/rule",
+			ingressToService("default", "rule", "example.com", "/", networking.PathTypePrefix, "web", 80))
+		ctrl.watchedIngresses.Store("default/dflt", withDefaultBackend(
+			ingressToService("default", "dflt", "example.com", "/x", networking.PathTypeExact, "web", 80),
+			"fallback", 80))
+
+		ctrl.reloadIngressDebounced()
+
+		assert.Equal(t, "web", servedService(t, ctrl, "example.com", "/anything"))
+	})
+
+	t.Run("ingress without rules catches every host", func(t *testing.T) {
+		ctrl := New("", proxy.New())
+		ctrl.watchedServices.Store("default/web", clusterIPService("default", "web", 80, 8080))
+		ctrl.watchedServices.Store("default/fallback", clusterIPService("default", "fallback", 80, 8080))
+		ctrl.watchedIngresses.Store("default/ing",
+			ingressToService("default", "ing", "example.com", "/", networking.PathTypePrefix, "web", 80))
+		only := withDefaultBackend(ingressToService("default", "only", "", "/", networking.PathTypePrefix, "web", 80), "fallback", 80)
+		only.Spec.Rules = nil
+		ctrl.watchedIngresses.Store("default/only", only)
+
+		ctrl.reloadIngressDebounced()
+
+		assert.Equal(t, "web", servedService(t, ctrl, "example.com", "/"))
+		assert.Equal(t, "fallback", servedService(t, ctrl, "unknown.com", "/"))
+		assert.False(t, ctrl.IsKnownHost("unknown.com"), "catch-all doesn't widen the metric host set")
+	})
+
+	t.Run("conflicting defaults resolve by ingress name", func(t *testing.T) {
+		ctrl := New("", proxy.New())
+		for _, name := range []string{"web", "a-fallback", "b-fallback"} {
+			ctrl.watchedServices.Store("default/"+name, clusterIPService("default", name, 80, 8080))
+		}
+		ctrl.watchedIngresses.Store("default/b", withDefaultBackend(
+			ingressToService("default", "b", "example.com", "/b", networking.PathTypeExact, "web", 80),
+			"b-fallback", 80))
+		ctrl.watchedIngresses.Store("default/a", withDefaultBackend(
+			ingressToService("default", "a", "example.com", "/a", networking.PathTypeExact, "web", 80),
+			"a-fallback", 80))
+
+		for i := 0; i < 5; i++ {
+			ctrl.reloadIngressDebounced()
+			assert.Equal(t, "a-fallback", servedService(t, ctrl, "example.com", "/other"))
+		}
+	})
+
+	t.Run("unresolvable default backend registers nothing", func(t *testing.T) {
+		ctrl := New("", proxy.New())
+		ctrl.watchedServices.Store("default/web", clusterIPService("default", "web", 80, 8080))
+		ctrl.watchedIngresses.Store("default/ing", withDefaultBackend(
+			ingressToService("default", "ing", "example.com", "/api", networking.PathTypeExact, "web", 80),
+			"missing", 80))
+
+		ctrl.reloadIngressDebounced()
+
+		assert.Equal(t, "web", servedService(t, ctrl, "example.com", "/api"))
+		assert.Empty(t, matchedPattern(t, ctrl.currentMux(), "example.com", "/other"))
+	})
+}
+
+func TestReloadIngressControllerDefaultBackend(t *testing.T) {
+	newCtrl := func() *Controller {
+		ctrl := New("", proxy.New())
+		ctrl.DefaultBackend = &DefaultBackend{
+			Namespace: "infra",
+			Service:   networking.IngressServiceBackend{Name: "fallback", Port: networking.ServiceBackendPort{Number: 80}},
+		}
+		ctrl.watchedServices.Store("default/web", clusterIPService("default", "web", 80, 8080))
+		ctrl.watchedServices.Store("default/dflt", clusterIPService("default", "dflt", 80, 8080))
+		ctrl.watchedServices.Store("infra/fallback", clusterIPService("infra", "fallback", 80, 8080))
+		ctrl.watchedIngresses.Store("default/ing",
+			ingressToService("default", "ing", "example.com", "/api", networking.PathTypePrefix, "web", 80))
+		return ctrl
+	}
+
+	t.Run("serves hosts no rule serves", func(t *testing.T) {
+		ctrl := newCtrl()
+		ctrl.reloadIngressDebounced()
+
+		assert.Equal(t, "web", servedService(t, ctrl, "example.com", "/api"))
+		assert.Equal(t, "fallback", servedService(t, ctrl, "unknown.com", "/"))
+		assert.Equal(t, "fallback", servedService(t, ctrl, "example.com", "/other"),
+			"an unmatched path on a served host falls through to the host-less fallback")
+	})
+
+	t.Run("runs the plugin chain", func(t *testing.T) {
+		ctrl := newCtrl()
+		var ran []string
+		ctrl.Use(func(ctx plugin.Context) { ran = append(ran, ctx.Ingress.Namespace) })
+		ctrl.reloadIngressDebounced()
+
+		assert.Contains(t, ran, "infra")
+	})
+
+	t.Run("shadowed by an ingress's host-less default", func(t *testing.T) {
+		ctrl := newCtrl()
+		only := withDefaultBackend(ingressToService("default", "only", "", "/", networking.PathTypePrefix, "web", 80), "dflt", 80)
+		only.Spec.Rules = nil
+		ctrl.watchedIngresses.Store("default/only", only)
+		ctrl.reloadIngressDebounced()
+
+		assert.Equal(t, "dflt", servedService(t, ctrl, "unknown.com", "/"))
+	})
+
+	t.Run("service outside the watched set registers nothing", func(t *testing.T) {
+		ctrl := newCtrl()
+		ctrl.watchedServices.Delete("infra/fallback")
+		ctrl.reloadIngressDebounced()
+
+		assert.Empty(t, matchedPattern(t, ctrl.currentMux(), "unknown.com", "/"))
+	})
+}
@@ -0,0 +1,1090 @@
+package controller
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/moonrhythm/parapet/pkg/header"
+	v1 "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/moonrhythm/parapet-ingress-controller/k8s"
+)
+
+// DefaultGatewayControllerName is the controllerName a GatewayClass names to
+// be implemented by this controller, unless GatewayConfig overrides it.
+const DefaultGatewayControllerName = "parapet.moonrhythm.io/gateway-controller"
+
+// GatewayConfig configures the Gateway API support: the Gateways of every
+// GatewayClass naming ControllerName, and the HTTPRoutes attached to them, are
+// compiled into the same routing table (and per-route plugin chain) as the
+// Ingresses. Off unless Enabled: no watch, no status.
+type GatewayConfig struct {
+	Enabled        bool
+	ControllerName string
+}
+
+func (c GatewayConfig) controllerName() gatewayv1.GatewayController {
+	if c.ControllerName == "" {
+		return DefaultGatewayControllerName
+	}
+	return gatewayv1.GatewayController(c.ControllerName)
+}
+
+func (ctrl *Controller) preloadGatewayResources(ctx context.Context) {
+	preloadList(ctx, "gatewayclasses", func() error {
+		classes, err := k8s.GetGatewayClasses(ctx)
+		if err != nil {
+			return err
+		}
+		for i := range classes {
+			ctrl.watchedGatewayClasses.Store(classes[i].Namespace+"/"+classes[i].Name, &classes[i])
+		}
+		return nil
+	})
+	preloadList(ctx, "gateways", func() error {
+		gateways, err := k8s.GetGateways(ctx, ctrl.watchNamespace)
+		if err != nil {
+			return err
+		}
+		for i := range gateways {
+			ctrl.watchedGateways.Store(gateways[i].Namespace+"/"+gateways[i].Name, &gateways[i])
+		}
+		return nil
+	})
+	preloadList(ctx, "httproutes", func() error {
+		routes, err := k8s.GetHTTPRoutes(ctx, ctrl.watchNamespace)
+		if err != nil {
+			return err
+		}
+		for i := range routes {
+			ctrl.watchedHTTPRoutes.Store(routes[i].Namespace+"/"+routes[i].Name, &routes[i])
+		}
+		return nil
+	})
+}
+
+// watchGatewayResources watches the Gateway API kinds; any change recompiles
+// the routes (and, through the ingress reload, the listener certificates).
+func (ctrl *Controller) watchGatewayResources(ctx context.Context) {
+	// GatewayClass is cluster-scoped: the watch namespace doesn't apply
+	go watchResource(ctx, "", "gatewayclasses",
+		func(ctx context.Context, _ string) (watch.Interface, error) { return k8s.WatchGatewayClasses(ctx) },
+		func(ctx context.Context, _ string) ([]gatewayv1.GatewayClass, error) {
+			return k8s.GetGatewayClasses(ctx)
+		},
+		&ctrl.watchedGatewayClasses,
+		func(_ *gatewayv1.GatewayClass) { ctrl.reloadIngress() },
+		func(_ *gatewayv1.GatewayClass) { ctrl.reloadIngress() },
+		ctrl.reloadIngress,
+	)
+	go watchResource(ctx, ctrl.watchNamespace, "gateways", k8s.WatchGateways, k8s.GetGateways,
+		&ctrl.watchedGateways,
+		func(_ *gatewayv1.Gateway) { ctrl.reloadIngress() },
+		func(_ *gatewayv1.Gateway) { ctrl.reloadIngress() },
+		ctrl.reloadIngress,
+	)
+	go watchResource(ctx, ctrl.watchNamespace, "httproutes", k8s.WatchHTTPRoutes, k8s.GetHTTPRoutes,
+		&ctrl.watchedHTTPRoutes,
+		func(_ *gatewayv1.HTTPRoute) { ctrl.reloadIngress() },
+		func(_ *gatewayv1.HTTPRoute) { ctrl.reloadIngress() },
+		ctrl.reloadIngress,
+	)
+}
+
+// gatewayStatus is the status the last compile computed, published by the
+// status leader (publishGatewayStatus).
+type gatewayStatus struct {
+	classes  map[string][]metav1.Condition            // GatewayClass name
+	gateways map[string]gatewayv1.GatewayStatus       // namespace/name; addresses are added on publish
+	routes   map[string][]gatewayv1.RouteParentStatus // namespace/name; this controller's parents only
+}
+
+// gatewayState is a Gateway of one of this controller's classes, as compiled.
+type gatewayState struct {
+	gw        *gatewayv1.Gateway
+	listeners []*gatewayListener
+}
+
+type gatewayListener struct {
+	listener   gatewayv1.Listener
+	status     gatewayv1.ListenerStatus
+	attachable bool // routes may attach
+}
+
+// gatewayMatch is one HTTPRoute match compiled for dispatch. Every match of a
+// host is tried in Gateway API precedence order (see compareGatewayMatches);
+// the first that matches the request serves it.
+type gatewayMatch struct {
+	pathType  gatewayv1.PathMatchType
+	path      string // Exact: the path; PathPrefix: the prefix without trailing slash
+	pathRegex *regexp.Regexp
+	method    string
+	headers   []valueMatch
+	query     []valueMatch
+
+	created     metav1.Time
+	owner       string // namespace/name of the HTTPRoute
+	rule, index int
+	handler     http.Handler
+}
+
+func (m *gatewayMatch) matches(r *http.Request, query url.Values) bool {
+	p := r.URL.Path
+	switch m.pathType {
+	case gatewayv1.PathMatchExact:
+		if p != m.path {
+			return false
+		}
+	case gatewayv1.PathMatchPathPrefix:
+		if m.path != "" && p != m.path && !strings.HasPrefix(p, m.path+"/") {
+			return false
+		}
+	case gatewayv1.PathMatchRegularExpression:
+		if !m.pathRegex.MatchString(p) {
+			return false
+		}
+	}
+	if m.method != "" && r.Method != m.method {
+		return false
+	}
+	return matchHeaders(r.Header, m.headers) && matchQuery(query, m.query)
+}
+
+// keys returns the mux keys a request this match can serve lands on for host.
+// A regular expression can match any path, so it takes the host's catch-all.
+func (m *gatewayMatch) keys(host string) []string {
+	switch m.pathType {
+	case gatewayv1.PathMatchExact:
+		if strings.HasSuffix(m.path, "/") {
+			return []string{host + m.path + "{$}"}
+		}
+		return []string{host + m.path}
+	case gatewayv1.PathMatchPathPrefix:
+		if m.path == "" {
+			return []string{host + "/"}
+		}
+		return []string{host + m.path, host + m.path + "/"}
+	default:
+		return []string{host + "/"}
+	}
+}
+
+// compareGatewayMatches orders matches by the Gateway API precedence: Exact
+// path, then the longest prefix (a regular expression last), then a method
+// match, then the most header matches, then the most query matches; ties go to
+// the oldest HTTPRoute, then namespace/name, then rule and match order.
+func compareGatewayMatches(a, b *gatewayMatch) int {
+	rank := func(m *gatewayMatch) int {
+		switch m.pathType {
+		case gatewayv1.PathMatchExact:
+			return 2
+		case gatewayv1.PathMatchPathPrefix:
+			return 1
+		}
+		return 0
+	}
+	hasMethod := func(m *gatewayMatch) int {
+		if m.method != "" {
+			return 1
+		}
+		return 0
+	}
+	return cmp.Or(
+		cmp.Compare(rank(b), rank(a)),
+		cmp.Compare(len(b.path), len(a.path)),
+		cmp.Compare(hasMethod(b), hasMethod(a)),
+		cmp.Compare(len(b.headers), len(a.headers)),
+		cmp.Compare(len(b.query), len(a.query)),
+		a.created.Compare(b.created.Time),
+		cmp.Compare(a.owner, b.owner),
+		cmp.Compare(a.rule, b.rule),
+		cmp.Compare(a.index, b.index),
+	)
+}
+
+// gatewayMatches dispatches to the first match of a host (sorted by
+// compareGatewayMatches) that matches the request; none is a 404. Every key of
+// the host shares it, so a request falls through to a shorter prefix whenever
+// the matches on its longest key don't take it.
+type gatewayMatches []*gatewayMatch
+
+func (ms gatewayMatches) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var query url.Values
+	for _, m := range ms {
+		if len(m.query) > 0 && query == nil {
+			query = r.URL.Query()
+		}
+		if m.matches(r, query) {
+			m.handler.ServeHTTP(w, r)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// compileGateways compiles the HTTPRoutes attached to this controller's
+// Gateways into routes, after the Ingresses: a key an Ingress already serves
+// stays the Ingress's (logged). It records the resulting status for the
+// publisher.
+func (ctrl *Controller) compileGateways(routes map[string]http.Handler) {
+	st := &gatewayStatus{
+		classes:  map[string][]metav1.Condition{},
+		gateways: map[string]gatewayv1.GatewayStatus{},
+		routes:   map[string][]gatewayv1.RouteParentStatus{},
+	}
+
+	classes := ctrl.gatewayClasses()
+	for name, gc := range classes {
+		st.classes[name] = []metav1.Condition{
+			gatewayCondition(gatewayv1.GatewayClassConditionStatusAccepted, true, gatewayv1.GatewayClassReasonAccepted, "", gc.Generation),
+		}
+	}
+
+	gateways := map[string]*gatewayState{}
+	ctrl.watchedGateways.Range(func(_, value any) bool {
+		gw := value.(*gatewayv1.Gateway)
+		if _, ok := classes[string(gw.Spec.GatewayClassName)]; ok {
+			gateways[gw.Namespace+"/"+gw.Name] = ctrl.compileGateway(gw)
+		}
+		return true
+	})
+
+	var httpRoutes []*gatewayv1.HTTPRoute
+	ctrl.watchedHTTPRoutes.Range(func(_, value any) bool {
+		httpRoutes = append(httpRoutes, value.(*gatewayv1.HTTPRoute))
+		return true
+	})
+	slices.SortFunc(httpRoutes, func(a, b *gatewayv1.HTTPRoute) int {
+		return cmp.Or(
+			a.CreationTimestamp.Compare(b.CreationTimestamp.Time),
+			cmp.Compare(a.Namespace+"/"+a.Name, b.Namespace+"/"+b.Name),
+		)
+	})
+
+	hosts := map[string]gatewayMatches{}
+	var attached int
+	for _, route := range httpRoutes {
+		parents := ctrl.compileHTTPRoute(route, gateways, hosts, routes)
+		if len(parents) > 0 {
+			st.routes[route.Namespace+"/"+route.Name] = parents
+			attached++
+		}
+	}
+
+	for key, gs := range gateways {
+		st.gateways[key] = gs.status()
+	}
+
+	for host, matches := range hosts {
+		slices.SortFunc(matches, compareGatewayMatches)
+		keys := map[string]struct{}{}
+		for _, m := range matches {
+			for _, key := range m.keys(host) {
+				keys[key] = struct{}{}
+			}
+		}
+		for key := range keys {
+			if _, ok := routes[key]; ok {
+				slog.Warn("httproute path already served by an ingress, skipping", "path", key)
+				continue
+			}
+			routes[key] = matches
+			slog.Debug("registered path", "type", "httproute", "path", key)
+		}
+	}
+
+	ctrl.gatewayStatus.Store(st)
+	slog.Info("reloaded gateway api", "classes", len(classes), "gateways", len(gateways), "httproutes", attached)
+}
+
+// gatewayClasses returns the GatewayClasses naming this controller by name.
+func (ctrl *Controller) gatewayClasses() map[string]*gatewayv1.GatewayClass {
+	classes := map[string]*gatewayv1.GatewayClass{}
+	name := ctrl.GatewayConfig.controllerName()
+	ctrl.watchedGatewayClasses.Range(func(_, value any) bool {
+		gc := value.(*gatewayv1.GatewayClass)
+		if gc.Spec.ControllerName == name {
+			classes[gc.Name] = gc
+		}
+		return true
+	})
+	return classes
+}
+
+// compileGateway validates gw's listeners. Only HTTP and HTTPS (terminated
+// here) listeners accept routes; the listener port is informational, every
+// listener is served on the controller's own HTTP and HTTPS ports.
+func (ctrl *Controller) compileGateway(gw *gatewayv1.Gateway) *gatewayState {
+	gs := &gatewayState{gw: gw}
+	gen := gw.Generation
+	for _, l := range gw.Spec.Listeners {
+		accepted := gatewayCondition(gatewayv1.ListenerConditionAccepted, true, gatewayv1.ListenerReasonAccepted, "", gen)
+		resolved := gatewayCondition(gatewayv1.ListenerConditionResolvedRefs, true, gatewayv1.ListenerReasonResolvedRefs, "", gen)
+
+		kinds, kindsOK := listenerKinds(l)
+		if !kindsOK {
+			resolved = gatewayCondition(gatewayv1.ListenerConditionResolvedRefs, false, gatewayv1.ListenerReasonInvalidRouteKinds, "only HTTPRoute is supported", gen)
+		}
+		switch l.Protocol {
+		case gatewayv1.HTTPProtocolType:
+		case gatewayv1.HTTPSProtocolType:
+			if l.TLS != nil && l.TLS.Mode != nil && *l.TLS.Mode == gatewayv1.TLSModePassthrough {
+				accepted = gatewayCondition(gatewayv1.ListenerConditionAccepted, false, gatewayv1.ListenerReasonUnsupportedValue, "tls passthrough is not supported", gen)
+			} else if reason, msg := ctrl.listenerCertificates(gw, l, nil); reason != "" {
+				resolved = gatewayCondition(gatewayv1.ListenerConditionResolvedRefs, false, reason, msg, gen)
+			}
+		default:
+			accepted = gatewayCondition(gatewayv1.ListenerConditionAccepted, false, gatewayv1.ListenerReasonUnsupportedProtocol, fmt.Sprintf("protocol %s is not supported", l.Protocol), gen)
+			kinds = []gatewayv1.RouteGroupKind{}
+		}
+
+		ok := accepted.Status == metav1.ConditionTrue
+		programmed := gatewayCondition(gatewayv1.ListenerConditionProgrammed, true, gatewayv1.ListenerReasonProgrammed, "", gen)
+		if !ok || resolved.Status != metav1.ConditionTrue {
+			programmed = gatewayCondition(gatewayv1.ListenerConditionProgrammed, false, gatewayv1.ListenerReasonInvalid, "", gen)
+		}
+		gs.listeners = append(gs.listeners, &gatewayListener{
+			listener: l,
+			status: gatewayv1.ListenerStatus{
+				Name:           l.Name,
+				SupportedKinds: kinds,
+				Conditions:     []metav1.Condition{accepted, programmed, resolved},
+			},
+			attachable: ok && len(kinds) > 0,
+		})
+	}
+	return gs
+}
+
+// listenerKinds returns the route kinds an HTTP(S) listener accepts: HTTPRoute,
+// unless allowedRoutes.kinds leaves it out. ok=false when allowedRoutes.kinds
+// names a kind this controller doesn't serve.
+func listenerKinds(l gatewayv1.Listener) (kinds []gatewayv1.RouteGroupKind, ok bool) {
+	group := gatewayv1.Group(gatewayv1.GroupName)
+	httpRoute := gatewayv1.RouteGroupKind{Group: &group, Kind: "HTTPRoute"}
+	if l.AllowedRoutes == nil || len(l.AllowedRoutes.Kinds) == 0 {
+		return []gatewayv1.RouteGroupKind{httpRoute}, true
+	}
+	kinds = []gatewayv1.RouteGroupKind{}
+	ok = true
+	for _, k := range l.AllowedRoutes.Kinds {
+		if (k.Group == nil || *k.Group == group) && k.Kind == "HTTPRoute" {
+			kinds = []gatewayv1.RouteGroupKind{httpRoute}
+		} else {
+			ok = false
+		}
+	}
+	return kinds, ok
+}
+
+// listenerCertificates checks an HTTPS listener's certificateRefs, adding the
+// "namespace/name" of each usable Secret to secrets when it isn't nil. Only
+// Secrets in the Gateway's own namespace may be referenced (ReferenceGrant is
+// not supported). A non-empty reason is the listener's ResolvedRefs failure.
+func (ctrl *Controller) listenerCertificates(gw *gatewayv1.Gateway, l gatewayv1.Listener, secrets map[string]struct{}) (reason gatewayv1.ListenerConditionReason, msg string) {
+	if l.TLS == nil || len(l.TLS.CertificateRefs) == 0 {
+		return gatewayv1.ListenerReasonInvalidCertificateRef, "no certificateRefs"
+	}
+	for _, ref := range l.TLS.CertificateRefs {
+		if ref.Group != nil && *ref.Group != "" || ref.Kind != nil && *ref.Kind != "Secret" {
+			reason, msg = gatewayv1.ListenerReasonInvalidCertificateRef, fmt.Sprintf("certificateRef %s is not a Secret", ref.Name)
+			continue
+		}
+		if ref.Namespace != nil && string(*ref.Namespace) != gw.Namespace {
+			reason, msg = gatewayv1.ListenerReasonRefNotPermitted, fmt.Sprintf("certificateRef %s/%s is in another namespace", *ref.Namespace, ref.Name)
+			continue
+		}
+		key := gw.Namespace + "/" + string(ref.Name)
+		v, ok := ctrl.watchedSecrets.Load(key)
+		if !ok {
+			reason, msg = gatewayv1.ListenerReasonInvalidCertificateRef, fmt.Sprintf("secret %s not found", key)
+			continue
+		}
+		s := v.(*v1.Secret)
+		if _, err := tls.X509KeyPair(s.Data["tls.crt"], s.Data["tls.key"]); err != nil {
+			reason, msg = gatewayv1.ListenerReasonInvalidCertificateRef, fmt.Sprintf("secret %s: %v", key, err)
+			continue
+		}
+		if secrets != nil {
+			secrets[key] = struct{}{}
+		}
+	}
+	return reason, msg
+}
+
+// addGatewaySecrets adds the certificates of the HTTPS listeners of this
+// controller's Gateways to the secrets the cert table is built from.
+func (ctrl *Controller) addGatewaySecrets(secrets map[string]struct{}) {
+	classes := ctrl.gatewayClasses()
+	ctrl.watchedGateways.Range(func(_, value any) bool {
+		gw := value.(*gatewayv1.Gateway)
+		if _, ok := classes[string(gw.Spec.GatewayClassName)]; !ok {
+			return true
+		}
+		for _, l := range gw.Spec.Listeners {
+			if l.Protocol == gatewayv1.HTTPSProtocolType {
+				ctrl.listenerCertificates(gw, l, secrets)
+			}
+		}
+		return true
+	})
+}
+
+func (gs *gatewayState) status() gatewayv1.GatewayStatus {
+	gen := gs.gw.Generation
+	var st gatewayv1.GatewayStatus
+	var valid, programmed int
+	for _, l := range gs.listeners {
+		st.Listeners = append(st.Listeners, l.status)
+		if l.attachable {
+			valid++
+		}
+		if meta.IsStatusConditionTrue(l.status.Conditions, string(gatewayv1.ListenerConditionProgrammed)) {
+			programmed++
+		}
+	}
+
+	accepted := gatewayCondition(gatewayv1.GatewayConditionAccepted, true, gatewayv1.GatewayReasonAccepted, "", gen)
+	if valid < len(gs.listeners) {
+		accepted = gatewayCondition(gatewayv1.GatewayConditionAccepted, valid > 0, gatewayv1.GatewayReasonListenersNotValid, "", gen)
+	}
+	prog := gatewayCondition(gatewayv1.GatewayConditionProgrammed, programmed > 0, gatewayv1.GatewayReasonProgrammed, "", gen)
+	if programmed == 0 {
+		prog.Reason = string(gatewayv1.GatewayReasonInvalid)
+	}
+	st.Conditions = []metav1.Condition{accepted, prog}
+	return st
+}
+
+// routeParent is one of an HTTPRoute's parentRefs that names a Gateway of this
+// controller.
+type routeParent struct {
+	status    gatewayv1.RouteParentStatus
+	listeners []*gatewayListener
+	hosts     []string
+}
+
+// attachHTTPRoute resolves route's parentRefs against this controller's
+// Gateways; parentRefs naming anything else are left to their controllers.
+func (ctrl *Controller) attachHTTPRoute(route *gatewayv1.HTTPRoute, gateways map[string]*gatewayState) []*routeParent {
+	var parents []*routeParent
+	for _, ref := range route.Spec.ParentRefs {
+		if ref.Group != nil && *ref.Group != gatewayv1.GroupName || ref.Kind != nil && *ref.Kind != "Gateway" {
+			continue
+		}
+		ns := route.Namespace
+		if ref.Namespace != nil {
+			ns = string(*ref.Namespace)
+		}
+		gs, ok := gateways[ns+"/"+string(ref.Name)]
+		if !ok {
+			continue
+		}
+
+		p := &routeParent{status: gatewayv1.RouteParentStatus{
+			ParentRef:      ref,
+			ControllerName: ctrl.GatewayConfig.controllerName(),
+		}}
+		parents = append(parents, p)
+		reject := func(reason gatewayv1.RouteConditionReason, msg string) {
+			p.status.Conditions = []metav1.Condition{gatewayCondition(gatewayv1.RouteConditionAccepted, false, reason, msg, route.Generation)}
+		}
+
+		var matched, allowed int
+		for _, l := range gs.listeners {
+			if ref.SectionName != nil && *ref.SectionName != l.listener.Name || ref.Port != nil && *ref.Port != l.listener.Port {
+				continue
+			}
+			matched++
+			if !l.attachable || !listenerAllows(gs.gw, l.listener, route.Namespace) {
+				continue
+			}
+			allowed++
+			hosts, ok := intersectHostnames(l.listener.Hostname, route.Spec.Hostnames)
+			if !ok {
+				continue
+			}
+			p.listeners = append(p.listeners, l)
+			for _, h := range hosts {
+				if !slices.Contains(p.hosts, h) {
+					p.hosts = append(p.hosts, h)
+				}
+			}
+		}
+		switch {
+		case matched == 0:
+			reject(gatewayv1.RouteReasonNoMatchingParent, "no listener matches the parentRef")
+		case allowed == 0:
+			reject(gatewayv1.RouteReasonNotAllowedByListeners, "")
+		case len(p.listeners) == 0:
+			reject(gatewayv1.RouteReasonNoMatchingListenerHostname, "")
+		default:
+			p.status.Conditions = []metav1.Condition{gatewayCondition(gatewayv1.RouteConditionAccepted, true, gatewayv1.RouteReasonAccepted, "", route.Generation)}
+		}
+	}
+	return parents
+}
+
+// listenerAllows reports whether l admits routes from namespace. Namespace
+// selectors are not supported: such a listener admits no route.
+func listenerAllows(gw *gatewayv1.Gateway, l gatewayv1.Listener, namespace string) bool {
+	from := gatewayv1.NamespacesFromSame
+	if l.AllowedRoutes != nil && l.AllowedRoutes.Namespaces != nil && l.AllowedRoutes.Namespaces.From != nil {
+		from = *l.AllowedRoutes.Namespaces.From
+	}
+	switch from {
+	case gatewayv1.NamespacesFromAll:
+		return true
+	case gatewayv1.NamespacesFromSame:
+		return namespace == gw.Namespace
+	default:
+		return false
+	}
+}
+
+// intersectHostnames returns the hosts a route serves through a listener: the
+// route's hostnames the listener's covers (or the listener's, when a route
+// wildcard covers it). An empty list on either side matches anything; both
+// empty serve every host (""). ok=false when they don't intersect.
+func intersectHostnames(listener *gatewayv1.Hostname, route []gatewayv1.Hostname) (hosts []string, ok bool) {
+	if len(route) == 0 {
+		if listener == nil {
+			return []string{""}, true
+		}
+		return []string{strings.ToLower(string(*listener))}, true
+	}
+	for _, h := range route {
+		r := strings.ToLower(string(h))
+		if listener == nil {
+			hosts = append(hosts, r)
+			continue
+		}
+		l := strings.ToLower(string(*listener))
+		switch {
+		case r == l, hostnameCovers(l, r):
+			hosts = append(hosts, r)
+		case hostnameCovers(r, l):
+			hosts = append(hosts, l)
+		}
+	}
+	return hosts, len(hosts) > 0
+}
+
+// hostnameCovers reports whether the wildcard pattern ("*.example.com") covers
+// host, which is then a subdomain (of any depth) of its suffix.
+func hostnameCovers(pattern, host string) bool {
+	return strings.HasPrefix(pattern, "*.") && len(host) > len(pattern)-1 && strings.HasSuffix(host, pattern[1:])
+}
+
+// compileHTTPRoute adds the matches of route to hosts when one of its parents
+// accepts it, and returns its status on this controller's parents. Its
+// annotations configure a plugin chain exactly as an Ingress's do.
+func (ctrl *Controller) compileHTTPRoute(route *gatewayv1.HTTPRoute, gateways map[string]*gatewayState, hosts map[string]gatewayMatches, routes map[string]http.Handler) []gatewayv1.RouteParentStatus {
+	parents := ctrl.attachHTTPRoute(route, gateways)
+	if len(parents) == 0 {
+		return nil
+	}
+	owner := route.Namespace + "/" + route.Name
+
+	var routeHosts []string
+	for _, p := range parents {
+		for _, h := range p.hosts {
+			if !slices.Contains(routeHosts, h) {
+				routeHosts = append(routeHosts, h)
+			}
+		}
+	}
+
+	var (
+		rules  [][]*gatewayMatch
+		reason gatewayv1.RouteConditionReason
+		msg    string
+	)
+	if len(routeHosts) > 0 {
+		rules, reason, msg = compileHTTPRouteRules(route)
+		if rules == nil {
+			slog.Error("unsupported httproute", "httproute", owner, "reason", reason, "message", msg)
+		}
+	}
+
+	resolved := gatewayCondition(gatewayv1.RouteConditionResolvedRefs, true, gatewayv1.RouteReasonResolvedRefs, "", route.Generation)
+	if rules != nil {
+		ing := &networking.Ingress{ObjectMeta: route.ObjectMeta}
+		h := ctrl.ingressChain(ing, routes)
+		for i, rule := range route.Spec.Rules {
+			backends, refReason, refMsg := ctrl.gatewayBackends(ing, rule.BackendRefs)
+			if refReason != "" && resolved.Status == metav1.ConditionTrue {
+				resolved = gatewayCondition(gatewayv1.RouteConditionResolvedRefs, false, refReason, refMsg, route.Generation)
+			}
+			for _, m := range rules[i] {
+				m.handler = h.ServeHandler(gatewayFilters(rule.Filters, m.path, weightedBackends(backends, m.path)))
+				for _, host := range routeHosts {
+					hosts[host] = append(hosts[host], m)
+				}
+			}
+		}
+	}
+
+	out := make([]gatewayv1.RouteParentStatus, 0, len(parents))
+	for _, p := range parents {
+		if meta.IsStatusConditionTrue(p.status.Conditions, string(gatewayv1.RouteConditionAccepted)) {
+			if rules == nil {
+				p.status.Conditions = []metav1.Condition{gatewayCondition(gatewayv1.RouteConditionAccepted, false, reason, msg, route.Generation)}
+			} else {
+				for _, l := range p.listeners {
+					l.status.AttachedRoutes++
+				}
+			}
+		}
+		p.status.Conditions = append(p.status.Conditions, resolved)
+		out = append(out, p.status)
+	}
+	return out
+}
+
+// compileHTTPRouteRules compiles the matches of each rule of route, or returns
+// the reason route can't be served: a filter, match or rule field this
+// controller doesn't implement, or an invalid regular expression.
+func compileHTTPRouteRules(route *gatewayv1.HTTPRoute) (rules [][]*gatewayMatch, reason gatewayv1.RouteConditionReason, msg string) {
+	owner := route.Namespace + "/" + route.Name
+	rules = make([][]*gatewayMatch, len(route.Spec.Rules))
+	for i, rule := range route.Spec.Rules {
+		if rule.Timeouts != nil || rule.Retry != nil || rule.SessionPersistence != nil {
+			return nil, gatewayv1.RouteReasonUnsupportedValue, fmt.Sprintf("rule %d: timeouts, retry and sessionPersistence are not supported", i)
+		}
+		if reason, msg := checkGatewayFilters(rule.Filters, false); reason != "" {
+			return nil, reason, fmt.Sprintf("rule %d: %s", i, msg)
+		}
+		for _, ref := range rule.BackendRefs {
+			if reason, msg := checkGatewayFilters(ref.Filters, true); reason != "" {
+				return nil, reason, fmt.Sprintf("rule %d backendRef %s: %s", i, ref.Name, msg)
+			}
+		}
+
+		matches := rule.Matches
+		if len(matches) == 0 {
+			matches = []gatewayv1.HTTPRouteMatch{{}}
+		}
+		for j, match := range matches {
+			m, err := compileGatewayMatch(match)
+			if err != nil {
+				return nil, gatewayv1.RouteReasonUnsupportedValue, fmt.Sprintf("rule %d match %d: %v", i, j, err)
+			}
+			m.created = route.CreationTimestamp
+			m.owner = owner
+			m.rule, m.index = i, j
+			rules[i] = append(rules[i], m)
+		}
+	}
+	return rules, "", ""
+}
+
+func compileGatewayMatch(match gatewayv1.HTTPRouteMatch) (*gatewayMatch, error) {
+	m := &gatewayMatch{pathType: gatewayv1.PathMatchPathPrefix, path: "/"}
+	if match.Path != nil {
+		if match.Path.Type != nil {
+			m.pathType = *match.Path.Type
+		}
+		if match.Path.Value != nil {
+			m.path = *match.Path.Value
+		}
+	}
+	switch m.pathType {
+	case gatewayv1.PathMatchExact:
+	case gatewayv1.PathMatchPathPrefix:
+		m.path = strings.TrimSuffix(m.path, "/")
+	case gatewayv1.PathMatchRegularExpression:
+		re, err := compileFullMatch(m.path)
+		if err != nil {
+			return nil, err
+		}
+		m.pathRegex = re
+	default:
+		return nil, fmt.Errorf("path match type %s is not supported", m.pathType)
+	}
+	if match.Method != nil {
+		m.method = string(*match.Method)
+	}
+	for _, h := range match.Headers {
+		vm := valueMatch{name: http.CanonicalHeaderKey(string(h.Name)), value: h.Value}
+		if h.Type != nil && *h.Type == gatewayv1.HeaderMatchRegularExpression {
+			re, err := compileFullMatch(h.Value)
+			if err != nil {
+				return nil, err
+			}
+			vm.regex = re
+		}
+		m.headers = append(m.headers, vm)
+	}
+	for _, q := range match.QueryParams {
+		vm := valueMatch{name: string(q.Name), value: q.Value}
+		if q.Type != nil && *q.Type == gatewayv1.QueryParamMatchRegularExpression {
+			re, err := compileFullMatch(q.Value)
+			if err != nil {
+				return nil, err
+			}
+			vm.regex = re
+		}
+		m.query = append(m.query, vm)
+	}
+	return m, nil
+}
+
+// compileFullMatch compiles a Gateway API regular expression (RE2), which has
+// to match the whole value.
+func compileFullMatch(expr string) (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + expr + ")$")
+}
+
+// checkGatewayFilters rejects the filters this controller doesn't implement.
+// A backendRef's filters can't redirect.
+func checkGatewayFilters(filters []gatewayv1.HTTPRouteFilter, backend bool) (reason gatewayv1.RouteConditionReason, msg string) {
+	var redirect, rewrite bool
+	for _, f := range filters {
+		switch {
+		case f.Type == gatewayv1.HTTPRouteFilterRequestHeaderModifier && f.RequestHeaderModifier != nil:
+		case f.Type == gatewayv1.HTTPRouteFilterURLRewrite && f.URLRewrite != nil:
+			rewrite = true
+		case f.Type == gatewayv1.HTTPRouteFilterRequestRedirect && f.RequestRedirect != nil && !backend:
+			redirect = true
+		default:
+			return gatewayv1.RouteReasonUnsupportedValue, fmt.Sprintf("filter %s is not supported", f.Type)
+		}
+	}
+	if redirect && rewrite {
+		return gatewayv1.RouteReasonIncompatibleFilters, "RequestRedirect and URLRewrite can't be combined"
+	}
+	return "", ""
+}
+
+// gatewayFilters applies filters to the request before next; a RequestRedirect
+// answers it instead. prefix is the matched path prefix a ReplacePrefixMatch
+// path modifier replaces.
+func gatewayFilters(filters []gatewayv1.HTTPRouteFilter, prefix string, next http.Handler) http.Handler {
+	if len(filters) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, f := range filters {
+			switch f.Type {
+			case gatewayv1.HTTPRouteFilterRequestHeaderModifier:
+				modifyRequestHeaders(r, f.RequestHeaderModifier)
+			case gatewayv1.HTTPRouteFilterURLRewrite:
+				if f.URLRewrite.Hostname != nil {
+					r.Host = string(*f.URLRewrite.Hostname)
+				}
+				if f.URLRewrite.Path != nil {
+					r.URL.Path = modifyPath(r.URL.Path, prefix, f.URLRewrite.Path)
+					r.URL.RawPath = ""
+				}
+			case gatewayv1.HTTPRouteFilterRequestRedirect:
+				redirectRequest(w, r, prefix, f.RequestRedirect)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func modifyRequestHeaders(r *http.Request, f *gatewayv1.HTTPHeaderFilter) {
+	for _, h := range f.Set {
+		r.Header.Set(string(h.Name), h.Value)
+	}
+	for _, h := range f.Add {
+		r.Header.Add(string(h.Name), h.Value)
+	}
+	for _, name := range f.Remove {
+		r.Header.Del(name)
+	}
+}
+
+// modifyPath applies a path modifier to path, prefix being the matched path
+// prefix ("" for "/").
+func modifyPath(path, prefix string, m *gatewayv1.HTTPPathModifier) string {
+	switch m.Type {
+	case gatewayv1.FullPathHTTPPathModifier:
+		if m.ReplaceFullPath != nil {
+			return *m.ReplaceFullPath
+		}
+	case gatewayv1.PrefixMatchHTTPPathModifier:
+		if m.ReplacePrefixMatch == nil {
+			return path
+		}
+		rest := strings.TrimPrefix(path, prefix)
+		if rest == "" {
+			if *m.ReplacePrefixMatch == "" {
+				return "/"
+			}
+			return *m.ReplacePrefixMatch
+		}
+		return strings.TrimSuffix(*m.ReplacePrefixMatch, "/") + rest
+	}
+	return path
+}
+
+// redirectRequest answers r with the redirect f describes. Unset parts keep the
+// request's; changing the scheme without a port drops the request's port, and
+// a scheme's well-known port is left out.
+func redirectRequest(w http.ResponseWriter, r *http.Request, prefix string, f *gatewayv1.HTTPRequestRedirectFilter) {
+	scheme := "http"
+	if r.TLS != nil || header.Get(r.Header, header.XForwardedProto) == "https" {
+		scheme = "https"
+	}
+	host, port := r.Host, ""
+	if h, p, err := net.SplitHostPort(r.Host); err == nil {
+		host, port = h, p
+	}
+	if f.Scheme != nil {
+		scheme = *f.Scheme
+		port = ""
+	}
+	if f.Hostname != nil {
+		host = string(*f.Hostname)
+	}
+	if f.Port != nil {
+		port = strconv.Itoa(int(*f.Port))
+	}
+	if scheme == "http" && port == "80" || scheme == "https" && port == "443" {
+		port = ""
+	}
+
+	u := url.URL{Scheme: scheme, Host: host, Path: r.URL.Path, RawQuery: r.URL.RawQuery}
+	if port != "" {
+		u.Host = net.JoinHostPort(host, port)
+	}
+	if f.Path != nil {
+		u.Path = modifyPath(r.URL.Path, prefix, f.Path)
+	}
+	code := http.StatusFound
+	if f.StatusCode != nil {
+		code = *f.StatusCode
+	}
+	http.Redirect(w, r, u.String(), code)
+}
+
+// gatewayBackend is a resolved backendRef. An unresolvable one keeps its weight
+// and answers 500, so the share of requests it was given fails instead of
+// shifting to the other backends.
+type gatewayBackend struct {
+	handler http.Handler
+	filters []gatewayv1.HTTPRouteFilter
+	weight  int
+}
+
+// gatewayBackends resolves a rule's backendRefs, which have to be Services in
+// the route's namespace (ReferenceGrant is not supported). A non-empty reason
+// is the route's ResolvedRefs failure.
+func (ctrl *Controller) gatewayBackends(ing *networking.Ingress, refs []gatewayv1.HTTPBackendRef) (backends []gatewayBackend, reason gatewayv1.RouteConditionReason, msg string) {
+	for _, ref := range refs {
+		b := gatewayBackend{handler: http.HandlerFunc(internalServerError), filters: ref.Filters, weight: 1}
+		if ref.Weight != nil {
+			b.weight = int(*ref.Weight)
+		}
+		backends = append(backends, b)
+
+		switch {
+		case ref.Group != nil && *ref.Group != "" || ref.Kind != nil && *ref.Kind != "Service":
+			reason, msg = gatewayv1.RouteReasonInvalidKind, fmt.Sprintf("backendRef %s is not a Service", ref.Name)
+			continue
+		case ref.Namespace != nil && string(*ref.Namespace) != ing.Namespace:
+			reason, msg = gatewayv1.RouteReasonRefNotPermitted, fmt.Sprintf("backendRef %s/%s is in another namespace", *ref.Namespace, ref.Name)
+			continue
+		case ref.Port == nil:
+			reason, msg = gatewayv1.RouteReasonUnsupportedValue, fmt.Sprintf("backendRef %s has no port", ref.Name)
+			continue
+		}
+		if _, ok := ctrl.watchedServices.Load(ing.Namespace + "/" + string(ref.Name)); !ok {
+			reason, msg = gatewayv1.RouteReasonBackendNotFound, fmt.Sprintf("service %s not found", ref.Name)
+			continue
+		}
+		handler, _, ok := ctrl.resolveBackend(ing, &networking.IngressBackend{
+			Service: &networking.IngressServiceBackend{
+				Name: string(ref.Name),
+				Port: networking.ServiceBackendPort{Number: *ref.Port},
+			},
+		})
+		if !ok {
+			reason, msg = gatewayv1.RouteReasonBackendNotFound, fmt.Sprintf("service %s has no port %d", ref.Name, *ref.Port)
+			continue
+		}
+		backends[len(backends)-1].handler = handler
+	}
+	return backends, reason, msg
+}
+
+// weightedBackends splits requests between backends by weight. No backend
+// (or only zero weights) answers 500.
+func weightedBackends(backends []gatewayBackend, prefix string) http.Handler {
+	var total int
+	handlers := make([]http.Handler, len(backends))
+	for i, b := range backends {
+		total += b.weight
+		handlers[i] = gatewayFilters(b.filters, prefix, b.handler)
+	}
+	if total == 0 {
+		return http.HandlerFunc(internalServerError)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := rand.IntN(total)
+		for i, b := range backends {
+			if n < b.weight {
+				handlers[i].ServeHTTP(w, r)
+				return
+			}
+			n -= b.weight
+		}
+	})
+}
+
+func internalServerError(w http.ResponseWriter, _ *http.Request) {
+	http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+}
+
+func gatewayCondition[T ~string, R ~string](typ T, ok bool, reason R, msg string, generation int64) metav1.Condition {
+	status := metav1.ConditionTrue
+	if !ok {
+		status = metav1.ConditionFalse
+	}
+	return metav1.Condition{
+		Type:               string(typ),
+		Status:             status,
+		Reason:             string(reason),
+		Message:            msg,
+		ObservedGeneration: generation,
+	}
+}
+
+// publishGatewayStatus writes the status of the last compile into the
+// GatewayClasses, Gateways and HTTPRoutes it differs from. A condition whose
+// status is unchanged keeps its lastTransitionTime. Gateway addresses are the
+// Ingress status publisher's (StatusConfig), when it is configured.
+func (ctrl *Controller) publishGatewayStatus(ctx context.Context) {
+	st := ctrl.gatewayStatus.Load()
+	if st == nil { // not compiled yet
+		return
+	}
+
+	var addrs []gatewayv1.GatewayStatusAddress
+	ipType, hostnameType := gatewayv1.IPAddressType, gatewayv1.HostnameAddressType
+	if ctrl.StatusConfig.Enabled() {
+		ingAddrs, err := ctrl.statusAddresses(ctx)
+		if err != nil {
+			slog.Error("status: resolve addresses failed", "error", err)
+		}
+		for _, a := range ingAddrs {
+			if a.IP != "" {
+				addrs = append(addrs, gatewayv1.GatewayStatusAddress{Type: &ipType, Value: a.IP})
+			} else {
+				addrs = append(addrs, gatewayv1.GatewayStatusAddress{Type: &hostnameType, Value: a.Hostname})
+			}
+		}
+	}
+
+	ctrl.watchedGatewayClasses.Range(func(_, value any) bool {
+		gc := value.(*gatewayv1.GatewayClass)
+		conds, ok := st.classes[gc.Name]
+		if !ok {
+			return true
+		}
+		next := gc.DeepCopy()
+		setConditions(&next.Status.Conditions, conds)
+		if equality.Semantic.DeepEqual(gc.Status, next.Status) {
+			return true
+		}
+		if _, err := k8s.UpdateGatewayClassStatus(ctx, next); err != nil {
+			slog.Error("status: update gatewayclass status failed", "name", gc.Name, "error", err)
+			return ctx.Err() == nil
+		}
+		return true
+	})
+
+	ctrl.watchedGateways.Range(func(_, value any) bool {
+		gw := value.(*gatewayv1.Gateway)
+		want, ok := st.gateways[gw.Namespace+"/"+gw.Name]
+		if !ok {
+			return true
+		}
+		next := gw.DeepCopy()
+		setConditions(&next.Status.Conditions, want.Conditions)
+		listeners := make([]gatewayv1.ListenerStatus, 0, len(want.Listeners))
+		for _, l := range want.Listeners {
+			var conds []metav1.Condition
+			if i := slices.IndexFunc(gw.Status.Listeners, func(cur gatewayv1.ListenerStatus) bool { return cur.Name == l.Name }); i >= 0 {
+				conds = slices.Clone(gw.Status.Listeners[i].Conditions)
+			}
+			setConditions(&conds, l.Conditions)
+			l.Conditions = conds
+			listeners = append(listeners, l)
+		}
+		next.Status.Listeners = listeners
+		if addrs != nil {
+			next.Status.Addresses = addrs
+		}
+		if equality.Semantic.DeepEqual(gw.Status, next.Status) {
+			return true
+		}
+		if _, err := k8s.UpdateGatewayStatus(ctx, next); err != nil {
+			slog.Error("status: update gateway status failed", "namespace", gw.Namespace, "name", gw.Name, "error", err)
+			return ctx.Err() == nil
+		}
+		return true
+	})
+
+	name := ctrl.GatewayConfig.controllerName()
+	ctrl.watchedHTTPRoutes.Range(func(_, value any) bool {
+		route := value.(*gatewayv1.HTTPRoute)
+		want := st.routes[route.Namespace+"/"+route.Name]
+		var parents []gatewayv1.RouteParentStatus
+		for _, p := range route.Status.Parents {
+			if p.ControllerName != name { // another controller's
+				parents = append(parents, p)
+			}
+		}
+		for _, p := range want {
+			var conds []metav1.Condition
+			if i := slices.IndexFunc(route.Status.Parents, func(cur gatewayv1.RouteParentStatus) bool {
+				return cur.ControllerName == name && equality.Semantic.DeepEqual(cur.ParentRef, p.ParentRef)
+			}); i >= 0 {
+				conds = slices.Clone(route.Status.Parents[i].Conditions)
+			}
+			setConditions(&conds, p.Conditions)
+			p.Conditions = conds
+			parents = append(parents, p)
+		}
+		if equality.Semantic.DeepEqual(parents, route.Status.Parents) { // nil and empty are equal
+			return true
+		}
+		next := route.DeepCopy()
+		next.Status.Parents = parents
+		if _, err := k8s.UpdateHTTPRouteStatus(ctx, next); err != nil {
+			slog.Error("status: update httproute status failed", "namespace", route.Namespace, "name", route.Name, "error", err)
+			return ctx.Err() == nil
+		}
+		return true
+	})
+}
+
+// setConditions sets conds into dst, keeping the lastTransitionTime of a
+// condition whose status doesn't change.
+func setConditions(dst *[]metav1.Condition, conds []metav1.Condition) {
+	for _, c := range conds {
+		meta.SetStatusCondition(dst, c)
+	}
+}
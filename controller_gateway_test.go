@@ -0,0 +1,268 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/moonrhythm/parapet-ingress-controller/k8s"
+	"github.com/moonrhythm/parapet-ingress-controller/proxy"
+)
+
+// gatewayController loads the conformance/gateway-api fixtures into the fs
+// backend and a controller serving them.
+func gatewayController(t *testing.T) *Controller {
+	t.Helper()
+	t.Setenv("KUBERNETES_BACKEND", "fs")
+	t.Setenv("KUBERNETES_FS", "conformance/gateway-api")
+	require.NoError(t, k8s.Init())
+
+	ctrl := New("", proxy.New())
+	ctrl.GatewayConfig = GatewayConfig{Enabled: true}
+	ctrl.preloadResources(context.Background())
+	ctrl.reloadIngressDebounced()
+	return ctrl
+}
+
+func gatewayServe(ctrl *Controller, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	ctrl.ServeHandler(nil).ServeHTTP(w, r)
+	return w
+}
+
+func TestGatewayRouting(t *testing.T) {
+	ctrl := gatewayController(t)
+
+	request := func(method, target string, hdr ...string) *http.Request {
+		r := httptest.NewRequest(method, target, nil)
+		for i := 0; i < len(hdr); i += 2 {
+			r.Header.Set(hdr[i], hdr[i+1])
+		}
+		return r
+	}
+
+	cases := []struct {
+		name string
+		r    *http.Request
+		want string
+	}{
+		{"catch-all rule", request("GET", "http://app.example.com/"), "web"},
+		{"prefix", request("GET", "http://app.example.com/api/users"), "api"},
+		{"prefix is element-wise", request("GET", "http://app.example.com/apis"), "web"},
+		{"header match wins", request("GET", "http://app.example.com/api/users", "X-Version", "v2"), "api-v2"},
+		{"header value must match", request("GET", "http://app.example.com/api/users", "X-Version", "v3"), "api"},
+		{"query match", request("GET", "http://app.example.com/home?canary=yes"), "api-v2"},
+		{"exact with method", request("POST", "http://app.example.com/login"), "api"},
+		{"method must match", request("GET", "http://app.example.com/login"), "web"},
+		{"another namespace", request("GET", "http://shop.example.com/v1/cart"), "shop"},
+		{"no rule matches", request("GET", "http://shop.example.com/v2"), ""},
+		{"unsupported route", request("GET", "http://unsupported.example.com/"), ""},
+		{"hostname outside the listener", request("GET", "http://app.example.org/"), ""},
+		{"another controller's gateway", request("GET", "http://foreign.example.com/"), ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, servedServiceFor(ctrl, tc.r))
+		})
+	}
+
+	t.Run("redirect", func(t *testing.T) {
+		w := gatewayServe(ctrl, request("GET", "http://app.example.com/old/page?x=1"))
+		assert.Equal(t, http.StatusMovedPermanently, w.Code)
+		assert.Equal(t, "https://app.example.com/new/page?x=1", w.Header().Get("Location"))
+	})
+
+	t.Run("unresolved backend answers 500", func(t *testing.T) {
+		w := gatewayServe(ctrl, request("GET", "http://missing.example.com/"))
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+
+	t.Run("ingress keeps its routes", func(t *testing.T) {
+		ctrl.watchedIngresses.Store("default/app", ingressToService("default", "app", "app.example.com", "/", "Prefix", "api-v2", 80))
+		ctrl.reloadIngressDebounced()
+		assert.Equal(t, "api-v2", servedService(t, ctrl, "app.example.com", "/"))
+		assert.Equal(t, "api", servedService(t, ctrl, "app.example.com", "/api/users"))
+	})
+}
+
+func TestGatewayStatus(t *testing.T) {
+	ctrl := gatewayController(t)
+	ctrl.publishGatewayStatus(context.Background())
+
+	classes, err := k8s.GetGatewayClasses(context.Background())
+	require.NoError(t, err)
+	for _, gc := range classes {
+		if gc.Name == "parapet" {
+			assert.True(t, meta.IsStatusConditionTrue(gc.Status.Conditions, "Accepted"))
+		} else {
+			assert.Empty(t, gc.Status.Conditions, gc.Name)
+		}
+	}
+
+	gateways, err := k8s.GetGateways(context.Background(), "")
+	require.NoError(t, err)
+	for _, gw := range gateways {
+		if gw.Name == "foreign" {
+			assert.Empty(t, gw.Status.Conditions)
+			continue
+		}
+		accepted := meta.FindStatusCondition(gw.Status.Conditions, "Accepted")
+		require.NotNil(t, accepted)
+		assert.Equal(t, metav1.ConditionTrue, accepted.Status)
+		assert.Equal(t, "ListenersNotValid", accepted.Reason, "the tcp listener")
+		assert.EqualValues(t, 2, accepted.ObservedGeneration)
+		assert.True(t, meta.IsStatusConditionTrue(gw.Status.Conditions, "Programmed"))
+
+		require.Len(t, gw.Status.Listeners, 3)
+		http, https, tcp := gw.Status.Listeners[0], gw.Status.Listeners[1], gw.Status.Listeners[2]
+		assert.EqualValues(t, 3, http.AttachedRoutes)
+		assert.True(t, meta.IsStatusConditionTrue(http.Conditions, "Programmed"))
+		assert.Equal(t, "InvalidCertificateRef", meta.FindStatusCondition(https.Conditions, "ResolvedRefs").Reason)
+		assert.False(t, meta.IsStatusConditionTrue(https.Conditions, "Programmed"))
+		assert.Equal(t, "UnsupportedProtocol", meta.FindStatusCondition(tcp.Conditions, "Accepted").Reason)
+		assert.Empty(t, tcp.SupportedKinds)
+	}
+
+	routes, err := k8s.GetHTTPRoutes(context.Background(), "")
+	require.NoError(t, err)
+	parents := map[string][]gatewayv1.RouteParentStatus{}
+	for _, route := range routes {
+		parents[route.Name] = route.Status.Parents
+	}
+	accepted := func(name string) *metav1.Condition {
+		require.Len(t, parents[name], 1, name)
+		assert.EqualValues(t, DefaultGatewayControllerName, parents[name][0].ControllerName)
+		return meta.FindStatusCondition(parents[name][0].Conditions, "Accepted")
+	}
+	assert.Equal(t, "Accepted", accepted("app").Reason)
+	assert.EqualValues(t, 3, accepted("app").ObservedGeneration)
+	assert.Equal(t, "Accepted", accepted("shop").Reason)
+	assert.Equal(t, "UnsupportedValue", accepted("unsupported").Reason)
+	assert.Equal(t, "NoMatchingListenerHostname", accepted("wrong-host").Reason)
+	assert.True(t, meta.IsStatusConditionTrue(parents["app"][0].Conditions, "ResolvedRefs"))
+	assert.Equal(t, "BackendNotFound", meta.FindStatusCondition(parents["missing-backend"][0].Conditions, "ResolvedRefs").Reason)
+	assert.Empty(t, parents["foreign"])
+
+	t.Run("republishing keeps the transition times", func(t *testing.T) {
+		var before []gatewayv1.HTTPRoute
+		for _, route := range routes {
+			before = append(before, *route.DeepCopy())
+		}
+		ctrl.preloadResources(context.Background()) // the store now holds the published status
+		ctrl.publishGatewayStatus(context.Background())
+		after, err := k8s.GetHTTPRoutes(context.Background(), "")
+		require.NoError(t, err)
+		assert.Equal(t, before, after)
+	})
+}
+
+func TestIntersectHostnames(t *testing.T) {
+	t.Parallel()
+
+	h := func(s string) *gatewayv1.Hostname { v := gatewayv1.Hostname(s); return &v }
+	hs := func(s ...string) (out []gatewayv1.Hostname) {
+		for _, v := range s {
+			out = append(out, gatewayv1.Hostname(v))
+		}
+		return
+	}
+	cases := []struct {
+		listener *gatewayv1.Hostname
+		route    []gatewayv1.Hostname
+		want     []string
+	}{
+		{nil, nil, []string{""}},
+		{h("a.com"), nil, []string{"a.com"}},
+		{nil, hs("A.com", "b.com"), []string{"a.com", "b.com"}},
+		{h("*.a.com"), hs("x.a.com", "x.y.a.com", "a.com", "b.com"), []string{"x.a.com", "x.y.a.com"}},
+		{h("x.a.com"), hs("*.a.com"), []string{"x.a.com"}},
+		{h("*.a.com"), hs("*.a.com", "*.x.a.com"), []string{"*.a.com", "*.x.a.com"}},
+		{h("a.com"), hs("b.com"), nil},
+	}
+	for _, tc := range cases {
+		got, ok := intersectHostnames(tc.listener, tc.route)
+		assert.Equal(t, tc.want, got)
+		assert.Equal(t, tc.want != nil, ok)
+	}
+}
+
+func TestModifyPath(t *testing.T) {
+	t.Parallel()
+
+	full := func(p string) *gatewayv1.HTTPPathModifier {
+		return &gatewayv1.HTTPPathModifier{Type: gatewayv1.FullPathHTTPPathModifier, ReplaceFullPath: &p}
+	}
+	prefix := func(p string) *gatewayv1.HTTPPathModifier {
+		return &gatewayv1.HTTPPathModifier{Type: gatewayv1.PrefixMatchHTTPPathModifier, ReplacePrefixMatch: &p}
+	}
+	assert.Equal(t, "/x", modifyPath("/a/b", "/a", full("/x")))
+	assert.Equal(t, "/one/two", modifyPath("/prefix/one/two", "/prefix/one", prefix("/one")))
+	assert.Equal(t, "/two", modifyPath("/prefix/one/two", "/prefix/one", prefix("/")))
+	assert.Equal(t, "/", modifyPath("/prefix/one", "/prefix/one", prefix("/")))
+	assert.Equal(t, "/new", modifyPath("/prefix/one", "/prefix/one", prefix("/new")))
+	assert.Equal(t, "/new/bar", modifyPath("/bar", "", prefix("/new")))
+}
+
+func TestGatewayFilters(t *testing.T) {
+	t.Parallel()
+
+	var got *http.Request
+	next := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) { got = r })
+
+	path := "/v2"
+	hostname := gatewayv1.PreciseHostname("internal.example.com")
+	h := gatewayFilters([]gatewayv1.HTTPRouteFilter{
+		{
+			Type: gatewayv1.HTTPRouteFilterRequestHeaderModifier,
+			RequestHeaderModifier: &gatewayv1.HTTPHeaderFilter{
+				Set:    []gatewayv1.HTTPHeader{{Name: "X-Set", Value: "new"}},
+				Add:    []gatewayv1.HTTPHeader{{Name: "X-Add", Value: "2"}},
+				Remove: []string{"X-Remove"},
+			},
+		},
+		{
+			Type: gatewayv1.HTTPRouteFilterURLRewrite,
+			URLRewrite: &gatewayv1.HTTPURLRewriteFilter{
+				Hostname: &hostname,
+				Path:     &gatewayv1.HTTPPathModifier{Type: gatewayv1.PrefixMatchHTTPPathModifier, ReplacePrefixMatch: &path},
+			},
+		},
+	}, "/v1", next)
+
+	r := httptest.NewRequest("GET", "http://example.com/v1/users", nil)
+	r.Header.Set("X-Set", "old")
+	r.Header.Set("X-Add", "1")
+	r.Header.Set("X-Remove", "1")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	require.NotNil(t, got)
+	assert.Equal(t, "new", got.Header.Get("X-Set"))
+	assert.Equal(t, []string{"1", "2"}, got.Header.Values("X-Add"))
+	assert.Empty(t, got.Header.Get("X-Remove"))
+	assert.Equal(t, "internal.example.com", got.Host)
+	assert.Equal(t, "/v2/users", got.URL.Path)
+}
+
+func TestCheckGatewayFilters(t *testing.T) {
+	t.Parallel()
+
+	redirect := gatewayv1.HTTPRouteFilter{Type: gatewayv1.HTTPRouteFilterRequestRedirect, RequestRedirect: &gatewayv1.HTTPRequestRedirectFilter{}}
+	rewrite := gatewayv1.HTTPRouteFilter{Type: gatewayv1.HTTPRouteFilterURLRewrite, URLRewrite: &gatewayv1.HTTPURLRewriteFilter{}}
+	mirror := gatewayv1.HTTPRouteFilter{Type: gatewayv1.HTTPRouteFilterRequestMirror}
+
+	reason, _ := checkGatewayFilters([]gatewayv1.HTTPRouteFilter{redirect}, false)
+	assert.Empty(t, reason)
+	reason, _ = checkGatewayFilters([]gatewayv1.HTTPRouteFilter{redirect}, true)
+	assert.Equal(t, gatewayv1.RouteReasonUnsupportedValue, reason)
+	reason, _ = checkGatewayFilters([]gatewayv1.HTTPRouteFilter{redirect, rewrite}, false)
+	assert.Equal(t, gatewayv1.RouteReasonIncompatibleFilters, reason)
+	reason, _ = checkGatewayFilters([]gatewayv1.HTTPRouteFilter{mirror}, false)
+	assert.Equal(t, gatewayv1.RouteReasonUnsupportedValue, reason)
+}
@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/moonrhythm/parapet-ingress-controller/metric"
+	"github.com/moonrhythm/parapet-ingress-controller/route"
+)
+
+// Health check annotations, read from the backend Service (not the Ingress):
+// health is a property of the pods, shared by every Ingress routing to them.
+const (
+	healthCheckAnnotationPrefix = "parapet.moonrhythm.io/health-check-"
+	outlierAnnotationPrefix     = "parapet.moonrhythm.io/outlier-"
+)
+
+const (
+	defaultHealthCheckInterval = 10 * time.Second
+	defaultHealthCheckTimeout  = 2 * time.Second
+	defaultHealthyThreshold    = 2
+	defaultUnhealthyThreshold  = 3
+	defaultOutlierEjectionTime = 30 * time.Second
+)
+
+// serviceHealthCheck builds a Service's health check from its annotations:
+// active probing is on when health-check-path is set, outlier detection when
+// outlier-consecutive-5xx is positive. ok is false when neither is. A malformed
+// value is logged and replaced by its default, like the Ingress annotations.
+func (ctrl *Controller) serviceHealthCheck(s *v1.Service) (hc route.HealthCheck, ok bool) {
+	ann := s.Annotations
+	id := s.Namespace + "/" + s.Name
+
+	duration := func(key string, def time.Duration) time.Duration {
+		a := ann[key]
+		if a == "" {
+			return def
+		}
+		d, err := time.ParseDuration(a)
+		if err != nil || d <= 0 {
+			slog.Error("invalid health check duration, using default", "service", id, "annotation", key, "value", a, "error", err)
+			return def
+		}
+		return d
+	}
+	count := func(key string, def int) int {
+		a := ann[key]
+		if a == "" {
+			return def
+		}
+		n, err := strconv.Atoi(a)
+		if err != nil || n < 0 {
+			slog.Error("invalid health check count, using default", "service", id, "annotation", key, "value", a, "error", err)
+			return def
+		}
+		return n
+	}
+
+	hc.Consecutive5xx = count(outlierAnnotationPrefix+"consecutive-5xx", 0)
+	if hc.Consecutive5xx > 0 {
+		hc.EjectionTime = duration(outlierAnnotationPrefix+"ejection-time", defaultOutlierEjectionTime)
+	}
+
+	if path := strings.TrimSpace(ann[healthCheckAnnotationPrefix+"path"]); path != "" {
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		if p, target, found := ctrl.healthCheckPort(s, ann[healthCheckAnnotationPrefix+"port"]); found {
+			hc.Path = path
+			hc.Port = target
+			hc.Scheme = "http"
+			if p.AppProtocol != nil && *p.AppProtocol == "https" {
+				hc.Scheme = "https"
+			}
+			hc.Interval = duration(healthCheckAnnotationPrefix+"interval", defaultHealthCheckInterval)
+			hc.Timeout = duration(healthCheckAnnotationPrefix+"timeout", defaultHealthCheckTimeout)
+			hc.HealthyThreshold = max(count(healthCheckAnnotationPrefix+"healthy-threshold", defaultHealthyThreshold), 1)
+			hc.UnhealthyThreshold = max(count(healthCheckAnnotationPrefix+"unhealthy-threshold", defaultUnhealthyThreshold), 1)
+		}
+	}
+
+	return hc, hc.Path != "" || hc.Consecutive5xx > 0
+}
+
+// healthCheckPort picks the Service port to probe — the one named or numbered
+// by spec, else the first — and resolves its pod port. found is false when no
+// port matches or a named targetPort can't be resolved yet (it converges when
+// the endpoints arrive, as for routing).
+func (ctrl *Controller) healthCheckPort(s *v1.Service, spec string) (p v1.ServicePort, target string, found bool) {
+	spec = strings.TrimSpace(spec)
+	for _, sp := range s.Spec.Ports {
+		if spec != "" && sp.Name != spec && strconv.Itoa(int(sp.Port)) != spec {
+			continue
+		}
+		target, found = ctrl.resolveTargetPort(s, sp)
+		if !found {
+			slog.Warn("health check port not resolvable yet", "service", s.Namespace+"/"+s.Name, "port", sp.Port)
+		}
+		return sp, target, found
+	}
+	slog.Error("health check port not found", "service", s.Namespace+"/"+s.Name, "port", spec)
+	return p, "", false
+}
+
+// observeResponse feeds a proxied response into the Service's outlier
+// detection (proxy.OnResponse).
+func (ctrl *Controller) observeResponse(namespace, serviceName, addr string, statusCode int) {
+	if !ctrl.routeTable.HasHealthChecks() {
+		return
+	}
+	ctrl.routeTable.ObserveResponse(buildHost(namespace, serviceName), addr, statusCode)
+}
+
+// reportEjected exports a Service host's ejected endpoint count
+// (route.Table.OnEjected), dropping it with the host's health check.
+func reportEjected(host string, ejected int) {
+	namespace, name, ok := splitHost(host)
+	if !ok {
+		return
+	}
+	if ejected < 0 {
+		metric.DeleteBackendEjected(namespace, name)
+		return
+	}
+	metric.BackendEjected(namespace, name, ejected)
+}
+
+// splitHost is the inverse of buildHost.
+func splitHost(host string) (namespace, name string, ok bool) {
+	rest, ok := strings.CutSuffix(host, ".svc.cluster.local")
+	if !ok {
+		return "", "", false
+	}
+	name, namespace, ok = strings.Cut(rest, ".")
+	return namespace, name, ok && name != "" && namespace != ""
+}
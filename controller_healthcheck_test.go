@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/moonrhythm/parapet-ingress-controller/proxy"
+	"github.com/moonrhythm/parapet-ingress-controller/route"
+)
+
+func withAnnotations(s *v1.Service, ann map[string]string) *v1.Service {
+	s.Annotations = ann
+	return s
+}
+
+func TestServiceHealthCheck(t *testing.T) {
+	t.Parallel()
+
+	ctrl := New("", proxy.New())
+
+	t.Run("no annotations", func(t *testing.T) {
+		_, ok := ctrl.serviceHealthCheck(clusterIPService("default", "web", 80, 8080))
+		assert.False(t, ok)
+	})
+
+	t.Run("active defaults", func(t *testing.T) {
+		hc, ok := ctrl.serviceHealthCheck(withAnnotations(clusterIPService("default", "web", 80, 8080), map[string]string{
+			"parapet.moonrhythm.io/health-check-path": "healthz",
+		}))
+		assert.True(t, ok)
+		assert.Equal(t, route.HealthCheck{
+			Path:               "/healthz",
+			Port:               "8080",
+			Scheme:             "http",
+			Interval:           defaultHealthCheckInterval,
+			Timeout:            defaultHealthCheckTimeout,
+			HealthyThreshold:   defaultHealthyThreshold,
+			UnhealthyThreshold: defaultUnhealthyThreshold,
+		}, hc)
+	})
+
+	t.Run("all annotations", func(t *testing.T) {
+		s := clusterIPService("default", "web", 80, 8080)
+		s.Spec.Ports = append(s.Spec.Ports, v1.ServicePort{
+			Name: "admin", Port: 9000, TargetPort: intstr.FromInt(9443), AppProtocol: ptr("https"),
+		})
+		hc, ok := ctrl.serviceHealthCheck(withAnnotations(s, map[string]string{
+			"parapet.moonrhythm.io/health-check-path":                "/ready",
+			"parapet.moonrhythm.io/health-check-port":                "admin",
+			"parapet.moonrhythm.io/health-check-interval":            "5s",
+			"parapet.moonrhythm.io/health-check-timeout":             "1s",
+			"parapet.moonrhythm.io/health-check-healthy-threshold":   "1",
+			"parapet.moonrhythm.io/health-check-unhealthy-threshold": "5",
+			"parapet.moonrhythm.io/outlier-consecutive-5xx":          "10",
+			"parapet.moonrhythm.io/outlier-ejection-time":            "1m",
+		}))
+		assert.True(t, ok)
+		assert.Equal(t, route.HealthCheck{
+			Path:               "/ready",
+			Port:               "9443",
+			Scheme:             "https",
+			Interval:           5 * time.Second,
+			Timeout:            time.Second,
+			HealthyThreshold:   1,
+			UnhealthyThreshold: 5,
+			Consecutive5xx:     10,
+			EjectionTime:       time.Minute,
+		}, hc)
+	})
+
+	t.Run("outlier detection only", func(t *testing.T) {
+		hc, ok := ctrl.serviceHealthCheck(withAnnotations(clusterIPService("default", "web", 80, 8080), map[string]string{
+			"parapet.moonrhythm.io/outlier-consecutive-5xx": "5",
+		}))
+		assert.True(t, ok)
+		assert.Equal(t, route.HealthCheck{Consecutive5xx: 5, EjectionTime: defaultOutlierEjectionTime}, hc)
+	})
+
+	t.Run("malformed values fall back to defaults", func(t *testing.T) {
+		hc, ok := ctrl.serviceHealthCheck(withAnnotations(clusterIPService("default", "web", 80, 8080), map[string]string{
+			"parapet.moonrhythm.io/health-check-path":              "/healthz",
+			"parapet.moonrhythm.io/health-check-interval":          "soon",
+			"parapet.moonrhythm.io/health-check-healthy-threshold": "-1",
+		}))
+		assert.True(t, ok)
+		assert.Equal(t, defaultHealthCheckInterval, hc.Interval)
+		assert.Equal(t, defaultHealthyThreshold, hc.HealthyThreshold)
+	})
+
+	t.Run("unknown port disables active probing", func(t *testing.T) {
+		_, ok := ctrl.serviceHealthCheck(withAnnotations(clusterIPService("default", "web", 80, 8080), map[string]string{
+			"parapet.moonrhythm.io/health-check-path": "/healthz",
+			"parapet.moonrhythm.io/health-check-port": "81",
+		}))
+		assert.False(t, ok)
+	})
+}
+
+func TestSplitHost(t *testing.T) {
+	t.Parallel()
+
+	ns, name, ok := splitHost(buildHost("default", "web"))
+	assert.True(t, ok)
+	assert.Equal(t, "default", ns)
+	assert.Equal(t, "web", name)
+
+	_, _, ok = splitHost("api.example.com")
+	assert.False(t, ok)
+}
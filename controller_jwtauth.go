@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"log/slog"
+
+	"github.com/go-jose/go-jose/v4"
+	v1 "k8s.io/api/core/v1"
+)
+
+// LookupJWTKeys returns the keys of the Secret namespace/name, for
+// plugin.JWTAuth: the JWKS in jwks.json and the public keys and certificates
+// in key.pem. nil when the Secret is missing or holds none. Key sets are
+// rebuilt only when the Secret changes.
+func (ctrl *Controller) LookupJWTKeys(namespace, name string) *jose.JSONWebKeySet {
+	return ctrl.jwtKeys.lookup(&ctrl.watchedSecrets, namespace+"/"+name)
+}
+
+// parseJWTKeySecret builds the key set of a jwt-auth Secret
+// (secretCache.parse).
+func parseJWTKeySecret(key string, s *v1.Secret) *jose.JSONWebKeySet {
+	set := parseJWTKeys(key, s.Data["jwks.json"], s.Data["key.pem"])
+	if len(set.Keys) == 0 {
+		slog.Error("no key in jwt key secret, rejecting tokens", "secret", key)
+		return nil
+	}
+	slog.Debug("loaded jwt keys", "secret", key, "keys", len(set.Keys))
+	return set
+}
+
+func parseJWTKeys(secret string, jwks, keyPEM []byte) *jose.JSONWebKeySet {
+	var set jose.JSONWebKeySet
+	if len(jwks) > 0 {
+		if err := json.Unmarshal(jwks, &set); err != nil {
+			slog.Error("invalid jwks.json in jwt key secret", "secret", secret, "error", err)
+		}
+	}
+	rest := keyPEM
+	for {
+		var b *pem.Block
+		b, rest = pem.Decode(rest)
+		if b == nil {
+			break
+		}
+		var pub any
+		switch b.Type {
+		case "PUBLIC KEY":
+			pub, _ = x509.ParsePKIXPublicKey(b.Bytes)
+		case "RSA PUBLIC KEY":
+			pub, _ = x509.ParsePKCS1PublicKey(b.Bytes)
+		case "CERTIFICATE":
+			if crt, err := x509.ParseCertificate(b.Bytes); err == nil {
+				pub = crt.PublicKey
+			}
+		}
+		if pub != nil {
+			set.Keys = append(set.Keys, jose.JSONWebKey{Key: pub})
+		}
+	}
+	return &set
+}
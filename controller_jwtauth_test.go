@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/moonrhythm/parapet-ingress-controller/proxy"
+)
+
+func TestLookupJWTKeys(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	certPEM, _ := selfSignedCertPEM(t, "issuer.example.com")
+	jwks, err := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: []byte("0123456789abcdef0123456789abcdef"), KeyID: "hmac", Algorithm: "HS256"}}})
+	require.NoError(t, err)
+
+	ctrl := New("", proxy.New())
+	assert.Nil(t, ctrl.LookupJWTKeys("default", "api-keys"))
+
+	ctrl.watchedSecrets.Store("default/api-keys", secretFixture("default", "api-keys", "1", map[string][]byte{
+		"jwks.json": jwks,
+		"key.pem":   append(keyPEM, certPEM...),
+	}))
+	set := ctrl.LookupJWTKeys("default", "api-keys")
+	if assert.NotNil(t, set) {
+		assert.Len(t, set.Keys, 3)
+		assert.Len(t, set.Key("hmac"), 1)
+	}
+	assert.Same(t, set, ctrl.LookupJWTKeys("default", "api-keys"), "cached until the Secret changes")
+
+	ctrl.watchedSecrets.Store("default/api-keys", secretFixture("default", "api-keys", "2", map[string][]byte{"key.pem": keyPEM}))
+	set = ctrl.LookupJWTKeys("default", "api-keys")
+	if assert.NotNil(t, set) {
+		assert.Len(t, set.Keys, 1)
+	}
+
+	ctrl.watchedSecrets.Store("default/api-keys", secretFixture("default", "api-keys", "3", map[string][]byte{"jwks.json": []byte("junk")}))
+	assert.Nil(t, ctrl.LookupJWTKeys("default", "api-keys"))
+	ctrl.watchedSecrets.Delete("default/api-keys")
+	assert.Nil(t, ctrl.LookupJWTKeys("default", "api-keys"))
+}
@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	networking "k8s.io/api/networking/v1"
+
+	"github.com/moonrhythm/parapet-ingress-controller/geoip"
+	"github.com/moonrhythm/parapet-ingress-controller/route"
+)
+
+const (
+	loadBalancerAnnotation        = "parapet.moonrhythm.io/load-balancer"
+	loadBalancerHashKeyAnnotation = "parapet.moonrhythm.io/load-balancer-hash-key"
+)
+
+// loadBalancer is how an Ingress's routes pick a pod: the algorithm, plus the
+// request key the hash algorithm hashes.
+type loadBalancer struct {
+	algorithm route.Algorithm
+	key       func(r *http.Request) string // route.Hash only
+}
+
+// ingressLoadBalancer reads an Ingress's load-balancer annotations. An unknown
+// algorithm, or hash without a valid key, is logged and falls back to
+// round-robin — a routing preference, so unlike the auth annotations it fails
+// open.
+func ingressLoadBalancer(ing *networking.Ingress) loadBalancer {
+	a := strings.TrimSpace(ing.Annotations[loadBalancerAnnotation])
+	if a == "" {
+		return loadBalancer{}
+	}
+	alg, err := route.ParseAlgorithm(a)
+	if err != nil {
+		slog.Error("invalid load-balancer, using round-robin", "ingress", ing.Namespace+"/"+ing.Name, "error", err)
+		return loadBalancer{}
+	}
+	if alg != route.Hash {
+		return loadBalancer{algorithm: alg}
+	}
+
+	key, err := parseHashKey(ing.Annotations[loadBalancerHashKeyAnnotation])
+	if err != nil {
+		slog.Error("invalid load-balancer-hash-key, using round-robin", "ingress", ing.Namespace+"/"+ing.Name, "error", err)
+		return loadBalancer{}
+	}
+	return loadBalancer{algorithm: alg, key: key}
+}
+
+// parseHashKey parses a hash key spec: "header:<name>", "cookie:<name>", or
+// "ip" (the client IP, resolved like the WAF's request.remote_ip). A request
+// without the key hashes to "" and is round-robined.
+func parseHashKey(spec string) (func(r *http.Request) string, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "ip" {
+		return func(r *http.Request) string {
+			if ip := geoip.ClientIP(r); ip != nil {
+				return ip.String()
+			}
+			return ""
+		}, nil
+	}
+
+	kind, name, _ := strings.Cut(spec, ":")
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("hash key %q: want header:<name>, cookie:<name> or ip", spec)
+	}
+	switch kind {
+	case "header":
+		name = http.CanonicalHeaderKey(name)
+		return func(r *http.Request) string {
+			return r.Header.Get(name)
+		}, nil
+	case "cookie":
+		return func(r *http.Request) string {
+			c, err := r.Cookie(name)
+			if err != nil {
+				return ""
+			}
+			return c.Value
+		}, nil
+	}
+	return nil, fmt.Errorf("hash key %q: want header:<name>, cookie:<name> or ip", spec)
+}
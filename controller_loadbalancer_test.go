@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/moonrhythm/parapet-ingress-controller/route"
+)
+
+func TestIngressLoadBalancer(t *testing.T) {
+	t.Parallel()
+
+	lbOf := func(ann map[string]string) loadBalancer {
+		return ingressLoadBalancer(&networking.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "ing", Annotations: ann}})
+	}
+
+	assert.Equal(t, route.RoundRobin, lbOf(nil).algorithm)
+	assert.Equal(t, route.LeastRequest, lbOf(map[string]string{loadBalancerAnnotation: "least-request"}).algorithm)
+	assert.Equal(t, route.PowerOfTwo, lbOf(map[string]string{loadBalancerAnnotation: "p2c-ewma"}).algorithm)
+	assert.Equal(t, route.RoundRobin, lbOf(map[string]string{loadBalancerAnnotation: "fastest"}).algorithm, "unknown falls back")
+
+	lb := lbOf(map[string]string{loadBalancerAnnotation: "hash", loadBalancerHashKeyAnnotation: "header:x-user"})
+	assert.Equal(t, route.Hash, lb.algorithm)
+	require.NotNil(t, lb.key)
+
+	lb = lbOf(map[string]string{loadBalancerAnnotation: "hash"})
+	assert.Equal(t, route.RoundRobin, lb.algorithm, "hash without a key falls back")
+	assert.Nil(t, lb.key)
+}
+
+func TestParseHashKey(t *testing.T) {
+	t.Parallel()
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-User", "u1")
+	r.Header.Set("X-Real-Ip", "203.0.113.7")
+	r.AddCookie(&http.Cookie{Name: "session", Value: "s1"})
+
+	for spec, want := range map[string]string{
+		"header:x-user":  "u1",
+		"header:X-Other": "",
+		"cookie:session": "s1",
+		"cookie:other":   "",
+		"ip":             "203.0.113.7",
+	} {
+		key, err := parseHashKey(spec)
+		require.NoError(t, err, spec)
+		assert.Equal(t, want, key(r), spec)
+	}
+
+	for _, spec := range []string{"", "header", "header:", "cookie: ", "query:x"} {
+		_, err := parseHashKey(spec)
+		assert.Error(t, err, spec)
+	}
+}
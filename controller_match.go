@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	networking "k8s.io/api/networking/v1"
+)
+
+const matchRulesAnnotation = "parapet.moonrhythm.io/match-rules"
+
+// matchRule sends the requests it matches — method, every header and every
+// query param — to its own Service instead of the path's backend.
+type matchRule struct {
+	method  string
+	headers []valueMatch
+	query   []valueMatch
+	handler http.Handler
+	target  string
+}
+
+func (m *matchRule) matches(r *http.Request, query url.Values) bool {
+	if m.method != "" && r.Method != m.method {
+		return false
+	}
+	return matchHeaders(r.Header, m.headers) && matchQuery(query, m.query)
+}
+
+// matchRules are an Ingress's match rules, tried in order after the mux has
+// picked the host+path route.
+type matchRules []*matchRule
+
+// wrap puts the rules in front of a path's backend handler, which serves every
+// request no rule matches.
+func (rules matchRules) wrap(next http.Handler) http.Handler {
+	if len(rules) == 0 {
+		return next
+	}
+	var useQuery bool
+	for _, m := range rules {
+		useQuery = useQuery || len(m.query) > 0
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var query url.Values
+		if useQuery {
+			query = r.URL.Query()
+		}
+		for _, m := range rules {
+			if m.matches(r, query) {
+				m.handler.ServeHTTP(w, r)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ingressMatchRules compiles ing's match-rules annotation. Its rules name
+// Services in ing's namespace, balanced like the Ingress's own backends. Bad
+// YAML drops every rule; a rule without a condition, with an invalid regex or
+// an unresolvable Service is dropped alone. Both are logged, and the requests
+// they would have matched stay on the path's backend.
+func (ctrl *Controller) ingressMatchRules(ing *networking.Ingress) matchRules {
+	a := ing.Annotations[matchRulesAnnotation]
+	if strings.TrimSpace(a) == "" {
+		return nil
+	}
+	var obj []struct {
+		Method      string            `yaml:"method"`
+		Headers     map[string]string `yaml:"headers"`
+		HeaderRegex map[string]string `yaml:"headerRegex"`
+		Query       map[string]string `yaml:"query"`
+		QueryRegex  map[string]string `yaml:"queryRegex"`
+		Service     string            `yaml:"service"`
+		Port        string            `yaml:"port"`
+	}
+	if err := yaml.Unmarshal([]byte(a), &obj); err != nil {
+		slog.Error("invalid match-rules, ignoring", "ingress", ing.Namespace+"/"+ing.Name, "error", err)
+		return nil
+	}
+
+	var rules matchRules
+	for i, x := range obj {
+		invalid := func(reason string, args ...any) {
+			args = append([]any{"ingress", ing.Namespace + "/" + ing.Name, "rule", i, "reason", reason}, args...)
+			slog.Error("invalid match rule, ignoring", args...)
+		}
+
+		m := matchRule{method: strings.ToUpper(strings.TrimSpace(x.Method))}
+		var err error
+		if m.headers, err = compileValueMatches(x.Headers, x.HeaderRegex, http.CanonicalHeaderKey); err != nil {
+			invalid("bad header regex", "error", err)
+			continue
+		}
+		if m.query, err = compileValueMatches(x.Query, x.QueryRegex, nil); err != nil {
+			invalid("bad query regex", "error", err)
+			continue
+		}
+		if m.method == "" && len(m.headers) == 0 && len(m.query) == 0 {
+			invalid("no method, header or query condition")
+			continue
+		}
+
+		if x.Service == "" || x.Port == "" {
+			invalid("service and port are required")
+			continue
+		}
+		backend := networking.IngressBackend{Service: &networking.IngressServiceBackend{Name: x.Service}}
+		if n, err := strconv.Atoi(x.Port); err == nil {
+			backend.Service.Port.Number = int32(n)
+		} else {
+			backend.Service.Port.Name = x.Port
+		}
+		handler, target, ok := ctrl.resolveBackend(ing, &backend)
+		if !ok {
+			invalid("backend not resolved", "service", x.Service, "port", x.Port)
+			continue
+		}
+		m.handler, m.target = handler, target
+		rules = append(rules, &m)
+		slog.Debug("registered match rule", "ingress", ing.Namespace+"/"+ing.Name, "rule", i, "target", target)
+	}
+	return rules
+}
+
+// compileValueMatches compiles the exact and regex (whole value) matches of
+// one kind, canonicalizing names with canon when set.
+func compileValueMatches(exact, regex map[string]string, canon func(string) string) ([]valueMatch, error) {
+	if canon == nil {
+		canon = func(s string) string { return s }
+	}
+	var ms []valueMatch
+	for name, value := range exact {
+		ms = append(ms, valueMatch{name: canon(name), value: value})
+	}
+	for name, expr := range regex {
+		re, err := compileFullMatch(expr)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, valueMatch{name: canon(name), value: expr, regex: re})
+	}
+	return ms, nil
+}
+
+// valueMatch matches a header or query param by name, shared by the match
+// rules and Gateway API HTTPRoutes.
+type valueMatch struct {
+	name  string
+	value string
+	regex *regexp.Regexp // RegularExpression match; nil = Exact
+}
+
+func (m valueMatch) matches(v string, ok bool) bool {
+	if !ok {
+		return false
+	}
+	if m.regex != nil {
+		return m.regex.MatchString(v)
+	}
+	return v == m.value
+}
+
+// matchHeaders reports whether every match has a header in hdr; a repeated
+// header is matched on its values joined with ",".
+func matchHeaders(hdr http.Header, ms []valueMatch) bool {
+	for _, h := range ms {
+		vs := hdr.Values(h.name)
+		if !h.matches(strings.Join(vs, ","), len(vs) > 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchQuery is matchHeaders for query params.
+func matchQuery(query url.Values, ms []valueMatch) bool {
+	for _, q := range ms {
+		vs, ok := query[q.name]
+		if !q.matches(strings.Join(vs, ","), ok && len(vs) > 0) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/moonrhythm/parapet-ingress-controller/k8s"
+	"github.com/moonrhythm/parapet-ingress-controller/proxy"
+)
+
+func TestIngressMatchRules(t *testing.T) {
+	t.Setenv("KUBERNETES_BACKEND", "fs")
+	t.Setenv("KUBERNETES_FS", "conformance/ingress-match")
+	require.NoError(t, k8s.Init())
+
+	ctrl := New("", proxy.New())
+	ctrl.preloadResources(context.Background())
+	ctrl.reloadIngressDebounced()
+
+	request := func(method, target string, hdr ...string) *http.Request {
+		r := httptest.NewRequest(method, target, nil)
+		for i := 0; i < len(hdr); i += 2 {
+			r.Header.Set(hdr[i], hdr[i+1])
+		}
+		return r
+	}
+
+	cases := []struct {
+		name string
+		r    *http.Request
+		want string
+	}{
+		{"no rule matches", request("GET", "http://app.example.com/"), "web"},
+		{"header", request("GET", "http://app.example.com/users", "X-Api-Version", "2"), "api-v2"},
+		{"header value must match", request("GET", "http://app.example.com/users", "X-Api-Version", "3"), "web"},
+		{"query", request("GET", "http://app.example.com/?beta=1"), "beta"},
+		{"first rule wins", request("GET", "http://app.example.com/?beta=1", "X-Api-Version", "2"), "api-v2"},
+		{"method and header regex", request("POST", "http://app.example.com/", "Content-Type", "application/cbor"), "writer"},
+		{"method must match", request("PUT", "http://app.example.com/", "Content-Type", "application/json"), "web"},
+		{"header regex is whole value", request("POST", "http://app.example.com/", "Content-Type", "application/jsonx"), "web"},
+		{"query regex", request("GET", "http://app.example.com/?channel=alpha-3"), "beta"},
+		{"rule without condition dropped", request("DELETE", "http://app.example.com/"), "web"},
+		{"unresolved rule dropped", request("GET", "http://app.example.com/", "X-Missing", "1"), "web"},
+		{"invalid annotation", request("GET", "http://broken.example.com/", "X-Api-Version", "2"), "web"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, servedServiceFor(ctrl, tc.r))
+		})
+	}
+
+	t.Run("before the canary", func(t *testing.T) {
+		canary := ingressToService("default", "app-canary", "app.example.com", "/", "Prefix", "writer", 80)
+		canary.Annotations = map[string]string{canaryAnnotation: "true", canaryWeightAnnotation: "100"}
+		ctrl.watchedIngresses.Store("default/app-canary", canary)
+		ctrl.reloadIngressDebounced()
+
+		assert.Equal(t, "writer", servedServiceFor(ctrl, request("GET", "http://app.example.com/")))
+		assert.Equal(t, "api-v2", servedServiceFor(ctrl, request("GET", "http://app.example.com/", "X-Api-Version", "2")))
+	})
+}
@@ -0,0 +1,30 @@
+package controller
+
+import (
+	"log/slog"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/moonrhythm/parapet-ingress-controller/plugin"
+)
+
+// LookupOIDCSecret returns the client-secret and cookie-secret of the Secret
+// namespace/name, for plugin.OIDCAuth; nil when the Secret is missing or its
+// cookie-secret is shorter than 16 bytes.
+func (ctrl *Controller) LookupOIDCSecret(namespace, name string) *plugin.OIDCSecret {
+	return ctrl.oidcSecrets.lookup(&ctrl.watchedSecrets, namespace+"/"+name)
+}
+
+// parseOIDCSecret reads an oidc-auth Secret (secretCache.parse).
+func parseOIDCSecret(key string, s *v1.Secret) *plugin.OIDCSecret {
+	cookieSecret := s.Data["cookie-secret"]
+	if len(cookieSecret) < 16 {
+		slog.Error("cookie-secret of oidc secret missing or shorter than 16 bytes, rejecting requests", "secret", key)
+		return nil
+	}
+	return &plugin.OIDCSecret{
+		ClientSecret: strings.TrimSpace(string(s.Data["client-secret"])),
+		CookieSecret: cookieSecret,
+	}
+}
@@ -0,0 +1,30 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/moonrhythm/parapet-ingress-controller/proxy"
+)
+
+func TestLookupOIDCSecret(t *testing.T) {
+	ctrl := New("", proxy.New())
+	assert.Nil(t, ctrl.LookupOIDCSecret("default", "oidc"))
+
+	ctrl.watchedSecrets.Store("default/oidc", secretFixture("default", "oidc", "1", map[string][]byte{
+		"client-secret": []byte("s3cret\n"),
+		"cookie-secret": []byte("0123456789abcdef"),
+	}))
+	s := ctrl.LookupOIDCSecret("default", "oidc")
+	if assert.NotNil(t, s) {
+		assert.Equal(t, "s3cret", s.ClientSecret)
+		assert.Equal(t, []byte("0123456789abcdef"), s.CookieSecret)
+	}
+	assert.Same(t, s, ctrl.LookupOIDCSecret("default", "oidc"), "cached until the Secret changes")
+
+	ctrl.watchedSecrets.Store("default/oidc", secretFixture("default", "oidc", "2", map[string][]byte{"cookie-secret": []byte("short")}))
+	assert.Nil(t, ctrl.LookupOIDCSecret("default", "oidc"))
+	ctrl.watchedSecrets.Delete("default/oidc")
+	assert.Nil(t, ctrl.LookupOIDCSecret("default", "oidc"))
+}
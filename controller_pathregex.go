@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"cmp"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	networking "k8s.io/api/networking/v1"
+
+	"github.com/moonrhythm/parapet-ingress-controller/plugin"
+)
+
+const pathRegexAnnotation = "parapet.moonrhythm.io/path-regex"
+
+// isPathRegex reports whether ing's ImplementationSpecific paths are regular
+// expressions (`path-regex: "true"`).
+func isPathRegex(ing *networking.Ingress) bool {
+	return ing.Annotations[pathRegexAnnotation] == "true"
+}
+
+// regexRoute is an ImplementationSpecific path of a path-regex Ingress,
+// compiled to match the whole request path.
+type regexRoute struct {
+	re      *regexp.Regexp
+	expr    string
+	owner   string // namespace/name of the Ingress
+	index   int    // order of the path in its Ingress
+	handler http.Handler
+}
+
+// regexRoutes are the regex paths by host (as registered: lowercase, a
+// wildcard host literal).
+type regexRoutes map[string][]*regexRoute
+
+// add compiles a regex path. An invalid expression is logged and the path
+// registers nothing, like a path with an unresolvable backend.
+func (routes regexRoutes) add(ing *networking.Ingress, host, expr string, index int, handler http.Handler) bool {
+	re, err := compileFullMatch(expr)
+	if err != nil {
+		slog.Error("invalid path regex, ignoring", "namespace", ing.Namespace, "name", ing.Name, "path", host+expr, "error", err)
+		return false
+	}
+	routes[host] = append(routes[host], &regexRoute{
+		re:      re,
+		expr:    expr,
+		owner:   ing.Namespace + "/" + ing.Name,
+		index:   index,
+		handler: handler,
+	})
+	return true
+}
+
+// sort orders every host's regex paths for matching: the longest expression
+// first, then by Ingress namespace/name and path order, so the winner of a
+// request several expressions match doesn't depend on the watch order.
+func (routes regexRoutes) sort() {
+	for _, rs := range routes {
+		slices.SortFunc(rs, func(a, b *regexRoute) int {
+			return cmp.Or(
+				cmp.Compare(len(b.expr), len(a.expr)),
+				strings.Compare(a.owner, b.owner),
+				cmp.Compare(a.index, b.index),
+			)
+		})
+	}
+}
+
+// handler returns the handler of the first of host's regex paths matching r,
+// or nil. The match is recorded in the request context for upstream-path.
+func (routes regexRoutes) handler(host string, r *http.Request) http.Handler {
+	for _, route := range routes[host] {
+		p := r.URL.Path
+		if m := route.re.FindStringSubmatchIndex(p); m != nil {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				route.handler.ServeHTTP(w, r.WithContext(plugin.WithPathMatch(r.Context(), route.re, p, m)))
+			})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/moonrhythm/parapet"
+	"github.com/stretchr/testify/assert"
+	networking "k8s.io/api/networking/v1"
+
+	"github.com/moonrhythm/parapet-ingress-controller/plugin"
+	"github.com/moonrhythm/parapet-ingress-controller/proxy"
+)
+
+func TestPathRegex(t *testing.T) {
+	ctrl := New("", proxy.New())
+	for _, name := range []string{"users", "api", "web", "other", "wild"} {
+		ctrl.watchedServices.Store("default/"+name, clusterIPService("default", name, 80, 8080))
+	}
+	regex := func(name, host, path, svc string) *networking.Ingress {
+		ing := ingressToService("default", name, host, path, networking.PathTypeImplementationSpecific, svc, 80)
+		ing.Annotations = map[string]string{pathRegexAnnotation: "true"}
+		return ing
+	}
+	ctrl.watchedIngresses.Store("default/users", regex("users", "example.com", "/api/v[0-9]+/users(/.*)?", "users"))
+	ctrl.watchedIngresses.Store("default/other", regex("other", "example.com", "/[a-z]+/v1/users", "other"))
+	ctrl.watchedIngresses.Store("default/invalid", regex("invalid", "example.com", "/(", "other"))
+	ctrl.watchedIngresses.Store("default/api", ingressToService("default", "api", "example.com", "/api/internal", networking.PathTypePrefix, "api", 80))
+	ctrl.watchedIngresses.Store("default/web", ingressToService("default", "web", "example.com", "/", networking.PathTypePrefix, "web", 80))
+	ctrl.watchedIngresses.Store("default/literal", ingressToService("default", "literal", "example.com", "/v[0-9]", networking.PathTypeImplementationSpecific, "api", 80))
+	ctrl.watchedIngresses.Store("default/wild", regex("wild", "*.example.net", "/x/[0-9]+", "wild"))
+	ctrl.reloadIngressDebounced()
+
+	cases := []struct {
+		host, path string
+		want       string
+	}{
+		{"example.com", "/api/v2/users", "users"},
+		{"example.com", "/api/v1/users/42", "users"},
+		{"example.com", "/api/v2/usersx", "web"},         // anchored at the end
+		{"example.com", "/x/api/v2/users", "web"},        // and at the start
+		{"example.com", "/api/internal/v1/users", "api"}, // prefix first
+		{"example.com", "/api/v1/users", "users"},        // longest expression first
+		{"example.com", "/abc/v1/users", "other"},
+		{"example.com", "/v[0-9]", "api"},  // literal without path-regex
+		{"a.example.net", "/x/12", "wild"}, // wildcard host
+		{"a.example.net", "/x/y", ""},
+		{"example.org", "/api/v2/users", ""}, // another host
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.want, servedService(t, ctrl, tc.host, tc.path), tc.host+tc.path)
+	}
+	assert.True(t, ctrl.IsKnownHost("a.example.net"))
+}
+
+func TestPathRegexHostless(t *testing.T) {
+	ctrl := New("", proxy.New())
+	for _, name := range []string{"users", "api", "web", "host"} {
+		ctrl.watchedServices.Store("default/"+name, clusterIPService("default", name, 80, 8080))
+	}
+	users := ingressToService("default", "users", "", "/api/v[0-9]+/users", networking.PathTypeImplementationSpecific, "users", 80)
+	users.Annotations = map[string]string{pathRegexAnnotation: "true"}
+	ctrl.watchedIngresses.Store("default/users", users)
+	ctrl.watchedIngresses.Store("default/api", ingressToService("default", "api", "", "/api/internal", networking.PathTypePrefix, "api", 80))
+	ctrl.watchedIngresses.Store("default/web", ingressToService("default", "web", "", "/", networking.PathTypePrefix, "web", 80))
+	ctrl.watchedIngresses.Store("default/host", ingressToService("default", "host", "example.com", "/", networking.PathTypePrefix, "host", 80))
+	ctrl.reloadIngressDebounced()
+
+	cases := []struct {
+		host, path string
+		want       string
+	}{
+		{"any.example.org", "/api/v2/users", "users"},
+		{"any.example.org", "/api/internal/v2/users", "api"}, // prefix first
+		{"any.example.org", "/api/v2/usersx", "web"},         // catch-all last
+		{"example.com", "/api/v2/users", "host"},             // a host route wins
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.want, servedService(t, ctrl, tc.host, tc.path), tc.host+tc.path)
+	}
+	assert.False(t, ctrl.IsKnownHost(""), "host-less rules add no known host")
+}
+
+func TestPathRegexUpstreamPath(t *testing.T) {
+	var upstream string
+	ctrl := New("", proxy.New())
+	ctrl.Use(plugin.UpstreamPath)
+	ctrl.Use(func(ctx plugin.Context) {
+		ctx.Use(parapet.MiddlewareFunc(func(http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				upstream = r.URL.RequestURI()
+			})
+		}))
+	})
+	ctrl.watchedServices.Store("default/users", clusterIPService("default", "users", 80, 8080))
+	ing := ingressToService("default", "users", "example.com", "/api/v(?P<version>[0-9]+)/users/(.*)", networking.PathTypeImplementationSpecific, "users", 80)
+	ing.Annotations = map[string]string{
+		pathRegexAnnotation:                   "true",
+		"parapet.moonrhythm.io/upstream-path": "/users/$2?version=${version}",
+	}
+	ctrl.watchedIngresses.Store("default/users", ing)
+	ctrl.reloadIngressDebounced()
+
+	r := httptest.NewRequest(http.MethodGet, "http://example.com/api/v3/users/42?a=1", nil)
+	ctrl.ServeHandler(nil).ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, "/users/42?version=3&a=1", upstream)
+}
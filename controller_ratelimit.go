@@ -2,6 +2,8 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
 	"sort"
@@ -42,6 +44,9 @@ type RateLimitConfig struct {
 	// defaults (cost 1e6, macros enabled).
 	FilterCostLimit     uint64
 	FilterDisableMacros bool
+	// Shared counts `backend: shared` limits across replicas; nil makes
+	// SetLimits reject them. Set from RATELIMIT_REDIS_URL in main.
+	Shared *ratelimitrule.SharedStore
 }
 
 // newRateLimiter builds a Limiter wired with the controller's metric observer,
@@ -61,6 +66,7 @@ func (ctrl *Controller) newRateLimiter(namePrefix string) *ratelimitrule.Limiter
 		// WAF_DISABLE_MACROS) so the two CEL surfaces are hardened identically.
 		FilterCostLimit:     ctrl.RateLimitConfig.FilterCostLimit,
 		FilterDisableMacros: ctrl.RateLimitConfig.FilterDisableMacros,
+		Shared:              ctrl.RateLimitConfig.Shared,
 	}
 }
 
@@ -252,3 +258,83 @@ func (ctrl *Controller) reloadRateLimitDebounced() {
 	ctrl.rlZoneFingerprints = newFingerprints
 	slog.Info("reloaded ratelimit", "global_limits", len(ctrl.globalRateLimit.IDs()), "zones", len(newZones))
 }
+
+// rateLimitUsageResponse is the RateLimitUsage payload.
+type rateLimitUsageResponse struct {
+	Name         string   `json:"name"` // the parapet_ratelimit_total name
+	Key          []string `json:"key"`
+	Values       []string `json:"values"`
+	Algorithm    string   `json:"algorithm"`
+	Rate         int      `json:"rate"`
+	Window       string   `json:"window"`
+	Burst        int      `json:"burst,omitempty"`
+	Concurrency  int      `json:"concurrency,omitempty"`
+	Backend      string   `json:"backend"`
+	Mode         string   `json:"mode"`
+	Count        int      `json:"count"`
+	Remaining    int      `json:"remaining"`
+	ResetSeconds float64  `json:"reset_seconds"`
+}
+
+// RateLimitUsage serves the read-only state of one rate-limit bucket, for
+// answering "why is this client throttled?":
+//
+//	GET ?id=<limit id>[&zone=<namespace>/<name>]&key=<value>[&key=<value>...]
+//
+// One key value per characteristic of the limit's key, in order (see
+// ratelimitrule.Limiter.Usage); no zone means the global set. Nothing is
+// counted. Mounted on the metrics port only: the bucket values are client
+// data, not for the proxy listeners.
+func (ctrl *Controller) RateLimitUsage() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if ctrl.globalRateLimit == nil {
+			http.Error(w, "rate limiting disabled", http.StatusNotFound)
+			return
+		}
+		q := r.URL.Query()
+		id, zone := q.Get("id"), q.Get("zone")
+		if id == "" {
+			http.Error(w, "id is required", http.StatusBadRequest)
+			return
+		}
+		l, name := ctrl.globalRateLimit, "global:"+id
+		if zone != "" {
+			if l = ctrl.LookupRateLimitZone(zone); l == nil {
+				http.Error(w, "unknown zone", http.StatusNotFound)
+				return
+			}
+			name = "zone:" + zone + ":" + id
+		}
+		values := q["key"]
+		u, err := l.Usage(id, values)
+		if errors.Is(err, ratelimitrule.ErrUnknownLimit) {
+			http.Error(w, "unknown limit", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(rateLimitUsageResponse{
+			Name:         name,
+			Key:          u.Limit.Key,
+			Values:       values,
+			Algorithm:    u.Limit.Algorithm,
+			Rate:         u.Limit.Rate,
+			Window:       u.Limit.Window,
+			Burst:        u.Limit.Burst,
+			Concurrency:  u.Limit.Concurrency,
+			Backend:      u.Limit.Backend,
+			Mode:         u.Limit.Mode,
+			Count:        u.Count,
+			Remaining:    u.Remaining,
+			ResetSeconds: u.Reset.Seconds(),
+		})
+	})
+}
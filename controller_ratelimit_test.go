@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"sync"
@@ -570,3 +571,63 @@ limits:
 	require.NotNil(t, zone)
 	assert.Empty(t, zone.IDs(), "FilterDisableMacros wired: macro filter rejected, last-good kept")
 }
+
+func TestRateLimitUsage(t *testing.T) {
+	t.Parallel()
+
+	ctrl := newRLController()
+	ctrl.watchedRLConfigMaps.Store("ctrl-ns/rl-global", rlCM("ctrl-ns", "rl-global", roleGlobal, rlOneLimit))
+	ctrl.watchedRLConfigMaps.Store("cust1/acme", rlCM("cust1", "acme", roleZone, `
+limits:
+  - id: per-key
+    key: header:x-api-key
+    rate: 10
+    window: 1m
+    algorithm: token-bucket
+`))
+	ctrl.reloadRateLimitDebounced()
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Real-Ip", "192.0.2.1")
+	ctrl.globalRateLimit.Serve(httptest.NewRecorder(), r, http.NotFoundHandler())
+
+	h := ctrl.RateLimitUsage()
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	w := get("/debug/ratelimit?id=per-ip&key=192.0.2.1")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Positive(t, got["reset_seconds"])
+	delete(got, "reset_seconds")
+	assert.Equal(t, map[string]any{
+		"name": "global:per-ip", "key": []any{"ip"}, "values": []any{"192.0.2.1"},
+		"algorithm": "fixed", "rate": 1.0, "window": "1h0m0s", "backend": "local", "mode": "enforce",
+		"count": 1.0, "remaining": 0.0,
+	}, got)
+
+	w = get("/debug/ratelimit?zone=cust1/acme&id=per-key&key=k1")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"name":"zone:cust1/acme:per-key"`)
+	assert.Contains(t, w.Body.String(), `"burst":10,`)
+	assert.Contains(t, w.Body.String(), `"remaining":10,`)
+
+	assert.Equal(t, http.StatusBadRequest, get("/debug/ratelimit?key=x").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/debug/ratelimit?id=per-ip").Code, "missing key value")
+	assert.Equal(t, http.StatusNotFound, get("/debug/ratelimit?id=nope&key=x").Code)
+	assert.Equal(t, http.StatusNotFound, get("/debug/ratelimit?zone=cust1/missing&id=per-key&key=x").Code)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/debug/ratelimit?id=per-ip&key=x", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	disabled := New("", proxy.New())
+	w = httptest.NewRecorder()
+	disabled.RateLimitUsage().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/ratelimit?id=per-ip&key=x", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
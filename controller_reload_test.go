@@ -49,6 +49,15 @@ func clusterIPService(namespace, name string, port, targetPort int) *v1.Service
 	}
 }
 
+// secretFixture is a watched Secret at resourceVersion version, for tests of
+// what is cached per Secret version.
+func secretFixture(namespace, name, version string, data map[string][]byte) *v1.Secret {
+	return &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, ResourceVersion: version},
+		Data:       data,
+	}
+}
+
 func ingressToService(namespace, name, host, path string, pathType networking.PathType, svcName string, svcPort int) *networking.Ingress {
 	return &networking.Ingress{
 		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"log/slog"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// secretCache caches what a feature reads from watched Secrets, by Secret
+// (namespace/name), so a lookup on every request or handshake parses a Secret
+// again only when it changes (UID@resourceVersion).
+type secretCache[T any] struct {
+	// missing is logged when a looked up Secret isn't watched, once until it
+	// appears.
+	missing string
+	// parse builds a Secret's value, or the zero T (logged by parse) when the
+	// Secret is unusable; lookups then return the zero T until it changes.
+	parse func(key string, s *v1.Secret) T
+
+	mu      sync.Mutex
+	entries map[string]*secretCacheEntry[T]
+}
+
+// secretCacheEntry is a Secret's value as last parsed, and the
+// UID@resourceVersion it was parsed from; the zero entry records a missing
+// Secret.
+type secretCacheEntry[T any] struct {
+	version string
+	value   T
+}
+
+func newSecretCache[T any](missing string, parse func(key string, s *v1.Secret) T) *secretCache[T] {
+	return &secretCache[T]{
+		missing: missing,
+		parse:   parse,
+		entries: make(map[string]*secretCacheEntry[T]),
+	}
+}
+
+// lookup returns the value of the Secret key in secrets (the watched
+// Secrets), or the zero T when it is missing or unusable.
+func (c *secretCache[T]) lookup(secrets *sync.Map, key string) T {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e := c.entries[key]
+	v, ok := secrets.Load(key)
+	if !ok {
+		if e == nil || e.version != "" { // logged once, not per request
+			slog.Error(c.missing, "secret", key)
+			c.entries[key] = &secretCacheEntry[T]{}
+		}
+		var zero T
+		return zero
+	}
+	s := v.(*v1.Secret)
+	version := string(s.UID) + "@" + s.ResourceVersion
+	if e != nil && e.version == version {
+		return e.value
+	}
+
+	e = &secretCacheEntry[T]{version: version, value: c.parse(key, s)}
+	c.entries[key] = e
+	return e.value
+}
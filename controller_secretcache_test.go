@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestSecretCache(t *testing.T) {
+	t.Parallel()
+
+	parses := 0
+	c := newSecretCache("missing", func(_ string, s *v1.Secret) *string {
+		parses++
+		if len(s.Data["v"]) == 0 {
+			return nil
+		}
+		v := string(s.Data["v"])
+		return &v
+	})
+	var secrets sync.Map
+	store := func(version, v string) {
+		secrets.Store("default/s", secretFixture("default", "s", version, map[string][]byte{"v": []byte(v)}))
+	}
+
+	assert.Nil(t, c.lookup(&secrets, "default/s"), "missing")
+
+	store("1", "a")
+	assert.Equal(t, "a", *c.lookup(&secrets, "default/s"))
+	assert.Equal(t, "a", *c.lookup(&secrets, "default/s"))
+	assert.Equal(t, 1, parses, "parsed once per version")
+
+	store("2", "")
+	assert.Nil(t, c.lookup(&secrets, "default/s"), "unusable")
+	assert.Nil(t, c.lookup(&secrets, "default/s"))
+	assert.Equal(t, 2, parses, "an unusable version isn't parsed again either")
+
+	secrets.Delete("default/s")
+	assert.Nil(t, c.lookup(&secrets, "default/s"))
+	store("3", "b")
+	assert.Equal(t, "b", *c.lookup(&secrets, "default/s"))
+}
@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	networking "k8s.io/api/networking/v1"
+
+	"github.com/moonrhythm/parapet-ingress-controller/k8s"
+)
+
+// StatusConfig configures the Ingress status publisher, which writes the
+// controller's address into status.loadBalancer.ingress of every Ingress it
+// serves (what external-dns, Argo CD and `kubectl get ing` read). It is off
+// unless PublishService or Addresses is set.
+type StatusConfig struct {
+	// PublishService, "namespace/name", publishes that Service's load balancer
+	// ingress (its spec.externalIPs when it has none) — normally the Service
+	// fronting the controller.
+	PublishService string
+	// Addresses are static IPs or hostnames, published along with
+	// PublishService's.
+	Addresses []string
+	// LeaseName is the Lease, in PodNamespace, the replicas elect the one
+	// writer by; Identity names this replica in it (the pod name).
+	LeaseName string
+	Identity  string
+}
+
+// Enabled reports whether there is anything to publish.
+func (c StatusConfig) Enabled() bool {
+	return c.PublishService != "" || len(c.Addresses) > 0
+}
+
+// statusResync is how often the leader re-publishes without an Ingress reload,
+// picking up a change of the published Service's address.
+const statusResync = 30 * time.Second
+
+// runStatusPublisher campaigns for the status Lease and publishes while it
+// leads, so only one replica writes: the Ingress status (when StatusConfig is
+// enabled) and the Gateway API status (when GatewayConfig is). It returns when
+// ctx is done.
+func (ctrl *Controller) runStatusPublisher(ctx context.Context) {
+	k8s.RunLeaderElection(ctx, ctrl.PodNamespace, ctrl.StatusConfig.LeaseName, ctrl.StatusConfig.Identity, ctrl.publishStatusLoop)
+}
+
+// publishStatusLoop publishes on every Ingress reload and every statusResync,
+// until ctx (the leadership) is done.
+func (ctrl *Controller) publishStatusLoop(ctx context.Context) {
+	slog.Info("status: publishing status", "identity", ctrl.StatusConfig.Identity)
+	ticker := time.NewTicker(statusResync)
+	defer ticker.Stop()
+	for {
+		if ctrl.StatusConfig.Enabled() {
+			ctrl.publishStatus(ctx)
+		}
+		if ctrl.GatewayConfig.Enabled {
+			ctrl.publishGatewayStatus(ctx)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-ctrl.statusKick:
+		}
+	}
+}
+
+// kickStatus asks the publisher, if this replica runs it, to publish now.
+func (ctrl *Controller) kickStatus() {
+	select {
+	case ctrl.statusKick <- struct{}{}:
+	default: // a publish is already pending
+	}
+}
+
+// publishStatus writes the current addresses into every Ingress of this
+// controller's class whose status differs. When no address can be resolved
+// (the Service has no load balancer yet, or can't be read) it writes nothing
+// rather than blanking the published ones.
+func (ctrl *Controller) publishStatus(ctx context.Context) {
+	addrs, err := ctrl.statusAddresses(ctx)
+	if err != nil {
+		slog.Error("status: resolve addresses failed", "error", err)
+		return
+	}
+	if len(addrs) == 0 {
+		slog.Warn("status: no address to publish yet", "service", ctrl.StatusConfig.PublishService)
+		return
+	}
+
+	ctrl.watchedIngresses.Range(func(_, value any) bool {
+		ing := value.(*networking.Ingress)
+		if getIngressClass(ing) != IngressClass || slices.EqualFunc(ing.Status.LoadBalancer.Ingress, addrs, sameAddress) {
+			return true
+		}
+		ing = ing.DeepCopy()
+		ing.Status.LoadBalancer.Ingress = addrs
+		if _, err := k8s.UpdateIngressStatus(ctx, ing); err != nil {
+			// retried on the next reload or resync
+			slog.Error("status: update ingress status failed", "namespace", ing.Namespace, "name", ing.Name, "error", err)
+			return ctx.Err() == nil
+		}
+		slog.Debug("status: updated ingress status", "namespace", ing.Namespace, "name", ing.Name)
+		return true
+	})
+}
+
+// statusAddresses resolves the addresses to publish, deduplicated and sorted so
+// an unchanged set compares equal to the published one.
+func (ctrl *Controller) statusAddresses(ctx context.Context) ([]networking.IngressLoadBalancerIngress, error) {
+	var addrs []networking.IngressLoadBalancerIngress
+	if spec := ctrl.StatusConfig.PublishService; spec != "" {
+		ns, name, ok := strings.Cut(spec, "/")
+		if !ok || ns == "" || name == "" {
+			return nil, fmt.Errorf("publish service %q: want <namespace>/<name>", spec)
+		}
+		svc, err := k8s.GetService(ctx, ns, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, lb := range svc.Status.LoadBalancer.Ingress {
+			addrs = append(addrs, networking.IngressLoadBalancerIngress{IP: lb.IP, Hostname: lb.Hostname})
+		}
+		if len(addrs) == 0 {
+			for _, ip := range svc.Spec.ExternalIPs {
+				addrs = append(addrs, networking.IngressLoadBalancerIngress{IP: ip})
+			}
+		}
+	}
+	for _, a := range ctrl.StatusConfig.Addresses {
+		if net.ParseIP(a) != nil {
+			addrs = append(addrs, networking.IngressLoadBalancerIngress{IP: a})
+		} else {
+			addrs = append(addrs, networking.IngressLoadBalancerIngress{Hostname: a})
+		}
+	}
+
+	slices.SortFunc(addrs, func(a, b networking.IngressLoadBalancerIngress) int {
+		return cmp.Or(cmp.Compare(a.IP, b.IP), cmp.Compare(a.Hostname, b.Hostname))
+	})
+	return slices.CompactFunc(addrs, sameAddress), nil
+}
+
+func sameAddress(a, b networking.IngressLoadBalancerIngress) bool {
+	return a.IP == b.IP && a.Hostname == b.Hostname && len(a.Ports) == 0 && len(b.Ports) == 0
+}
@@ -0,0 +1,148 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	networking "k8s.io/api/networking/v1"
+
+	"github.com/moonrhythm/parapet-ingress-controller/k8s"
+	"github.com/moonrhythm/parapet-ingress-controller/proxy"
+)
+
+const statusFixture = `
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: web
+  namespace: default
+spec:
+  ingressClassName: parapet
+---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: other
+  namespace: default
+spec:
+  ingressClassName: nginx
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: parapet
+  namespace: parapet
+spec:
+  type: LoadBalancer
+status:
+  loadBalancer:
+    ingress:
+    - ip: 203.0.113.10
+    - hostname: lb.example.com
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: pending
+  namespace: parapet
+spec:
+  type: LoadBalancer
+`
+
+// statusController loads statusFixture into the fs backend and a controller
+// watching its Ingresses.
+func statusController(t *testing.T, cfg StatusConfig) *Controller {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "fixture.yaml"), []byte(statusFixture), 0o644))
+	t.Setenv("KUBERNETES_BACKEND", "fs")
+	t.Setenv("KUBERNETES_FS", dir)
+	require.NoError(t, k8s.Init())
+
+	ctrl := New("", proxy.New())
+	ctrl.StatusConfig = cfg
+	ings, err := k8s.GetIngresses(context.Background(), "")
+	require.NoError(t, err)
+	for i := range ings {
+		ctrl.watchedIngresses.Store(ings[i].Namespace+"/"+ings[i].Name, ings[i].DeepCopy())
+	}
+	return ctrl
+}
+
+func publishedStatus(t *testing.T) map[string][]networking.IngressLoadBalancerIngress {
+	t.Helper()
+	ings, err := k8s.GetIngresses(context.Background(), "")
+	require.NoError(t, err)
+	out := map[string][]networking.IngressLoadBalancerIngress{}
+	for _, ing := range ings {
+		out[ing.Name] = ing.Status.LoadBalancer.Ingress
+	}
+	return out
+}
+
+func TestStatusConfigEnabled(t *testing.T) {
+	t.Parallel()
+
+	assert.False(t, StatusConfig{LeaseName: "x"}.Enabled())
+	assert.True(t, StatusConfig{PublishService: "parapet/parapet"}.Enabled())
+	assert.True(t, StatusConfig{Addresses: []string{"203.0.113.1"}}.Enabled())
+}
+
+func TestPublishStatus(t *testing.T) {
+	t.Run("from the publish service and static addresses", func(t *testing.T) {
+		ctrl := statusController(t, StatusConfig{
+			PublishService: "parapet/parapet",
+			Addresses:      []string{"198.51.100.1", "203.0.113.10"},
+		})
+		ctrl.publishStatus(context.Background())
+
+		st := publishedStatus(t)
+		assert.Equal(t, []networking.IngressLoadBalancerIngress{
+			{Hostname: "lb.example.com"},
+			{IP: "198.51.100.1"},
+			{IP: "203.0.113.10"},
+		}, st["web"])
+		assert.Empty(t, st["other"], "another class's ingress is left alone")
+	})
+
+	t.Run("unchanged status is not rewritten", func(t *testing.T) {
+		ctrl := statusController(t, StatusConfig{Addresses: []string{"ingress.example.com"}})
+		want := []networking.IngressLoadBalancerIngress{{Hostname: "ingress.example.com"}}
+		addrs, err := ctrl.statusAddresses(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, want, addrs)
+
+		// the watched copy already carries the status: nothing to write, so the
+		// backend keeps its (empty) one
+		v, _ := ctrl.watchedIngresses.Load("default/web")
+		v.(*networking.Ingress).Status.LoadBalancer.Ingress = want
+		ctrl.publishStatus(context.Background())
+		assert.Empty(t, publishedStatus(t)["web"])
+	})
+
+	t.Run("service without an address publishes nothing", func(t *testing.T) {
+		ctrl := statusController(t, StatusConfig{PublishService: "parapet/pending"})
+		ctrl.publishStatus(context.Background())
+		assert.Empty(t, publishedStatus(t)["web"])
+	})
+
+	t.Run("missing or malformed service publishes nothing", func(t *testing.T) {
+		for _, spec := range []string{"parapet/missing", "parapet"} {
+			ctrl := statusController(t, StatusConfig{PublishService: spec, Addresses: []string{"198.51.100.1"}})
+			ctrl.publishStatus(context.Background())
+			assert.Empty(t, publishedStatus(t)["web"], spec)
+		}
+	})
+
+	t.Run("fs backend leads right away", func(t *testing.T) {
+		ctrl := statusController(t, StatusConfig{Addresses: []string{"198.51.100.1"}, LeaseName: "status"})
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		ctrl.runStatusPublisher(ctx) // one publish, then the cancelled ctx ends it
+		assert.Equal(t, []networking.IngressLoadBalancerIngress{{IP: "198.51.100.1"}}, publishedStatus(t)["web"])
+	})
+}
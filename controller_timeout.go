@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+
+	networking "k8s.io/api/networking/v1"
+
+	"github.com/moonrhythm/parapet-ingress-controller/proxy"
+)
+
+const (
+	upstreamConnectTimeoutAnnotation        = "parapet.moonrhythm.io/upstream-connect-timeout"
+	upstreamResponseHeaderTimeoutAnnotation = "parapet.moonrhythm.io/upstream-response-header-timeout"
+	upstreamIdleTimeoutAnnotation           = "parapet.moonrhythm.io/upstream-idle-timeout"
+)
+
+// ingressTimeouts reads an Ingress's upstream timeout annotations; ok=false
+// when it sets none. A malformed or non-positive duration is logged and its
+// default kept.
+func ingressTimeouts(ing *networking.Ingress) (t proxy.Timeouts, ok bool) {
+	parse := func(annotation string, d *time.Duration) {
+		a := strings.TrimSpace(ing.Annotations[annotation])
+		if a == "" {
+			return
+		}
+		v, err := time.ParseDuration(a)
+		if err != nil || v <= 0 {
+			slog.Error("invalid upstream timeout, using default", "ingress", ing.Namespace+"/"+ing.Name, "annotation", annotation, "value", a)
+			return
+		}
+		*d = v
+		ok = true
+	}
+	parse(upstreamConnectTimeoutAnnotation, &t.Connect)
+	parse(upstreamResponseHeaderTimeoutAnnotation, &t.ResponseHeader)
+	parse(upstreamIdleTimeoutAnnotation, &t.Idle)
+	return
+}
@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"crypto/tls"
+	"log/slog"
+
+	networking "k8s.io/api/networking/v1"
+
+	"github.com/moonrhythm/parapet-ingress-controller/tlspolicy"
+)
+
+// ingressTLSPolicy reads an Ingress's ssl-policy annotations; nil when it sets
+// none. An invalid policy is logged and the listener's default kept.
+func ingressTLSPolicy(ing *networking.Ingress) *tlspolicy.Policy {
+	p, err := tlspolicy.FromAnnotations(ing.Annotations)
+	if err != nil {
+		slog.Error("invalid ssl policy, using default", "ingress", ing.Namespace+"/"+ing.Name, "error", err)
+		return nil
+	}
+	return p
+}
+
+// TLSPolicyConfig serves each host with the TLS policy (ssl-policy) of its
+// Ingresses, resolved per handshake (SNI) like ClientAuthConfig, which it
+// composes with. Other hosts keep base (or its GetConfigForClient).
+func (ctrl *Controller) TLSPolicyConfig(base *tls.Config) *tls.Config {
+	next := base.GetConfigForClient
+	base.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		var c *tls.Config
+		if next != nil {
+			var err error
+			if c, err = next(hello); err != nil {
+				return nil, err
+			}
+		}
+		p := ctrl.routes.Load().tlsPolicies.Lookup(hello.ServerName)
+		if p == nil {
+			return c, nil
+		}
+		if c == nil {
+			c = base.Clone()
+		}
+		p.Apply(c)
+		return c, nil
+	}
+	return base
+}
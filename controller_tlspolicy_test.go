@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/moonrhythm/parapet-ingress-controller/proxy"
+	"github.com/moonrhythm/parapet-ingress-controller/tlspolicy"
+)
+
+func TestTLSPolicyConfig(t *testing.T) {
+	ctrl := New("", proxy.New())
+	ctrl.watchedServices.Store("default/web", clusterIPService("default", "web", 80, 8080))
+	modern := ingressToService("default", "modern", "secure.example.com", "/", "Prefix", "web", 80)
+	modern.Annotations = map[string]string{tlspolicy.PolicyAnnotation: "modern", authTLSVerifyClientAnnotation: "optional_no_ca"}
+	wild := ingressToService("default", "wild", "*.example.net", "/", "Prefix", "web", 80)
+	wild.Annotations = map[string]string{tlspolicy.PolicyAnnotation: "intermediate", tlspolicy.ALPNAnnotation: "http/1.1"}
+	invalid := ingressToService("default", "invalid", "invalid.example.com", "/", "Prefix", "web", 80)
+	invalid.Annotations = map[string]string{tlspolicy.PolicyAnnotation: "ancient"}
+	ctrl.watchedIngresses.Store("default/modern", modern)
+	ctrl.watchedIngresses.Store("default/wild", wild)
+	ctrl.watchedIngresses.Store("default/invalid", invalid)
+	ctrl.watchedIngresses.Store("default/open", ingressToService("default", "open", "open.example.com", "/", "Prefix", "web", 80))
+	ctrl.reloadIngressDebounced()
+
+	base := ctrl.TLSPolicyConfig(ctrl.ClientAuthConfig(&tls.Config{MinVersion: tls.VersionTLS12, NextProtos: []string{"h2", "http/1.1"}}))
+	config := func(serverName string) *tls.Config {
+		t.Helper()
+		c, err := base.GetConfigForClient(&tls.ClientHelloInfo{ServerName: serverName})
+		require.NoError(t, err)
+		return c
+	}
+
+	c := config("Secure.Example.com")
+	if assert.NotNil(t, c) {
+		assert.EqualValues(t, tls.VersionTLS13, c.MinVersion)
+		assert.Equal(t, tls.RequestClientCert, c.ClientAuth, "composes with the client certificate request")
+		assert.Equal(t, []string{"h2", "http/1.1"}, c.NextProtos)
+	}
+	c = config("a.example.net")
+	if assert.NotNil(t, c) {
+		assert.EqualValues(t, tls.VersionTLS12, c.MinVersion)
+		assert.NotEmpty(t, c.CipherSuites)
+		assert.Equal(t, []string{"http/1.1"}, c.NextProtos)
+	}
+	assert.Nil(t, config("invalid.example.com"), "an invalid policy keeps the default")
+	assert.Nil(t, config("open.example.com"))
+	assert.EqualValues(t, tls.VersionTLS12, base.MinVersion, "base is never written")
+}
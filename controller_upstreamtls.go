@@ -0,0 +1,170 @@
+package controller
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+
+	"github.com/moonrhythm/parapet-ingress-controller/proxy"
+)
+
+const (
+	upstreamTLSCASecretAnnotation     = "parapet.moonrhythm.io/upstream-tls-ca-secret"
+	upstreamTLSServerNameAnnotation   = "parapet.moonrhythm.io/upstream-tls-server-name"
+	upstreamTLSClientSecretAnnotation = "parapet.moonrhythm.io/upstream-tls-client-secret"
+)
+
+// upstreamTLSSpec identifies a verified upstream TLS configuration: the
+// Secrets, in namespace, it is built from and the server name it verifies.
+type upstreamTLSSpec struct {
+	namespace    string
+	caSecret     string // ca.crt: the CAs the upstream's certificate must chain to
+	clientSecret string // tls.crt/tls.key: the client certificate presented
+	serverName   string
+}
+
+// upstreamTLSEntry is a spec's configuration as last built, and the
+// resourceVersions of the Secrets it was built from (or the error it failed
+// with).
+type upstreamTLSEntry struct {
+	tls     *proxy.UpstreamTLS
+	version string
+	failed  string
+}
+
+// upstreamTLSFor returns the verified TLS configuration of ing's https
+// backends on svc, or nil when ing has none (the shared, unverified transport
+// serves them). Server name defaults to the Service's cluster DNS name.
+//
+// Entries are shared by every backend with the same spec and survive reloads
+// while a route still uses them, so their connection pools do too. A new
+// entry is built right away; reloadUpstreamTLS rebuilds them on Secret changes.
+func (ctrl *Controller) upstreamTLSFor(ing *networking.Ingress, svc *v1.Service) *proxy.UpstreamTLS {
+	spec := upstreamTLSSpec{
+		namespace:    ing.Namespace,
+		caSecret:     strings.TrimSpace(ing.Annotations[upstreamTLSCASecretAnnotation]),
+		clientSecret: strings.TrimSpace(ing.Annotations[upstreamTLSClientSecretAnnotation]),
+		serverName:   strings.TrimSpace(ing.Annotations[upstreamTLSServerNameAnnotation]),
+	}
+	if spec.caSecret == "" && spec.clientSecret == "" {
+		if spec.serverName != "" {
+			slog.Error("upstream-tls-server-name without upstream-tls-ca-secret, ignoring", "ingress", ing.Namespace+"/"+ing.Name)
+		}
+		return nil
+	}
+	if spec.serverName == "" && spec.caSecret != "" {
+		spec.serverName = buildHost(svc.Namespace, svc.Name)
+	}
+
+	ctrl.upstreamTLSMu.Lock()
+	defer ctrl.upstreamTLSMu.Unlock()
+
+	if e, ok := ctrl.nextUpstreamTLS[spec]; ok {
+		return e.tls
+	}
+	e, ok := ctrl.upstreamTLS[spec]
+	if !ok {
+		e = &upstreamTLSEntry{tls: ctrl.proxy.NewUpstreamTLS()}
+		ctrl.buildUpstreamTLS(spec, e)
+	}
+	if ctrl.nextUpstreamTLS != nil {
+		ctrl.nextUpstreamTLS[spec] = e
+	} else {
+		if ctrl.upstreamTLS == nil {
+			ctrl.upstreamTLS = make(map[upstreamTLSSpec]*upstreamTLSEntry)
+		}
+		ctrl.upstreamTLS[spec] = e
+	}
+	return e.tls
+}
+
+// beginUpstreamTLS starts collecting the entries an Ingress reload uses;
+// commitUpstreamTLS makes them the live set, dropping the rest.
+func (ctrl *Controller) beginUpstreamTLS() {
+	ctrl.upstreamTLSMu.Lock()
+	ctrl.nextUpstreamTLS = make(map[upstreamTLSSpec]*upstreamTLSEntry)
+	ctrl.upstreamTLSMu.Unlock()
+}
+
+func (ctrl *Controller) commitUpstreamTLS() {
+	ctrl.upstreamTLSMu.Lock()
+	ctrl.upstreamTLS, ctrl.nextUpstreamTLS = ctrl.nextUpstreamTLS, nil
+	ctrl.upstreamTLSMu.Unlock()
+}
+
+// reloadUpstreamTLS rebuilds every live configuration whose Secrets changed.
+func (ctrl *Controller) reloadUpstreamTLS() {
+	ctrl.upstreamTLSMu.Lock()
+	defer ctrl.upstreamTLSMu.Unlock()
+
+	for spec, e := range ctrl.upstreamTLS {
+		ctrl.buildUpstreamTLS(spec, e)
+	}
+}
+
+// buildUpstreamTLS (re)builds e from spec's Secrets, unless they are unchanged.
+// A Secret missing or invalid clears the configuration (logged): its backends
+// fail with 502 rather than fall back to an unverified connection.
+func (ctrl *Controller) buildUpstreamTLS(spec upstreamTLSSpec, e *upstreamTLSEntry) {
+	var (
+		config  = &tls.Config{ServerName: spec.serverName}
+		version []string
+		err     error
+	)
+	if spec.caSecret != "" {
+		var s *v1.Secret
+		if s, err = ctrl.upstreamTLSSecret(spec.namespace, spec.caSecret); err == nil {
+			version = append(version, string(s.UID)+"@"+s.ResourceVersion)
+			config.RootCAs = x509.NewCertPool()
+			if !config.RootCAs.AppendCertsFromPEM(s.Data["ca.crt"]) {
+				err = fmt.Errorf("secret %s/%s: no certificate in ca.crt", s.Namespace, s.Name)
+			}
+		}
+	} else {
+		// a client certificate alone: mTLS to an upstream still unverified
+		config.InsecureSkipVerify = true
+	}
+	if spec.clientSecret != "" && err == nil {
+		var s *v1.Secret
+		if s, err = ctrl.upstreamTLSSecret(spec.namespace, spec.clientSecret); err == nil {
+			version = append(version, string(s.UID)+"@"+s.ResourceVersion)
+			var crt tls.Certificate
+			if crt, err = tls.X509KeyPair(s.Data["tls.crt"], s.Data["tls.key"]); err == nil {
+				config.Certificates = []tls.Certificate{crt}
+			} else {
+				err = fmt.Errorf("secret %s/%s: %w", s.Namespace, s.Name, err)
+			}
+		}
+	}
+
+	if err != nil {
+		if msg := err.Error(); msg != e.failed { // once per failure, not per reload
+			slog.Error("can not load upstream tls, failing its backends", "namespace", spec.namespace, "ca", spec.caSecret, "client", spec.clientSecret, "error", err)
+			e.failed = msg
+		}
+		e.version = ""
+		e.tls.Set(nil)
+		return
+	}
+	e.failed = ""
+	v := strings.Join(version, ",")
+	if v == e.version {
+		return
+	}
+	e.version = v
+	e.tls.Set(config)
+	slog.Debug("loaded upstream tls", "namespace", spec.namespace, "ca", spec.caSecret, "client", spec.clientSecret, "serverName", spec.serverName)
+}
+
+func (ctrl *Controller) upstreamTLSSecret(namespace, name string) (*v1.Secret, error) {
+	v, ok := ctrl.watchedSecrets.Load(namespace + "/" + name)
+	if !ok {
+		return nil, fmt.Errorf("secret %s/%s not found", namespace, name)
+	}
+	return v.(*v1.Secret), nil
+}
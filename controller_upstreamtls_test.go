@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/moonrhythm/parapet-ingress-controller/proxy"
+)
+
+func TestUpstreamTLS(t *testing.T) {
+	caPEM, _ := selfSignedCertPEM(t, "web.default.svc.cluster.local")
+	clientPEM, clientKey := selfSignedCertPEM(t, "client")
+
+	ctrl := New("", proxy.New())
+	ctrl.watchedServices.Store("default/web", clusterIPService("default", "web", 443, 8443))
+	ctrl.watchedSecrets.Store("default/ca", secretFixture("default", "ca", "1", map[string][]byte{"ca.crt": caPEM}))
+	ctrl.watchedSecrets.Store("default/client", secretFixture("default", "client", "1", map[string][]byte{"tls.crt": clientPEM, "tls.key": clientKey}))
+	ing := ingressToService("default", "web", "example.com", "/", "Prefix", "web", 443)
+	ing.Annotations = map[string]string{
+		upstreamTLSCASecretAnnotation:     "ca",
+		upstreamTLSClientSecretAnnotation: "client",
+	}
+	ctrl.watchedIngresses.Store("default/web", ing)
+
+	spec := upstreamTLSSpec{namespace: "default", caSecret: "ca", clientSecret: "client", serverName: "web.default.svc.cluster.local"}
+	entry := func() *upstreamTLSEntry {
+		t.Helper()
+		ctrl.upstreamTLSMu.Lock()
+		defer ctrl.upstreamTLSMu.Unlock()
+		require.Len(t, ctrl.upstreamTLS, 1)
+		e := ctrl.upstreamTLS[spec]
+		require.NotNil(t, e, "server name defaults to the Service's")
+		return e
+	}
+
+	ctrl.reloadIngressDebounced()
+	e := entry()
+	assert.Equal(t, "@1,@1", e.version)
+	assert.Empty(t, e.failed)
+
+	t.Run("kept across reloads", func(t *testing.T) {
+		ctrl.reloadIngressDebounced()
+		assert.Same(t, e, entry())
+	})
+
+	t.Run("rebuilt on a Secret change", func(t *testing.T) {
+		ctrl.watchedSecrets.Store("default/client", secretFixture("default", "client", "2", map[string][]byte{"tls.crt": clientPEM, "tls.key": clientKey}))
+		ctrl.reloadSecretDebounced()
+		assert.Equal(t, "@1,@2", entry().version)
+	})
+
+	t.Run("a missing Secret fails it", func(t *testing.T) {
+		ctrl.watchedSecrets.Delete("default/ca")
+		ctrl.reloadSecretDebounced()
+		assert.Empty(t, entry().version)
+		assert.Contains(t, entry().failed, "default/ca not found")
+
+		ctrl.watchedSecrets.Store("default/ca", secretFixture("default", "ca", "3", map[string][]byte{"ca.crt": []byte("junk")}))
+		ctrl.reloadSecretDebounced()
+		assert.Contains(t, entry().failed, "no certificate in ca.crt")
+	})
+
+	t.Run("dropped with its Ingress", func(t *testing.T) {
+		ctrl.watchedIngresses.Delete("default/web")
+		ctrl.reloadIngressDebounced()
+		assert.Empty(t, ctrl.upstreamTLS)
+	})
+
+	t.Run("not configured", func(t *testing.T) {
+		svc := clusterIPService("default", "web", 443, 8443)
+		plain := ingressToService("default", "plain", "example.com", "/", "Prefix", "web", 443)
+		assert.Nil(t, ctrl.upstreamTLSFor(plain, svc))
+		plain.Annotations = map[string]string{upstreamTLSServerNameAnnotation: "web.internal"}
+		assert.Nil(t, ctrl.upstreamTLSFor(plain, svc))
+	})
+}
@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	networking "k8s.io/api/networking/v1"
+
+	"github.com/moonrhythm/parapet-ingress-controller/proxy"
+)
+
+func TestWildcardSuffix(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, ".example.com", wildcardSuffix("a.example.com"))
+	assert.Equal(t, ".b.example.com", wildcardSuffix("a.b.example.com"))
+	assert.Equal(t, ".com", wildcardSuffix("example.com"))
+	assert.Empty(t, wildcardSuffix("localhost"))
+	assert.Empty(t, wildcardSuffix(".example.com"))
+}
+
+func TestBuildWildcards(t *testing.T) {
+	t.Parallel()
+
+	known := buildKnownHosts(map[string]http.Handler{
+		"*.example.com/":    http.NotFoundHandler(),
+		"*.a.example.com/x": http.NotFoundHandler(),
+		"example.com/":      http.NotFoundHandler(),
+		"/":                 http.NotFoundHandler(),
+	})
+	assert.Equal(t, map[string]struct{}{
+		".example.com":   {},
+		".a.example.com": {},
+	}, buildWildcards(known))
+}
+
+func TestReloadIngressWildcardHost(t *testing.T) {
+	newCtrl := func(ings ...*networking.Ingress) *Controller {
+		ctrl := New("", proxy.New())
+		for _, name := range []string{"wild", "wild-api", "exact", "fallback"} {
+			ctrl.watchedServices.Store("default/"+name, clusterIPService("default", name, 80, 8080))
+		}
+		for _, ing := range ings {
+			ctrl.watchedIngresses.Store(ing.Namespace+"/"+ing.Name, ing)
+		}
+		ctrl.reloadIngressDebounced()
+		return ctrl
+	}
+
+	t.Run("matches a single label only", func(t *testing.T) {
+		ctrl := newCtrl(
+			ingressToService("default", "wild", "*.example.com", "/", networking.PathTypePrefix, "wild", 80))
+
+		assert.Equal(t, "wild", servedService(t, ctrl, "a.example.com", "/"))
+		assert.Equal(t, "wild", servedService(t, ctrl, "customer-1.example.com", "/deep/path"))
+		assert.Empty(t, servedService(t, ctrl, "example.com", "/"), "the bare domain is not covered")
+		assert.Empty(t, servedService(t, ctrl, "a.b.example.com", "/"), "two labels are not covered")
+		assert.Empty(t, servedService(t, ctrl, "a.example.org", "/"))
+	})
+
+	t.Run("longest path wins within the wildcard host", func(t *testing.T) {
+		ctrl := newCtrl(
+			ingressToService("default", "wild", "*.example.com", "/", networking.PathTypePrefix, "wild", 80),
+			ingressToService("default", "wild-api", "*.example.com", "/api", networking.PathTypePrefix, "wild-api", 80))
+
+		assert.Equal(t, "wild-api", servedService(t, ctrl, "a.example.com", "/api/users"))
+		assert.Equal(t, "wild", servedService(t, ctrl, "a.example.com", "/other"))
+	})
+
+	t.Run("exact host wins over wildcard", func(t *testing.T) {
+		ctrl := newCtrl(
+			ingressToService("default", "wild", "*.example.com", "/api", networking.PathTypePrefix, "wild", 80),
+			ingressToService("default", "exact", "www.example.com", "/", networking.PathTypePrefix, "exact", 80))
+
+		assert.Equal(t, "exact", servedService(t, ctrl, "www.example.com", "/api"),
+			"a shorter path on the exact host still beats a longer wildcard path")
+		assert.Equal(t, "wild", servedService(t, ctrl, "app.example.com", "/api"))
+	})
+
+	t.Run("unmatched wildcard path falls through to host-less routes", func(t *testing.T) {
+		ctrl := newCtrl(
+			ingressToService("default", "wild", "*.example.com", "/api", networking.PathTypeExact, "wild", 80),
+			ingressToService("default", "fallback", "", "/", networking.PathTypePrefix, "fallback", 80))
+
+		assert.Equal(t, "wild", servedService(t, ctrl, "a.example.com", "/api"))
+		assert.Equal(t, "fallback", servedService(t, ctrl, "a.example.com", "/other"))
+	})
+
+	t.Run("default backend on a wildcard host", func(t *testing.T) {
+		ctrl := newCtrl(withDefaultBackend(
+			ingressToService("default", "wild", "*.example.com", "/api", networking.PathTypeExact, "wild", 80),
+			"fallback", 80))
+
+		assert.Equal(t, "wild", servedService(t, ctrl, "a.example.com", "/api"))
+		assert.Equal(t, "fallback", servedService(t, ctrl, "a.example.com", "/other"))
+	})
+
+	t.Run("covered hosts are known", func(t *testing.T) {
+		ctrl := newCtrl(
+			ingressToService("default", "wild", "*.example.com", "/", networking.PathTypePrefix, "wild", 80))
+
+		assert.True(t, ctrl.IsKnownHost("a.example.com"))
+		assert.True(t, ctrl.IsKnownHost("customer-1.example.com"))
+		assert.False(t, ctrl.IsKnownHost("example.com"))
+		assert.False(t, ctrl.IsKnownHost("a.b.example.com"))
+		assert.False(t, ctrl.IsKnownHost("evil.com"))
+	})
+}
@@ -12,6 +12,7 @@
 package edge
 
 import (
+	"context"
 	"crypto/tls"
 	"strings"
 	"sync"
@@ -21,6 +22,8 @@ import (
 	"golang.org/x/sync/singleflight"
 
 	"github.com/moonrhythm/parapet-ingress-controller/cert"
+	"github.com/moonrhythm/parapet-ingress-controller/metric/observe"
+	"github.com/moonrhythm/parapet-ingress-controller/tlspolicy"
 )
 
 // On-demand (serve-all) fetch guards. A handshake for an unheld SNI blocks on a
@@ -52,6 +55,10 @@ type CertStore struct {
 	cache  map[string]cachedCert // fetch key -> parsed cert + its ETag
 	loaded atomic.Bool           // flips true after the first successful Update (readiness)
 
+	// policies are the ssl-policy by host of every cached cert, merged; read
+	// per handshake by TLSPolicyConfig, rebuilt by Update.
+	policies atomic.Pointer[tlspolicy.Hosts]
+
 	// onDemand, when set (serve-all mode), fetches a missing SNI's cert from the
 	// control plane during the handshake. nil in pinned mode (a miss falls back
 	// to self-signed). Set via SetOnDemand.
@@ -73,8 +80,9 @@ type CertStore struct {
 }
 
 type cachedCert struct {
-	cert *tls.Certificate
-	etag string
+	cert     *tls.Certificate
+	policies tlspolicy.Hosts
+	etag     string
 }
 
 // NewCertStore returns an empty store with the on-demand guards at their defaults
@@ -228,21 +236,31 @@ func (s *CertStore) cached(key string) bool {
 	return ok
 }
 
-// Update installs/replaces the material for a fetch key and atomically rebuilds
-// the SNI index. Returns false if the PEM can't be parsed into a key pair — the
-// caller keeps the old copy (fail-static); the old cert + old ETag are retained.
-func (s *CertStore) Update(key string, chainPEM, keyPEM []byte, etag string) bool {
+// Update installs/replaces the material for a fetch key, with the TLS policies
+// of the hosts it is served for, and atomically rebuilds the SNI index. Returns
+// false if the PEM can't be parsed into a key pair — the caller keeps the old
+// copy (fail-static); the old cert, policies and ETag are retained.
+func (s *CertStore) Update(key string, chainPEM, keyPEM []byte, policies tlspolicy.Hosts, etag string) bool {
 	crt, err := tls.X509KeyPair(chainPEM, keyPEM)
 	if err != nil {
 		return false
 	}
 
 	s.mu.Lock()
-	s.cache[key] = cachedCert{cert: &crt, etag: etag}
+	s.cache[key] = cachedCert{cert: &crt, policies: policies, etag: etag}
 	certs := make([]*tls.Certificate, 0, len(s.cache))
-	for _, c := range s.cache {
+	served := make([]observe.ServedCertificate, 0, len(s.cache))
+	merged := make(tlspolicy.Hosts)
+	for k, c := range s.cache {
 		certs = append(certs, c.cert)
+		served = append(served, observe.ServedCertificate{Secret: k, Leaf: c.cert.Leaf})
+		for host, p := range c.policies {
+			merged[host] = p
+		}
 	}
+	// under mu, so a slower Update can't overwrite a newer set of series
+	observe.SetCertificates(served)
+	s.policies.Store(&merged)
 	s.mu.Unlock()
 
 	// Rebuild the SAN index from every cached cert and swap it in atomically.
@@ -252,6 +270,32 @@ func (s *CertStore) Update(key string, chainPEM, keyPEM []byte, etag string) boo
 	return true
 }
 
+// TLSPolicyConfig serves each host with the TLS policy the control plane sent
+// with its cert, resolved per handshake (SNI) like the controller's
+// TLSPolicyConfig. Other hosts keep base.
+func (s *CertStore) TLSPolicyConfig(base *tls.Config) *tls.Config {
+	base.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		hosts := s.policies.Load()
+		if hosts == nil {
+			return nil, nil
+		}
+		p := hosts.Lookup(hello.ServerName)
+		if p == nil {
+			return nil, nil
+		}
+		c := base.Clone()
+		p.Apply(c)
+		return c, nil
+	}
+	return base
+}
+
+// StapleOCSP staples the held certificates' OCSP responses, fetched in the
+// background until ctx is done; see cert.Table.StapleOCSP.
+func (s *CertStore) StapleOCSP(ctx context.Context) {
+	s.table.StapleOCSP(ctx, nil)
+}
+
 // Etag returns the ETag currently cached for a fetch key (sent as If-None-Match),
 // or "" if none.
 func (s *CertStore) Etag(key string) string {
@@ -9,6 +9,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/moonrhythm/parapet-ingress-controller/tlspolicy"
 )
 
 // get resolves an SNI through the store via the GetCertificate callback,
@@ -28,8 +30,8 @@ func TestCertStore_UpdateThenSNIMatchExactAndWildcard(t *testing.T) {
 	s := NewCertStore()
 	c1, k1 := genCertPEM(t, "acme.com")
 	c2, k2 := genCertPEM(t, "*.acme.com")
-	require.True(t, s.Update("acme.com", c1, k1, `"e1"`))
-	require.True(t, s.Update("*.acme.com", c2, k2, ""))
+	require.True(t, s.Update("acme.com", c1, k1, nil, `"e1"`))
+	require.True(t, s.Update("*.acme.com", c2, k2, nil, ""))
 
 	assert.True(t, get(s, "acme.com"), "exact match")
 	assert.True(t, get(s, "www.acme.com"), "single-label wildcard")
@@ -39,10 +41,41 @@ func TestCertStore_UpdateThenSNIMatchExactAndWildcard(t *testing.T) {
 	assert.Equal(t, 2, s.Len())
 }
 
+func TestCertStore_TLSPolicyConfig(t *testing.T) {
+	s := NewCertStore()
+	base := s.TLSPolicyConfig(&tls.Config{MinVersion: tls.VersionTLS12, NextProtos: []string{"h2", "http/1.1"}})
+	config := func(sni string) *tls.Config {
+		t.Helper()
+		c, err := base.GetConfigForClient(&tls.ClientHelloInfo{ServerName: sni})
+		require.NoError(t, err)
+		return c
+	}
+	assert.Nil(t, config("acme.com"), "nothing loaded")
+
+	c1, k1 := genCertPEM(t, "acme.com")
+	c2, k2 := genCertPEM(t, "*.acme.com")
+	require.True(t, s.Update("acme.com", c1, k1, tlspolicy.Hosts{"acme.com": {MinVersion: tls.VersionTLS13}}, ""))
+	require.True(t, s.Update("*.acme.com", c2, k2, tlspolicy.Hosts{"*.acme.com": {ALPN: []string{"http/1.1"}}}, ""))
+
+	if c := config("ACME.com"); assert.NotNil(t, c) {
+		assert.EqualValues(t, tls.VersionTLS13, c.MinVersion)
+		assert.Equal(t, []string{"h2", "http/1.1"}, c.NextProtos)
+	}
+	if c := config("www.acme.com"); assert.NotNil(t, c) {
+		assert.EqualValues(t, tls.VersionTLS12, c.MinVersion)
+		assert.Equal(t, []string{"http/1.1"}, c.NextProtos)
+	}
+	assert.Nil(t, config("other.com"))
+
+	// a refetch without the policy drops it
+	require.True(t, s.Update("acme.com", c1, k1, nil, ""))
+	assert.Nil(t, config("acme.com"))
+}
+
 func TestCertStore_EtagRoundtripsPerFetchKey(t *testing.T) {
 	s := NewCertStore()
 	c, k := genCertPEM(t, "acme.com")
-	s.Update("acme.com", c, k, `"abc"`)
+	s.Update("acme.com", c, k, nil, `"abc"`)
 	assert.Equal(t, `"abc"`, s.Etag("acme.com"))
 	assert.Equal(t, "", s.Etag("missing.com"))
 }
@@ -50,9 +83,9 @@ func TestCertStore_EtagRoundtripsPerFetchKey(t *testing.T) {
 func TestCertStore_UnparseablePEMKeepsOld(t *testing.T) {
 	s := NewCertStore()
 	c, k := genCertPEM(t, "acme.com")
-	require.True(t, s.Update("acme.com", c, k, `"v1"`))
+	require.True(t, s.Update("acme.com", c, k, nil, `"v1"`))
 	// garbage PEM -> Update returns false, store unchanged (fail static)
-	assert.False(t, s.Update("acme.com", []byte("not a cert"), []byte("nope"), `"v2"`))
+	assert.False(t, s.Update("acme.com", []byte("not a cert"), []byte("nope"), nil, `"v2"`))
 	assert.True(t, get(s, "acme.com"), "old cert still served")
 	assert.Equal(t, `"v1"`, s.Etag("acme.com"), "old etag retained")
 }
@@ -60,9 +93,9 @@ func TestCertStore_UnparseablePEMKeepsOld(t *testing.T) {
 func TestCertStore_UpdateReplacesSameKeyAndRebuildsIndex(t *testing.T) {
 	s := NewCertStore()
 	c1, k1 := genCertPEM(t, "acme.com")
-	s.Update("acme.com", c1, k1, `"v1"`)
+	s.Update("acme.com", c1, k1, nil, `"v1"`)
 	c2, k2 := genCertPEM(t, "acme.com")
-	require.True(t, s.Update("acme.com", c2, k2, `"v2"`))
+	require.True(t, s.Update("acme.com", c2, k2, nil, `"v2"`))
 	assert.Equal(t, 1, s.Len(), "same fetch key replaces, not duplicates")
 	assert.Equal(t, `"v2"`, s.Etag("acme.com"))
 	assert.True(t, get(s, "acme.com"))
@@ -72,7 +105,7 @@ func TestCertStore_LoadedFlag(t *testing.T) {
 	s := NewCertStore()
 	assert.False(t, s.Loaded())
 	c, k := genCertPEM(t, "acme.com")
-	s.Update("acme.com", c, k, "")
+	s.Update("acme.com", c, k, nil, "")
 	assert.True(t, s.Loaded())
 }
 
@@ -83,7 +116,7 @@ func TestCertStore_OnDemandFetchOnMiss(t *testing.T) {
 		calls++
 		if sni == "lazy.com" {
 			c, k := genCertPEM(t, "lazy.com")
-			s.Update(sni, c, k, "")
+			s.Update(sni, c, k, nil, "")
 		}
 	})
 	assert.True(t, get(s, "lazy.com"), "on-demand fetch populated the cert")
@@ -102,7 +135,7 @@ func TestCertStore_OnDemandFetchKeyNormalizesTrailingDotAndCase(t *testing.T) {
 		got = append(got, sni)
 		if sni == "lazy.com" {
 			c, k := genCertPEM(t, "lazy.com")
-			s.Update(sni, c, k, "")
+			s.Update(sni, c, k, nil, "")
 		}
 	})
 	// RFC 6066 forbids a trailing dot, but non-compliant clients send one; the
@@ -148,7 +181,7 @@ func TestCertStore_OnDemandUpdateLiftsSuppression(t *testing.T) {
 		atomic.AddInt32(&calls, 1)
 		if deliver {
 			c, k := genCertPEM(t, sni)
-			s.Update(sni, c, k, "")
+			s.Update(sni, c, k, nil, "")
 		}
 	})
 	assert.False(t, get(s, "lazy.com"), "first attempt misses and negative-caches")
@@ -158,7 +191,7 @@ func TestCertStore_OnDemandUpdateLiftsSuppression(t *testing.T) {
 	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
 	// A cert arriving by any path (here the periodic loop) clears the suppression.
 	c, k := genCertPEM(t, "lazy.com")
-	require.True(t, s.Update("lazy.com", c, k, ""))
+	require.True(t, s.Update("lazy.com", c, k, nil, ""))
 	assert.True(t, get(s, "lazy.com"), "served from the table once a cert lands")
 }
 
@@ -173,7 +206,7 @@ func TestCertStore_OnDemandSingleFlightCollapsesConcurrent(t *testing.T) {
 		once.Do(func() { close(started) })
 		<-release // hold the leader so followers pile into single-flight
 		c, k := genCertPEM(t, sni)
-		s.Update(sni, c, k, "")
+		s.Update(sni, c, k, nil, "")
 	})
 
 	const n = 8
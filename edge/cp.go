@@ -9,12 +9,15 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/moonrhythm/parapet-ingress-controller/tlspolicy"
 )
 
 // Response body caps: a compromised/buggy control plane shouldn't be able to
@@ -99,6 +102,9 @@ type CertFetch struct {
 	ChainPEM []byte
 	KeyPEM   []byte
 	Etag     string
+	// TLSPolicies are the ssl-policy of the hosts the cert is served for, on a
+	// 200 (nil when none is set).
+	TLSPolicies tlspolicy.Hosts
 	// CAID is the signer's target ca_id from the X-Parapet-CA-Id response header. It
 	// is populated on EVERY status (200, 304, and even a 404) — the universal
 	// force-re-mint signal that rides the edge's existing /v1/certs poll. "" means the
@@ -111,8 +117,9 @@ type CertFetch struct {
 }
 
 type certBody struct {
-	ChainPEM string `json:"chain_pem"`
-	KeyPEM   string `json:"key_pem"`
+	ChainPEM    string                     `json:"chain_pem"`
+	KeyPEM      string                     `json:"key_pem"`
+	TLSPolicies map[string]json.RawMessage `json:"tls_policies"`
 }
 
 // FetchCert fetches the cert+key for sni with ETag revalidation. The sni is
@@ -142,11 +149,12 @@ func (c *CpClient) FetchCert(sni, currentEtag string) (CertFetch, error) {
 			return CertFetch{}, fmt.Errorf("decode: %w", err)
 		}
 		return CertFetch{
-			ChainPEM: []byte(body.ChainPEM),
-			KeyPEM:   []byte(body.KeyPEM),
-			Etag:     resp.Header.Get("ETag"),
-			CAID:     caID,
-			SignerFP: signerFP,
+			ChainPEM:    []byte(body.ChainPEM),
+			KeyPEM:      []byte(body.KeyPEM),
+			Etag:        resp.Header.Get("ETag"),
+			TLSPolicies: decodeTLSPolicies(sni, body.TLSPolicies),
+			CAID:        caID,
+			SignerFP:    signerFP,
 		}, nil
 	default:
 		// Surface the target with the error so the caller can still observe a flip
@@ -155,6 +163,25 @@ func (c *CpClient) FetchCert(sni, currentEtag string) (CertFetch, error) {
 	}
 }
 
+// decodeTLSPolicies decodes each host's policy on its own: one this edge
+// doesn't understand (e.g. a suite its Go doesn't support) is logged and the
+// host served with the default, rather than failing the whole cert fetch.
+func decodeTLSPolicies(sni string, raw map[string]json.RawMessage) tlspolicy.Hosts {
+	var hosts tlspolicy.Hosts
+	for host, b := range raw {
+		var p tlspolicy.Policy
+		if err := json.Unmarshal(b, &p); err != nil {
+			slog.Warn("edge: unusable tls policy; serving the host with the default", "sni", sni, "host", host, "error", err)
+			continue
+		}
+		if hosts == nil {
+			hosts = make(tlspolicy.Hosts)
+		}
+		hosts[host] = &p
+	}
+	return hosts
+}
+
 // WafFetch is the outcome of a WAF ruleset fetch.
 type WafFetch struct {
 	// Unchanged is true on a 304.
@@ -1,6 +1,7 @@
 package edge
 
 import (
+	"crypto/tls"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -55,6 +56,20 @@ func TestCpClient_FetchCert200ParsesBodyAndEtagAndSendsBearer(t *testing.T) {
 	assert.Equal(t, "acme.com", gotQuery)
 }
 
+func TestCpClient_FetchCertTLSPolicies(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"chain_pem":"C","key_pem":"K","tls_policies":{` +
+			`"acme.com":{"min_version":"1.3"},` +
+			`"www.acme.com":{"min_version":"1.2","cipher_suites":["TLS_FUTURE_SUITE"]}}}`))
+	}))
+	defer srv.Close()
+	cp, _ := NewCpClient(srv.URL, "t", nil)
+	res, err := cp.FetchCert("acme.com", "")
+	require.NoError(t, err, "a policy this edge can't apply doesn't fail the cert")
+	require.Len(t, res.TLSPolicies, 1)
+	assert.EqualValues(t, tls.VersionTLS13, res.TLSPolicies["acme.com"].MinVersion)
+}
+
 func TestCpClient_FetchCertWildcardSNIEncoded(t *testing.T) {
 	var gotQuery string
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
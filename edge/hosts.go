@@ -1,6 +1,7 @@
 package edge
 
 import (
+	"strings"
 	"sync"
 	"sync/atomic"
 )
@@ -68,6 +69,32 @@ func (h *EdgeHosts) IsKnownHost(host string) bool {
 	if m == nil {
 		return false
 	}
-	_, ok := (*m)[host]
+	return hostInSet(*m, host)
+}
+
+// hostInSet reports whether an Ingress-declared host set covers host, either
+// exactly or through a single-label wildcard rule ("*.acme.com" covers
+// "app.acme.com", not "acme.com" or "a.b.acme.com") — the controller's
+// IsKnownHost semantics.
+func hostInSet(hosts map[string]struct{}, host string) bool {
+	if _, ok := hosts[host]; ok {
+		return true
+	}
+	suffix := wildcardSuffix(host)
+	if suffix == "" {
+		return false
+	}
+	_, ok := hosts["*"+suffix]
 	return ok
 }
+
+// wildcardSuffix returns host without its first label (".acme.com" for
+// "app.acme.com"), or "" when host has no first label to strip. Mirrors the
+// controller's wildcardSuffix.
+func wildcardSuffix(host string) string {
+	i := strings.IndexByte(host, '.')
+	if i <= 0 {
+		return ""
+	}
+	return host[i:]
+}
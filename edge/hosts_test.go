@@ -30,3 +30,13 @@ func TestEdgeHosts_Update(t *testing.T) {
 	assert.False(t, h.IsKnownHost("acme.com"), "removed host is no longer known")
 	assert.EqualValues(t, 6, h.Generation())
 }
+
+func TestEdgeHosts_WildcardHost(t *testing.T) {
+	h := NewEdgeHosts()
+	h.Update(1, []string{"*.acme.com"}, `"h1"`)
+
+	assert.True(t, h.IsKnownHost("app.acme.com"), "a subdomain a wildcard rule covers keeps its own label")
+	assert.False(t, h.IsKnownHost("acme.com"))
+	assert.False(t, h.IsKnownHost("a.b.acme.com"))
+	assert.False(t, h.IsKnownHost("evil.com"))
+}
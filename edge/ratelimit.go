@@ -15,7 +15,7 @@ import (
 // EdgeRateLimit holds the compiled global limit set plus tenant zones fetched
 // from the control plane, and exposes them as parapet middleware. It reuses
 // ratelimitrule (the same runtime the controller uses: hot-swappable Limiter,
-// fixed/sliding strategies, all-or-nothing SetLimits with per-limit counter
+// every algorithm, all-or-nothing SetLimits with per-limit counter
 // carry-over), so a limit shapes traffic identically at the edge and at
 // parapet — but counters are PER EDGE, exactly as the controller's are per
 // pod. The edge enforcing a limit does not relieve the core's own enforcement;
@@ -35,6 +35,7 @@ type EdgeRateLimit struct {
 	knownHosts atomic.Pointer[map[string]struct{}]               // Ingress-declared hosts (host-key collapse)
 
 	newZone func(key string) *ratelimitrule.Limiter
+	shared  *ratelimitrule.SharedStore
 
 	generation atomic.Uint64
 
@@ -57,8 +58,7 @@ func NewEdgeRateLimit(country func(*http.Request) string, asn func(*http.Request
 		if m == nil {
 			return false
 		}
-		_, ok := (*m)[host]
-		return ok
+		return hostInSet(*m, host)
 	}
 	newLimiter := func(namePrefix string) *ratelimitrule.Limiter {
 		return &ratelimitrule.Limiter{
@@ -70,6 +70,7 @@ func NewEdgeRateLimit(country func(*http.Request) string, asn func(*http.Request
 			KnownHost: knownHost,
 			Country:   country,
 			ASN:       asn,
+			Shared:    e.shared,
 		}
 	}
 	e.global = newLimiter("global")
@@ -82,6 +83,14 @@ func NewEdgeRateLimit(country func(*http.Request) string, asn func(*http.Request
 	return e
 }
 
+// SetSharedStore makes `backend: shared` limits count in s, shared by every
+// edge pointed at it; without one they are rejected. Call before the first
+// Update.
+func (e *EdgeRateLimit) SetSharedStore(s *ratelimitrule.SharedStore) {
+	e.shared = s
+	e.global.Shared = s
+}
+
 // Etag returns the ETag of the currently-loaded config (sent as If-None-Match).
 func (e *EdgeRateLimit) Etag() string {
 	e.mu.Lock()
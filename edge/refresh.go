@@ -138,7 +138,7 @@ func RefreshCertOnce(cp *CpClient, store *CertStore, domain string, coord *Remin
 	case res.Unchanged:
 		// 304: cached copy is current.
 	default:
-		if store.Update(domain, res.ChainPEM, res.KeyPEM, res.Etag) {
+		if store.Update(domain, res.ChainPEM, res.KeyPEM, res.TLSPolicies, res.Etag) {
 			slog.Info("edge: cert updated", "domain", domain)
 		} else {
 			slog.Warn("edge: cert PEM unparseable; keeping cached copy", "domain", domain)
@@ -62,8 +62,22 @@ func newZoneMatcher(routeZone, hostZone map[string]string) *zoneMatcher {
 // resolve returns the zone key bound to the request's host+path, if any. Host
 // must already be normalized (host.StripPort + host.ToLower upstream — the mux
 // also strips a port itself, but lowercasing is on the caller).
+//
+// A wildcard rule's patterns carry the literal "*.acme.com" host (the core
+// registers them that way too), so a host with no pattern of its own is looked
+// up again as its wildcard — exact host first, then wildcard, like the core.
+// The matcher only holds zone-bound patterns, so an exact host served by an
+// unbound Ingress under a bound wildcard still resolves to the wildcard's zone
+// here: over-enforcement, the conservative direction (see buildZoneRoutes).
 func (m *zoneMatcher) resolve(r *http.Request) (string, bool) {
-	h, _ := m.mux.Handler(r)
+	h, pattern := m.mux.Handler(r)
+	if pattern == "" {
+		if suffix := wildcardSuffix(r.Host); suffix != "" {
+			wr := *r
+			wr.Host = "*" + suffix
+			h, _ = m.mux.Handler(&wr)
+		}
+	}
 	if zh, ok := h.(zoneHandler); ok {
 		return zh.key, true
 	}
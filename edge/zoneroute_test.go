@@ -0,0 +1,35 @@
+package edge
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func resolveZone(m *zoneMatcher, host, path string) string {
+	key, _ := m.resolve(httptest.NewRequest("GET", "https://"+host+path, nil))
+	return key
+}
+
+func TestZoneMatcher_WildcardHost(t *testing.T) {
+	m := newZoneMatcher(map[string]string{
+		"*.acme.com/":     "ns/wild",
+		"*.acme.com/api":  "ns/wild-api",
+		"*.acme.com/api/": "ns/wild-api",
+		"www.acme.com/":   "ns/www",
+	}, nil)
+
+	assert.Equal(t, "ns/wild", resolveZone(m, "app.acme.com", "/"))
+	assert.Equal(t, "ns/wild-api", resolveZone(m, "app.acme.com", "/api/users"), "longest path wins within the wildcard")
+	assert.Equal(t, "ns/www", resolveZone(m, "www.acme.com", "/api/users"), "exact host wins over wildcard")
+	assert.Empty(t, resolveZone(m, "acme.com", "/"), "the bare domain is not covered")
+	assert.Empty(t, resolveZone(m, "a.b.acme.com", "/"), "only a single label is covered")
+}
+
+func TestZoneMatcher_WildcardLegacyHostZone(t *testing.T) {
+	m := newZoneMatcher(nil, map[string]string{"*.acme.com": "ns/wild"})
+
+	assert.Equal(t, "ns/wild", resolveZone(m, "app.acme.com", "/any"))
+	assert.Empty(t, resolveZone(m, "acme.com", "/any"))
+}
@@ -12,6 +12,8 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+
+	"github.com/moonrhythm/parapet-ingress-controller/tlspolicy"
 )
 
 // certEntry is the material served for one TLS secret: the raw PEM the edge
@@ -30,6 +32,9 @@ type certEntry struct {
 type CertStore struct {
 	mu     sync.RWMutex
 	byName map[string]*certEntry // SAN (lowercased) -> entry
+	// policies are the Ingresses' ssl-policy by host (SetTLSPolicies), served
+	// with the certificate covering each host.
+	policies tlspolicy.Hosts
 	// loaded flips true after the first Set (the reloader's initial cluster list
 	// completed), so the control plane can report readiness via /healthz?ready=1.
 	loaded atomic.Bool
@@ -72,35 +77,65 @@ func (s *CertStore) Set(pairs []PEMPair) {
 			byName[strings.ToLower(n)] = e
 		}
 	}
-	names := make([]string, 0, len(byName))
-	for n := range byName {
-		names = append(names, n)
-	}
-	sort.Strings(names)
+
+	s.mu.Lock()
+	s.byName = byName
+	s.recomputeLocked()
+	s.mu.Unlock()
+	s.loaded.Store(true)
+}
+
+// SetTLSPolicies replaces the ssl-policy by host (derived from Ingresses by
+// the IngressReloader).
+func (s *CertStore) SetTLSPolicies(policies tlspolicy.Hosts) {
+	s.mu.Lock()
+	s.policies = policies
+	s.recomputeLocked()
+	s.mu.Unlock()
+}
+
+// recomputeLocked refreshes the version fingerprint. Caller holds mu.
+func (s *CertStore) recomputeLocked() {
 	var fp strings.Builder
-	for _, n := range names {
+	for _, n := range sortedKeys(s.byName) {
 		fp.WriteString(n)
 		fp.WriteByte('=')
-		fp.WriteString(byName[n].etag)
+		fp.WriteString(s.byName[n].etag)
+		fp.WriteByte('\n')
+	}
+	// absent policies leave the fingerprint as it was before they existed
+	for _, h := range sortedKeys(s.policies) {
+		fp.WriteString("policy ")
+		fp.WriteString(h)
+		fp.WriteByte('=')
+		fp.WriteString(s.policies[h].String())
 		fp.WriteByte('\n')
 	}
 	v := etagOfString(fp.String())
-
-	s.mu.Lock()
-	s.byName = byName
-	s.mu.Unlock()
 	s.version.Store(&v)
-	s.loaded.Store(true)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 // Get resolves an SNI to its cert material: exact, then single-label wildcard.
 func (s *CertStore) Get(sni string) (*certEntry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.getLocked(sni)
+}
+
+func (s *CertStore) getLocked(sni string) (*certEntry, bool) {
 	name := strings.ToLower(strings.TrimSuffix(sni, "."))
 	if name == "" {
 		return nil, false
 	}
-	s.mu.RLock()
-	defer s.mu.RUnlock()
 	if e, ok := s.byName[name]; ok {
 		return e, true
 	}
@@ -112,6 +147,36 @@ func (s *CertStore) Get(sni string) (*certEntry, bool) {
 	return nil, false
 }
 
+// TLSPolicies returns the ssl-policy of every host e's certificate is served
+// for, and the ETag of e with them; e's own ETag when there are none, so an
+// edge's cached validator stays current where no policy is set.
+func (s *CertStore) TLSPolicies(e *certEntry) (tlspolicy.Hosts, string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var hosts tlspolicy.Hosts
+	for _, h := range sortedKeys(s.policies) {
+		if covering, ok := s.getLocked(h); !ok || covering != e {
+			continue
+		}
+		if hosts == nil {
+			hosts = make(tlspolicy.Hosts)
+		}
+		hosts[h] = s.policies[h]
+	}
+	if len(hosts) == 0 {
+		return nil, e.etag
+	}
+	var fp strings.Builder
+	fp.WriteString(e.etag)
+	for _, h := range sortedKeys(hosts) {
+		fp.WriteByte('\n')
+		fp.WriteString(h)
+		fp.WriteByte('=')
+		fp.WriteString(hosts[h].String())
+	}
+	return hosts, etagOfString(fp.String())
+}
+
 // PEMPair is one TLS secret's raw bytes (tls.crt is a leaf-first fullchain).
 type PEMPair struct {
 	ChainPEM []byte
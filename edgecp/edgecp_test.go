@@ -13,6 +13,10 @@ import (
 	"net/http/httptest"
 	"testing"
 	"time"
+
+	networking "k8s.io/api/networking/v1"
+
+	"github.com/moonrhythm/parapet-ingress-controller/tlspolicy"
 )
 
 // selfSigned returns a fullchain PEM + key PEM for the given SANs.
@@ -155,6 +159,63 @@ func TestServerCertEndpoint(t *testing.T) {
 	}
 }
 
+func TestServerCertTLSPolicies(t *testing.T) {
+	store := NewCertStore()
+	store.Set([]PEMPair{selfSigned(t, "acme.com"), selfSigned(t, "*.acme.com")})
+	authz := NewAuthz(map[string][]string{"tok": {"acme.com", "*.acme.com"}})
+	h := NewServer(store, authz).Handler()
+	get := func(sni string) (certResponse, string) {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/v1/certs?sni="+sni, nil)
+		req.Header.Set("Authorization", "Bearer tok")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("want 200, got %d", rec.Code)
+		}
+		var resp certResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp, rec.Header().Get("ETag")
+	}
+
+	_, plainEtag := get("acme.com")
+	version := store.Version()
+
+	store.SetTLSPolicies(buildTLSPolicies([]networking.Ingress{
+		routedIngress("cust1", "web", map[string]string{tlspolicy.PolicyAnnotation: "modern"},
+			httpRule("ACME.com"), httpRule("www.acme.com")),
+		routedIngress("cust1", "web-canary", map[string]string{canaryAnnotation: "true", tlspolicy.PolicyAnnotation: "intermediate"},
+			httpRule("api.acme.com")),
+		routedIngress("cust1", "bad", map[string]string{tlspolicy.PolicyAnnotation: "ancient"},
+			httpRule("bad.acme.com")),
+	}))
+	if store.Version() == version {
+		t.Error("a policy change must change the store version")
+	}
+
+	resp, etag := get("acme.com")
+	if len(resp.TLSPolicies) != 1 || resp.TLSPolicies["acme.com"].String() != "min=1.3" {
+		t.Errorf("acme.com policies = %v, want its own only", resp.TLSPolicies)
+	}
+	if etag == plainEtag {
+		t.Error("the ETag must cover the policies")
+	}
+	resp, _ = get("www.acme.com")
+	if len(resp.TLSPolicies) != 1 || resp.TLSPolicies["www.acme.com"] == nil {
+		t.Errorf("wildcard cert policies = %v, want www.acme.com (a canary's and an invalid one's skipped)", resp.TLSPolicies)
+	}
+
+	store.SetTLSPolicies(nil)
+	if _, etag := get("acme.com"); etag != plainEtag {
+		t.Error("without policies the ETag is the cert's own")
+	}
+	if store.Version() != version {
+		t.Error("without policies the version is the certs' own")
+	}
+}
+
 func TestServerMissingSNI(t *testing.T) {
 	store := NewCertStore()
 	store.Set([]PEMPair{selfSigned(t, "acme.com")})
@@ -11,8 +11,29 @@ import (
 	"k8s.io/apimachinery/pkg/watch"
 
 	"github.com/moonrhythm/parapet-ingress-controller/k8s"
+	"github.com/moonrhythm/parapet-ingress-controller/tlspolicy"
 )
 
+// canaryAnnotation marks a canary Ingress — mirror the controller's
+// (controller_canary.go). A canary's paths are served under the primary
+// Ingress's chain, so its own zone annotations bind nothing; the zone builders
+// skip it.
+const canaryAnnotation = "parapet.moonrhythm.io/canary"
+
+func isCanaryIngress(ing *networking.Ingress) bool {
+	return ing.Annotations[canaryAnnotation] == "true"
+}
+
+// pathRegexAnnotation makes an Ingress's ImplementationSpecific paths regular
+// expressions — mirror the controller's (controller_pathregex.go). A mux can't
+// match them, so the zone builders bind no pattern for them.
+const pathRegexAnnotation = "parapet.moonrhythm.io/path-regex"
+
+func isRegexPath(ing *networking.Ingress, httpPath networking.HTTPIngressPath) bool {
+	return ing.Annotations[pathRegexAnnotation] == "true" &&
+		(httpPath.PathType == nil || *httpPath.PathType == networking.PathTypeImplementationSpecific)
+}
+
 // IngressReloader derives the zone bindings from Ingress objects: for each
 // Ingress carrying the `parapet.moonrhythm.io/waf-zone` annotation, every route
 // pattern its rules register at the controller maps to the resolved zone key
@@ -30,6 +51,7 @@ type IngressReloader struct {
 	rl             *RateLimitStore // optional (nil = rate-limit derivation off)
 	cache          *CacheStore     // optional (nil = cache-override derivation off)
 	hosts          *HostsStore     // optional (nil = /v1/hosts distribution off)
+	certs          *CertStore      // optional (nil = ssl-policy distribution off)
 	watchNamespace string
 	debounce       time.Duration
 }
@@ -69,6 +91,14 @@ func (r *IngressReloader) WithHosts(hosts *HostsStore) *IngressReloader {
 	return r
 }
 
+// WithTLSPolicy wires the cert store so the same Ingress reload also derives
+// the ssl-policy by host, served with each host's certificate on /v1/certs.
+// Returns the reloader for chaining.
+func (r *IngressReloader) WithTLSPolicy(certs *CertStore) *IngressReloader {
+	r.certs = certs
+	return r
+}
+
 // LoadOnce does a single synchronous load (call before serving — see WafReloader).
 func (r *IngressReloader) LoadOnce(ctx context.Context) error { return r.reload(ctx) }
 
@@ -141,9 +171,37 @@ func (r *IngressReloader) reload(ctx context.Context) error {
 	if r.hosts != nil {
 		r.hosts.SetHosts(collectIngressHosts(ings))
 	}
+	if r.certs != nil {
+		r.certs.SetTLSPolicies(buildTLSPolicies(ings))
+	}
 	return nil
 }
 
+// buildTLSPolicies maps each host of an Ingress setting ssl-policy to the
+// policy, resolved as the controller does (tlspolicy.Builder). A canary
+// Ingress sets none, as at the controller, which merges it into its primary.
+// An invalid policy is logged and skipped, leaving the edge's default.
+func buildTLSPolicies(ings []networking.Ingress) tlspolicy.Hosts {
+	var b tlspolicy.Builder
+	for i := range ings {
+		ing := &ings[i]
+		if isCanaryIngress(ing) {
+			continue
+		}
+		p, err := tlspolicy.FromAnnotations(ing.Annotations)
+		if err != nil {
+			slog.Warn("edgecp: invalid ssl-policy; ignoring", "ingress", ing.Namespace+"/"+ing.Name, "err", err)
+			continue
+		}
+		for _, rule := range ing.Spec.Rules {
+			if host := strings.TrimSpace(rule.Host); host != "" {
+				b.Add(ing.Namespace+"/"+ing.Name, host, p)
+			}
+		}
+	}
+	return b.Hosts()
+}
+
 // buildHostZone maps each host of a zone-bound Ingress to its resolved zone key.
 // Last writer wins on host collisions (rare; matches the controller's
 // last-reconciled behavior). Hosts are lowercased to match SNI normalization.
@@ -153,7 +211,7 @@ func buildHostZone(ings []networking.Ingress) map[string]string {
 		ing := &ings[i]
 		raw := ing.Annotations[WAFZoneAnnotation]
 		key, ok := zoneKeyOf(ing.Namespace, raw)
-		if !ok {
+		if !ok || isCanaryIngress(ing) {
 			continue
 		}
 		for _, rule := range ing.Spec.Rules {
@@ -178,7 +236,7 @@ func buildRateLimitHostZone(ings []networking.Ingress) map[string]string {
 		ing := &ings[i]
 		raw := ing.Annotations[RateLimitZoneAnnotation]
 		key, ok := zoneKeyOf(ing.Namespace, raw)
-		if !ok {
+		if !ok || isCanaryIngress(ing) {
 			continue
 		}
 		if !strings.HasPrefix(key, ing.Namespace+"/") {
@@ -201,7 +259,9 @@ func buildRateLimitHostZone(ings []networking.Ingress) map[string]string {
 // (lowercased, deduped, sorted — the order feeds the store fingerprint). The
 // edge wires this as the Limiter's KnownHost, so host-keyed limit buckets for
 // hosts no Ingress declares collapse into one shared bucket — mirroring the
-// controller's IsKnownHost cardinality bound under a random-Host flood.
+// controller's IsKnownHost cardinality bound under a random-Host flood. A
+// wildcard host ("*.acme.com") is listed verbatim; the edge treats it as
+// covering every single-label subdomain, as the controller does.
 func collectIngressHosts(ings []networking.Ingress) []string {
 	seen := map[string]struct{}{}
 	for i := range ings {
@@ -230,8 +290,9 @@ func collectIngressHosts(ings []networking.Ingress) []string {
 // and different zones. Divergences from the controller's registration are
 // deliberate: the CP doesn't watch Services, so routes the controller skips for
 // a missing Service/port still get a binding here (the edge enforcing a zone on
-// a route the core 404s is conservative); a host-less rule is skipped (it can't
-// be scoped to an edge; the core remains authoritative for it); and an
+// a route the core 404s is conservative); a host-less rule and a regex path
+// (path-regex) are skipped (they can't be scoped to an edge mux pattern; the
+// core remains authoritative for them); and an
 // HTTP-less rule (host only, e.g. TLS-only) is skipped because the controller
 // registers no route for it — the core never zone-evaluates that host, so
 // binding it at the edge (as the legacy host-level map did) was
@@ -241,16 +302,26 @@ func collectIngressHosts(ings []networking.Ingress) []string {
 // counter state — see buildRateLimitHostZone); the WAF allows cross-namespace
 // references, mirroring plugin.WAFZone.
 //
+// A canary Ingress binds nothing: the controller serves its paths under the
+// primary Ingress's chain, so the primary's zone applies to both backends.
+//
 // Identical patterns from different ingresses collide last-writer-wins, the
 // same arbitrary resolution the controller's own routes map has — but unlike
 // the host-level maps the collision surface is an exact host+path duplicate,
 // not a whole host.
+//
+// A wildcard rule ("*.acme.com") yields patterns on the literal wildcard host,
+// exactly the keys the controller registers; the edge's zone matcher falls back
+// to them for a host with no pattern of its own. Because only zone-bound
+// Ingresses contribute patterns, an exact host served by an UNBOUND Ingress
+// under a bound wildcard resolves to the wildcard's zone at the edge while the
+// core serves it zone-free — the same conservative over-enforcement as above.
 func buildZoneRoutes(ings []networking.Ingress, annotation string, sameNamespaceOnly bool) map[string]string {
 	rz := map[string]string{}
 	for i := range ings {
 		ing := &ings[i]
 		key, ok := zoneKeyOf(ing.Namespace, ing.Annotations[annotation])
-		if !ok {
+		if !ok || isCanaryIngress(ing) {
 			continue
 		}
 		if sameNamespaceOnly && !strings.HasPrefix(key, ing.Namespace+"/") {
@@ -263,6 +334,9 @@ func buildZoneRoutes(ings []networking.Ingress, annotation string, sameNamespace
 				continue
 			}
 			for _, httpPath := range rule.HTTP.Paths {
+				if isRegexPath(ing, httpPath) {
+					continue
+				}
 				for _, pattern := range routePatterns(host, httpPath) {
 					rz[pattern] = key
 				}
@@ -73,6 +73,24 @@ func TestBuildZoneRoutes(t *testing.T) {
 	}
 }
 
+func TestWildcardHostPassesThrough(t *testing.T) {
+	// A wildcard rule's host is carried verbatim: the edge matches "*.acme.com"
+	// patterns and hosts the same way the controller's router does.
+	ings := []networking.Ingress{
+		routedIngress("cust1", "wild", map[string]string{WAFZoneAnnotation: "z"},
+			httpRule("*.ACME.com", networking.HTTPIngressPath{Path: "/", PathType: pt(networking.PathTypePrefix)})),
+		routedIngress("cust1", "www", nil,
+			httpRule("www.acme.com", networking.HTTPIngressPath{Path: "/", PathType: pt(networking.PathTypePrefix)})),
+	}
+
+	if got, want := buildZoneRoutes(ings, WAFZoneAnnotation, false), map[string]string{"*.acme.com/": "cust1/z"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("zone routes: got %v, want %v", got, want)
+	}
+	if got, want := collectIngressHosts(ings), []string{"*.acme.com", "www.acme.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("hosts: got %v, want %v", got, want)
+	}
+}
+
 func TestBuildZoneRoutesSameNamespaceOnly(t *testing.T) {
 	ings := []networking.Ingress{
 		routedIngress("cust1", "own", map[string]string{RateLimitZoneAnnotation: "basic"},
@@ -88,3 +106,36 @@ func TestBuildZoneRoutesSameNamespaceOnly(t *testing.T) {
 		t.Errorf("got %v, want %v", got, want)
 	}
 }
+
+func TestCanaryIngressBindsNoZone(t *testing.T) {
+	// A canary is served under its primary's chain: its own zone annotation
+	// must not override the primary's binding for the shared route.
+	ings := []networking.Ingress{
+		routedIngress("cust1", "app", map[string]string{WAFZoneAnnotation: "z"},
+			httpRule("acme.com", networking.HTTPIngressPath{Path: "/", PathType: pt(networking.PathTypePrefix)})),
+		routedIngress("cust1", "app-canary", map[string]string{canaryAnnotation: "true", WAFZoneAnnotation: "other"},
+			httpRule("acme.com", networking.HTTPIngressPath{Path: "/", PathType: pt(networking.PathTypePrefix)})),
+	}
+	if got, want := buildZoneRoutes(ings, WAFZoneAnnotation, false), map[string]string{"acme.com/": "cust1/z"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("zone routes: got %v, want %v", got, want)
+	}
+	if got, want := buildHostZone(ings), map[string]string{"acme.com": "cust1/z"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("host zone: got %v, want %v", got, want)
+	}
+}
+
+func TestRegexPathBindsNoZone(t *testing.T) {
+	// A regex path isn't a mux pattern: the edge can't match it, so only the
+	// Ingress's other paths bind.
+	ings := []networking.Ingress{
+		routedIngress("cust1", "app", map[string]string{WAFZoneAnnotation: "z", pathRegexAnnotation: "true"},
+			httpRule("acme.com",
+				networking.HTTPIngressPath{Path: "/api/v[0-9]+"},
+				networking.HTTPIngressPath{Path: "/web", PathType: pt(networking.PathTypePrefix)})),
+	}
+	got := buildZoneRoutes(ings, WAFZoneAnnotation, false)
+	want := map[string]string{"acme.com/web": "cust1/z", "acme.com/web/": "cust1/z"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -11,6 +11,8 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/moonrhythm/parapet-ingress-controller/tlspolicy"
 )
 
 // Server is the edge control-plane HTTP API. It authorizes each request by the
@@ -289,6 +291,10 @@ func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
 type certResponse struct {
 	ChainPEM string `json:"chain_pem"`
 	KeyPEM   string `json:"key_pem"`
+	// TLSPolicies are the ssl-policy of the hosts the certificate is served
+	// for (exact or wildcard host), so the edge enforces what the controller
+	// does; absent where no Ingress sets one.
+	TLSPolicies tlspolicy.Hosts `json:"tls_policies,omitempty"`
 }
 
 // handleCert serves the cert+key for the `sni` query parameter
@@ -334,8 +340,10 @@ func (s *Server) handleCert(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// ETag revalidation: the edge sends its cached validator; unchanged → 304.
-	w.Header().Set("ETag", entry.etag)
-	if match := r.Header.Get("If-None-Match"); match != "" && etagMatch(match, entry.etag) {
+	// The validator covers the TLS policies too, so a policy change refetches.
+	policies, etag := s.certs.TLSPolicies(entry)
+	w.Header().Set("ETag", etag)
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatch(match, etag) {
 		w.WriteHeader(http.StatusNotModified)
 		return
 	}
@@ -343,8 +351,9 @@ func (s *Server) handleCert(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Cache-Control", "no-store") // a private key must not be cached by intermediaries
 	_ = json.NewEncoder(w).Encode(certResponse{
-		ChainPEM: string(entry.chainPEM),
-		KeyPEM:   string(entry.keyPEM),
+		ChainPEM:    string(entry.chainPEM),
+		KeyPEM:      string(entry.keyPEM),
+		TLSPolicies: policies,
 	})
 }
 
@@ -2,6 +2,7 @@ package k8s
 
 import (
 	"context"
+	"log/slog"
 
 	v1 "k8s.io/api/core/v1"
 	discovery "k8s.io/api/discovery/v1"
@@ -9,10 +10,15 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gateway "sigs.k8s.io/gateway-api/pkg/client/clientset/versioned"
 )
 
 type clusterClient struct {
-	client *kubernetes.Clientset
+	client  *kubernetes.Clientset
+	gateway *gateway.Clientset
 }
 
 func (c *clusterClient) WatchIngresses(ctx context.Context, namespace string) (watch.Interface, error) {
@@ -59,6 +65,10 @@ func (c *clusterClient) UpdateSecret(ctx context.Context, namespace string, secr
 	return c.client.CoreV1().Secrets(namespace).Update(ctx, secret, metav1.UpdateOptions{})
 }
 
+func (c *clusterClient) CreateSecret(ctx context.Context, namespace string, secret *v1.Secret) (*v1.Secret, error) {
+	return c.client.CoreV1().Secrets(namespace).Create(ctx, secret, metav1.CreateOptions{})
+}
+
 func (c *clusterClient) GetEndpointSlices(ctx context.Context, namespace string) ([]discovery.EndpointSlice, error) {
 	list, err := c.client.DiscoveryV1().EndpointSlices(namespace).List(ctx, metav1.ListOptions{})
 	if err != nil {
@@ -94,3 +104,86 @@ func (c *clusterClient) GetConfigMaps(ctx context.Context, namespace, labelSelec
 func (c *clusterClient) WatchConfigMaps(ctx context.Context, namespace, labelSelector string) (watch.Interface, error) {
 	return c.client.CoreV1().ConfigMaps(namespace).Watch(ctx, metav1.ListOptions{LabelSelector: labelSelector})
 }
+
+func (c *clusterClient) GetService(ctx context.Context, namespace, name string) (*v1.Service, error) {
+	return c.client.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+func (c *clusterClient) UpdateIngressStatus(ctx context.Context, ing *networking.Ingress) (*networking.Ingress, error) {
+	return c.client.NetworkingV1().Ingresses(ing.Namespace).UpdateStatus(ctx, ing, metav1.UpdateOptions{})
+}
+
+func (c *clusterClient) RunLeaderElection(ctx context.Context, namespace, name, identity string, lead func(ctx context.Context)) {
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Client:     c.client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+	}
+	for ctx.Err() == nil {
+		leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			LeaseDuration:   leaseDuration,
+			RenewDeadline:   renewDeadline,
+			RetryPeriod:     retryPeriod,
+			ReleaseOnCancel: true,
+			Name:            name,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: lead,
+				OnStoppedLeading: func() {
+					slog.Info("k8s: stopped leading", "lease", namespace+"/"+name, "identity", identity)
+				},
+				OnNewLeader: func(leader string) {
+					slog.Info("k8s: leader elected", "lease", namespace+"/"+name, "leader", leader)
+				},
+			},
+		})
+	}
+}
+
+func (c *clusterClient) GetGatewayClasses(ctx context.Context) ([]gatewayv1.GatewayClass, error) {
+	list, err := c.gateway.GatewayV1().GatewayClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+func (c *clusterClient) WatchGatewayClasses(ctx context.Context) (watch.Interface, error) {
+	return c.gateway.GatewayV1().GatewayClasses().Watch(ctx, metav1.ListOptions{})
+}
+
+func (c *clusterClient) GetGateways(ctx context.Context, namespace string) ([]gatewayv1.Gateway, error) {
+	list, err := c.gateway.GatewayV1().Gateways(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+func (c *clusterClient) WatchGateways(ctx context.Context, namespace string) (watch.Interface, error) {
+	return c.gateway.GatewayV1().Gateways(namespace).Watch(ctx, metav1.ListOptions{})
+}
+
+func (c *clusterClient) GetHTTPRoutes(ctx context.Context, namespace string) ([]gatewayv1.HTTPRoute, error) {
+	list, err := c.gateway.GatewayV1().HTTPRoutes(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+func (c *clusterClient) WatchHTTPRoutes(ctx context.Context, namespace string) (watch.Interface, error) {
+	return c.gateway.GatewayV1().HTTPRoutes(namespace).Watch(ctx, metav1.ListOptions{})
+}
+
+func (c *clusterClient) UpdateGatewayClassStatus(ctx context.Context, gc *gatewayv1.GatewayClass) (*gatewayv1.GatewayClass, error) {
+	return c.gateway.GatewayV1().GatewayClasses().UpdateStatus(ctx, gc, metav1.UpdateOptions{})
+}
+
+func (c *clusterClient) UpdateGatewayStatus(ctx context.Context, gw *gatewayv1.Gateway) (*gatewayv1.Gateway, error) {
+	return c.gateway.GatewayV1().Gateways(gw.Namespace).UpdateStatus(ctx, gw, metav1.UpdateOptions{})
+}
+
+func (c *clusterClient) UpdateHTTPRouteStatus(ctx context.Context, route *gatewayv1.HTTPRoute) (*gatewayv1.HTTPRoute, error) {
+	return c.gateway.GatewayV1().HTTPRoutes(route.Namespace).UpdateStatus(ctx, route, metav1.UpdateOptions{})
+}
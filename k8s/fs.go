@@ -21,6 +21,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/yaml"
 	"k8s.io/apimachinery/pkg/watch"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 )
 
 type fsClient struct {
@@ -32,6 +33,9 @@ type fsClient struct {
 	endpoints      []v1.Endpoints
 	secrets        []v1.Secret
 	configmaps     []v1.ConfigMap
+	gatewayClasses []gatewayv1.GatewayClass
+	gateways       []gatewayv1.Gateway
+	httpRoutes     []gatewayv1.HTTPRoute
 }
 
 func newFSClient(dir string) (*fsClient, error) {
@@ -52,6 +56,9 @@ func (c *fsClient) reset() {
 	c.endpoints = nil
 	c.secrets = nil
 	c.configmaps = nil
+	c.gatewayClasses = nil
+	c.gateways = nil
+	c.httpRoutes = nil
 }
 
 func (c *fsClient) load() error {
@@ -208,6 +215,38 @@ func (c *fsClient) addObject(raw []byte) {
 		}
 		c.autofillMeta(&cm.ObjectMeta)
 		c.configmaps = append(c.configmaps, cm)
+	case runtime.TypeMeta{
+		APIVersion: "gateway.networking.k8s.io/v1",
+		Kind:       "GatewayClass",
+	}:
+		var gc gatewayv1.GatewayClass
+		err := c.decode(raw, &gc)
+		if err != nil {
+			return
+		}
+		c.gatewayClasses = append(c.gatewayClasses, gc) // cluster-scoped
+	case runtime.TypeMeta{
+		APIVersion: "gateway.networking.k8s.io/v1",
+		Kind:       "Gateway",
+	}:
+		var gw gatewayv1.Gateway
+		err := c.decode(raw, &gw)
+		if err != nil {
+			return
+		}
+		c.autofillMeta(&gw.ObjectMeta)
+		c.gateways = append(c.gateways, gw)
+	case runtime.TypeMeta{
+		APIVersion: "gateway.networking.k8s.io/v1",
+		Kind:       "HTTPRoute",
+	}:
+		var route gatewayv1.HTTPRoute
+		err := c.decode(raw, &route)
+		if err != nil {
+			return
+		}
+		c.autofillMeta(&route.ObjectMeta)
+		c.httpRoutes = append(c.httpRoutes, route)
 	}
 	ok = true
 }
@@ -281,6 +320,19 @@ func (c *fsClient) UpdateSecret(ctx context.Context, namespace string, secret *v
 	return secret.DeepCopy(), nil
 }
 
+// CreateSecret appends the secret in memory, or fails with AlreadyExists.
+func (c *fsClient) CreateSecret(ctx context.Context, namespace string, secret *v1.Secret) (*v1.Secret, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.secrets {
+		if c.secrets[i].Name == secret.Name && c.secrets[i].Namespace == namespace {
+			return nil, apierrors.NewAlreadyExists(schema.GroupResource{Resource: "secrets"}, secret.Name)
+		}
+	}
+	c.secrets = append(c.secrets, *secret.DeepCopy())
+	return secret.DeepCopy(), nil
+}
+
 func (c *fsClient) GetEndpointSlices(ctx context.Context, namespace string) ([]discovery.EndpointSlice, error) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -318,3 +370,111 @@ func (c *fsClient) WatchConfigMaps(ctx context.Context, namespace, labelSelector
 	ch := make(chan watch.Event)
 	return watch.NewProxyWatcher(ch), nil
 }
+
+func (c *fsClient) GetService(ctx context.Context, namespace, name string) (*v1.Service, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for i := range c.services {
+		s := &c.services[i]
+		if s.Namespace == namespace && s.Name == name {
+			return s.DeepCopy(), nil
+		}
+	}
+	return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "services"}, name)
+}
+
+// UpdateIngressStatus replaces the status of the loaded ingress in memory, so a
+// later GetIngresses sees it. NON-CAS, like UpdateSecret.
+func (c *fsClient) UpdateIngressStatus(ctx context.Context, ing *networking.Ingress) (*networking.Ingress, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.ingresses {
+		cur := &c.ingresses[i]
+		if cur.Namespace == ing.Namespace && cur.Name == ing.Name {
+			cur.Status = *ing.Status.DeepCopy()
+			return cur.DeepCopy(), nil
+		}
+	}
+	return nil, apierrors.NewNotFound(schema.GroupResource{Group: "networking.k8s.io", Resource: "ingresses"}, ing.Name)
+}
+
+// RunLeaderElection leads right away: the fs backend is one process, with no
+// peers to elect among.
+func (c *fsClient) RunLeaderElection(ctx context.Context, namespace, name, identity string, lead func(ctx context.Context)) {
+	lead(ctx)
+}
+
+func (c *fsClient) GetGatewayClasses(ctx context.Context) ([]gatewayv1.GatewayClass, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.gatewayClasses, nil
+}
+
+func (c *fsClient) WatchGatewayClasses(ctx context.Context) (watch.Interface, error) {
+	ch := make(chan watch.Event)
+	return watch.NewProxyWatcher(ch), nil
+}
+
+func (c *fsClient) GetGateways(ctx context.Context, namespace string) ([]gatewayv1.Gateway, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.gateways, nil
+}
+
+func (c *fsClient) WatchGateways(ctx context.Context, namespace string) (watch.Interface, error) {
+	ch := make(chan watch.Event)
+	return watch.NewProxyWatcher(ch), nil
+}
+
+func (c *fsClient) GetHTTPRoutes(ctx context.Context, namespace string) ([]gatewayv1.HTTPRoute, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.httpRoutes, nil
+}
+
+func (c *fsClient) WatchHTTPRoutes(ctx context.Context, namespace string) (watch.Interface, error) {
+	ch := make(chan watch.Event)
+	return watch.NewProxyWatcher(ch), nil
+}
+
+// UpdateGatewayClassStatus, UpdateGatewayStatus and UpdateHTTPRouteStatus
+// replace the status of the loaded object in memory, like
+// UpdateIngressStatus.
+func (c *fsClient) UpdateGatewayClassStatus(ctx context.Context, gc *gatewayv1.GatewayClass) (*gatewayv1.GatewayClass, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.gatewayClasses {
+		cur := &c.gatewayClasses[i]
+		if cur.Name == gc.Name {
+			cur.Status = *gc.Status.DeepCopy()
+			return cur.DeepCopy(), nil
+		}
+	}
+	return nil, apierrors.NewNotFound(schema.GroupResource{Group: gatewayv1.GroupName, Resource: "gatewayclasses"}, gc.Name)
+}
+
+func (c *fsClient) UpdateGatewayStatus(ctx context.Context, gw *gatewayv1.Gateway) (*gatewayv1.Gateway, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.gateways {
+		cur := &c.gateways[i]
+		if cur.Namespace == gw.Namespace && cur.Name == gw.Name {
+			cur.Status = *gw.Status.DeepCopy()
+			return cur.DeepCopy(), nil
+		}
+	}
+	return nil, apierrors.NewNotFound(schema.GroupResource{Group: gatewayv1.GroupName, Resource: "gateways"}, gw.Name)
+}
+
+func (c *fsClient) UpdateHTTPRouteStatus(ctx context.Context, route *gatewayv1.HTTPRoute) (*gatewayv1.HTTPRoute, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.httpRoutes {
+		cur := &c.httpRoutes[i]
+		if cur.Namespace == route.Namespace && cur.Name == route.Name {
+			cur.Status = *route.Status.DeepCopy()
+			return cur.DeepCopy(), nil
+		}
+	}
+	return nil, apierrors.NewNotFound(schema.GroupResource{Group: gatewayv1.GroupName, Resource: "httproutes"}, route.Name)
+}
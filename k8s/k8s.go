@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
 	discovery "k8s.io/api/discovery/v1"
@@ -11,6 +12,8 @@ import (
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gateway "sigs.k8s.io/gateway-api/pkg/client/clientset/versioned"
 )
 
 // Init inits k8s client
@@ -22,12 +25,10 @@ func Init() error {
 			return err
 		}
 
-		k8sClient, err := kubernetes.NewForConfig(config)
+		client, err = newClusterClient(config)
 		if err != nil {
 			return err
 		}
-
-		client = &clusterClient{k8sClient}
 	case "fs":
 		kubeFS := os.Getenv("KUBERNETES_FS")
 		if kubeFS == "" {
@@ -37,13 +38,11 @@ func Init() error {
 		client, err = newFSClient(kubeFS)
 		return err
 	case "local":
-		k8sClient, err := kubernetes.NewForConfig(&rest.Config{
+		var err error
+		client, err = newClusterClient(&rest.Config{
 			Host: "127.0.0.1:8001",
 		})
-		if err != nil {
-			return err
-		}
-		client = &clusterClient{k8sClient}
+		return err
 	}
 
 	return nil
@@ -58,12 +57,37 @@ var client interface {
 	WatchSecrets(ctx context.Context, namespace string) (watch.Interface, error)
 	GetSecret(ctx context.Context, namespace, name string) (*v1.Secret, error)
 	UpdateSecret(ctx context.Context, namespace string, secret *v1.Secret) (*v1.Secret, error)
+	CreateSecret(ctx context.Context, namespace string, secret *v1.Secret) (*v1.Secret, error)
 	GetEndpointSlices(ctx context.Context, namespace string) ([]discovery.EndpointSlice, error)
 	WatchEndpointSlices(ctx context.Context, namespace string) (watch.Interface, error)
 	GetEndpoints(ctx context.Context, namespace string) ([]v1.Endpoints, error)
 	WatchEndpoints(ctx context.Context, namespace string) (watch.Interface, error)
 	GetConfigMaps(ctx context.Context, namespace, labelSelector string) ([]v1.ConfigMap, error)
 	WatchConfigMaps(ctx context.Context, namespace, labelSelector string) (watch.Interface, error)
+	GetService(ctx context.Context, namespace, name string) (*v1.Service, error)
+	UpdateIngressStatus(ctx context.Context, ing *networking.Ingress) (*networking.Ingress, error)
+	RunLeaderElection(ctx context.Context, namespace, name, identity string, lead func(ctx context.Context))
+	GetGatewayClasses(ctx context.Context) ([]gatewayv1.GatewayClass, error)
+	WatchGatewayClasses(ctx context.Context) (watch.Interface, error)
+	GetGateways(ctx context.Context, namespace string) ([]gatewayv1.Gateway, error)
+	WatchGateways(ctx context.Context, namespace string) (watch.Interface, error)
+	GetHTTPRoutes(ctx context.Context, namespace string) ([]gatewayv1.HTTPRoute, error)
+	WatchHTTPRoutes(ctx context.Context, namespace string) (watch.Interface, error)
+	UpdateGatewayClassStatus(ctx context.Context, gc *gatewayv1.GatewayClass) (*gatewayv1.GatewayClass, error)
+	UpdateGatewayStatus(ctx context.Context, gw *gatewayv1.Gateway) (*gatewayv1.Gateway, error)
+	UpdateHTTPRouteStatus(ctx context.Context, route *gatewayv1.HTTPRoute) (*gatewayv1.HTTPRoute, error)
+}
+
+func newClusterClient(config *rest.Config) (*clusterClient, error) {
+	k8sClient, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	gatewayClient, err := gateway.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &clusterClient{k8sClient, gatewayClient}, nil
 }
 
 // WatchIngresses watches ingresses for given namespace
@@ -103,11 +127,18 @@ func GetSecret(ctx context.Context, namespace, name string) (*v1.Secret, error)
 }
 
 // UpdateSecret writes a secret back (a resourceVersion compare-and-swap on the
-// cluster backend). Used ONLY by the edge-CA bootstrap/rotation path.
+// cluster backend). Used by the edge-CA bootstrap/rotation path and the ACME
+// issuer.
 func UpdateSecret(ctx context.Context, namespace string, secret *v1.Secret) (*v1.Secret, error) {
 	return client.UpdateSecret(ctx, namespace, secret)
 }
 
+// CreateSecret creates a secret, failing with AlreadyExists when it does. Used
+// ONLY by the ACME issuer, for the account key and a certificate's Secret.
+func CreateSecret(ctx context.Context, namespace string, secret *v1.Secret) (*v1.Secret, error) {
+	return client.CreateSecret(ctx, namespace, secret)
+}
+
 // GetEndpointSlices lists all endpoint slices
 func GetEndpointSlices(ctx context.Context, namespace string) ([]discovery.EndpointSlice, error) {
 	return client.GetEndpointSlices(ctx, namespace)
@@ -138,3 +169,77 @@ func GetConfigMaps(ctx context.Context, namespace, labelSelector string) ([]v1.C
 func WatchConfigMaps(ctx context.Context, namespace, labelSelector string) (watch.Interface, error) {
 	return client.WatchConfigMaps(ctx, namespace, labelSelector)
 }
+
+// GetService fetches one service by namespace+name. Used by the Ingress status
+// publisher to read the published Service's load balancer address.
+func GetService(ctx context.Context, namespace, name string) (*v1.Service, error) {
+	return client.GetService(ctx, namespace, name)
+}
+
+// UpdateIngressStatus writes ing's status subresource (a resourceVersion
+// compare-and-swap on the cluster backend). Used ONLY by the Ingress status
+// publisher.
+func UpdateIngressStatus(ctx context.Context, ing *networking.Ingress) (*networking.Ingress, error) {
+	return client.UpdateIngressStatus(ctx, ing)
+}
+
+// Leader election timings (the client-go defaults): a dead leader's Lease is
+// taken over within leaseDuration.
+const (
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+)
+
+// RunLeaderElection campaigns for the Lease namespace/name as identity until
+// ctx is done, calling lead while this replica holds it; lead's ctx is
+// cancelled when leadership is lost, and the campaign starts over.
+func RunLeaderElection(ctx context.Context, namespace, name, identity string, lead func(ctx context.Context)) {
+	client.RunLeaderElection(ctx, namespace, name, identity, lead)
+}
+
+// GetGatewayClasses lists all (cluster-scoped) Gateway API gateway classes
+func GetGatewayClasses(ctx context.Context) ([]gatewayv1.GatewayClass, error) {
+	return client.GetGatewayClasses(ctx)
+}
+
+// WatchGatewayClasses watches gateway classes
+func WatchGatewayClasses(ctx context.Context) (watch.Interface, error) {
+	return client.WatchGatewayClasses(ctx)
+}
+
+// GetGateways lists all Gateway API gateways for given namespace
+func GetGateways(ctx context.Context, namespace string) ([]gatewayv1.Gateway, error) {
+	return client.GetGateways(ctx, namespace)
+}
+
+// WatchGateways watches gateways for given namespace
+func WatchGateways(ctx context.Context, namespace string) (watch.Interface, error) {
+	return client.WatchGateways(ctx, namespace)
+}
+
+// GetHTTPRoutes lists all Gateway API http routes for given namespace
+func GetHTTPRoutes(ctx context.Context, namespace string) ([]gatewayv1.HTTPRoute, error) {
+	return client.GetHTTPRoutes(ctx, namespace)
+}
+
+// WatchHTTPRoutes watches http routes for given namespace
+func WatchHTTPRoutes(ctx context.Context, namespace string) (watch.Interface, error) {
+	return client.WatchHTTPRoutes(ctx, namespace)
+}
+
+// UpdateGatewayClassStatus writes gc's status subresource. Like the other
+// status writers below, used ONLY by the status publisher.
+func UpdateGatewayClassStatus(ctx context.Context, gc *gatewayv1.GatewayClass) (*gatewayv1.GatewayClass, error) {
+	return client.UpdateGatewayClassStatus(ctx, gc)
+}
+
+// UpdateGatewayStatus writes gw's status subresource.
+func UpdateGatewayStatus(ctx context.Context, gw *gatewayv1.Gateway) (*gatewayv1.Gateway, error) {
+	return client.UpdateGatewayStatus(ctx, gw)
+}
+
+// UpdateHTTPRouteStatus writes route's status subresource.
+func UpdateHTTPRouteStatus(ctx context.Context, route *gatewayv1.HTTPRoute) (*gatewayv1.HTTPRoute, error) {
+	return client.UpdateHTTPRouteStatus(ctx, route)
+}
@@ -0,0 +1,27 @@
+package metric
+
+import (
+	"github.com/moonrhythm/parapet/pkg/prom"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var _backendEjected = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: prom.Namespace,
+	Name:      "backend_ejected_endpoints",
+}, []string{"service_namespace", "service_name"})
+
+func init() {
+	prom.Registry().MustRegister(_backendEjected)
+}
+
+// BackendEjected sets the number of a Service's endpoints its health checking
+// (active probes or outlier detection) currently ejects from load balancing.
+func BackendEjected(namespace, name string, ejected int) {
+	_backendEjected.WithLabelValues(namespace, name).Set(float64(ejected))
+}
+
+// DeleteBackendEjected drops the gauge of a Service whose health checking
+// was removed.
+func DeleteBackendEjected(namespace, name string) {
+	_backendEjected.DeleteLabelValues(namespace, name)
+}
@@ -0,0 +1,17 @@
+package metric
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackendEjected(t *testing.T) {
+	BackendEjected("default", "ejected-test", 2)
+	assert.Equal(t, 2.0, testutil.ToFloat64(_backendEjected.WithLabelValues("default", "ejected-test")))
+
+	n := testutil.CollectAndCount(_backendEjected)
+	DeleteBackendEjected("default", "ejected-test")
+	assert.Equal(t, n-1, testutil.CollectAndCount(_backendEjected), "the series is gone")
+}
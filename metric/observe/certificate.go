@@ -0,0 +1,47 @@
+package observe
+
+import (
+	"crypto/x509"
+
+	"github.com/moonrhythm/parapet/pkg/prom"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// _certExpiry is the expiry of every certificate a binary serves. A new metric
+// name, registered eagerly: a binary serving no certificate exports no series.
+var _certExpiry *prometheus.GaugeVec
+
+func init() {
+	_certExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: prom.Namespace,
+		Name:      "certificate_expiry_timestamp_seconds",
+		Help:      "Expiry (unix seconds) of a served certificate's leaf.",
+	}, []string{"secret", "namespace", "cn"})
+	prom.Registry().MustRegister(_certExpiry)
+}
+
+// ServedCertificate is a certificate being served, and where it came from.
+type ServedCertificate struct {
+	Secret    string
+	Namespace string
+	Leaf      *x509.Certificate
+}
+
+// SetCertificates replaces the parapet_certificate_expiry_timestamp_seconds
+// series with one per certificate in certs, labeled by its source and the
+// leaf's CN (its first DNS name when it has none), so an alert can catch one
+// nearing expiry. The controller labels by Secret; the edge by the domain it
+// fetched, with no namespace.
+func SetCertificates(certs []ServedCertificate) {
+	_certExpiry.Reset()
+	for _, c := range certs {
+		if c.Leaf == nil {
+			continue
+		}
+		cn := c.Leaf.Subject.CommonName
+		if cn == "" && len(c.Leaf.DNSNames) > 0 {
+			cn = c.Leaf.DNSNames[0]
+		}
+		_certExpiry.WithLabelValues(c.Secret, c.Namespace, cn).Set(float64(c.Leaf.NotAfter.Unix()))
+	}
+}
@@ -0,0 +1,27 @@
+package observe
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetCertificates(t *testing.T) {
+	notAfter := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	SetCertificates([]ServedCertificate{
+		{Secret: "web-tls", Namespace: "default", Leaf: &x509.Certificate{Subject: pkix.Name{CommonName: "example.com"}, NotAfter: notAfter}},
+		{Secret: "*.example.net", Leaf: &x509.Certificate{DNSNames: []string{"*.example.net"}, NotAfter: notAfter}},
+		{Secret: "broken"},
+	})
+	assert.Equal(t, 2, testutil.CollectAndCount(_certExpiry))
+	assert.Equal(t, float64(notAfter.Unix()), testutil.ToFloat64(_certExpiry.WithLabelValues("web-tls", "default", "example.com")))
+	assert.Equal(t, float64(notAfter.Unix()), testutil.ToFloat64(_certExpiry.WithLabelValues("*.example.net", "", "*.example.net")), "no CN: the first DNS name")
+
+	// a Secret no longer served loses its series
+	SetCertificates(nil)
+	assert.Equal(t, 0, testutil.CollectAndCount(_certExpiry))
+}
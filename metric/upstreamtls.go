@@ -0,0 +1,21 @@
+package metric
+
+import (
+	"github.com/moonrhythm/parapet/pkg/prom"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var _upstreamTLSVerifyFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: prom.Namespace,
+	Name:      "upstream_tls_verify_failures",
+}, []string{"service_namespace", "service_name"})
+
+func init() {
+	prom.Registry().MustRegister(_upstreamTLSVerifyFailures)
+}
+
+// UpstreamTLSVerifyFailure counts a TLS handshake with a Service's pod that
+// failed because the pod's certificate didn't verify.
+func UpstreamTLSVerifyFailure(namespace, name string) {
+	_upstreamTLSVerifyFailures.WithLabelValues(namespace, name).Inc()
+}
@@ -11,6 +11,8 @@ import (
 	"github.com/moonrhythm/parapet/pkg/authn"
 	"github.com/moonrhythm/parapet/pkg/headers"
 	"gopkg.in/yaml.v3"
+
+	"github.com/moonrhythm/parapet-ingress-controller/state"
 )
 
 // denyAll mounts a middleware that answers 403 Forbidden to every request,
@@ -66,7 +68,57 @@ func BasicAuth(ctx Context) {
 		return
 	}
 
-	ctx.Use(authn.Basic(user, pass))
+	auth := authn.Basic(user, pass)
+	auth.Realm = ctx.Ingress.Annotations[namespace+"/basic-auth-realm"]
+	auth.Authenticate = recordAuthUser(auth.Authenticate)
+	ctx.Use(auth)
+}
+
+// BasicAuthSecret adds basic auth with the users of an htpasswd file, the
+// auth key of the Secret named by basic-auth-secret in the Ingress's
+// namespace; basic-auth-realm names the realm. lookup resolves the Secret per
+// request, so the secret watcher's updates apply without a mux rebuild; a
+// Secret missing or without a usable user rejects every request. The user
+// goes to the access log (state "authUser").
+func BasicAuthSecret(lookup func(namespace, name string) *Htpasswd) Plugin {
+	return func(ctx Context) {
+		secret := strings.TrimSpace(ctx.Ingress.Annotations[namespace+"/basic-auth-secret"])
+		if secret == "" {
+			return
+		}
+		if ctx.Ingress.Annotations[namespace+"/basic-auth"] != "" {
+			slog.Error("plugin/BasicAuthSecret: both basic-auth and basic-auth-secret, failing closed",
+				"ingress", ctx.ingressID())
+			denyAll(ctx)
+			return
+		}
+		ns := ctx.Ingress.Namespace
+
+		usePrivateCache(ctx)
+		ctx.Use(authn.BasicAuthenticator{
+			Realm: ctx.Ingress.Annotations[namespace+"/basic-auth-realm"],
+			Authenticate: recordAuthUser(func(_ *http.Request, user, pass string) error {
+				h := lookup(ns, secret)
+				if h == nil || !h.Verify(user, pass) {
+					return authn.ErrInvalidCredentials
+				}
+				return nil
+			}),
+		})
+	}
+}
+
+// recordAuthUser records the user authenticate lets through in the request
+// state, for the access log. The authenticator drops the Authorization header,
+// so it can't be read back later in the chain.
+func recordAuthUser(authenticate func(r *http.Request, user, pass string) error) func(r *http.Request, user, pass string) error {
+	return func(r *http.Request, user, pass string) error {
+		if err := authenticate(r, user, pass); err != nil {
+			return err
+		}
+		state.Get(r.Context())["authUser"] = user
+		return nil
+	}
 }
 
 // ForwardAuth adds forward auth
@@ -100,17 +152,7 @@ func ForwardAuth(ctx Context) {
 		denyAll(ctx)
 		return
 	}
-	// Make every response on a forward-auth-gated ingress non-cacheable at the
-	// out-of-cluster edge response cache. That cache is honor-origin and its key
-	// ignores Cookie, so a cached 200 for a gated host would be served to
-	// anonymous users (forward-auth gates the request path, not a cache hit that
-	// answers before the request ever reaches here). Cache-Control: private
-	// makes the edge (a shared cache) refuse to store or serve it — and the edge
-	// honors private even under an aggressive cache-override, so a force-cache
-	// rule can't defeat it. Installed BEFORE the authenticator so it is
-	// outermost: it overrides whatever Cache-Control the upstream sent and also
-	// covers the auth deny/redirect response.
-	ctx.Use(headers.SetResponse("Cache-Control", "private"))
+	usePrivateCache(ctx)
 	ctx.Use(authn.ForwardAuthenticator{
 		URL:                 u,
 		Client:              authHTTPClient,
@@ -118,3 +160,17 @@ func ForwardAuth(ctx Context) {
 		AuthResponseHeaders: obj.AuthResponseHeaders,
 	})
 }
+
+// usePrivateCache makes every response on an auth-gated ingress non-cacheable
+// at the out-of-cluster edge response cache. That cache is honor-origin and
+// its key ignores Cookie, so a cached 200 for a gated host would be served to
+// anonymous users (the auth gates the request path, not a cache hit that
+// answers before the request ever reaches here). Cache-Control: private makes
+// the edge (a shared cache) refuse to store or serve it — and the edge honors
+// private even under an aggressive cache-override, so a force-cache rule can't
+// defeat it. Call it BEFORE installing the authenticator so it is outermost:
+// it overrides whatever Cache-Control the upstream sent and also covers the
+// auth deny/redirect response.
+func usePrivateCache(ctx Context) {
+	ctx.Use(headers.SetResponse("Cache-Control", "private"))
+}
@@ -4,14 +4,18 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/moonrhythm/parapet"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
 	networking "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	. "github.com/moonrhythm/parapet-ingress-controller/plugin"
+	"github.com/moonrhythm/parapet-ingress-controller/state"
 )
 
 func TestBasicAuth(t *testing.T) {
@@ -105,6 +109,92 @@ func TestBasicAuthMalformedFailsClosed(t *testing.T) {
 	}
 }
 
+func TestParseHtpasswd(t *testing.T) {
+	t.Parallel()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("alice-pass"), bcrypt.MinCost)
+	require.NoError(t, err)
+	h, errs := ParseHtpasswd([]byte(fmt.Sprintf(`# users
+alice:%s
+bob:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=
+carol:$apr1$x$y
+nocolon
+
+dave:plain
+`, strings.Replace(string(hash), "$2a$", "$2y$", 1))))
+	assert.Len(t, errs, 3)
+	assert.Equal(t, 2, h.Len())
+
+	assert.True(t, h.Verify("alice", "alice-pass"))
+	assert.True(t, h.Verify("alice", "alice-pass"), "remembered")
+	assert.False(t, h.Verify("alice", "wrong"))
+	assert.True(t, h.Verify("bob", "password"))
+	assert.False(t, h.Verify("bob", "Password"))
+	assert.False(t, h.Verify("carol", "x"))
+	assert.False(t, h.Verify("dave", "plain"))
+
+	assert.False(t, h.Verify("eve", "alice-pass"), "unknown user, checked against a dummy hash")
+}
+
+func TestBasicAuthSecret(t *testing.T) {
+	t.Parallel()
+
+	users, _ := ParseHtpasswd([]byte("bob:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n"))
+	lookup := func(namespace, name string) *Htpasswd {
+		if namespace == "default" && name == "users" {
+			return users
+		}
+		return nil
+	}
+	handler := func(annotations map[string]string) http.Handler {
+		ctx := Context{
+			Middlewares: &parapet.Middlewares{},
+			Ingress: &networking.Ingress{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app", Annotations: annotations},
+			},
+		}
+		BasicAuthSecret(lookup)(ctx)
+		return state.Middleware(false).ServeHandler(ctx.ServeHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-User", state.Get(r.Context())["authUser"])
+		})))
+	}
+	serve := func(h http.Handler, user, pass string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if user != "" {
+			r.SetBasicAuth(user, pass)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	h := handler(map[string]string{
+		"parapet.moonrhythm.io/basic-auth-secret": "users",
+		"parapet.moonrhythm.io/basic-auth-realm":  "Staff",
+	})
+	w := serve(h, "bob", "password")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "bob", w.Header().Get("X-User"))
+	assert.Equal(t, "private", w.Header().Get("Cache-Control"))
+
+	w = serve(h, "bob", "wrong")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Basic realm="Staff"`, w.Header().Get("WWW-Authenticate"))
+	assert.Empty(t, w.Header().Get("X-User"))
+	assert.Equal(t, http.StatusUnauthorized, serve(h, "", "").Code)
+
+	h = handler(map[string]string{"parapet.moonrhythm.io/basic-auth-secret": "other"})
+	assert.Equal(t, http.StatusUnauthorized, serve(h, "bob", "password").Code, "a missing Secret rejects")
+
+	h = handler(map[string]string{
+		"parapet.moonrhythm.io/basic-auth-secret": "users",
+		"parapet.moonrhythm.io/basic-auth":        "bob:password",
+	})
+	assert.Equal(t, http.StatusForbidden, serve(h, "bob", "password").Code, "ambiguous, fails closed")
+
+	assert.Equal(t, http.StatusOK, serve(handler(nil), "", "").Code)
+}
+
 func TestForwardAuth(t *testing.T) {
 	t.Parallel()
 
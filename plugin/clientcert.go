@@ -0,0 +1,135 @@
+package plugin
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/moonrhythm/parapet"
+)
+
+// Headers a client-cert-gated upstream receives. A client never sets them:
+// ClientCertAuth deletes whatever the request carried first.
+const (
+	ClientCertVerifyHeader      = "X-Client-Cert-Verify"      // SUCCESS, FAILED or NONE
+	ClientCertSubjectHeader     = "X-Client-Cert-Subject"     // RFC 2253 subject of the leaf
+	ClientCertFingerprintHeader = "X-Client-Cert-Fingerprint" // hex SHA-256 of the leaf
+	ClientCertHeader            = "X-Client-Cert"             // URL-escaped PEM of the leaf
+)
+
+// Client certificate verification modes (auth-tls-verify-client).
+const (
+	ClientCertVerifyOn           = "on"             // a certificate chaining to the CA is required
+	ClientCertVerifyOptional     = "optional"       // none is fine, but a certificate given must chain
+	ClientCertVerifyOptionalNoCA = "optional_no_ca" // any certificate, passed on unverified
+)
+
+// ClientCertAuth verifies the TLS client certificate on an Ingress with
+// auth-tls-secret, the name of a Secret in its own namespace whose ca.crt
+// holds the CAs a client certificate must chain to. auth-tls-verify-client
+// picks the mode (default on); optional_no_ca needs no Secret.
+//
+// The listener only requests client certificates (see the controller's
+// ClientAuthConfig), so the handshake never fails on one: a request the mode
+// rejects is answered 403. The verdict, and the subject and fingerprint of an
+// accepted certificate, go upstream as headers;
+// auth-tls-pass-certificate-to-upstream adds the certificate itself.
+//
+// lookup resolves the Secret's CA pool on the request path, so a rotated CA
+// applies without a mux rebuild; a Secret missing or without a CA rejects
+// every certificate. isEdge, when non-nil, recognizes the edge proxy's own
+// client certificate: a request through the edge carries no certificate of
+// its client, so it counts as none.
+func ClientCertAuth(lookup func(namespace, name string) *x509.CertPool, isEdge func(*tls.ConnectionState) bool) Plugin {
+	return func(ctx Context) {
+		secret := strings.TrimSpace(ctx.Ingress.Annotations[namespace+"/auth-tls-secret"])
+		mode := strings.TrimSpace(ctx.Ingress.Annotations[namespace+"/auth-tls-verify-client"])
+		if secret == "" && mode == "" {
+			return
+		}
+		switch mode {
+		case "":
+			mode = ClientCertVerifyOn
+		case ClientCertVerifyOn, ClientCertVerifyOptional, ClientCertVerifyOptionalNoCA:
+		default:
+			slog.Error("plugin/ClientCertAuth: invalid auth-tls-verify-client, failing closed",
+				"ingress", ctx.ingressID(), "value", mode)
+			denyAll(ctx)
+			return
+		}
+		if secret == "" && mode != ClientCertVerifyOptionalNoCA {
+			slog.Error("plugin/ClientCertAuth: auth-tls-verify-client without auth-tls-secret, failing closed",
+				"ingress", ctx.ingressID())
+			denyAll(ctx)
+			return
+		}
+		ns := ctx.Ingress.Namespace
+		passCert := ctx.Ingress.Annotations[namespace+"/auth-tls-pass-certificate-to-upstream"] == "true"
+
+		usePrivateCache(ctx)
+		ctx.Use(parapet.MiddlewareFunc(func(h http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				r.Header.Del(ClientCertVerifyHeader)
+				r.Header.Del(ClientCertSubjectHeader)
+				r.Header.Del(ClientCertFingerprintHeader)
+				r.Header.Del(ClientCertHeader)
+
+				var leaf *x509.Certificate
+				if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 && (isEdge == nil || !isEdge(r.TLS)) {
+					leaf = r.TLS.PeerCertificates[0]
+				}
+				if leaf == nil {
+					if mode == ClientCertVerifyOn {
+						http.Error(w, "Forbidden", http.StatusForbidden)
+						return
+					}
+					r.Header.Set(ClientCertVerifyHeader, "NONE")
+					h.ServeHTTP(w, r)
+					return
+				}
+
+				verified := secret != "" && verifyClientCert(r.TLS.PeerCertificates, lookup(ns, secret))
+				if !verified && mode != ClientCertVerifyOptionalNoCA {
+					http.Error(w, "Forbidden", http.StatusForbidden)
+					return
+				}
+				if verified {
+					r.Header.Set(ClientCertVerifyHeader, "SUCCESS")
+				} else {
+					r.Header.Set(ClientCertVerifyHeader, "FAILED")
+				}
+				sum := sha256.Sum256(leaf.Raw)
+				r.Header.Set(ClientCertSubjectHeader, leaf.Subject.String())
+				r.Header.Set(ClientCertFingerprintHeader, hex.EncodeToString(sum[:]))
+				if passCert {
+					r.Header.Set(ClientCertHeader, url.QueryEscape(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw}))))
+				}
+				h.ServeHTTP(w, r)
+			})
+		}))
+	}
+}
+
+// verifyClientCert reports whether chain's leaf is a client certificate
+// chaining to roots, through the rest of chain.
+func verifyClientCert(chain []*x509.Certificate, roots *x509.CertPool) bool {
+	if roots == nil {
+		return false
+	}
+	inter := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		inter.AddCert(c)
+	}
+	_, err := chain[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: inter,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return err == nil
+}
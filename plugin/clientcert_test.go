@@ -0,0 +1,169 @@
+package plugin_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/moonrhythm/parapet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	. "github.com/moonrhythm/parapet-ingress-controller/plugin"
+)
+
+// issueCert returns a certificate for cn, signed by parent (self-signed when
+// nil); isCA marks a CA.
+func issueCert(t *testing.T, cn string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn, Organization: []string{"Example"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if isCA {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+		tmpl.ExtKeyUsage = nil
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	crt, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return crt, key
+}
+
+func TestClientCertAuth(t *testing.T) {
+	t.Parallel()
+
+	ca, caKey := issueCert(t, "ca", true, nil, nil)
+	client, _ := issueCert(t, "client", false, ca, caKey)
+	stranger, _ := issueCert(t, "stranger", false, nil, nil)
+	edge, _ := issueCert(t, "edge", false, nil, nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	lookup := func(namespace, name string) *x509.CertPool {
+		if namespace == "default" && name == "client-ca" {
+			return pool
+		}
+		return nil
+	}
+	isEdge := func(cs *tls.ConnectionState) bool { return cs.PeerCertificates[0] == edge }
+
+	handler := func(annotations map[string]string) http.Handler {
+		ctx := Context{
+			Middlewares: &parapet.Middlewares{},
+			Ingress: &networking.Ingress{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app", Annotations: annotations},
+			},
+		}
+		ClientCertAuth(lookup, isEdge)(ctx)
+		return ctx.ServeHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Verify", r.Header.Get(ClientCertVerifyHeader))
+			w.Header().Set("X-Subject", r.Header.Get(ClientCertSubjectHeader))
+			w.Header().Set("X-Fingerprint", r.Header.Get(ClientCertFingerprintHeader))
+			w.Header().Set("X-Cert", r.Header.Get(ClientCertHeader))
+		}))
+	}
+	serve := func(h http.Handler, crt *x509.Certificate) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+		r.Header.Set(ClientCertVerifyHeader, "SUCCESS") // a client never sets these
+		r.Header.Set(ClientCertSubjectHeader, "CN=admin")
+		if crt != nil {
+			r.TLS.PeerCertificates = []*x509.Certificate{crt}
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("not configured", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve(handler(nil), nil).Code)
+	})
+
+	t.Run("on", func(t *testing.T) {
+		h := handler(map[string]string{"parapet.moonrhythm.io/auth-tls-secret": "client-ca"})
+
+		w := serve(h, client)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "private", w.Header().Get("Cache-Control"))
+		assert.Equal(t, "SUCCESS", w.Header().Get("X-Verify"))
+		assert.Equal(t, "CN=client,O=Example", w.Header().Get("X-Subject"))
+		assert.Len(t, w.Header().Get("X-Fingerprint"), 64)
+		assert.Empty(t, w.Header().Get("X-Cert"))
+
+		assert.Equal(t, http.StatusForbidden, serve(h, nil).Code)
+		assert.Equal(t, http.StatusForbidden, serve(h, stranger).Code)
+		assert.Equal(t, http.StatusForbidden, serve(h, edge).Code, "the edge's certificate is not its client's")
+	})
+
+	t.Run("optional", func(t *testing.T) {
+		h := handler(map[string]string{
+			"parapet.moonrhythm.io/auth-tls-secret":        "client-ca",
+			"parapet.moonrhythm.io/auth-tls-verify-client": "optional",
+		})
+
+		w := serve(h, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "NONE", w.Header().Get("X-Verify"))
+		assert.Empty(t, w.Header().Get("X-Subject"))
+
+		assert.Equal(t, "NONE", serve(h, edge).Header().Get("X-Verify"))
+		assert.Equal(t, "SUCCESS", serve(h, client).Header().Get("X-Verify"))
+		assert.Equal(t, http.StatusForbidden, serve(h, stranger).Code)
+	})
+
+	t.Run("optional_no_ca", func(t *testing.T) {
+		h := handler(map[string]string{
+			"parapet.moonrhythm.io/auth-tls-verify-client":                "optional_no_ca",
+			"parapet.moonrhythm.io/auth-tls-pass-certificate-to-upstream": "true",
+		})
+
+		w := serve(h, stranger)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "FAILED", w.Header().Get("X-Verify"))
+		assert.Equal(t, "CN=stranger,O=Example", w.Header().Get("X-Subject"))
+		pemCert, err := url.QueryUnescape(w.Header().Get("X-Cert"))
+		assert.NoError(t, err)
+		assert.Contains(t, pemCert, "-----BEGIN CERTIFICATE-----")
+
+		assert.Equal(t, "NONE", serve(h, nil).Header().Get("X-Verify"))
+	})
+
+	t.Run("missing CA Secret rejects", func(t *testing.T) {
+		h := handler(map[string]string{"parapet.moonrhythm.io/auth-tls-secret": "other"})
+		assert.Equal(t, http.StatusForbidden, serve(h, client).Code)
+	})
+
+	t.Run("malformed fails closed", func(t *testing.T) {
+		h := handler(map[string]string{
+			"parapet.moonrhythm.io/auth-tls-secret":        "client-ca",
+			"parapet.moonrhythm.io/auth-tls-verify-client": "maybe",
+		})
+		assert.Equal(t, http.StatusForbidden, serve(h, client).Code)
+
+		h = handler(map[string]string{"parapet.moonrhythm.io/auth-tls-verify-client": "optional"})
+		assert.Equal(t, http.StatusForbidden, serve(h, client).Code)
+	})
+}
@@ -0,0 +1,315 @@
+package plugin
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"github.com/moonrhythm/parapet"
+	"github.com/moonrhythm/parapet/pkg/header"
+	"golang.org/x/net/http/httpguts"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gopkg.in/yaml.v3"
+
+	"github.com/moonrhythm/parapet-ingress-controller/geoip"
+)
+
+const defaultExtAuthzTimeout = time.Second
+
+type extAuthzConfig struct {
+	Address  string        `yaml:"address"`
+	TLS      bool          `yaml:"tls"`
+	Timeout  time.Duration `yaml:"timeout"`
+	FailOpen bool          `yaml:"failOpen"`
+}
+
+func parseExtAuthzConfig(a string) (*extAuthzConfig, error) {
+	var c extAuthzConfig
+	dec := yaml.NewDecoder(strings.NewReader(a))
+	dec.KnownFields(true) // a misspelled failOpen must not flip the failure mode
+	if err := dec.Decode(&c); err != nil {
+		return nil, err
+	}
+	if _, port, err := net.SplitHostPort(c.Address); err != nil || port == "" {
+		return nil, fmt.Errorf("invalid address %q, want host:port", c.Address)
+	}
+	if c.Timeout < 0 {
+		return nil, errors.New("negative timeout")
+	}
+	if c.Timeout == 0 {
+		c.Timeout = defaultExtAuthzTimeout
+	}
+	return &c, nil
+}
+
+// ExtAuthz asks an external authorization service, over the Envoy ext_authz
+// gRPC API (envoy.service.auth.v3.Authorization/Check), whether to let a
+// request through, on an Ingress with the ext-authz annotation, a YAML
+// document:
+//
+//	address: opa.policy.svc.cluster.local:9191
+//	tls: false      # true verifies the server against the system roots
+//	timeout: 1s
+//	failOpen: false
+//
+// The Check request carries the method, path, host, scheme, protocol and
+// headers (lowercased, multiple values joined with ","), the client IP as the
+// source address and, in the context extensions, the Ingress (namespace,
+// ingress) and the client's country and asn when country and asn (nil without
+// a GeoIP database) resolve them. The body is not sent.
+//
+// An OK answer lets the request through with its header and query parameter
+// mutations applied upstream and its response headers added to the response;
+// a header without append or append_action overwrites. A denied answer is
+// relayed: its status (default 403), headers and body. Every request is asked,
+// nothing is cached. When the service errors or doesn't answer within
+// timeout, the request is answered 403 unless failOpen, when it goes through
+// unchanged.
+//
+// Connections are shared by address and kept across reloads. A malformed
+// annotation (bad YAML or unknown key, an address without a port, a negative
+// timeout) fails closed.
+func ExtAuthz(country func(*http.Request) string, asn func(*http.Request) int64) Plugin {
+	return func(ctx Context) {
+		a := ctx.Ingress.Annotations[namespace+"/ext-authz"]
+		if strings.TrimSpace(a) == "" {
+			return
+		}
+		c, err := parseExtAuthzConfig(a)
+		if err != nil {
+			slog.Error("plugin/ExtAuthz: malformed ext-authz annotation, failing closed",
+				"ingress", ctx.ingressID(), "error", err)
+			denyAll(ctx)
+			return
+		}
+		cc, err := extAuthzConn(c.Address, c.TLS)
+		if err != nil {
+			slog.Error("plugin/ExtAuthz: malformed ext-authz annotation, failing closed",
+				"ingress", ctx.ingressID(), "error", err)
+			denyAll(ctx)
+			return
+		}
+		client := authv3.NewAuthorizationClient(cc)
+		id := ctx.ingressID()
+		ingress := map[string]string{
+			"namespace": ctx.Ingress.Namespace,
+			"ingress":   ctx.Ingress.Name,
+		}
+
+		usePrivateCache(ctx)
+		ctx.Use(parapet.MiddlewareFunc(func(h http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				checkCtx, cancel := context.WithTimeout(r.Context(), c.Timeout)
+				resp, err := client.Check(checkCtx, extAuthzCheckRequest(r, ingress, country, asn))
+				cancel()
+				if err == nil && resp.GetStatus() == nil {
+					err = errors.New("no status")
+				}
+				if err != nil {
+					slog.Warn("plugin/ExtAuthz: check failed",
+						"ingress", id, "address", c.Address, "failOpen", c.FailOpen, "error", err)
+					if c.FailOpen {
+						h.ServeHTTP(w, r)
+						return
+					}
+					http.Error(w, "Forbidden", http.StatusForbidden)
+					return
+				}
+
+				if codes.Code(resp.GetStatus().GetCode()) != codes.OK {
+					denied := resp.GetDeniedResponse()
+					for _, o := range denied.GetHeaders() {
+						applyHeaderOption(w.Header(), o)
+					}
+					status := int(denied.GetStatus().GetCode())
+					if status < 200 || status > 599 {
+						status = http.StatusForbidden
+					}
+					if body := denied.GetBody(); body != "" {
+						w.WriteHeader(status)
+						w.Write([]byte(body))
+						return
+					}
+					http.Error(w, http.StatusText(status), status)
+					return
+				}
+
+				ok := resp.GetOkResponse()
+				for _, k := range ok.GetHeadersToRemove() {
+					if k == "" || k[0] == ':' || strings.EqualFold(k, "Host") {
+						continue
+					}
+					r.Header.Del(k)
+				}
+				for _, o := range ok.GetHeaders() {
+					applyHeaderOption(r.Header, o)
+				}
+				if len(ok.GetQueryParametersToSet()) > 0 || len(ok.GetQueryParametersToRemove()) > 0 {
+					q := r.URL.Query()
+					for _, k := range ok.GetQueryParametersToRemove() {
+						q.Del(k)
+					}
+					for _, p := range ok.GetQueryParametersToSet() {
+						q.Set(p.GetKey(), p.GetValue())
+					}
+					r.URL.RawQuery = q.Encode()
+				}
+				for _, o := range ok.GetResponseHeadersToAdd() {
+					applyHeaderOption(w.Header(), o)
+				}
+				h.ServeHTTP(w, r)
+			})
+		}))
+	}
+}
+
+type extAuthzConnKey struct {
+	address string
+	tls     bool
+}
+
+var extAuthzConns struct {
+	mu sync.Mutex
+	m  map[extAuthzConnKey]*grpc.ClientConn
+}
+
+// extAuthzConn returns the connection to address, shared by every Ingress
+// naming it; grpc connects lazily and reconnects on its own.
+func extAuthzConn(address string, useTLS bool) (*grpc.ClientConn, error) {
+	k := extAuthzConnKey{address, useTLS}
+
+	extAuthzConns.mu.Lock()
+	defer extAuthzConns.mu.Unlock()
+
+	if cc := extAuthzConns.m[k]; cc != nil {
+		return cc, nil
+	}
+	creds := insecure.NewCredentials()
+	if useTLS {
+		creds = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	}
+	cc, err := grpc.NewClient(address, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+	if extAuthzConns.m == nil {
+		extAuthzConns.m = make(map[extAuthzConnKey]*grpc.ClientConn)
+	}
+	extAuthzConns.m[k] = cc
+	return cc, nil
+}
+
+func extAuthzCheckRequest(r *http.Request, ingress map[string]string, country func(*http.Request) string, asn func(*http.Request) int64) *authv3.CheckRequest {
+	scheme := "http"
+	if r.TLS != nil || header.Get(r.Header, header.XForwardedProto) == "https" {
+		scheme = "https"
+	}
+	hs := make(map[string]string, len(r.Header)+4)
+	for k, vs := range r.Header {
+		hs[strings.ToLower(k)] = strings.Join(vs, ",")
+	}
+	hs[":authority"] = r.Host
+	hs[":method"] = r.Method
+	hs[":path"] = r.URL.RequestURI()
+	hs[":scheme"] = scheme
+
+	ext := make(map[string]string, len(ingress)+2)
+	for k, v := range ingress {
+		ext[k] = v
+	}
+	if country != nil {
+		if v := country(r); v != "" {
+			ext["country"] = v
+		}
+	}
+	if asn != nil {
+		if v := asn(r); v != 0 {
+			ext["asn"] = strconv.FormatInt(v, 10)
+		}
+	}
+
+	var source *authv3.AttributeContext_Peer
+	if ip := geoip.ClientIP(r); ip != nil {
+		source = &authv3.AttributeContext_Peer{
+			Address: &corev3.Address{Address: &corev3.Address_SocketAddress{
+				SocketAddress: &corev3.SocketAddress{Address: ip.String()},
+			}},
+		}
+	}
+
+	return &authv3.CheckRequest{Attributes: &authv3.AttributeContext{
+		Source: source,
+		Request: &authv3.AttributeContext_Request{
+			Time: timestamppb.Now(),
+			Http: &authv3.AttributeContext_HttpRequest{
+				Id:       r.Header.Get("X-Request-Id"),
+				Method:   r.Method,
+				Headers:  hs,
+				Path:     r.URL.RequestURI(),
+				Host:     r.Host,
+				Scheme:   scheme,
+				Query:    r.URL.RawQuery,
+				Size:     r.ContentLength,
+				Protocol: r.Proto,
+			},
+		},
+		ContextExtensions: ext,
+	}}
+}
+
+// applyHeaderOption applies an ext_authz header mutation to h. The deprecated
+// append wins when set; else append_action, except that its zero value
+// (append) is read as overwrite, the ext_authz default for a header without
+// either.
+func applyHeaderOption(h http.Header, o *corev3.HeaderValueOption) {
+	k := o.GetHeader().GetKey()
+	v := o.GetHeader().GetValue()
+	if v == "" {
+		v = string(o.GetHeader().GetRawValue())
+	}
+	if k == "" || k[0] == ':' || !httpguts.ValidHeaderFieldName(k) || !httpguts.ValidHeaderFieldValue(v) {
+		return
+	}
+	if v == "" && !o.GetKeepEmptyValue() {
+		return
+	}
+
+	action := o.GetAppendAction()
+	if action == corev3.HeaderValueOption_APPEND_IF_EXISTS_OR_ADD {
+		action = corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD
+	}
+	if a := o.GetAppend(); a != nil {
+		action = corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD
+		if a.GetValue() {
+			action = corev3.HeaderValueOption_APPEND_IF_EXISTS_OR_ADD
+		}
+	}
+	switch action {
+	case corev3.HeaderValueOption_APPEND_IF_EXISTS_OR_ADD:
+		h.Add(k, v)
+	case corev3.HeaderValueOption_ADD_IF_ABSENT:
+		if len(h.Values(k)) == 0 {
+			h.Set(k, v)
+		}
+	case corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD:
+		h.Set(k, v)
+	case corev3.HeaderValueOption_OVERWRITE_IF_EXISTS:
+		if len(h.Values(k)) > 0 {
+			h.Set(k, v)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package plugin_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/moonrhythm/parapet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	. "github.com/moonrhythm/parapet-ingress-controller/plugin"
+)
+
+// stubAuthz is an ext_authz server answering with check, recording the last
+// request.
+type stubAuthz struct {
+	authv3.UnimplementedAuthorizationServer
+	check func(*authv3.CheckRequest) *authv3.CheckResponse
+
+	mu   sync.Mutex
+	last *authv3.CheckRequest
+}
+
+func (s *stubAuthz) Check(_ context.Context, req *authv3.CheckRequest) (*authv3.CheckResponse, error) {
+	s.mu.Lock()
+	s.last = req
+	s.mu.Unlock()
+	return s.check(req), nil
+}
+
+func (s *stubAuthz) lastRequest() *authv3.CheckRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
+
+func TestExtAuthz(t *testing.T) {
+	t.Parallel()
+
+	stub := &stubAuthz{check: func(req *authv3.CheckRequest) *authv3.CheckResponse {
+		switch req.GetAttributes().GetRequest().GetHttp().GetPath() {
+		case "/slow":
+			time.Sleep(500 * time.Millisecond)
+			fallthrough
+		case "/", "/?a=1&b=2":
+			return &authv3.CheckResponse{
+				Status: &rpcstatus.Status{Code: int32(codes.OK)},
+				HttpResponse: &authv3.CheckResponse_OkResponse{OkResponse: &authv3.OkHttpResponse{
+					Headers: []*corev3.HeaderValueOption{
+						{Header: &corev3.HeaderValue{Key: "x-user", Value: "alice"}},
+						{Header: &corev3.HeaderValue{Key: "x-roles", Value: "admin"}, Append: wrapperspb.Bool(true)},
+						{Header: &corev3.HeaderValue{Key: "x-tenant", Value: "t1"}, AppendAction: corev3.HeaderValueOption_ADD_IF_ABSENT},
+					},
+					HeadersToRemove:         []string{"authorization"},
+					QueryParametersToSet:    []*corev3.QueryParameter{{Key: "a", Value: "3"}},
+					QueryParametersToRemove: []string{"b"},
+					ResponseHeadersToAdd: []*corev3.HeaderValueOption{
+						{Header: &corev3.HeaderValue{Key: "x-authz", Value: "ok"}},
+					},
+				}},
+			}
+		case "/teapot":
+			return &authv3.CheckResponse{
+				Status: &rpcstatus.Status{Code: int32(codes.PermissionDenied)},
+				HttpResponse: &authv3.CheckResponse_DeniedResponse{DeniedResponse: &authv3.DeniedHttpResponse{
+					Status:  &typev3.HttpStatus{Code: typev3.StatusCode_Unauthorized},
+					Headers: []*corev3.HeaderValueOption{{Header: &corev3.HeaderValue{Key: "www-authenticate", Value: "Bearer"}}},
+					Body:    "login first",
+				}},
+			}
+		}
+		return &authv3.CheckResponse{Status: &rpcstatus.Status{Code: int32(codes.PermissionDenied)}}
+	}}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	authv3.RegisterAuthorizationServer(srv, stub)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	address := lis.Addr().String()
+
+	country := func(*http.Request) string { return "TH" }
+	asn := func(*http.Request) int64 { return 131445 }
+	handler := func(annotation string) http.Handler {
+		ctx := Context{
+			Middlewares: &parapet.Middlewares{},
+			Ingress: &networking.Ingress{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "api", Annotations: map[string]string{
+					"parapet.moonrhythm.io/ext-authz": annotation,
+				}},
+			},
+		}
+		ExtAuthz(country, asn)(ctx)
+		return ctx.ServeHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Got-User", r.Header.Get("X-User"))
+			w.Header()["X-Got-Roles"] = r.Header.Values("X-Roles")
+			w.Header().Set("X-Got-Tenant", r.Header.Get("X-Tenant"))
+			w.Header().Set("X-Got-Authorization", r.Header.Get("Authorization"))
+			w.Header().Set("X-Got-Query", r.URL.RawQuery)
+		}))
+	}
+	serve := func(h http.Handler, target string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		r.Header.Set("X-User", "admin") // overwritten
+		r.Header.Set("X-Roles", "user") // appended to
+		r.Header.Set("X-Tenant", "t0")  // kept
+		r.Header.Set("Authorization", "Bearer token")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("not configured", func(t *testing.T) {
+		w := serve(handler(""), "/")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("Cache-Control"))
+	})
+
+	t.Run("allowed", func(t *testing.T) {
+		w := serve(handler("address: "+address), "/?a=1&b=2")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "alice", w.Header().Get("X-Got-User"))
+		assert.Equal(t, []string{"user", "admin"}, w.Header().Values("X-Got-Roles"))
+		assert.Equal(t, "t0", w.Header().Get("X-Got-Tenant"))
+		assert.Empty(t, w.Header().Get("X-Got-Authorization"))
+		assert.Equal(t, "a=3", w.Header().Get("X-Got-Query"))
+		assert.Equal(t, "ok", w.Header().Get("X-Authz"))
+		assert.Equal(t, "private", w.Header().Get("Cache-Control"))
+
+		attrs := stub.lastRequest().GetAttributes()
+		req := attrs.GetRequest().GetHttp()
+		assert.Equal(t, http.MethodGet, req.GetMethod())
+		assert.Equal(t, "/?a=1&b=2", req.GetPath())
+		assert.Equal(t, "example.com", req.GetHost())
+		assert.Equal(t, "http", req.GetScheme())
+		assert.Equal(t, "Bearer token", req.GetHeaders()["authorization"])
+		assert.Equal(t, "192.0.2.1", attrs.GetSource().GetAddress().GetSocketAddress().GetAddress())
+		assert.Equal(t, map[string]string{
+			"namespace": "default",
+			"ingress":   "api",
+			"country":   "TH",
+			"asn":       "131445",
+		}, attrs.GetContextExtensions())
+	})
+
+	t.Run("denied", func(t *testing.T) {
+		w := serve(handler("address: "+address), "/admin")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Equal(t, "private", w.Header().Get("Cache-Control"))
+
+		w = serve(handler("address: "+address), "/teapot")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+		assert.Equal(t, "login first", w.Body.String())
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, serve(handler("{address: "+address+", timeout: 100ms}"), "/slow").Code)
+		w := serve(handler("{address: "+address+", timeout: 100ms, failOpen: true}"), "/slow")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "admin", w.Header().Get("X-Got-User"))
+	})
+
+	t.Run("unavailable", func(t *testing.T) {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		down := lis.Addr().String()
+		lis.Close()
+
+		assert.Equal(t, http.StatusForbidden, serve(handler("address: "+down), "/").Code)
+		assert.Equal(t, http.StatusOK, serve(handler("{address: "+down+", failOpen: true}"), "/").Code)
+	})
+
+	t.Run("malformed fails closed", func(t *testing.T) {
+		for _, a := range []string{
+			"address: [",
+			"timeout: 1s",
+			"address: authz",
+			"{address: " + address + ", failopen: true}",
+			"{address: " + address + ", timeout: -1s}",
+		} {
+			assert.Equal(t, http.StatusForbidden, serve(handler(a), "/").Code, a)
+		}
+	})
+}
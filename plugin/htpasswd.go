@@ -0,0 +1,109 @@
+package plugin
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Htpasswd is the users of an htpasswd file and their password hashes:
+// bcrypt ($2y$, $2a$, $2b$) or {SHA} (base64 SHA-1).
+type Htpasswd struct {
+	users map[string]string
+
+	// verified remembers, by user, the SHA-256 of the password last verified
+	// against a bcrypt hash, so a user's every request doesn't pay for bcrypt.
+	mu       sync.Mutex
+	verified map[string][sha256.Size]byte
+
+	// cost is the highest bcrypt cost of the users' hashes (0: none is
+	// bcrypt); an unknown user is checked against dummy, a hash of that cost
+	// made on first use, so the time taken doesn't tell which users exist.
+	cost      int
+	dummyOnce sync.Once
+	dummy     []byte
+}
+
+// ParseHtpasswd reads an htpasswd file. Lines it can't use (no colon, an
+// unsupported hash such as $apr1$ or plaintext) are skipped, each reported
+// in errs.
+func ParseHtpasswd(b []byte) (h *Htpasswd, errs []error) {
+	h = &Htpasswd{users: make(map[string]string), verified: make(map[string][sha256.Size]byte)}
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			errs = append(errs, fmt.Errorf("line %d: malformed", n))
+			continue
+		}
+		if !isBcrypt(hash) && !strings.HasPrefix(hash, "{SHA}") {
+			errs = append(errs, fmt.Errorf("line %d: unsupported hash for user %q", n, user))
+			continue
+		}
+		h.users[user] = hash
+		if cost, err := bcrypt.Cost([]byte(hash)); err == nil {
+			h.cost = max(h.cost, cost)
+		}
+	}
+	return h, errs
+}
+
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2y$") || strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$")
+}
+
+// Len returns the number of users.
+func (h *Htpasswd) Len() int { return len(h.users) }
+
+// Verify reports whether pass is user's password.
+func (h *Htpasswd) Verify(user, pass string) bool {
+	hash, ok := h.users[user]
+	if !ok {
+		if h.cost > 0 {
+			bcrypt.CompareHashAndPassword(h.dummyHash(), []byte(pass))
+		}
+		return false
+	}
+	if sha, ok := strings.CutPrefix(hash, "{SHA}"); ok {
+		sum := sha1.Sum([]byte(pass))
+		return subtle.ConstantTimeCompare([]byte(base64.StdEncoding.EncodeToString(sum[:])), []byte(sha)) == 1
+	}
+
+	sum := sha256.Sum256([]byte(pass))
+	h.mu.Lock()
+	last, ok := h.verified[user]
+	h.mu.Unlock()
+	if ok && subtle.ConstantTimeCompare(last[:], sum[:]) == 1 {
+		return true
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)) != nil {
+		return false
+	}
+	h.mu.Lock()
+	h.verified[user] = sum
+	h.mu.Unlock()
+	return true
+}
+
+// dummyHash returns the bcrypt hash unknown users are checked against.
+func (h *Htpasswd) dummyHash() []byte {
+	h.dummyOnce.Do(func() {
+		pass := make([]byte, 16)
+		rand.Read(pass)
+		h.dummy, _ = bcrypt.GenerateFromPassword(pass, h.cost)
+	})
+	return h.dummy
+}
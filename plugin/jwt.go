@@ -0,0 +1,374 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/moonrhythm/parapet"
+	"github.com/moonrhythm/parapet/pkg/waf"
+	"golang.org/x/net/http/httpguts"
+	"gopkg.in/yaml.v3"
+)
+
+const defaultJWKSRefresh = 10 * time.Minute
+
+// jwtAlgorithms are the signature algorithms jwt-auth accepts by name. The
+// default is the asymmetric ones; an HMAC one must be listed explicitly.
+var jwtAlgorithms = map[string]jose.SignatureAlgorithm{
+	"RS256": jose.RS256, "RS384": jose.RS384, "RS512": jose.RS512,
+	"PS256": jose.PS256, "PS384": jose.PS384, "PS512": jose.PS512,
+	"ES256": jose.ES256, "ES384": jose.ES384, "ES512": jose.ES512,
+	"EdDSA": jose.EdDSA,
+	"HS256": jose.HS256, "HS384": jose.HS384, "HS512": jose.HS512,
+}
+
+var defaultJWTAlgorithms = []jose.SignatureAlgorithm{
+	jose.RS256, jose.RS384, jose.RS512,
+	jose.PS256, jose.PS384, jose.PS512,
+	jose.ES256, jose.ES384, jose.ES512,
+	jose.EdDSA,
+}
+
+// stringList is a YAML string or list of strings.
+type stringList []string
+
+func (l *stringList) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		*l = stringList{n.Value}
+		return nil
+	}
+	var xs []string
+	if err := n.Decode(&xs); err != nil {
+		return err
+	}
+	*l = xs
+	return nil
+}
+
+type jwtAuthConfig struct {
+	JWKSURL       string                `yaml:"jwksURL"`
+	Secret        string                `yaml:"secret"`
+	Issuer        string                `yaml:"issuer"`
+	Audience      stringList            `yaml:"audience"`
+	Algorithms    []string              `yaml:"algorithms"`
+	RequireClaims map[string]stringList `yaml:"requireClaims"`
+	ClaimHeaders  map[string]string     `yaml:"claimHeaders"`
+	Leeway        *time.Duration        `yaml:"leeway"`
+	JWKSRefresh   time.Duration         `yaml:"jwksRefresh"`
+}
+
+func parseJWTAuthConfig(a string) (*jwtAuthConfig, error) {
+	var c jwtAuthConfig
+	dec := yaml.NewDecoder(strings.NewReader(a))
+	dec.KnownFields(true) // a misspelled requireClaims must not pass every token
+	if err := dec.Decode(&c); err != nil {
+		return nil, err
+	}
+	if (c.JWKSURL == "") == (c.Secret == "") {
+		return nil, errors.New("exactly one of jwksURL and secret is required")
+	}
+	if c.JWKSURL != "" {
+		u, err := url.Parse(c.JWKSURL)
+		if err != nil {
+			return nil, err
+		}
+		if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return nil, fmt.Errorf("invalid jwksURL %q", c.JWKSURL)
+		}
+	}
+	for _, alg := range c.Algorithms {
+		if _, ok := jwtAlgorithms[alg]; !ok {
+			return nil, fmt.Errorf("unknown algorithm %q", alg)
+		}
+	}
+	for claim, header := range c.ClaimHeaders {
+		if claim == "" || !httpguts.ValidHeaderFieldName(header) {
+			return nil, fmt.Errorf("invalid claim header %q: %q", claim, header)
+		}
+	}
+	if c.Leeway != nil && *c.Leeway < 0 || c.JWKSRefresh < 0 {
+		return nil, errors.New("negative duration")
+	}
+	return &c, nil
+}
+
+// JWTAuth validates a bearer token (Authorization: Bearer) on an Ingress with
+// the jwt-auth annotation, a YAML document:
+//
+//	jwksURL: https://issuer.example.com/.well-known/jwks.json # or
+//	secret: api-keys   # a Secret in the Ingress's namespace
+//	issuer: https://issuer.example.com/
+//	audience: api      # or a list, any of which the token must name
+//	algorithms: [RS256]
+//	requireClaims: {scope: read, email_verified: "true"}
+//	claimHeaders: {sub: X-User}
+//	leeway: 1m
+//	jwksRefresh: 10m
+//
+// The signature is checked against the keys of jwksURL, fetched on first use
+// and refreshed in the background once older than jwksRefresh (and, rate
+// limited, when a token names a key it doesn't know), or against the Secret's,
+// resolved per request by lookup so a rotated key applies without a mux
+// rebuild. A token must carry exp; exp, nbf and iat are checked with leeway
+// (default 1m), iss and aud when configured. A missing or invalid token is
+// answered 401; one lacking a required claim 403.
+//
+// A required claim must be present and, when values are given, match one:
+// a string claim is split on spaces (like an OAuth scope), a list claim
+// matches on any element, other claims on their JSON form.
+//
+// The claims of a token let through are request.jwt to the CEL of the
+// plugins after it (WAF zone, rate limit filters, transform); mount it before
+// them. claimHeaders are sent upstream by JWTClaimHeaders.
+//
+// A malformed annotation (bad YAML or unknown key, no or both key sources,
+// unknown algorithm, invalid header name) fails closed.
+func JWTAuth(lookup func(namespace, name string) *jose.JSONWebKeySet) Plugin {
+	return func(ctx Context) {
+		a := ctx.Ingress.Annotations[namespace+"/jwt-auth"]
+		if strings.TrimSpace(a) == "" {
+			return
+		}
+		c, err := parseJWTAuthConfig(a)
+		if err != nil {
+			slog.Error("plugin/JWTAuth: malformed jwt-auth annotation, failing closed",
+				"ingress", ctx.ingressID(), "error", err)
+			denyAll(ctx)
+			return
+		}
+
+		algs := defaultJWTAlgorithms
+		if len(c.Algorithms) > 0 {
+			algs = nil
+			for _, alg := range c.Algorithms {
+				algs = append(algs, jwtAlgorithms[alg])
+			}
+		}
+		expected := jwt.Expected{Issuer: c.Issuer, AnyAudience: jwt.Audience(c.Audience)}
+		leeway := jwt.DefaultLeeway
+		if c.Leeway != nil {
+			leeway = *c.Leeway
+		}
+
+		var keys func(kid string) []jose.JSONWebKey
+		if c.JWKSURL != "" {
+			maxAge := c.JWKSRefresh
+			if maxAge == 0 {
+				maxAge = defaultJWKSRefresh
+			}
+			keys = remoteKeys(c.JWKSURL, maxAge)
+		} else {
+			ns, secret := ctx.Ingress.Namespace, c.Secret
+			keys = func(kid string) []jose.JSONWebKey {
+				return candidateKeys(lookup(ns, secret), kid)
+			}
+		}
+
+		usePrivateCache(ctx)
+		ctx.Use(parapet.MiddlewareFunc(func(h http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				raw, ok := bearerToken(r)
+				if !ok {
+					w.Header().Set("WWW-Authenticate", "Bearer")
+					http.Error(w, "Unauthorized", http.StatusUnauthorized)
+					return
+				}
+				claims, err := verifyJWT(raw, algs, keys, expected, leeway)
+				if err != nil {
+					w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+					http.Error(w, "Unauthorized", http.StatusUnauthorized)
+					return
+				}
+				for claim, values := range c.RequireClaims {
+					if !claimMatches(claims[claim], values) {
+						http.Error(w, "Forbidden", http.StatusForbidden)
+						return
+					}
+				}
+				rctx := waf.WithRequestFields(r.Context(), map[string]any{"jwt": claims})
+				h.ServeHTTP(w, r.WithContext(context.WithValue(rctx, jwtClaimsKey{}, claims)))
+			})
+		}))
+	}
+}
+
+type jwtClaimsKey struct{}
+
+// JWTClaimHeaders sends the claimHeaders of the jwt-auth annotation upstream,
+// from the claims JWTAuth verified: a string claim as is, others JSON encoded;
+// whatever the client (or a transform) put in them is removed first. It is
+// split from JWTAuth so it can run after the transform, like ForwardAuth's
+// identity headers, while the claims reach CEL before it. A malformed
+// annotation is left to JWTAuth, which fails closed.
+func JWTClaimHeaders(ctx Context) {
+	a := ctx.Ingress.Annotations[namespace+"/jwt-auth"]
+	if strings.TrimSpace(a) == "" {
+		return
+	}
+	c, err := parseJWTAuthConfig(a)
+	if err != nil || len(c.ClaimHeaders) == 0 {
+		return
+	}
+
+	ctx.Use(parapet.MiddlewareFunc(func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, header := range c.ClaimHeaders {
+				r.Header.Del(header)
+			}
+			claims, _ := r.Context().Value(jwtClaimsKey{}).(map[string]any)
+			for claim, header := range c.ClaimHeaders {
+				if v, ok := claimHeaderValue(claims[claim]); ok {
+					r.Header.Set(header, v)
+				}
+			}
+			h.ServeHTTP(w, r)
+		})
+	}))
+}
+
+// verifyJWT returns the claims of raw, a token signed with one of algs by one
+// of the keys for its kid, carrying exp and meeting expected.
+func verifyJWT(raw string, algs []jose.SignatureAlgorithm, keys func(kid string) []jose.JSONWebKey, expected jwt.Expected, leeway time.Duration) (map[string]any, error) {
+	tok, err := jwt.ParseSigned(raw, algs)
+	if err != nil {
+		return nil, err
+	}
+	header := tok.Headers[0]
+	for _, k := range keys(header.KeyID) {
+		if k.Algorithm != "" && k.Algorithm != header.Algorithm {
+			continue
+		}
+		var std jwt.Claims
+		var claims map[string]any
+		if tok.Claims(k.Key, &std, &claims) != nil {
+			continue
+		}
+		if std.Expiry == nil {
+			return nil, errors.New("token has no exp")
+		}
+		if err := std.ValidateWithLeeway(expected, leeway); err != nil {
+			return nil, err
+		}
+		return claims, nil
+	}
+	return nil, errors.New("no key verifies the token")
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// remoteKeys resolves a token's keys from the JWKS at u, refetched (rate
+// limited) when the token names a key it doesn't have.
+func remoteKeys(u string, maxAge time.Duration) func(kid string) []jose.JSONWebKey {
+	remote := jwksCache.get(u)
+	return func(kid string) []jose.JSONWebKey {
+		ks := candidateKeys(remote.get(maxAge), kid)
+		if len(ks) == 0 && kid != "" {
+			ks = candidateKeys(remote.refresh(), kid)
+		}
+		return ks
+	}
+}
+
+// candidateKeys are the keys of set a token naming kid may be signed by: the
+// ones with that id, else the ones without an id (a Secret's PEM keys).
+func candidateKeys(set *jose.JSONWebKeySet, kid string) []jose.JSONWebKey {
+	if set == nil {
+		return nil
+	}
+	var ks, anonymous []jose.JSONWebKey
+	for _, k := range set.Keys {
+		if k.Use == "enc" {
+			continue
+		}
+		switch {
+		case kid == "" || k.KeyID == kid:
+			ks = append(ks, k)
+		case k.KeyID == "":
+			anonymous = append(anonymous, k)
+		}
+	}
+	if len(ks) == 0 {
+		return anonymous
+	}
+	return ks
+}
+
+func claimMatches(v any, values []string) bool {
+	if v == nil {
+		return false
+	}
+	if len(values) == 0 {
+		return true
+	}
+	var got []string
+	switch v := v.(type) {
+	case string:
+		got = strings.Fields(v)
+	case []any:
+		for _, x := range v {
+			if s, ok := x.(string); ok {
+				got = append(got, s)
+			} else if b, err := json.Marshal(x); err == nil {
+				got = append(got, string(b))
+			}
+		}
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return false
+		}
+		got = []string{string(b)}
+	}
+	for _, s := range got {
+		for _, want := range values {
+			if s == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func claimHeaderValue(v any) (string, bool) {
+	if v == nil {
+		return "", false
+	}
+	s, ok := v.(string)
+	if !ok {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", false
+		}
+		s = string(b)
+	}
+	return s, httpguts.ValidHeaderFieldValue(s)
+}
+
+// jwksCache holds the key sets of the JWKS URLs in use, shared by the
+// Ingresses naming the same URL and kept across mux reloads.
+var jwksCache = newRemoteDocs(func(b []byte) (*jose.JSONWebKeySet, error) {
+	var set jose.JSONWebKeySet
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, err
+	}
+	if len(set.Keys) == 0 {
+		return nil, errors.New("no key")
+	}
+	return &set, nil
+})
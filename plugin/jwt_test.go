@@ -0,0 +1,232 @@
+package plugin_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/moonrhythm/parapet"
+	"github.com/moonrhythm/parapet/pkg/waf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	. "github.com/moonrhythm/parapet-ingress-controller/plugin"
+)
+
+// signJWT signs claims with key (ES256, or HS256 for a []byte key), naming
+// kid when set.
+func signJWT(t *testing.T, key any, kid string, claims map[string]any) string {
+	t.Helper()
+
+	alg := jose.ES256
+	if _, ok := key.([]byte); ok {
+		alg = jose.HS256
+	}
+	opts := (&jose.SignerOptions{}).WithType("JWT")
+	if kid != "" {
+		opts = opts.WithHeader("kid", kid)
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: alg, Key: key}, opts)
+	require.NoError(t, err)
+	raw, err := jwt.Signed(signer).Claims(claims).Serialize()
+	require.NoError(t, err)
+	return raw
+}
+
+func TestJWTAuth(t *testing.T) {
+	t.Parallel()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	hmacKey := []byte("0123456789abcdef0123456789abcdef")
+	lookup := func(namespace, name string) *jose.JSONWebKeySet {
+		if namespace == "default" && name == "api-keys" {
+			return &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+				{Key: &key.PublicKey},
+				{Key: hmacKey, KeyID: "hmac"},
+			}}
+		}
+		return nil
+	}
+
+	sub, err := waf.NewPredicate(`has(request.jwt) && request.jwt.sub == "user-1"`)
+	require.NoError(t, err)
+	// handlerWith mounts JWTAuth, then between (in a transform's slot), then
+	// JWTClaimHeaders.
+	handlerWith := func(annotation string, between parapet.Middleware) http.Handler {
+		ctx := Context{
+			Middlewares: &parapet.Middlewares{},
+			Ingress: &networking.Ingress{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "api", Annotations: map[string]string{
+					"parapet.moonrhythm.io/jwt-auth": annotation,
+				}},
+			},
+		}
+		JWTAuth(lookup)(ctx)
+		if between != nil {
+			ctx.Use(between)
+		}
+		JWTClaimHeaders(ctx)
+		return ctx.ServeHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Got-User", r.Header.Get("X-User"))
+			w.Header().Set("X-Got-Roles", r.Header.Get("X-Roles"))
+			ok, _ := sub.Eval(r.Context(), waf.NewInput(r, "", "", 0))
+			w.Header().Set("X-Got-CEL-Sub", strconv.FormatBool(ok))
+		}))
+	}
+	handler := func(annotation string) http.Handler { return handlerWith(annotation, nil) }
+	serve := func(h http.Handler, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-User", "admin") // a client never sets these
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	now := time.Now().Unix()
+	claims := func(extra map[string]any) map[string]any {
+		c := map[string]any{"iss": "https://issuer.example.com/", "aud": "api", "sub": "user-1", "exp": now + 60}
+		for k, v := range extra {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+
+	t.Run("not configured", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve(handler(""), "").Code)
+	})
+
+	t.Run("secret", func(t *testing.T) {
+		h := handler(`
+secret: api-keys
+issuer: https://issuer.example.com/
+audience: [web, api]
+requireClaims:
+  scope: write
+claimHeaders:
+  sub: X-User
+  roles: X-Roles
+`)
+
+		w := serve(h, signJWT(t, key, "", claims(map[string]any{"scope": "read write", "roles": []string{"a", "b"}})))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "private", w.Header().Get("Cache-Control"))
+		assert.Equal(t, "user-1", w.Header().Get("X-Got-User"))
+		assert.Equal(t, `["a","b"]`, w.Header().Get("X-Got-Roles"))
+		assert.Equal(t, "true", w.Header().Get("X-Got-CEL-Sub"), "claims are request.jwt")
+
+		w = serve(h, "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+		assert.Empty(t, w.Header().Get("X-Got-User"))
+
+		for name, token := range map[string]string{
+			"garbage":      "a.b.c",
+			"other key":    signJWT(t, other, "", claims(map[string]any{"scope": "write"})),
+			"expired":      signJWT(t, key, "", claims(map[string]any{"scope": "write", "exp": now - 3600})),
+			"not yet":      signJWT(t, key, "", claims(map[string]any{"scope": "write", "nbf": now + 3600})),
+			"no exp":       signJWT(t, key, "", claims(map[string]any{"scope": "write", "exp": nil})),
+			"issuer":       signJWT(t, key, "", claims(map[string]any{"scope": "write", "iss": "https://evil.example.com/"})),
+			"audience":     signJWT(t, key, "", claims(map[string]any{"scope": "write", "aud": "other"})),
+			"hmac not set": signJWT(t, hmacKey, "hmac", claims(map[string]any{"scope": "write"})),
+		} {
+			w := serve(h, token)
+			assert.Equal(t, http.StatusUnauthorized, w.Code, name)
+			assert.Equal(t, `Bearer error="invalid_token"`, w.Header().Get("WWW-Authenticate"), name)
+		}
+
+		assert.Equal(t, http.StatusForbidden, serve(h, signJWT(t, key, "", claims(map[string]any{"scope": "read"}))).Code)
+		assert.Equal(t, http.StatusForbidden, serve(h, signJWT(t, key, "", claims(nil))).Code)
+	})
+
+	t.Run("claim headers are stamped after what runs between", func(t *testing.T) {
+		forge := parapet.MiddlewareFunc(func(h http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				r.Header.Set("X-User", "admin")
+				r.Header.Set("X-Roles", "admin")
+				h.ServeHTTP(w, r)
+			})
+		})
+		w := serve(handlerWith("{secret: api-keys, claimHeaders: {sub: X-User, roles: X-Roles}}", forge), signJWT(t, key, "", claims(nil)))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "user-1", w.Header().Get("X-Got-User"))
+		assert.Empty(t, w.Header().Get("X-Got-Roles"), "a claim the token lacks")
+	})
+
+	t.Run("hmac", func(t *testing.T) {
+		h := handler(`{secret: api-keys, algorithms: [HS256], requireClaims: {email_verified: "true", tenant: []}}`)
+		assert.Equal(t, http.StatusOK, serve(h, signJWT(t, hmacKey, "hmac", claims(map[string]any{"email_verified": true, "tenant": "t"}))).Code)
+		assert.Equal(t, http.StatusForbidden, serve(h, signJWT(t, hmacKey, "hmac", claims(map[string]any{"email_verified": false, "tenant": "t"}))).Code)
+		assert.Equal(t, http.StatusForbidden, serve(h, signJWT(t, hmacKey, "hmac", claims(map[string]any{"email_verified": true}))).Code)
+		assert.Equal(t, http.StatusUnauthorized, serve(h, signJWT(t, key, "", claims(nil))).Code, "only the listed algorithms")
+	})
+
+	t.Run("missing secret rejects", func(t *testing.T) {
+		h := handler(`secret: other`)
+		assert.Equal(t, http.StatusUnauthorized, serve(h, signJWT(t, key, "", claims(nil))).Code)
+	})
+
+	t.Run("jwks", func(t *testing.T) {
+		var set atomic.Pointer[jose.JSONWebKeySet]
+		set.Store(&jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: &key.PublicKey, KeyID: "k1", Algorithm: "ES256", Use: "sig"}}})
+		var fetches atomic.Int64
+		jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fetches.Add(1)
+			json.NewEncoder(w).Encode(set.Load())
+		}))
+		defer jwks.Close()
+
+		h := handler("jwksURL: " + jwks.URL + "\nclaimHeaders: {sub: X-User}")
+		w := serve(h, signJWT(t, key, "k1", claims(nil)))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "user-1", w.Header().Get("X-Got-User"))
+		assert.Equal(t, http.StatusOK, serve(h, signJWT(t, key, "k1", claims(nil))).Code)
+		assert.EqualValues(t, 1, fetches.Load(), "cached")
+
+		// the issuer rotates to a new key
+		set.Store(&jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: &other.PublicKey, KeyID: "k2"}}})
+		assert.Equal(t, http.StatusOK, serve(h, signJWT(t, other, "k2", claims(nil))).Code, "an unknown key refreshes")
+		assert.EqualValues(t, 2, fetches.Load())
+		assert.Equal(t, http.StatusUnauthorized, serve(h, signJWT(t, other, "k3", claims(nil))).Code)
+		assert.EqualValues(t, 2, fetches.Load(), "refreshes on unknown keys are rate limited")
+
+		// another Ingress on the same URL shares the keys
+		assert.Equal(t, http.StatusOK, serve(handler("jwksURL: "+jwks.URL), signJWT(t, other, "k2", claims(nil))).Code)
+		assert.EqualValues(t, 2, fetches.Load())
+	})
+
+	t.Run("malformed fails closed", func(t *testing.T) {
+		token := signJWT(t, key, "", claims(nil))
+		for _, a := range []string{
+			"secret: [",
+			"issuer: https://issuer.example.com/",
+			"{secret: api-keys, jwksURL: https://issuer.example.com/jwks}",
+			"jwksURL: /jwks",
+			"{secret: api-keys, algorithms: [none]}",
+			"{secret: api-keys, requiredClaims: {scope: write}}",
+			"{secret: api-keys, claimHeaders: {sub: 'X User'}}",
+			"{secret: api-keys, leeway: soon}",
+		} {
+			assert.Equal(t, http.StatusForbidden, serve(handler(a), token).Code, a)
+		}
+	})
+}
@@ -0,0 +1,551 @@
+package plugin
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/moonrhythm/parapet"
+	"github.com/moonrhythm/parapet/pkg/header"
+	"golang.org/x/net/http/httpguts"
+	"golang.org/x/oauth2"
+	"gopkg.in/yaml.v3"
+)
+
+// Headers an oidc-auth-gated upstream receives, named like oauth2-proxy's. A
+// client never sets them: OIDCAuth deletes whatever the request carried first.
+const (
+	OIDCUserHeader   = "X-Auth-Request-User"   // sub
+	OIDCEmailHeader  = "X-Auth-Request-Email"  // a verified email, when the provider gives one
+	OIDCGroupsHeader = "X-Auth-Request-Groups" // comma separated
+)
+
+const (
+	defaultOIDCRedirectPath = "/oauth2/callback"
+	defaultOIDCCookieName   = "_parapet_oidc"
+	defaultOIDCSessionTTL   = 7 * 24 * time.Hour
+	oidcLoginTTL            = 10 * time.Minute
+	oidcDiscoveryRefresh    = time.Hour
+	// maxCookieSize keeps a session cookie within what browsers store; a
+	// larger one is stored without its refresh token.
+	maxCookieSize = 4000
+)
+
+// OIDCSecret is what the Secret of an oidc-auth Ingress holds: the client
+// secret (empty for a public client) and the key of its session cookies.
+type OIDCSecret struct {
+	ClientSecret string
+	CookieSecret []byte
+}
+
+type oidcAuthConfig struct {
+	Issuer       string        `yaml:"issuer"`
+	ClientID     string        `yaml:"clientID"`
+	Secret       string        `yaml:"secret"`
+	Scopes       []string      `yaml:"scopes"`
+	RedirectPath string        `yaml:"redirectPath"`
+	EmailDomains []string      `yaml:"emailDomains"`
+	Groups       []string      `yaml:"groups"`
+	GroupsClaim  string        `yaml:"groupsClaim"`
+	CookieName   string        `yaml:"cookieName"`
+	SessionTTL   time.Duration `yaml:"sessionTTL"`
+}
+
+func parseOIDCAuthConfig(a string) (*oidcAuthConfig, error) {
+	c := oidcAuthConfig{
+		RedirectPath: defaultOIDCRedirectPath,
+		GroupsClaim:  "groups",
+		CookieName:   defaultOIDCCookieName,
+		SessionTTL:   defaultOIDCSessionTTL,
+	}
+	dec := yaml.NewDecoder(strings.NewReader(a))
+	dec.KnownFields(true) // a misspelled emailDomains must not let everyone in
+	if err := dec.Decode(&c); err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(c.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("invalid issuer %q", c.Issuer)
+	}
+	if c.ClientID == "" || c.Secret == "" {
+		return nil, errors.New("clientID and secret are required")
+	}
+	if !strings.HasPrefix(c.RedirectPath, "/") {
+		return nil, fmt.Errorf("invalid redirectPath %q", c.RedirectPath)
+	}
+	if err := (&http.Cookie{Name: c.CookieName}).Valid(); err != nil {
+		return nil, err
+	}
+	if c.SessionTTL <= 0 {
+		return nil, errors.New("sessionTTL must be positive")
+	}
+	if !slices.Contains(c.Scopes, "openid") {
+		c.Scopes = append([]string{"openid"}, c.Scopes...)
+	}
+	if len(c.Scopes) == 1 {
+		c.Scopes = append(c.Scopes, "email", "profile")
+	}
+	for i, d := range c.EmailDomains {
+		c.EmailDomains[i] = strings.ToLower(strings.TrimPrefix(d, "@"))
+	}
+	return &c, nil
+}
+
+// oidcProvider is an issuer's OpenID Connect discovery document.
+type oidcProvider struct {
+	Issuer   string `json:"issuer"`
+	AuthURL  string `json:"authorization_endpoint"`
+	TokenURL string `json:"token_endpoint"`
+	JWKSURL  string `json:"jwks_uri"`
+}
+
+// oidcDiscoveryCache holds the discovery documents of the issuers in use.
+var oidcDiscoveryCache = newRemoteDocs(func(b []byte) (*oidcProvider, error) {
+	var p oidcProvider
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, err
+	}
+	if p.AuthURL == "" || p.TokenURL == "" || p.JWKSURL == "" {
+		return nil, errors.New("incomplete discovery document")
+	}
+	return &p, nil
+})
+
+// oidcSession is the identity a session cookie carries.
+type oidcSession struct {
+	Subject      string   `json:"sub"`
+	Email        string   `json:"email,omitempty"`
+	Groups       []string `json:"groups,omitempty"`
+	Expiry       int64    `json:"exp"` // of the ID token, or the refreshed access token
+	RefreshToken string   `json:"rt,omitempty"`
+	Created      int64    `json:"iat"`
+}
+
+// oidcLogin is the state of a login in progress, kept in the login cookie.
+type oidcLogin struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Return   string `json:"return"`
+}
+
+// OIDCAuth logs browsers in with an OpenID Connect provider on an Ingress
+// with the oidc-auth annotation, a YAML document:
+//
+//	issuer: https://accounts.example.com
+//	clientID: dashboards
+//	secret: dashboards-oidc        # a Secret in the Ingress's namespace
+//	scopes: [openid, email, groups] # default openid, email, profile
+//	emailDomains: [example.com]
+//	groups: [admins]
+//	groupsClaim: groups             # default
+//	redirectPath: /oauth2/callback  # default
+//	cookieName: _parapet_oidc       # default
+//	sessionTTL: 168h                # default
+//
+// A request without a session is sent to the provider's authorization
+// endpoint (authorization code flow, with PKCE, state and nonce in a login
+// cookie), a GET or HEAD by redirect, others with 401. The provider returns
+// to redirectPath, which must be under a path of the Ingress; the code is
+// exchanged, the ID token verified against the provider's JWKS, and the
+// identity kept in a session cookie encrypted (AES-GCM) with the Secret's
+// cookie-secret. A session past its ID token's expiry is refreshed with its
+// refresh token; one older than sessionTTL logs in again.
+//
+// emailDomains and groups restrict who is let in (both when both are set):
+// others get 403. The identity goes upstream as OIDCUserHeader,
+// OIDCEmailHeader and OIDCGroupsHeader.
+//
+// lookup resolves the Secret per request, so a rotated key applies without a
+// mux rebuild; a Secret missing or without a cookie key answers 403. A
+// malformed annotation fails closed.
+func OIDCAuth(lookup func(namespace, name string) *OIDCSecret) Plugin {
+	return func(ctx Context) {
+		a := ctx.Ingress.Annotations[namespace+"/oidc-auth"]
+		if strings.TrimSpace(a) == "" {
+			return
+		}
+		c, err := parseOIDCAuthConfig(a)
+		if err != nil {
+			slog.Error("plugin/OIDCAuth: malformed oidc-auth annotation, failing closed",
+				"ingress", ctx.ingressID(), "error", err)
+			denyAll(ctx)
+			return
+		}
+		o := &oidcAuth{
+			config:    c,
+			discovery: oidcDiscoveryCache.get(strings.TrimSuffix(c.Issuer, "/") + "/.well-known/openid-configuration"),
+			ingress:   ctx.ingressID(),
+		}
+		ns := ctx.Ingress.Namespace
+
+		usePrivateCache(ctx)
+		ctx.Use(parapet.MiddlewareFunc(func(h http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				r.Header.Del(OIDCUserHeader)
+				r.Header.Del(OIDCEmailHeader)
+				r.Header.Del(OIDCGroupsHeader)
+
+				secret := lookup(ns, c.Secret)
+				if secret == nil {
+					http.Error(w, "Forbidden", http.StatusForbidden)
+					return
+				}
+				aead, err := oidcCookieCipher(secret.CookieSecret)
+				if err != nil {
+					http.Error(w, "Forbidden", http.StatusForbidden)
+					return
+				}
+				req := &oidcRequest{oidcAuth: o, w: w, r: r, secret: secret, aead: aead}
+
+				if r.URL.Path == c.RedirectPath {
+					req.callback()
+					return
+				}
+				s := req.session()
+				if s == nil {
+					req.login()
+					return
+				}
+				if !o.allowed(s) {
+					http.Error(w, "Forbidden", http.StatusForbidden)
+					return
+				}
+				r.Header.Set(OIDCUserHeader, s.Subject)
+				if s.Email != "" {
+					r.Header.Set(OIDCEmailHeader, s.Email)
+				}
+				if len(s.Groups) > 0 {
+					r.Header.Set(OIDCGroupsHeader, strings.Join(s.Groups, ","))
+				}
+				h.ServeHTTP(w, r)
+			})
+		}))
+	}
+}
+
+type oidcAuth struct {
+	config    *oidcAuthConfig
+	discovery *remoteDoc[oidcProvider]
+	ingress   string
+}
+
+// provider returns the issuer's discovery document; nil while unavailable.
+func (o *oidcAuth) provider() *oidcProvider {
+	p := o.discovery.get(oidcDiscoveryRefresh)
+	if p == nil || strings.TrimSuffix(p.Issuer, "/") != strings.TrimSuffix(o.config.Issuer, "/") {
+		return nil
+	}
+	return p
+}
+
+func (o *oidcAuth) allowed(s *oidcSession) bool {
+	if len(o.config.EmailDomains) > 0 {
+		_, domain, ok := strings.Cut(strings.ToLower(s.Email), "@")
+		if !ok || !slices.Contains(o.config.EmailDomains, domain) {
+			return false
+		}
+	}
+	if len(o.config.Groups) > 0 {
+		if !slices.ContainsFunc(s.Groups, func(g string) bool { return slices.Contains(o.config.Groups, g) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// oidcRequest is a request through an oidc-auth Ingress.
+type oidcRequest struct {
+	*oidcAuth
+	w      http.ResponseWriter
+	r      *http.Request
+	secret *OIDCSecret
+	aead   cipher.AEAD
+}
+
+func (req *oidcRequest) https() bool {
+	return req.r.TLS != nil || header.Get(req.r.Header, header.XForwardedProto) == "https"
+}
+
+func (req *oidcRequest) oauth2Config(p *oidcProvider) *oauth2.Config {
+	scheme := "http"
+	if req.https() {
+		scheme = "https"
+	}
+	return &oauth2.Config{
+		ClientID:     req.config.ClientID,
+		ClientSecret: req.secret.ClientSecret,
+		Endpoint:     oauth2.Endpoint{AuthURL: p.AuthURL, TokenURL: p.TokenURL},
+		RedirectURL:  scheme + "://" + req.r.Host + req.config.RedirectPath,
+		Scopes:       req.config.Scopes,
+	}
+}
+
+func (req *oidcRequest) context() context.Context {
+	return context.WithValue(req.r.Context(), oauth2.HTTPClient, idpHTTPClient)
+}
+
+// login sends the browser to the provider.
+func (req *oidcRequest) login() {
+	if req.r.Method != http.MethodGet && req.r.Method != http.MethodHead {
+		http.Error(req.w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	p := req.provider()
+	if p == nil {
+		http.Error(req.w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	l := oidcLogin{
+		State:    randomToken(),
+		Nonce:    randomToken(),
+		Verifier: oauth2.GenerateVerifier(),
+		Return:   req.r.URL.RequestURI(),
+	}
+	if !req.setCookie(req.loginCookieName(), l, oidcLoginTTL) {
+		http.Error(req.w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	u := req.oauth2Config(p).AuthCodeURL(l.State,
+		oauth2.S256ChallengeOption(l.Verifier),
+		oauth2.SetAuthURLParam("nonce", l.Nonce),
+	)
+	http.Redirect(req.w, req.r, u, http.StatusFound)
+}
+
+// callback completes a login the provider returned from.
+func (req *oidcRequest) callback() {
+	var l oidcLogin
+	q := req.r.URL.Query()
+	if !req.readCookie(req.loginCookieName(), &l) || q.Get("state") != l.State {
+		http.Error(req.w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	req.deleteCookie(req.loginCookieName())
+	if e := q.Get("error"); e != "" {
+		slog.Info("plugin/OIDCAuth: login refused by provider", "ingress", req.ingress, "error", e)
+		http.Error(req.w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	p := req.provider()
+	if p == nil {
+		http.Error(req.w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	tok, err := req.oauth2Config(p).Exchange(req.context(), q.Get("code"), oauth2.VerifierOption(l.Verifier))
+	if err != nil {
+		slog.Warn("plugin/OIDCAuth: can not exchange code", "ingress", req.ingress, "error", err)
+		http.Error(req.w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	s, err := req.identity(p, tok, l.Nonce)
+	if err != nil {
+		slog.Warn("plugin/OIDCAuth: invalid id token", "ingress", req.ingress, "error", err)
+		http.Error(req.w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	s.Created = time.Now().Unix()
+	if !req.allowed(s) {
+		http.Error(req.w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if !req.setSession(s) {
+		http.Error(req.w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	ret := l.Return
+	if !strings.HasPrefix(ret, "/") || strings.HasPrefix(ret, "//") || strings.HasPrefix(ret, req.config.RedirectPath) {
+		ret = "/"
+	}
+	http.Redirect(req.w, req.r, ret, http.StatusFound)
+}
+
+// identity verifies the ID token of tok, issued with nonce (any when empty,
+// on a refresh), into a session.
+func (req *oidcRequest) identity(p *oidcProvider, tok *oauth2.Token, nonce string) (*oidcSession, error) {
+	raw, _ := tok.Extra("id_token").(string)
+	if raw == "" {
+		return nil, errors.New("no id_token")
+	}
+	claims, err := verifyJWT(raw, defaultJWTAlgorithms, remoteKeys(p.JWKSURL, defaultJWKSRefresh),
+		jwt.Expected{Issuer: p.Issuer, AnyAudience: jwt.Audience{req.config.ClientID}}, jwt.DefaultLeeway)
+	if err != nil {
+		return nil, err
+	}
+	if got, _ := claims["nonce"].(string); nonce != "" && got != nonce {
+		return nil, errors.New("nonce mismatch")
+	}
+	s := &oidcSession{RefreshToken: tok.RefreshToken}
+	s.Subject, _ = claims["sub"].(string)
+	if s.Subject == "" {
+		return nil, errors.New("no sub")
+	}
+	if exp, ok := claims["exp"].(float64); ok {
+		s.Expiry = int64(exp)
+	}
+	if verified, ok := claims["email_verified"].(bool); !ok || verified {
+		s.Email, _ = claims["email"].(string)
+	}
+	switch g := claims[req.config.GroupsClaim].(type) {
+	case string:
+		s.Groups = []string{g}
+	case []any:
+		for _, x := range g {
+			if x, ok := x.(string); ok {
+				s.Groups = append(s.Groups, x)
+			}
+		}
+	}
+	if !httpguts.ValidHeaderFieldValue(s.Subject) || !httpguts.ValidHeaderFieldValue(s.Email) ||
+		slices.ContainsFunc(s.Groups, func(g string) bool { return !httpguts.ValidHeaderFieldValue(g) }) {
+		return nil, errors.New("invalid identity claim")
+	}
+	return s, nil
+}
+
+// session returns the request's session, refreshed when past its expiry;
+// nil for none.
+func (req *oidcRequest) session() *oidcSession {
+	var s oidcSession
+	if !req.readCookie(req.config.CookieName, &s) {
+		return nil
+	}
+	now := time.Now()
+	if now.After(time.Unix(s.Created, 0).Add(req.config.SessionTTL)) {
+		return nil
+	}
+	if now.Unix() < s.Expiry {
+		return &s
+	}
+	if s.RefreshToken == "" {
+		return nil
+	}
+	p := req.provider()
+	if p == nil {
+		return nil
+	}
+	tok, err := req.oauth2Config(p).TokenSource(req.context(), &oauth2.Token{RefreshToken: s.RefreshToken}).Token()
+	if err != nil {
+		slog.Debug("plugin/OIDCAuth: can not refresh session", "ingress", req.ingress, "error", err)
+		return nil
+	}
+	ns := &s
+	if _, ok := tok.Extra("id_token").(string); ok {
+		if ns, err = req.identity(p, tok, ""); err != nil || ns.Subject != s.Subject {
+			slog.Warn("plugin/OIDCAuth: invalid refreshed id token", "ingress", req.ingress, "error", err)
+			return nil
+		}
+		ns.Created = s.Created
+	} else {
+		ns.Expiry = tok.Expiry.Unix()
+	}
+	if tok.RefreshToken != "" {
+		ns.RefreshToken = tok.RefreshToken
+	}
+	if ns.Expiry <= now.Unix() || !req.setSession(ns) {
+		return nil
+	}
+	return ns
+}
+
+func (req *oidcRequest) setSession(s *oidcSession) bool {
+	ttl := time.Until(time.Unix(s.Created, 0).Add(req.config.SessionTTL))
+	if req.setCookie(req.config.CookieName, s, ttl) {
+		return true
+	}
+	if s.RefreshToken == "" {
+		return false
+	}
+	slog.Debug("plugin/OIDCAuth: session cookie too large, dropping the refresh token", "ingress", req.ingress)
+	ns := *s
+	ns.RefreshToken = ""
+	return req.setCookie(req.config.CookieName, &ns, ttl)
+}
+
+func (req *oidcRequest) loginCookieName() string { return req.config.CookieName + "_login" }
+
+// cookieAD binds a cookie to its name and client: another Ingress sharing
+// the key can't take it.
+func (req *oidcRequest) cookieAD(name string) []byte {
+	return []byte(name + "\x00" + req.config.Issuer + "\x00" + req.config.ClientID)
+}
+
+func (req *oidcRequest) setCookie(name string, v any, ttl time.Duration) bool {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return false
+	}
+	nonce := make([]byte, req.aead.NonceSize())
+	rand.Read(nonce)
+	value := base64.RawURLEncoding.EncodeToString(req.aead.Seal(nonce, nonce, b, req.cookieAD(name)))
+	if len(name)+len(value) > maxCookieSize {
+		return false
+	}
+	http.SetCookie(req.w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(ttl / time.Second),
+		Secure:   req.https(),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return true
+}
+
+func (req *oidcRequest) readCookie(name string, v any) bool {
+	ck, err := req.r.Cookie(name)
+	if err != nil {
+		return false
+	}
+	b, err := base64.RawURLEncoding.DecodeString(ck.Value)
+	if err != nil || len(b) < req.aead.NonceSize() {
+		return false
+	}
+	nonce, sealed := b[:req.aead.NonceSize()], b[req.aead.NonceSize():]
+	plain, err := req.aead.Open(nil, nonce, sealed, req.cookieAD(name))
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(plain, v) == nil
+}
+
+func (req *oidcRequest) deleteCookie(name string) {
+	http.SetCookie(req.w, &http.Cookie{Name: name, Path: "/", MaxAge: -1, Secure: req.https(), HttpOnly: true})
+}
+
+// oidcCookieCipher is the AES-256-GCM cipher of the session cookies, keyed
+// by the SHA-256 of a cookie secret of at least 16 bytes.
+func oidcCookieCipher(secret []byte) (cipher.AEAD, error) {
+	if len(secret) < 16 {
+		return nil, errors.New("cookie secret too short")
+	}
+	key := sha256.Sum256(secret)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,300 @@
+package plugin_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/moonrhythm/parapet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	. "github.com/moonrhythm/parapet-ingress-controller/plugin"
+)
+
+// mockIdP is an OpenID Connect provider issuing ID tokens with its claims
+// for client "dashboards", secret "s3cret".
+type mockIdP struct {
+	*httptest.Server
+	t   *testing.T
+	key *ecdsa.PrivateKey
+
+	mu        sync.Mutex
+	claims    map[string]any
+	ttl       time.Duration // of the ID tokens
+	codes     map[string]url.Values
+	refreshes atomic.Int64
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	idp := &mockIdP{t: t, key: key, ttl: time.Hour, codes: make(map[string]url.Values)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: &key.PublicKey, KeyID: "idp"}}})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		code := randomString(t)
+		idp.mu.Lock()
+		idp.codes[code] = q
+		idp.mu.Unlock()
+		http.Redirect(w, r, q.Get("redirect_uri")+"?"+url.Values{"code": {code}, "state": {q.Get("state")}}.Encode(), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "dashboards" || secret != "s3cret" {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		var nonce string
+		switch r.PostFormValue("grant_type") {
+		case "authorization_code":
+			idp.mu.Lock()
+			q := idp.codes[r.PostFormValue("code")]
+			delete(idp.codes, r.PostFormValue("code"))
+			idp.mu.Unlock()
+			sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+			if q == nil || q.Get("code_challenge") != base64.RawURLEncoding.EncodeToString(sum[:]) {
+				http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+				return
+			}
+			nonce = q.Get("nonce")
+		case "refresh_token":
+			if r.PostFormValue("refresh_token") != "refresh-1" {
+				http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+				return
+			}
+			idp.refreshes.Add(1)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  "access",
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+			"refresh_token": "refresh-1",
+			"id_token":      idp.idToken(nonce),
+		})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func (idp *mockIdP) idToken(nonce string) string {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	now := time.Now()
+	claims := map[string]any{"iss": idp.URL, "aud": "dashboards", "iat": now.Unix(), "exp": now.Add(idp.ttl).Unix()}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	for k, v := range idp.claims {
+		claims[k] = v
+	}
+	return signJWT(idp.t, idp.key, "idp", claims)
+}
+
+func (idp *mockIdP) set(ttl time.Duration, claims map[string]any) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.ttl, idp.claims = ttl, claims
+}
+
+func randomString(t *testing.T) string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	require.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func TestOIDCAuth(t *testing.T) {
+	t.Parallel()
+
+	idp := newMockIdP(t)
+	lookup := func(namespace, name string) *OIDCSecret {
+		if namespace == "default" && name == "dashboards-oidc" {
+			return &OIDCSecret{ClientSecret: "s3cret", CookieSecret: []byte("0123456789abcdef")}
+		}
+		return nil
+	}
+	handler := func(annotation string) http.Handler {
+		ctx := Context{
+			Middlewares: &parapet.Middlewares{},
+			Ingress: &networking.Ingress{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "dashboards", Annotations: map[string]string{
+					"parapet.moonrhythm.io/oidc-auth": annotation,
+				}},
+			},
+		}
+		OIDCAuth(lookup)(ctx)
+		return ctx.ServeHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Got-User", r.Header.Get(OIDCUserHeader))
+			w.Header().Set("X-Got-Email", r.Header.Get(OIDCEmailHeader))
+			w.Header().Set("X-Got-Groups", r.Header.Get(OIDCGroupsHeader))
+		}))
+	}
+	serve := func(h http.Handler, method, target string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, nil)
+		r.Header.Set(OIDCUserHeader, "admin") // a client never sets these
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	// login goes through the provider from path, returning the callback's
+	// response and the login cookie.
+	login := func(h http.Handler, path string) (*httptest.ResponseRecorder, []*http.Cookie) {
+		t.Helper()
+		w := serve(h, http.MethodGet, "https://app.example.com"+path, nil)
+		require.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "private", w.Header().Get("Cache-Control"))
+		auth, err := url.Parse(w.Header().Get("Location"))
+		require.NoError(t, err)
+		assert.Equal(t, idp.URL+"/authorize", auth.Scheme+"://"+auth.Host+auth.Path)
+		assert.Equal(t, "https://app.example.com/oauth2/callback", auth.Query().Get("redirect_uri"))
+		assert.Equal(t, "S256", auth.Query().Get("code_challenge_method"))
+		loginCookies := w.Result().Cookies()
+		require.Len(t, loginCookies, 1)
+		assert.True(t, loginCookies[0].Secure)
+		assert.True(t, loginCookies[0].HttpOnly)
+
+		resp, err := noRedirect.Get(auth.String())
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusFound, resp.StatusCode)
+		return serve(h, http.MethodGet, resp.Header.Get("Location"), loginCookies), loginCookies
+	}
+
+	annotation := "issuer: " + idp.URL + `
+clientID: dashboards
+secret: dashboards-oidc
+emailDomains: [example.com]
+`
+
+	t.Run("not configured", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve(handler(""), http.MethodGet, "/", nil).Code)
+	})
+
+	t.Run("login", func(t *testing.T) {
+		idp.set(time.Hour, map[string]any{"sub": "u1", "email": "alice@Example.com", "groups": []string{"dev", "ops"}})
+		h := handler(annotation)
+
+		w, _ := login(h, "/dashboard?tab=1")
+		require.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "/dashboard?tab=1", w.Header().Get("Location"))
+		session := w.Result().Cookies()
+		require.NotEmpty(t, session)
+
+		w = serve(h, http.MethodGet, "https://app.example.com/dashboard", session)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "private", w.Header().Get("Cache-Control"))
+		assert.Equal(t, "u1", w.Header().Get("X-Got-User"))
+		assert.Equal(t, "alice@Example.com", w.Header().Get("X-Got-Email"))
+		assert.Equal(t, "dev,ops", w.Header().Get("X-Got-Groups"))
+
+		for _, c := range session {
+			if c.Name == "_parapet_oidc" {
+				c.Value = c.Value[:len(c.Value)-2] + "AA"
+			}
+		}
+		assert.Equal(t, http.StatusFound, serve(h, http.MethodGet, "https://app.example.com/dashboard", session).Code, "a tampered session logs in again")
+		w = serve(h, http.MethodPost, "https://app.example.com/api", nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Empty(t, w.Header().Get("X-Got-User"))
+	})
+
+	t.Run("state mismatch", func(t *testing.T) {
+		h := handler(annotation)
+		w := serve(h, http.MethodGet, "https://app.example.com/", nil)
+		cookies := w.Result().Cookies()
+		w = serve(h, http.MethodGet, "https://app.example.com/oauth2/callback?code=x&state=forged", cookies)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("restricted", func(t *testing.T) {
+		h := handler(annotation)
+		idp.set(time.Hour, map[string]any{"sub": "u2", "email": "mallory@evil.example"})
+		w, _ := login(h, "/")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		idp.set(time.Hour, map[string]any{"sub": "u3", "email": "bob@example.com", "email_verified": false})
+		w, _ = login(h, "/")
+		assert.Equal(t, http.StatusForbidden, w.Code, "an unverified email doesn't count")
+
+		h = handler(annotation + "groups: [admins]\n")
+		idp.set(time.Hour, map[string]any{"sub": "u4", "email": "carol@example.com", "groups": []string{"dev"}})
+		w, _ = login(h, "/")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		idp.set(time.Hour, map[string]any{"sub": "u4", "email": "carol@example.com", "groups": []string{"dev", "admins"}})
+		w, _ = login(h, "/")
+		assert.Equal(t, http.StatusFound, w.Code)
+	})
+
+	t.Run("refresh", func(t *testing.T) {
+		h := handler(annotation)
+		// an ID token expired within the leeway logs in, but its session needs
+		// a refresh right away
+		idp.set(-30*time.Second, map[string]any{"sub": "u5", "email": "dave@example.com"})
+		w, _ := login(h, "/")
+		require.Equal(t, http.StatusFound, w.Code)
+		session := w.Result().Cookies()
+
+		idp.set(time.Hour, map[string]any{"sub": "u5", "email": "dave@example.com", "groups": []string{"new"}})
+		before := idp.refreshes.Load()
+		w = serve(h, http.MethodGet, "https://app.example.com/", session)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "new", w.Header().Get("X-Got-Groups"))
+		assert.Equal(t, before+1, idp.refreshes.Load())
+		refreshed := w.Result().Cookies()
+		require.NotEmpty(t, refreshed, "the refreshed session is stored")
+
+		assert.Equal(t, http.StatusOK, serve(h, http.MethodGet, "https://app.example.com/", refreshed).Code)
+		assert.Equal(t, before+1, idp.refreshes.Load())
+	})
+
+	t.Run("missing secret rejects", func(t *testing.T) {
+		h := handler(strings.Replace(annotation, "dashboards-oidc", "other", 1))
+		assert.Equal(t, http.StatusForbidden, serve(h, http.MethodGet, "https://app.example.com/", nil).Code)
+	})
+
+	t.Run("malformed fails closed", func(t *testing.T) {
+		for _, a := range []string{
+			"issuer: [",
+			"{clientID: dashboards, secret: dashboards-oidc}",
+			"{issuer: " + idp.URL + ", secret: dashboards-oidc}",
+			"{issuer: " + idp.URL + ", clientID: dashboards, secret: dashboards-oidc, emailDomain: example.com}",
+			"{issuer: " + idp.URL + ", clientID: dashboards, secret: dashboards-oidc, redirectPath: callback}",
+			"{issuer: " + idp.URL + ", clientID: dashboards, secret: dashboards-oidc, cookieName: 'a b'}",
+		} {
+			assert.Equal(t, http.StatusForbidden, serve(handler(a), http.MethodGet, "https://app.example.com/", nil).Code, a)
+		}
+	})
+}
@@ -1,10 +1,12 @@
 package plugin
 
 import (
+	"context"
 	"log/slog"
 	"net"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -214,7 +216,24 @@ func UpstreamHost(ctx Context) {
 	}))
 }
 
-// UpstreamPath adds path prefix before send to upstream
+type pathMatchKey struct{}
+
+type pathMatch struct {
+	re    *regexp.Regexp
+	path  string
+	match []int
+}
+
+// WithPathMatch records that a regex path (path-regex) routed the request:
+// re matched path at the submatch indexes match. UpstreamPath expands the
+// capture groups from it.
+func WithPathMatch(ctx context.Context, re *regexp.Regexp, path string, match []int) context.Context {
+	return context.WithValue(ctx, pathMatchKey{}, &pathMatch{re: re, path: path, match: match})
+}
+
+// UpstreamPath adds path prefix before send to upstream.
+// For a request routed by a regex path, a value referencing capture groups
+// ($1, ${name}) is expanded and replaces the path instead.
 func UpstreamPath(ctx Context) {
 	prefix := ctx.Ingress.Annotations[namespace+"/upstream-path"]
 	if prefix == "" {
@@ -226,15 +245,22 @@ func UpstreamPath(ctx Context) {
 		slog.Warn("plugin/UpstreamPath: can not parse path", "path", prefix, "error", err)
 		return
 	}
+	template := strings.Contains(prefix, "$")
 
 	ctx.Use(parapet.MiddlewareFunc(func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			r.URL.Path = singleJoiningSlash(targetPath.Path, r.URL.Path)
+			targetQuery := targetPath.RawQuery
+			if m, ok := r.Context().Value(pathMatchKey{}).(*pathMatch); ok && template {
+				r.URL.Path = string(m.re.ExpandString(nil, targetPath.Path, m.path, m.match))
+				targetQuery = string(m.re.ExpandString(nil, targetQuery, m.path, m.match))
+			} else {
+				r.URL.Path = singleJoiningSlash(targetPath.Path, r.URL.Path)
+			}
 
-			if targetPath.RawQuery == "" || r.URL.RawQuery == "" {
-				r.URL.RawQuery = targetPath.RawQuery + r.URL.RawQuery
+			if targetQuery == "" || r.URL.RawQuery == "" {
+				r.URL.RawQuery = targetQuery + r.URL.RawQuery
 			} else {
-				r.URL.RawQuery = targetPath.RawQuery + "&" + r.URL.RawQuery
+				r.URL.RawQuery = targetQuery + "&" + r.URL.RawQuery
 			}
 
 			h.ServeHTTP(w, r)
@@ -5,6 +5,7 @@ import (
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
 	"testing"
 
 	"github.com/moonrhythm/parapet"
@@ -354,6 +355,36 @@ func TestUpstreamPath(t *testing.T) {
 	assert.True(t, called)
 }
 
+func TestUpstreamPathCaptures(t *testing.T) {
+	t.Parallel()
+
+	ctx := Context{
+		Middlewares: &parapet.Middlewares{},
+		Ingress: &networking.Ingress{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{
+					"parapet.moonrhythm.io/upstream-path": "/v$1/users",
+				},
+			},
+		},
+	}
+	UpstreamPath(ctx)
+
+	var got string
+	h := ctx.ServeHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.Path
+	}))
+
+	re := regexp.MustCompile(`^/api/([0-9]+)/u$`)
+	r := httptest.NewRequest(http.MethodGet, "/api/2/u", nil)
+	r = r.WithContext(WithPathMatch(r.Context(), re, "/api/2/u", re.FindStringSubmatchIndex("/api/2/u")))
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, "/v2/users", got, "routed by a regex path")
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/profile", nil))
+	assert.Equal(t, "/v$1/users/profile", got, "a plain prefix otherwise")
+}
+
 func TestAllowRemote(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,138 @@
+package plugin
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// remoteMinInterval bounds the fetches a miss (a token signed by an
+	// unknown key, an identity provider that is down) can cause: at most one
+	// per interval per URL.
+	remoteMinInterval = 10 * time.Second
+	remoteMaxSize     = 1 << 20
+)
+
+// idpHTTPClient talks to identity providers: JWKS, OIDC discovery and token
+// endpoints.
+var idpHTTPClient = &http.Client{
+	Timeout: 10 * time.Second,
+}
+
+// remoteDocs holds the documents (JWKS, OIDC discovery) of the URLs in use,
+// shared by the Ingresses naming the same URL and kept across mux reloads.
+type remoteDocs[T any] struct {
+	parse func([]byte) (*T, error)
+
+	mu   sync.Mutex
+	docs map[string]*remoteDoc[T]
+}
+
+func newRemoteDocs[T any](parse func([]byte) (*T, error)) *remoteDocs[T] {
+	return &remoteDocs[T]{parse: parse, docs: make(map[string]*remoteDoc[T])}
+}
+
+func (c *remoteDocs[T]) get(u string) *remoteDoc[T] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	d := c.docs[u]
+	if d == nil {
+		d = &remoteDoc[T]{url: u, parse: c.parse}
+		c.docs[u] = d
+	}
+	return d
+}
+
+// remoteDoc is a URL's document as last fetched. A failed fetch keeps the
+// last good one.
+type remoteDoc[T any] struct {
+	url   string
+	parse func([]byte) (*T, error)
+	sf    singleflight.Group
+
+	mu      sync.Mutex
+	doc     *T
+	checked time.Time // last fetch
+	forced  time.Time // last fetch on a miss
+}
+
+// get returns the document, fetching it on first use, and refreshing it in
+// the background once older than maxAge.
+func (d *remoteDoc[T]) get(maxAge time.Duration) *T {
+	d.mu.Lock()
+	doc, never, stale := d.doc, d.checked.IsZero(), time.Since(d.checked) > maxAge
+	d.mu.Unlock()
+	switch {
+	case never:
+		d.sf.Do("", d.fetch)
+		return d.current()
+	case doc == nil:
+		return d.refresh()
+	case stale:
+		d.sf.DoChan("", d.fetch)
+	}
+	return doc
+}
+
+func (d *remoteDoc[T]) current() *T {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.doc
+}
+
+// refresh fetches the document now, at most once per remoteMinInterval; a
+// caller arriving during a fetch waits for it.
+func (d *remoteDoc[T]) refresh() *T {
+	d.sf.Do("", func() (any, error) {
+		d.mu.Lock()
+		limited := time.Since(d.forced) < remoteMinInterval
+		if !limited {
+			d.forced = time.Now()
+		}
+		d.mu.Unlock()
+		if limited {
+			return nil, nil
+		}
+		return d.fetch()
+	})
+	return d.current()
+}
+
+// fetch replaces the document with the URL's; its results are for
+// singleflight.
+func (d *remoteDoc[T]) fetch() (any, error) {
+	doc, err := d.fetchDoc()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.checked = time.Now()
+	if err != nil {
+		slog.Warn("plugin: can not fetch from identity provider, keeping the last document", "url", d.url, "error", err)
+		return nil, nil
+	}
+	d.doc = doc
+	return nil, nil
+}
+
+func (d *remoteDoc[T]) fetchDoc() (*T, error) {
+	resp, err := idpHTTPClient.Get(d.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, remoteMaxSize))
+	if err != nil {
+		return nil, err
+	}
+	return d.parse(b)
+}
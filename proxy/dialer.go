@@ -25,7 +25,13 @@ func newDialer() *dialer {
 }
 
 func (d *dialer) DialContext(ctx context.Context, network, addr string) (conn net.Conn, err error) {
-	conn, err = d.inner.DialContext(ctx, network, addr)
+	if t := timeoutsFromContext(ctx).Connect; t > 0 {
+		inner := d.inner
+		inner.Timeout = t
+		conn, err = inner.DialContext(ctx, network, addr)
+	} else {
+		conn, err = d.inner.DialContext(ctx, network, addr)
+	}
 	if err != nil {
 		if ctx.Err() == nil { // parent context is not canceled
 			if d.onError != nil {
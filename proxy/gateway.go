@@ -17,6 +17,9 @@ func (g *gateway) RoundTrip(r *http.Request) (*http.Response, error) {
 		// explicit h2c (appProtocol) — no auto-detection / fallback
 		return g.H2C.RoundTrip(r)
 	case "https":
+		if u := upstreamTLSFromContext(r.Context()); u != nil {
+			return u.RoundTrip(r)
+		}
 		return g.Default.RoundTrip(r)
 	default: // http or empty
 		if g.AutoH2C != nil {
@@ -3,10 +3,13 @@ package proxy
 import (
 	"context"
 	"errors"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httputil"
+	"strconv"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/moonrhythm/parapet-ingress-controller/wafclaim"
@@ -16,10 +19,17 @@ import (
 type Proxy struct {
 	OnDialError func(addr string)
 
+	// OnResponse, when set, is called with the status of every upstream
+	// exchange (the upstream's response, or the 502 for a connection that broke
+	// after it was established) and the pod addr it came from, attributed to
+	// the backend Service set by WithBackendAttr. Feeds outlier detection.
+	OnResponse func(namespace, serviceName, addr string, statusCode int)
+
 	dialer        *dialer
 	reverseProxy  httputil.ReverseProxy
 	httpTransport *http.Transport
 	h2cTransport  *h2cTransport
+	http1, h2c    *timeoutTransport // the transports with the route timeouts
 	gw            *gateway
 	autoH2C       *autoH2CTransport
 
@@ -38,10 +48,12 @@ func New() *Proxy {
 	d.onError = p.onDialError
 	p.dialer = d
 	p.httpTransport = newHTTPTransport(d.DialContext)
-	p.h2cTransport = newH2CTransport(d.DialContext, p.httpTransport)
+	p.http1 = withTimeouts(p.httpTransport)
+	p.h2cTransport = newH2CTransport(d.DialContext, p.http1)
+	p.h2c = withTimeouts(p.h2cTransport)
 	p.gw = &gateway{
-		Default: p.httpTransport,
-		H2C:     p.h2cTransport,
+		Default: p.http1,
+		H2C:     p.h2c,
 	}
 	p.reverseProxy = httputil.ReverseProxy{
 		// The edge→core WAF claim is consumed in-process (GlobalWAF / WAFZone
@@ -54,10 +66,21 @@ func New() *Proxy {
 		},
 		BufferPool: newBufferPool(),
 		Transport:  p.gw,
-		// No ModifyResponse: an upstream that responded — including with 502/503 —
-		// has processed the request, so its response passes through to the client
-		// unchanged (status, headers, body). Only connection failures (no response)
-		// reach ErrorHandler and may be retried.
+		// ModifyResponse only observes: an upstream that responded — including
+		// with 502/503 — has processed the request, so its response passes
+		// through to the client unchanged (status, headers, body). Only
+		// connection failures (no response) reach ErrorHandler and may be retried.
+		//
+		// The one exception is a route's opt-in retry policy (WithRetry): a
+		// status it retries is discarded and handed to ErrorHandler instead.
+		ModifyResponse: func(resp *http.Response) error {
+			p.onResponse(resp.Request, resp.StatusCode)
+			if retry := retryFromContext(resp.Request.Context()); retry != nil && retry(resp.StatusCode, nil) {
+				resp.Body.Close()
+				return &retryError{statusCode: resp.StatusCode}
+			}
+			return nil
+		},
 		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
 			if errors.Is(err, context.Canceled) {
 				// client canceled request
@@ -71,7 +94,11 @@ func New() *Proxy {
 				// lets handler retry
 				panic(err)
 			}
+			if retry := retryFromContext(r.Context()); retry != nil && isConnReset(err) && retry(0, err) {
+				panic(&retryError{err: err})
+			}
 
+			p.onResponse(r, http.StatusBadGateway)
 			http.Error(w, "Bad Gateway", http.StatusBadGateway)
 		},
 	}
@@ -84,6 +111,17 @@ func (p *Proxy) onDialError(addr string) {
 	}
 }
 
+func (p *Proxy) onResponse(r *http.Request, statusCode int) {
+	if p.OnResponse == nil {
+		return
+	}
+	a := backendAttrFromContext(r.Context())
+	if a.serviceName == "" {
+		return
+	}
+	p.OnResponse(a.namespace, a.serviceName, r.URL.Host, statusCode)
+}
+
 func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// A normalized extended-CONNECT WebSocket handshake (wsh2.Normalize parked its
 	// stream in the context) cannot ride httputil.ReverseProxy: that path hijacks
@@ -108,7 +146,7 @@ func (p *Proxy) ConfigTransport(f func(tr *http.Transport)) {
 // concurrent probes are single-flighted. ttl <= 0 uses a sensible default. Call
 // before serving traffic.
 func (p *Proxy) EnableAutoH2C(ttl time.Duration) {
-	p.autoH2C = newAutoH2CTransport(p.h2cTransport, p.httpTransport, ttl)
+	p.autoH2C = newAutoH2CTransport(p.h2c, p.http1, ttl)
 	p.gw.AutoH2C = p.autoH2C
 }
 
@@ -123,6 +161,53 @@ func (p *Proxy) AutoH2CEnabled() bool {
 // 502/503) has already received and processed the request, so retrying could
 // duplicate side effects and amplify load on a failing backend. Those responses
 // pass through to the client unchanged instead of being retried.
+//
+// A route's retry policy (WithRetry) widens that for the exchanges it accepts;
+// they fail with an error IsRetryable reports too.
 func IsRetryable(err error) bool {
-	return isDialError(err)
+	var retryErr *retryError
+	return isDialError(err) || errors.As(err, &retryErr)
+}
+
+// RetryFunc is a route's retry policy, asked about an upstream exchange that
+// responded with a 5xx statusCode, or (statusCode 0) whose connection broke
+// with err after it was established. Returning true discards the outcome and
+// fails the exchange with a retryable error.
+type RetryFunc func(statusCode int, err error) bool
+
+type retryCtxKey struct{}
+
+// WithRetry returns a child context applying retry to the request's upstream
+// exchange. The retry middleware sets it on an attempt that may be retried.
+func WithRetry(ctx context.Context, retry RetryFunc) context.Context {
+	return context.WithValue(ctx, retryCtxKey{}, retry)
+}
+
+func retryFromContext(ctx context.Context) RetryFunc {
+	retry, _ := ctx.Value(retryCtxKey{}).(RetryFunc)
+	return retry
+}
+
+// retryError is an exchange a retry policy accepted for retry.
+type retryError struct {
+	statusCode int
+	err        error
+}
+
+func (e *retryError) Error() string {
+	if e.err != nil {
+		return "proxy: retry after connection error: " + e.err.Error()
+	}
+	return "proxy: retry after upstream status " + strconv.Itoa(e.statusCode)
+}
+
+func (e *retryError) Unwrap() error { return e.err }
+
+// isConnReset reports whether err is an established connection broken by the
+// upstream (reset, or closed before a response), not a timeout.
+func isConnReset(err error) bool {
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
 }
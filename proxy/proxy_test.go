@@ -83,6 +83,34 @@ func TestProxy(t *testing.T) {
 		assert.Equal(t, "upstream-503", w.Body.String())
 		assert.Equal(t, 1, calls)
 	})
+
+	t.Run("reports upstream responses to OnResponse", func(t *testing.T) {
+		t.Parallel()
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer ts.Close()
+
+		type observed struct {
+			namespace, name, addr string
+			status                int
+		}
+		var got []observed
+		proxy := New()
+		proxy.OnResponse = func(namespace, serviceName, addr string, statusCode int) {
+			got = append(got, observed{namespace, serviceName, addr, statusCode})
+		}
+
+		r := httptest.NewRequest(http.MethodGet, ts.URL, nil)
+		proxy.ServeHTTP(httptest.NewRecorder(), r)
+		assert.Empty(t, got, "an unattributed request is not reported")
+
+		r = httptest.NewRequest(http.MethodGet, ts.URL, nil)
+		r = r.WithContext(WithBackendAttr(r.Context(), "ClusterIP", "default", "api"))
+		proxy.ServeHTTP(httptest.NewRecorder(), r)
+		assert.Equal(t, []observed{{"default", "api", ts.Listener.Addr().String(), http.StatusInternalServerError}}, got)
+	})
 }
 
 func TestIsRetryable(t *testing.T) {
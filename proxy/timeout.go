@@ -0,0 +1,212 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// defaultResponseHeaderTimeout bounds the wait for an HTTP/1.1 (or https)
+// upstream's response headers once the request is written, when the route
+// sets none. It is the http.Transport's ResponseHeaderTimeout.
+const defaultResponseHeaderTimeout = 3 * time.Minute
+
+var (
+	errResponseHeaderTimeout = errors.New("proxy: timeout awaiting upstream response headers")
+	errIdleTimeout           = errors.New("proxy: upstream response idle timeout")
+)
+
+// Timeouts are a route's upstream timeouts; a zero field keeps the default.
+type Timeouts struct {
+	// Connect bounds the dial of a new connection (default 2s).
+	Connect time.Duration
+	// ResponseHeader bounds the wait for the response headers once the request
+	// is sent (default 3m; none for h2c upstreams).
+	ResponseHeader time.Duration
+	// Idle bounds the wait for each read of the response body, so a stream
+	// that stops sending is cut (default none).
+	Idle time.Duration
+}
+
+type timeoutsCtxKey struct{}
+
+// WithTimeouts returns a child context carrying a route's upstream timeouts.
+// The route handler sets it for a backend whose Ingress overrides any.
+func WithTimeouts(ctx context.Context, t Timeouts) context.Context {
+	return context.WithValue(ctx, timeoutsCtxKey{}, t)
+}
+
+func timeoutsFromContext(ctx context.Context) Timeouts {
+	t, _ := ctx.Value(timeoutsCtxKey{}).(Timeouts)
+	return t
+}
+
+// timeoutTransport applies a route's response header and idle timeouts to
+// its RoundTripper's exchanges. A request without them goes straight to the
+// RoundTripper, which applies the default response header timeout itself (the
+// http.Transport's ResponseHeaderTimeout; h2c has none). An exchange with a
+// response header timeout goes to the RoundTripper's headerless clone instead,
+// so a route can wait longer than the default as well as shorter.
+//
+// A timeout cancels the exchange's context. A header timeout is returned as
+// its own error, not the cancellation: ErrorHandler answers a canceled
+// request 499 (the client left), and a timed out exchange must not be retried.
+type timeoutTransport struct {
+	http.RoundTripper
+
+	tr        *http.Transport // the RoundTripper, when it is one
+	mu        sync.Mutex
+	unbounded *http.Transport // tr's headerless clone, made on first use
+}
+
+func withTimeouts(rt http.RoundTripper) *timeoutTransport {
+	t := &timeoutTransport{RoundTripper: rt}
+	t.tr, _ = rt.(*http.Transport)
+	return t
+}
+
+// headerless returns the RoundTripper without a default response header
+// timeout. An http.Transport's clone is made on first use — after
+// ConfigTransport has tuned it, and only once a route sets a timeout.
+func (t *timeoutTransport) headerless() http.RoundTripper {
+	if t.tr == nil {
+		return t.RoundTripper
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.unbounded == nil {
+		t.unbounded = t.tr.Clone()
+		t.unbounded.ResponseHeaderTimeout = 0
+	}
+	return t.unbounded
+}
+
+func (t *timeoutTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	to := timeoutsFromContext(r.Context())
+	if to.ResponseHeader <= 0 && to.Idle <= 0 {
+		return t.RoundTripper.RoundTrip(r)
+	}
+
+	ctx, cancel := context.WithCancelCause(r.Context())
+	rt := t.RoundTripper
+	var timer headerTimer
+	if to.ResponseHeader > 0 {
+		rt = t.headerless()
+		// timed from when the request is written, like ResponseHeaderTimeout,
+		// so neither the dial nor a slow upload counts
+		ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+			WroteRequest: func(httptrace.WroteRequestInfo) {
+				timer.start(to.ResponseHeader, func() { cancel(errResponseHeaderTimeout) })
+			},
+		})
+	}
+	resp, err := rt.RoundTrip(r.WithContext(ctx))
+	if timer.stop() {
+		if err == nil {
+			resp.Body.Close()
+		}
+		cancel(nil)
+		return nil, errResponseHeaderTimeout
+	}
+	if err != nil {
+		cancel(nil)
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		// the body is the upgraded connection, which ReverseProxy needs to
+		// write to as well; a spliced session has no idle timeout
+		if rwc, ok := resp.Body.(io.ReadWriteCloser); ok {
+			resp.Body = &upgradeBody{ReadWriteCloser: rwc, cancel: cancel}
+			return resp, nil
+		}
+	}
+	b := &timeoutBody{ReadCloser: resp.Body, cancel: cancel, idle: to.Idle}
+	if to.Idle > 0 {
+		b.timer = time.AfterFunc(to.Idle, func() { cancel(errIdleTimeout) })
+	}
+	resp.Body = b
+	return resp, nil
+}
+
+// CloseIdleConnections closes the idle connections of the transport and of
+// its headerless clone.
+func (t *timeoutTransport) CloseIdleConnections() {
+	if t.tr == nil {
+		return
+	}
+	t.tr.CloseIdleConnections()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.unbounded != nil {
+		t.unbounded.CloseIdleConnections()
+	}
+}
+
+// headerTimer is an exchange's response header timer, started once the
+// request is written, which may happen on another goroutine.
+type headerTimer struct {
+	mu      sync.Mutex
+	t       *time.Timer
+	stopped bool
+}
+
+func (h *headerTimer) start(d time.Duration, f func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.t == nil && !h.stopped {
+		h.t = time.AfterFunc(d, f)
+	}
+}
+
+// stop disarms the timer and reports whether it already fired.
+func (h *headerTimer) stop() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.stopped = true
+	return h.t != nil && !h.t.Stop()
+}
+
+// timeoutBody is a response body cut when a read waits longer than idle.
+type timeoutBody struct {
+	io.ReadCloser
+	cancel context.CancelCauseFunc
+	idle   time.Duration
+	timer  *time.Timer
+}
+
+func (b *timeoutBody) Read(p []byte) (int, error) {
+	if b.timer == nil {
+		return b.ReadCloser.Read(p)
+	}
+	// timed only while waiting for the upstream, not while the client is
+	// written to between reads
+	b.timer.Reset(b.idle)
+	n, err := b.ReadCloser.Read(p)
+	b.timer.Stop()
+	return n, err
+}
+
+func (b *timeoutBody) Close() error {
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	err := b.ReadCloser.Close()
+	b.cancel(nil)
+	return err
+}
+
+type upgradeBody struct {
+	io.ReadWriteCloser
+	cancel context.CancelCauseFunc
+}
+
+func (b *upgradeBody) Close() error {
+	err := b.ReadWriteCloser.Close()
+	b.cancel(nil)
+	return err
+}
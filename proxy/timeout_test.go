@@ -0,0 +1,144 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeouts(t *testing.T) {
+	t.Parallel()
+
+	serve := func(p *Proxy, target string, to Timeouts) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r = r.WithContext(WithTimeouts(r.Context(), to))
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("response header timeout answers 502", func(t *testing.T) {
+		t.Parallel()
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+			}
+		}))
+		defer ts.Close()
+
+		start := time.Now()
+		w := serve(New(), ts.URL, Timeouts{ResponseHeader: 50 * time.Millisecond})
+		assert.Equal(t, http.StatusBadGateway, w.Code)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("response header timeout starts once the request is written", func(t *testing.T) {
+		t.Parallel()
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			w.Write(b)
+		}))
+		defer ts.Close()
+
+		// an upload taking longer than the timeout
+		pr, pw := io.Pipe()
+		go func() {
+			for range 4 {
+				time.Sleep(40 * time.Millisecond)
+				pw.Write([]byte("x"))
+			}
+			pw.Close()
+		}()
+		r := httptest.NewRequest(http.MethodPost, ts.URL, pr)
+		r = r.WithContext(WithTimeouts(r.Context(), Timeouts{ResponseHeader: 50 * time.Millisecond}))
+		w := httptest.NewRecorder()
+		New().ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "xxxx", w.Body.String())
+	})
+
+	t.Run("default timeout stays on the shared transport", func(t *testing.T) {
+		t.Parallel()
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer ts.Close()
+
+		p := New()
+		assert.Equal(t, http.StatusOK, serve(p, ts.URL, Timeouts{}).Code)
+		assert.Equal(t, defaultResponseHeaderTimeout, p.httpTransport.ResponseHeaderTimeout)
+		assert.Nil(t, p.http1.unbounded, "no clone without a route timeout")
+
+		assert.Equal(t, http.StatusOK, serve(p, ts.URL, Timeouts{ResponseHeader: time.Hour}).Code)
+		if assert.NotNil(t, p.http1.unbounded) {
+			assert.Zero(t, p.http1.unbounded.ResponseHeaderTimeout, "a route may wait longer than the default")
+		}
+	})
+
+	t.Run("response header timeout is not a dial failure", func(t *testing.T) {
+		t.Parallel()
+
+		assert.False(t, IsRetryable(errResponseHeaderTimeout))
+	})
+
+	t.Run("idle timeout cuts a stalled body", func(t *testing.T) {
+		t.Parallel()
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("first"))
+			w.(http.Flusher).Flush()
+			select {
+			case <-time.After(time.Second):
+				w.Write([]byte("late"))
+			case <-r.Context().Done():
+			}
+		}))
+		defer ts.Close()
+
+		start := time.Now()
+		w := serve(New(), ts.URL, Timeouts{Idle: 50 * time.Millisecond})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "first", w.Body.String())
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("idle timeout leaves a steady stream", func(t *testing.T) {
+		t.Parallel()
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for range 4 {
+				time.Sleep(30 * time.Millisecond)
+				w.Write([]byte("x"))
+				w.(http.Flusher).Flush()
+			}
+		}))
+		defer ts.Close()
+
+		w := serve(New(), ts.URL, Timeouts{Idle: 100 * time.Millisecond})
+		assert.Equal(t, "xxxx", w.Body.String())
+	})
+
+	t.Run("connect timeout", func(t *testing.T) {
+		t.Parallel()
+
+		ts := httptest.NewServer(http.NotFoundHandler())
+		defer ts.Close()
+
+		d := newDialer()
+		conn, err := d.DialContext(context.Background(), "tcp", ts.Listener.Addr().String())
+		if assert.NoError(t, err) {
+			conn.Close()
+		}
+		// a connect timeout already passed when the dial starts
+		ctx := WithTimeouts(context.Background(), Timeouts{Connect: time.Nanosecond})
+		_, err = d.DialContext(ctx, "tcp", ts.Listener.Addr().String())
+		assert.Error(t, err)
+	})
+}
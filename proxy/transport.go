@@ -19,8 +19,8 @@ func newHTTPTransport(dial dialContextFunc) *http.Transport {
 		MaxIdleConnsPerHost:   100,
 		IdleConnTimeout:       10 * time.Second,
 		ExpectContinueTimeout: time.Second,
+		ResponseHeaderTimeout: defaultResponseHeaderTimeout,
 		DisableCompression:    true,
-		ResponseHeaderTimeout: 3 * time.Minute,
 		TLSClientConfig: &tls.Config{
 			InsecureSkipVerify: true,
 		},
@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/moonrhythm/parapet-ingress-controller/metric"
+)
+
+// errUpstreamTLSNotReady fails a request to an upstream whose verified TLS
+// configuration couldn't be built (a Secret missing or invalid): it must not
+// fall back to the unverified transport.
+var errUpstreamTLSNotReady = errors.New("proxy: upstream tls configuration not loaded")
+
+// UpstreamTLS is the TLS client configuration of https upstreams whose
+// certificate is verified, optionally presenting a client certificate (mTLS).
+// Its upstreams are spoken to over h2 when they negotiate it.
+// It has its own connection pool: the shared transport pools connections by
+// pod address only, so a connection established under another configuration
+// (or none) must never be reused for it.
+type UpstreamTLS struct {
+	base *http.Transport
+	tr   atomic.Pointer[upstreamTLSTransport]
+}
+
+type upstreamTLSTransport struct {
+	config *tls.Config
+	rt     *timeoutTransport
+}
+
+// NewUpstreamTLS returns an UpstreamTLS with no configuration yet; requests
+// through it fail until Set installs one.
+func (p *Proxy) NewUpstreamTLS() *UpstreamTLS {
+	return &UpstreamTLS{base: p.httpTransport}
+}
+
+// Set installs config, or nil when it can't be built. The previous
+// configuration's idle connections are closed; requests already in flight on
+// them finish.
+func (u *UpstreamTLS) Set(config *tls.Config) {
+	var next *upstreamTLSTransport
+	if config != nil {
+		tr := u.base.Clone()
+		// offers h2 by ALPN, so an h2 upstream is spoken to over h2; the
+		// transport keeps h1 for upgrades. A clone, since the transport adds
+		// to NextProtos and config (the WebSocket tunnel's) must stay h1.
+		tr.TLSClientConfig = config.Clone()
+		tr.ForceAttemptHTTP2 = true
+		next = &upstreamTLSTransport{config: config, rt: withTimeouts(tr)}
+	}
+	if prev := u.tr.Swap(next); prev != nil {
+		prev.rt.CloseIdleConnections()
+	}
+}
+
+// config returns the installed configuration, or nil.
+func (u *UpstreamTLS) config() *tls.Config {
+	if t := u.tr.Load(); t != nil {
+		return t.config
+	}
+	return nil
+}
+
+func (u *UpstreamTLS) RoundTrip(r *http.Request) (*http.Response, error) {
+	t := u.tr.Load()
+	if t == nil {
+		return nil, errUpstreamTLSNotReady
+	}
+	resp, err := t.rt.RoundTrip(r)
+	if err != nil {
+		countVerifyFailure(r.Context(), err)
+	}
+	return resp, err
+}
+
+// countVerifyFailure counts err if it is a failed verification of the
+// upstream's certificate.
+func countVerifyFailure(ctx context.Context, err error) {
+	var verr *tls.CertificateVerificationError
+	if errors.As(err, &verr) {
+		a := backendAttrFromContext(ctx)
+		metric.UpstreamTLSVerifyFailure(a.namespace, a.serviceName)
+	}
+}
+
+type upstreamTLSCtxKey struct{}
+
+// WithUpstreamTLS returns a child context sending an https request through u
+// instead of the shared, unverified transport. The route handler sets it for a
+// backend with verified upstream TLS.
+func WithUpstreamTLS(ctx context.Context, u *UpstreamTLS) context.Context {
+	return context.WithValue(ctx, upstreamTLSCtxKey{}, u)
+}
+
+func upstreamTLSFromContext(ctx context.Context) *UpstreamTLS {
+	u, _ := ctx.Value(upstreamTLSCtxKey{}).(*UpstreamTLS)
+	return u
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpstreamTLS(t *testing.T) {
+	t.Parallel()
+
+	var peerCerts, proto int
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peerCerts = len(r.TLS.PeerCertificates)
+		proto = r.ProtoMajor
+	}))
+	ts.EnableHTTP2 = true
+	ts.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	ts.StartTLS()
+	defer ts.Close()
+
+	trusted := x509.NewCertPool()
+	trusted.AddCert(ts.Certificate())
+
+	p := New()
+	serve := func(u *UpstreamTLS) int {
+		r := httptest.NewRequest(http.MethodGet, ts.URL, nil)
+		if u != nil {
+			r = r.WithContext(WithUpstreamTLS(r.Context(), u))
+		}
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	t.Run("unverified without configuration", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve(nil))
+	})
+
+	t.Run("verified", func(t *testing.T) {
+		config := &tls.Config{RootCAs: trusted, ServerName: "example.com"}
+		u := p.NewUpstreamTLS()
+		u.Set(config)
+		assert.Equal(t, http.StatusOK, serve(u))
+		assert.Zero(t, peerCerts)
+		assert.Equal(t, 2, proto, "h2 negotiated")
+		assert.Empty(t, u.config().NextProtos, "the tunnel's configuration stays h1")
+	})
+
+	t.Run("client certificate", func(t *testing.T) {
+		u := p.NewUpstreamTLS()
+		u.Set(&tls.Config{RootCAs: trusted, ServerName: "example.com", Certificates: ts.TLS.Certificates})
+		assert.Equal(t, http.StatusOK, serve(u))
+		assert.Equal(t, 1, peerCerts)
+	})
+
+	t.Run("unknown authority", func(t *testing.T) {
+		u := p.NewUpstreamTLS()
+		u.Set(&tls.Config{RootCAs: x509.NewCertPool(), ServerName: "example.com"})
+		assert.Equal(t, http.StatusBadGateway, serve(u))
+	})
+
+	t.Run("wrong server name", func(t *testing.T) {
+		u := p.NewUpstreamTLS()
+		u.Set(&tls.Config{RootCAs: trusted, ServerName: "other.example.org"})
+		assert.Equal(t, http.StatusBadGateway, serve(u))
+	})
+
+	t.Run("not loaded fails closed", func(t *testing.T) {
+		u := p.NewUpstreamTLS()
+		assert.Equal(t, http.StatusBadGateway, serve(u))
+
+		u.Set(&tls.Config{RootCAs: trusted, ServerName: "example.com"})
+		u.Set(nil)
+		assert.Equal(t, http.StatusBadGateway, serve(u))
+	})
+}
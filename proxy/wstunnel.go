@@ -54,13 +54,26 @@ func (p *Proxy) serveWSTunnel(w http.ResponseWriter, r *http.Request, stream io.
 	defer func() { conn.Close() }()
 
 	// https upstream: re-encrypt over TLS, HTTP/1.1 only (no h2 ALPN — this hop
-	// speaks the h1 WebSocket upgrade). Matches newHTTPTransport's TLS posture.
+	// speaks the h1 WebSocket upgrade). Matches the transports' TLS posture:
+	// the backend's verified configuration if it has one, else unverified.
 	if r.URL.Scheme == "https" {
-		tlsConn := tls.Client(conn, &tls.Config{InsecureSkipVerify: true})
+		config := &tls.Config{InsecureSkipVerify: true}
+		if u := upstreamTLSFromContext(ctx); u != nil {
+			if config = u.config(); config == nil {
+				slog.Warn("proxy: ws tunnel tls failed", "addr", addr, "error", errUpstreamTLSNotReady)
+				http.Error(w, "Bad Gateway", http.StatusBadGateway)
+				metric.WSTunnel("upstream_error")
+				return
+			}
+			config = config.Clone()
+			config.NextProtos = nil
+		}
+		tlsConn := tls.Client(conn, config)
 		_ = conn.SetDeadline(time.Now().Add(wsHandshakeTimeout))
 		if err := tlsConn.HandshakeContext(ctx); err != nil {
 			// The TCP connection was established, so the request may have reached the
 			// pod; do not retry. Nothing is written to the client yet.
+			countVerifyFailure(ctx, err)
 			slog.Warn("proxy: ws tunnel tls handshake failed", "addr", addr, "error", err)
 			http.Error(w, "Bad Gateway", http.StatusBadGateway)
 			metric.WSTunnel("upstream_error")
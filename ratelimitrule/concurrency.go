@@ -0,0 +1,239 @@
+package ratelimitrule
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// concurrencyStrategy caps each key's in-flight requests, like parapet's
+// ConcurrentQueueStrategy (the env-configured host limiters), with what the
+// zone model needs on top: a queued request gives up after the limit's wait or
+// when its client goes away (parapet's queue blocks until a slot frees), the
+// queue is FIFO, and the shape can be changed in place so a reload keeps the
+// in-flight counts — a fresh strategy would admit a full capacity on top of
+// the requests still running.
+type concurrencyStrategy struct {
+	mu   sync.Mutex
+	keys map[string]*inflight
+
+	capacity int           // max in flight per key, > 0
+	queue    int           // max waiting per key; 0 ⇒ reject at once
+	wait     time.Duration // longest a request waits in the queue
+}
+
+// inflight is one key's state. An entry lives while the key has requests in
+// flight or waiting, so the map holds only keys with open requests.
+type inflight struct {
+	n       int
+	waiters []chan struct{} // FIFO; a send hands the receiver a slot
+}
+
+func newConcurrency(capacity, queue int, wait time.Duration) *concurrencyStrategy {
+	return &concurrencyStrategy{
+		keys:     map[string]*inflight{},
+		capacity: capacity,
+		queue:    queue,
+		wait:     wait,
+	}
+}
+
+// Take takes a slot for key without waiting, for shadow limits.
+func (s *concurrencyStrategy) Take(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.entry(key)
+	if e.n >= s.capacity || len(e.waiters) > 0 {
+		s.drop(key, e)
+		return false
+	}
+	e.n++
+	return true
+}
+
+// acquire takes a slot for key, queueing for it when the key is at capacity.
+// It returns false when the queue is full, or when wait passes or ctx is done
+// before a slot is handed over.
+func (s *concurrencyStrategy) acquire(ctx context.Context, key string) bool {
+	s.mu.Lock()
+	e := s.entry(key)
+	if e.n < s.capacity && len(e.waiters) == 0 {
+		e.n++
+		s.mu.Unlock()
+		return true
+	}
+	if len(e.waiters) >= s.queue {
+		s.drop(key, e)
+		s.mu.Unlock()
+		return false
+	}
+	ch := make(chan struct{}, 1)
+	e.waiters = append(e.waiters, ch)
+	wait := s.wait
+	s.mu.Unlock()
+
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-ch:
+		return true
+	case <-t.C:
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-ch:
+		// Handed a slot while giving up: it is ours to release.
+		return true
+	default:
+	}
+	for i, w := range e.waiters {
+		if w == ch {
+			e.waiters = append(e.waiters[:i], e.waiters[i+1:]...)
+			break
+		}
+	}
+	s.drop(key, e)
+	return false
+}
+
+// Put releases key's slot, handing it to the longest waiter if there is one
+// and the key is under capacity without it.
+func (s *concurrencyStrategy) Put(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.keys[key]
+	if e == nil || e.n <= 0 {
+		return
+	}
+	if len(e.waiters) > 0 && e.n <= s.capacity {
+		s.handOff(e)
+		return
+	}
+	e.n--
+	s.drop(key, e)
+}
+
+// After is always 0: when a request finishes isn't known.
+func (s *concurrencyStrategy) After(string) time.Duration { return 0 }
+
+// quota reports key's requests in flight and the slots left. Reset is 0: a
+// slot frees when a request finishes, not on a schedule.
+func (s *concurrencyStrategy) quota(key string) (count, remaining int, reset time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e := s.keys[key]; e != nil {
+		count = e.n
+	}
+	return count, max(s.capacity-count, 0), 0
+}
+
+// reshape adopts the shape of a recompiled limit, keeping the in-flight
+// counts. A raised capacity admits waiters at once; a lowered one lets the
+// requests in flight finish and admits no one until they are under it.
+func (s *concurrencyStrategy) reshape(to *concurrencyStrategy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.capacity, s.queue, s.wait = to.capacity, to.queue, to.wait
+	for _, e := range s.keys {
+		for len(e.waiters) > 0 && e.n < s.capacity {
+			e.n++
+			s.handOff(e)
+		}
+	}
+}
+
+// entry returns key's state, creating it. Caller holds mu.
+func (s *concurrencyStrategy) entry(key string) *inflight {
+	e := s.keys[key]
+	if e == nil {
+		e = &inflight{}
+		s.keys[key] = e
+	}
+	return e
+}
+
+// handOff passes one slot to e's longest waiter. Caller holds mu.
+func (s *concurrencyStrategy) handOff(e *inflight) {
+	ch := e.waiters[0]
+	e.waiters[0] = nil
+	e.waiters = e.waiters[1:]
+	ch <- struct{}{}
+}
+
+// drop removes an idle key's entry. Caller holds mu.
+func (s *concurrencyStrategy) drop(key string, e *inflight) {
+	if e.n <= 0 && len(e.waiters) == 0 {
+		delete(s.keys, key)
+	}
+}
+
+// slot is one concurrency slot a request holds.
+type slot struct {
+	s   *concurrencyStrategy
+	key string
+}
+
+// releaseWriter releases a request's slots once its response headers are
+// written or its connection is hijacked — as the host limiters do with
+// ReleaseOnWriteHeader/ReleaseOnHijacked — so a slow body download doesn't
+// hold a slot the upstream is no longer using.
+type releaseWriter struct {
+	http.ResponseWriter
+	slots    []slot
+	released bool
+}
+
+func (w *releaseWriter) release() {
+	if w.released {
+		return
+	}
+	w.released = true
+	for _, sl := range w.slots {
+		sl.s.Put(sl.key)
+	}
+}
+
+func (w *releaseWriter) WriteHeader(statusCode int) {
+	// 1xx (other than 101) are interim responses; the final header is still
+	// to come.
+	if statusCode >= 200 || statusCode == http.StatusSwitchingProtocols {
+		w.release()
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *releaseWriter) Write(p []byte) (int, error) {
+	w.release()
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *releaseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Flush implements http.Flusher.
+func (w *releaseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.release()
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker.
+func (w *releaseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		w.release()
+		return h.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
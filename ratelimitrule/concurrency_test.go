@@ -0,0 +1,134 @@
+package ratelimitrule
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// acquireAsync runs acquire in a goroutine and returns its result channel.
+func acquireAsync(ctx context.Context, s *concurrencyStrategy, key string) <-chan bool {
+	ch := make(chan bool, 1)
+	go func() { ch <- s.acquire(ctx, key) }()
+	return ch
+}
+
+// waiters returns how many requests wait on key.
+func waiters(s *concurrencyStrategy, key string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e := s.keys[key]; e != nil {
+		return len(e.waiters)
+	}
+	return 0
+}
+
+func TestConcurrency_TakeAndPut(t *testing.T) {
+	t.Parallel()
+
+	s := newConcurrency(2, 0, 0)
+	require.True(t, s.Take("k"))
+	require.True(t, s.acquire(context.Background(), "k"))
+	assert.False(t, s.Take("k"))
+	assert.False(t, s.acquire(context.Background(), "k"), "no queue: rejected at once")
+	assert.True(t, s.Take("other"), "keys have independent slots")
+
+	count, remaining, reset := s.quota("k")
+	assert.Equal(t, 2, count)
+	assert.Zero(t, remaining)
+	assert.Zero(t, reset)
+
+	s.Put("k")
+	assert.True(t, s.Take("k"))
+	s.Put("k")
+	s.Put("k")
+	s.Put("k")
+	s.Put("other")
+	assert.Empty(t, s.keys, "idle keys hold no entry")
+	s.Put("k")
+	assert.Empty(t, s.keys, "a stray Put is ignored")
+}
+
+func TestConcurrency_QueueHandsOffInOrder(t *testing.T) {
+	t.Parallel()
+
+	s := newConcurrency(1, 2, time.Minute)
+	require.True(t, s.Take("k"))
+	first := acquireAsync(context.Background(), s, "k")
+	require.Eventually(t, func() bool { return waiters(s, "k") == 1 }, time.Second, time.Millisecond)
+	second := acquireAsync(context.Background(), s, "k")
+	require.Eventually(t, func() bool { return waiters(s, "k") == 2 }, time.Second, time.Millisecond)
+	assert.False(t, s.acquire(context.Background(), "k"), "queue full")
+	assert.False(t, s.Take("k"), "a Take never jumps the queue")
+
+	s.Put("k")
+	assert.True(t, <-first)
+	select {
+	case <-second:
+		t.Fatal("the second waiter must wait for the next release")
+	default:
+	}
+	s.Put("k")
+	assert.True(t, <-second)
+	count, _, _ := s.quota("k")
+	assert.Equal(t, 1, count, "a handed-off slot stays counted")
+}
+
+func TestConcurrency_WaitAndCancel(t *testing.T) {
+	t.Parallel()
+
+	s := newConcurrency(1, 5, 20*time.Millisecond)
+	require.True(t, s.Take("k"))
+	assert.False(t, s.acquire(context.Background(), "k"), "gives up after wait")
+	assert.Zero(t, waiters(s, "k"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.wait = time.Minute
+	res := acquireAsync(ctx, s, "k")
+	require.Eventually(t, func() bool { return waiters(s, "k") == 1 }, time.Second, time.Millisecond)
+	cancel()
+	assert.False(t, <-res, "a gone client leaves the queue")
+	assert.Zero(t, waiters(s, "k"))
+
+	s.Put("k")
+	assert.Empty(t, s.keys)
+}
+
+func TestConcurrency_Reshape(t *testing.T) {
+	t.Parallel()
+
+	s := newConcurrency(1, 5, time.Minute)
+	require.True(t, s.Take("k"))
+	res := acquireAsync(context.Background(), s, "k")
+	require.Eventually(t, func() bool { return waiters(s, "k") == 1 }, time.Second, time.Millisecond)
+
+	s.reshape(newConcurrency(2, 5, time.Minute))
+	assert.True(t, <-res, "a raised capacity admits waiters at once")
+
+	s.reshape(newConcurrency(1, 0, 0))
+	assert.False(t, s.Take("k"))
+	s.Put("k")
+	assert.False(t, s.Take("k"), "a lowered capacity waits for in-flight requests to drain")
+	s.Put("k")
+	assert.True(t, s.Take("k"))
+}
+
+func TestReleaseWriter(t *testing.T) {
+	t.Parallel()
+
+	s := newConcurrency(1, 0, 0)
+	require.True(t, s.Take("k"))
+	w := &releaseWriter{ResponseWriter: httptest.NewRecorder(), slots: []slot{{s: s, key: "k"}}}
+
+	w.WriteHeader(http.StatusEarlyHints)
+	assert.False(t, s.Take("k"), "an interim response keeps the slot")
+	w.WriteHeader(http.StatusOK)
+	assert.True(t, s.Take("k"), "the final header releases it")
+	w.release()
+	assert.False(t, s.Take("k"), "released once")
+}
@@ -0,0 +1,55 @@
+package ratelimitrule
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/moonrhythm/parapet/pkg/waf"
+)
+
+// maxCost caps what one request can draw from a bucket. A cost is also
+// clamped to the bucket's size at request time, so an expensive request can
+// drain a small bucket but never be unadmittable.
+const maxCost = 100
+
+// costExpr is a compiled Limit.Cost: one waf.IntExpr, on exactly the request
+// model, helpers and cost limit filters use. A constant cost (the common
+// "expensive endpoint" shape, with a filter) is never evaluated at all.
+type costExpr struct {
+	fixed int          // constant cost; 0 ⇒ evaluate expr
+	expr  *waf.IntExpr // the computed cost, clamped to 1..maxCost
+}
+
+// compileCost compiles a trimmed, non-empty cost expression. An integer
+// literal must already be in 1..maxCost; anything else must type-check as an
+// int, so a string or bool expression is rejected at load like a non-bool
+// filter is.
+func compileCost(expr string, opts []waf.PredicateOption) (*costExpr, error) {
+	if n, err := strconv.Atoi(expr); err == nil {
+		if n < 1 || n > maxCost {
+			return nil, fmt.Errorf("%d out of bounds (want 1..%d)", n, maxCost)
+		}
+		return &costExpr{fixed: n}, nil
+	}
+
+	e, err := waf.NewIntExpr(expr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &costExpr{expr: e}, nil
+}
+
+// eval returns the request's cost in 1..maxCost. An eval error (a non-int
+// result, a missing map key, a cost-limit breach, the eval timeout) costs 1 —
+// failing open to the default, like a filter error skips its limit.
+func (c *costExpr) eval(ctx context.Context, in waf.Input) int {
+	if c.fixed > 0 {
+		return c.fixed
+	}
+	n, err := c.expr.Eval(ctx, in)
+	if err != nil {
+		return 1
+	}
+	return int(min(max(n, 1), maxCost))
+}
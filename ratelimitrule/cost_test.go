@@ -0,0 +1,172 @@
+package ratelimitrule_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/moonrhythm/parapet-ingress-controller/ratelimitrule"
+)
+
+// costed is a limit() with a cost expression attached.
+func costed(id string, rate int, window, cost string) ratelimitrule.Limit {
+	l := limit(id, rate, window)
+	l.Cost = cost
+	return l
+}
+
+// serveBody sends a POST from 192.0.2.1 with a Content-Length of size through
+// l and reports whether next ran.
+func serveBody(l *ratelimitrule.Limiter, size int) bool {
+	r := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(strings.Repeat("x", size)))
+	r.Header.Set("X-Real-Ip", "192.0.2.1")
+	var called bool
+	l.Serve(httptest.NewRecorder(), r, http.HandlerFunc(func(http.ResponseWriter, *http.Request) { called = true }))
+	return called
+}
+
+func TestLimiter_KeyNone(t *testing.T) {
+	t.Parallel()
+
+	l := &ratelimitrule.Limiter{}
+	lim := limit("endpoint", 2, "1m")
+	lim.Key = ratelimitrule.Keys{"none"}
+	require.NoError(t, l.SetLimits([]ratelimitrule.Limit{lim}))
+	assert.Equal(t, ratelimitrule.Keys{"none"}, l.Limits()[0].Key)
+
+	_, called := serve(l, http.MethodGet, "/", map[string]string{"X-Real-Ip": "10.0.0.1"})
+	require.True(t, called)
+	_, called = serve(l, http.MethodGet, "/", map[string]string{"X-Real-Ip": "10.0.0.2"})
+	require.True(t, called)
+	w, called := serve(l, http.MethodGet, "/", map[string]string{"X-Real-Ip": "10.0.0.3"})
+	assert.False(t, called, "every client shares the one bucket")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	u, err := l.Usage("endpoint", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, u.Count)
+	_, err = l.Usage("endpoint", []string{"10.0.0.1"})
+	assert.Error(t, err, "a none key takes no values")
+}
+
+func TestLimiter_ConstantCost(t *testing.T) {
+	t.Parallel()
+
+	l := &ratelimitrule.Limiter{}
+	search := costed("search", 10, "1m", "4")
+	search.Filter = `request.method == "POST" && request.path == "/search"`
+	require.NoError(t, l.SetLimits([]ratelimitrule.Limit{search}))
+
+	for range 2 {
+		_, called := serve(l, http.MethodPost, "/search", nil)
+		require.True(t, called)
+	}
+	w, called := serve(l, http.MethodPost, "/search", nil)
+	assert.False(t, called, "4+4+4 exceeds 10")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+}
+
+func TestLimiter_CostExpression(t *testing.T) {
+	t.Parallel()
+
+	l := &ratelimitrule.Limiter{}
+	require.NoError(t, l.SetLimits([]ratelimitrule.Limit{
+		costed("upload", 50, "1m", "request.content_length / 1024 + 1"),
+	}))
+
+	require.True(t, serveBody(l, 0), "an empty body costs 1")
+	u, err := l.Usage("upload", []string{"192.0.2.1"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, u.Count)
+
+	require.True(t, serveBody(l, 37*1024), "costs 38")
+	u, _ = l.Usage("upload", []string{"192.0.2.1"})
+	assert.Equal(t, 39, u.Count)
+
+	assert.False(t, serveBody(l, 11*1024), "costs 12: over the 11 left")
+	assert.True(t, serveBody(l, 10*1024), "costs 11: exactly what is left")
+}
+
+func TestLimiter_CostClamped(t *testing.T) {
+	t.Parallel()
+
+	t.Run("to the bucket", func(t *testing.T) {
+		l := &ratelimitrule.Limiter{}
+		require.NoError(t, l.SetLimits([]ratelimitrule.Limit{
+			costed("big", 5, "1m", "request.content_length * 1000"),
+		}))
+		assert.True(t, serveBody(l, 10), "a huge cost drains the bucket but is admissible")
+		assert.False(t, serveBody(l, 0))
+	})
+
+	t.Run("to 100", func(t *testing.T) {
+		l := &ratelimitrule.Limiter{}
+		require.NoError(t, l.SetLimits([]ratelimitrule.Limit{
+			costed("big", 150, "1m", "request.content_length * 1000"),
+		}))
+		require.True(t, serveBody(l, 10))
+		u, err := l.Usage("big", []string{"192.0.2.1"})
+		require.NoError(t, err)
+		assert.Equal(t, 100, u.Count)
+	})
+
+	t.Run("up to 1", func(t *testing.T) {
+		l := &ratelimitrule.Limiter{}
+		require.NoError(t, l.SetLimits([]ratelimitrule.Limit{
+			costed("neg", 2, "1m", "request.content_length - 1000"),
+		}))
+		assert.True(t, serveBody(l, 10))
+		assert.True(t, serveBody(l, 10), "a negative cost still counts 1")
+		assert.False(t, serveBody(l, 10))
+	})
+}
+
+func TestLimiter_CostEvalErrorCostsOne(t *testing.T) {
+	t.Parallel()
+
+	l := &ratelimitrule.Limiter{}
+	require.NoError(t, l.SetLimits([]ratelimitrule.Limit{
+		costed("by-header", 3, "1m", `request.headers["x-cost"] == "high" ? 2 : 1`),
+	}))
+
+	// No such header: a missing map key is an eval error, so the default 1.
+	_, called := serve(l, http.MethodGet, "/", nil)
+	require.True(t, called)
+	_, called = serve(l, http.MethodGet, "/", map[string]string{"X-Cost": "high"})
+	require.True(t, called)
+	_, called = serve(l, http.MethodGet, "/", nil)
+	assert.False(t, called, "1+2 spent the bucket")
+}
+
+func TestLimiter_CostNonIntResultCostsOne(t *testing.T) {
+	t.Parallel()
+
+	// request.method type-checks as dyn, so it loads; its string value is an
+	// eval error at request time.
+	l := &ratelimitrule.Limiter{}
+	require.NoError(t, l.SetLimits([]ratelimitrule.Limit{costed("by-method", 2, "1m", "request.method")}))
+	for range 2 {
+		_, called := serve(l, http.MethodGet, "/", nil)
+		require.True(t, called)
+	}
+	_, called := serve(l, http.MethodGet, "/", nil)
+	assert.False(t, called, "1+1 spent the bucket")
+}
+
+func TestLimiter_CostEditKeepsCounters(t *testing.T) {
+	t.Parallel()
+
+	l := &ratelimitrule.Limiter{}
+	require.NoError(t, l.SetLimits([]ratelimitrule.Limit{costed("a", 4, "1m", "3")}))
+	_, called := serve(l, http.MethodGet, "/", nil)
+	require.True(t, called)
+
+	require.NoError(t, l.SetLimits([]ratelimitrule.Limit{costed("a", 4, "1m", "2")}))
+	_, called = serve(l, http.MethodGet, "/", nil)
+	assert.False(t, called, "3 already taken: a cost-only edit keeps the bucket")
+}
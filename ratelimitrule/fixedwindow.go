@@ -0,0 +1,99 @@
+package ratelimitrule
+
+import (
+	"sync"
+	"time"
+)
+
+// fixedWindowStrategy is parapet's ratelimit.FixedWindowStrategy (same
+// epoch-aligned windows, same admit and After math — keep the two in semantic
+// lockstep) with its counts readable for the RateLimit headers and the usage
+// endpoint, which parapet's unexported storage can't serve. Like
+// slidingWindowStrategy, a backward clock step never regresses the window (the
+// counts it holds are kept rather than reset), and there is no goroutine: the
+// map is cleared at each boundary.
+type fixedWindowStrategy struct {
+	mu     sync.Mutex
+	window int64          // window index that counts holds
+	counts map[string]int // admitted in window
+
+	max  int
+	size int64        // window size in ns, > 0 (validated by SetLimits)
+	now  func() int64 // test hook returning ns since epoch; nil = wall clock
+}
+
+func newFixedWindow(rate int, window time.Duration) *fixedWindowStrategy {
+	return &fixedWindowStrategy{
+		max:    rate,
+		size:   int64(window),
+		counts: map[string]int{},
+	}
+}
+
+func (s *fixedWindowStrategy) nowNano() int64 {
+	if s.now != nil {
+		return s.now()
+	}
+	return time.Now().UnixNano()
+}
+
+// count returns key's count in currentWindow without rolling. Caller holds mu.
+func (s *fixedWindowStrategy) count(key string, currentWindow int64) int {
+	if currentWindow > s.window {
+		return 0
+	}
+	return s.counts[key]
+}
+
+func (s *fixedWindowStrategy) Take(key string) bool { return s.takeN(key, 1) }
+
+func (s *fixedWindowStrategy) takeN(key string, n int) bool {
+	currentWindow := s.nowNano() / s.size
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if currentWindow > s.window {
+		clear(s.counts)
+		s.window = currentWindow
+	}
+	count := s.counts[key]
+	if count+n > s.max {
+		return false
+	}
+	s.counts[key] = count + n
+	return true
+}
+
+// Put does nothing — this is an arrival-rate limiter, not a concurrency limiter.
+func (s *fixedWindowStrategy) Put(string) {}
+
+// After returns how long until the window resets, when key's budget in it is
+// spent. The reset is on the epoch grid Take buckets on.
+func (s *fixedWindowStrategy) After(key string) time.Duration { return s.afterN(key, 1) }
+
+func (s *fixedWindowStrategy) afterN(key string, n int) time.Duration {
+	now := s.nowNano()
+	currentWindow := now / s.size
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.count(key, currentWindow)+n <= s.max {
+		return 0
+	}
+	return time.Duration((max(currentWindow, s.window)+1)*s.size - now)
+}
+
+// quota reports key's count in the current window, what is left of its
+// budget, and how long until the window resets. It never mutates state.
+func (s *fixedWindowStrategy) quota(key string) (count, remaining int, reset time.Duration) {
+	now := s.nowNano()
+	currentWindow := now / s.size
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count = s.count(key, currentWindow)
+	return count, max(s.max-count, 0), time.Duration((max(currentWindow, s.window)+1)*s.size - now)
+}
@@ -0,0 +1,77 @@
+package ratelimitrule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestFixed(rate int, startWindow int64) (*fixedWindowStrategy, *fixedClock) {
+	clock := &fixedClock{ns: startWindow * win}
+	s := newFixedWindow(rate, time.Second)
+	s.now = clock.now
+	return s, clock
+}
+
+func TestFixedWindow_TakeAndReset(t *testing.T) {
+	t.Parallel()
+
+	s, clock := newTestFixed(2, 100)
+	require.True(t, s.Take("k"))
+	require.True(t, s.Take("k"))
+	assert.False(t, s.Take("k"))
+	assert.True(t, s.Take("other"), "keys have independent budgets")
+
+	clock.ns = 100*win + win/4
+	assert.Equal(t, 3*time.Second/4, s.After("k"), "wait until the epoch-aligned boundary")
+	assert.Zero(t, s.After("other"))
+
+	clock.ns = 101 * win
+	assert.Zero(t, s.After("k"))
+	assert.True(t, s.Take("k"), "the boundary frees the budget")
+}
+
+func TestFixedWindow_Quota(t *testing.T) {
+	t.Parallel()
+
+	s, clock := newTestFixed(3, 100)
+	require.True(t, s.Take("k"))
+	clock.ns += win / 2
+	count, remaining, reset := s.quota("k")
+	assert.Equal(t, 1, count)
+	assert.Equal(t, 2, remaining)
+	assert.Equal(t, time.Second/2, reset)
+
+	clock.ns = 101 * win
+	count, remaining, _ = s.quota("k")
+	assert.Zero(t, count, "a past window reads as empty")
+	assert.Equal(t, 3, remaining)
+	assert.EqualValues(t, 100, s.window, "reads never roll the window")
+}
+
+func TestFixedWindow_BackwardClockKeepsCounts(t *testing.T) {
+	t.Parallel()
+
+	s, clock := newTestFixed(1, 100)
+	require.True(t, s.Take("k"))
+	clock.ns = 99 * win
+	assert.False(t, s.Take("k"), "a step back never forgets the window's counts")
+	assert.Equal(t, time.Duration(2*win), s.After("k"), "the wait is to the live window's end")
+}
+
+func TestFixedWindow_TakeN(t *testing.T) {
+	t.Parallel()
+
+	s, clock := newTestFixed(5, 100)
+	require.True(t, s.takeN("k", 3))
+	assert.False(t, s.takeN("k", 3), "3+3 exceeds 5")
+	assert.Zero(t, s.afterN("k", 2))
+	assert.Equal(t, time.Second, s.afterN("k", 3))
+	assert.True(t, s.takeN("k", 2))
+	assert.False(t, s.Take("k"))
+
+	clock.ns = 101 * win
+	assert.True(t, s.takeN("k", 5), "a whole budget fits a fresh window")
+}
@@ -0,0 +1,144 @@
+package ratelimitrule
+
+import (
+	"sync"
+	"time"
+)
+
+// gcraStrategy is the generic cell rate algorithm — the leaky bucket as a
+// meter — behind both `token-bucket` and `gcra` limits: a token bucket of
+// burst tokens refilled at rate per window admits exactly what GCRA with
+// emission interval window/rate and a tolerance of burst-1 intervals admits,
+// so one meter serves both and only the default burst differs. Per key it
+// keeps one number, the theoretical arrival time (TAT) of the next request
+// once the bucket is drained to its steady rate.
+//
+// Storage follows slidingWindowStrategy: two whole generations, each one
+// fill-time long (burst intervals, the longest a TAT can stay ahead of the
+// clock), retired wholesale at each boundary — a key untouched for a full
+// generation has a full bucket and needs no entry. No background goroutine.
+// A backward clock step never regresses the generations, and a TAT ahead of a
+// stepped-back clock only delays the key (never over-admits).
+type gcraStrategy struct {
+	mu   sync.Mutex
+	gen  int64            // generation index that cur holds
+	cur  map[string]int64 // TAT (ns since epoch) by key, written in gen
+	prev map[string]int64 // written in gen-1
+
+	interval  int64        // emission interval in ns (window/rate), > 0
+	tolerance int64        // (burst-1) * interval
+	fill      int64        // burst * interval: generation size
+	now       func() int64 // test hook returning ns since epoch; nil = wall clock
+}
+
+// newGCRA returns the meter admitting rate requests per window on average, up
+// to burst at once.
+func newGCRA(rate, burst int, window time.Duration) *gcraStrategy {
+	interval := max(int64(window)/int64(rate), 1)
+	return &gcraStrategy{
+		interval:  interval,
+		tolerance: int64(burst-1) * interval,
+		fill:      int64(burst) * interval,
+		cur:       map[string]int64{},
+		prev:      map[string]int64{},
+	}
+}
+
+func (s *gcraStrategy) nowNano() int64 {
+	if s.now != nil {
+		return s.now()
+	}
+	return time.Now().UnixNano()
+}
+
+// roll advances the generations to gen. Caller holds mu.
+func (s *gcraStrategy) roll(gen int64) {
+	switch d := gen - s.gen; {
+	case d <= 0:
+		return
+	case d == 1:
+		retired := s.prev
+		clear(retired)
+		s.prev, s.cur = s.cur, retired
+	default:
+		clear(s.cur)
+		clear(s.prev)
+	}
+	s.gen = gen
+}
+
+// tat returns key's TAT, no earlier than now. Caller holds mu.
+func (s *gcraStrategy) tat(key string, now int64) int64 {
+	tat, ok := s.cur[key]
+	if !ok {
+		tat = s.prev[key]
+	}
+	return max(tat, now)
+}
+
+// Take admits a request iff the bucket holds a token: its TAT is within the
+// tolerance of now.
+func (s *gcraStrategy) Take(key string) bool { return s.takeN(key, 1) }
+
+// takeN admits a request costing n tokens (<= burst) iff the bucket holds
+// them all: the TAT after taking them is within one interval past the
+// tolerance.
+func (s *gcraStrategy) takeN(key string, n int) bool {
+	now := s.nowNano()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.roll(now / s.fill)
+	tat := s.tat(key, now) + int64(n)*s.interval
+	if tat-s.tolerance-s.interval > now {
+		return false
+	}
+	s.cur[key] = tat
+	return true
+}
+
+// Put does nothing — this is an arrival-rate limiter, not a concurrency limiter.
+func (s *gcraStrategy) Put(string) {}
+
+// After returns how long until the bucket holds a token for key. It never
+// mutates state.
+func (s *gcraStrategy) After(key string) time.Duration { return s.afterN(key, 1) }
+
+// afterN is After for n tokens.
+func (s *gcraStrategy) afterN(key string, n int) time.Duration {
+	now := s.nowNano()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return time.Duration(max(s.peek(key, now)+int64(n-1)*s.interval-s.tolerance-now, 0))
+}
+
+// quota reports the tokens key's bucket holds (count is the tokens taken from
+// it) and how long until it is full again. It never mutates state.
+func (s *gcraStrategy) quota(key string) (count, remaining int, reset time.Duration) {
+	now := s.nowNano()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tat := s.peek(key, now)
+	if d := now + s.tolerance - tat; d >= 0 {
+		remaining = int(d/s.interval) + 1
+	}
+	return int(s.fill/s.interval) - remaining, remaining, time.Duration(tat - now)
+}
+
+// peek is tat without rolling: a generation the clock has left behind is
+// read as retired. Caller holds mu.
+func (s *gcraStrategy) peek(key string, now int64) int64 {
+	switch d := now/s.fill - s.gen; {
+	case d <= 0:
+		return s.tat(key, now)
+	case d == 1:
+		return max(s.cur[key], now)
+	default:
+		return now
+	}
+}
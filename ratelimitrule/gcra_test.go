@@ -0,0 +1,141 @@
+package ratelimitrule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestGCRA meters rate per second with the given burst, starting at
+// startSec.
+func newTestGCRA(rate, burst int, startSec int64) (*gcraStrategy, *fixedClock) {
+	clock := &fixedClock{ns: startSec * win}
+	s := newGCRA(rate, burst, time.Second)
+	s.now = clock.now
+	return s, clock
+}
+
+func TestGCRA_BurstThenSteadyRate(t *testing.T) {
+	t.Parallel()
+
+	s, clock := newTestGCRA(4, 4, 100)
+	for range 4 {
+		require.True(t, s.Take("k"))
+	}
+	assert.False(t, s.Take("k"), "bucket drained")
+	assert.True(t, s.Take("other"), "keys have independent buckets")
+
+	// One token refills per emission interval (250ms).
+	clock.ns += win / 4
+	assert.True(t, s.Take("k"))
+	assert.False(t, s.Take("k"))
+	clock.ns += win/4 - 1
+	assert.False(t, s.Take("k"), "a token is not back before its interval")
+	clock.ns++
+	assert.True(t, s.Take("k"))
+}
+
+func TestGCRA_BurstOneSpacesEvenly(t *testing.T) {
+	t.Parallel()
+
+	s, clock := newTestGCRA(2, 1, 100)
+	require.True(t, s.Take("k"))
+	assert.False(t, s.Take("k"), "burst 1: no second request in the same instant")
+	clock.ns += win / 2
+	assert.True(t, s.Take("k"))
+}
+
+func TestGCRA_AfterAndQuota(t *testing.T) {
+	t.Parallel()
+
+	s, clock := newTestGCRA(4, 4, 100)
+	count, remaining, reset := s.quota("k")
+	assert.Zero(t, count)
+	assert.Equal(t, 4, remaining)
+	assert.Zero(t, reset)
+	assert.Zero(t, s.After("k"))
+
+	require.True(t, s.Take("k"))
+	count, remaining, reset = s.quota("k")
+	assert.Equal(t, 1, count)
+	assert.Equal(t, 3, remaining)
+	assert.Equal(t, 250*time.Millisecond, reset)
+
+	for range 3 {
+		require.True(t, s.Take("k"))
+	}
+	require.False(t, s.Take("k"))
+	count, remaining, reset = s.quota("k")
+	assert.Equal(t, 4, count)
+	assert.Zero(t, remaining)
+	assert.Equal(t, time.Second, reset, "a drained bucket is full again after burst intervals")
+	assert.Equal(t, 250*time.Millisecond, s.After("k"))
+
+	clock.ns += win / 10
+	assert.Equal(t, 150*time.Millisecond, s.After("k"))
+	clock.ns += 150 * int64(time.Millisecond)
+	assert.Zero(t, s.After("k"))
+	assert.True(t, s.Take("k"), "After is exact: the key is admitted when it says")
+}
+
+func TestGCRA_ReadsDoNotMutate(t *testing.T) {
+	t.Parallel()
+
+	s, clock := newTestGCRA(1, 1, 100)
+	require.True(t, s.Take("k"))
+	clock.ns = 103 * win
+	s.After("k")
+	s.quota("k")
+	assert.EqualValues(t, 100, s.gen, "reads never roll the generations")
+	assert.Len(t, s.cur, 1)
+}
+
+func TestGCRA_IdleKeysAreRetired(t *testing.T) {
+	t.Parallel()
+
+	s, clock := newTestGCRA(2, 2, 100)
+	require.True(t, s.Take("old"))
+	clock.ns = 101 * win
+	require.True(t, s.Take("new"))
+	assert.Len(t, s.prev, 1)
+	assert.Len(t, s.cur, 1)
+
+	clock.ns = 102 * win
+	require.True(t, s.Take("new"))
+	assert.NotContains(t, s.prev, "old", "untouched for a full generation: bucket is full, entry dropped")
+
+	clock.ns = 110 * win
+	require.True(t, s.Take("k"))
+	assert.Empty(t, s.prev, "a long gap clears both generations")
+}
+
+func TestGCRA_BackwardClockOnlyDelays(t *testing.T) {
+	t.Parallel()
+
+	s, clock := newTestGCRA(1, 1, 100)
+	require.True(t, s.Take("k"))
+	clock.ns = 99 * win
+	assert.False(t, s.Take("k"), "a TAT ahead of a stepped-back clock never over-admits")
+	assert.EqualValues(t, 100, s.gen)
+	clock.ns = 101 * win
+	assert.True(t, s.Take("k"))
+}
+
+func TestGCRA_TakeN(t *testing.T) {
+	t.Parallel()
+
+	s, clock := newTestGCRA(4, 4, 100)
+	require.True(t, s.takeN("k", 3))
+	assert.False(t, s.takeN("k", 2), "one token left")
+	assert.Equal(t, 250*time.Millisecond, s.afterN("k", 2))
+	assert.Zero(t, s.afterN("k", 1))
+
+	clock.ns += win / 4
+	assert.True(t, s.takeN("k", 2), "After is exact for n tokens too")
+	assert.False(t, s.Take("k"))
+
+	clock.ns += win
+	assert.True(t, s.takeN("k", 4), "a full bucket admits its whole burst at once")
+}
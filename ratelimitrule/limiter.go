@@ -28,6 +28,13 @@ const (
 
 	maxIDLen = 63
 
+	// maxQueue bounds a concurrency limit's wait queue per key, and maxWait
+	// how long a queued request may wait; defaultWait applies when a queue is
+	// set without a wait.
+	maxQueue    = 10000
+	maxWait     = time.Minute
+	defaultWait = 10 * time.Second
+
 	// acmeChallengePrefix is never rate limited — platform-injected middleware
 	// must not break certificate issuance (same invariant as RedirectHTTPS and
 	// AllowRemote), and ACME validation probes come from unpublished IPs that an
@@ -98,13 +105,22 @@ type compiledLimit struct {
 	exclude  []netip.Prefix
 	observe  ratelimit.ObserveFunc // nil when no Observe factory is wired
 	filter   *waf.Predicate        // nil ⇒ limit always applies (no CEL gate)
+	cost     *costExpr             // nil ⇒ every request costs 1
+	inflight *concurrencyStrategy  // the strategy of a concurrency limit; nil for a rate limit
+	capacity int                   // most one request may take: Rate, or Burst for the bucket algorithms
+
+	rate    int           // normalized Rate, for the RateLimit-Policy header
+	window  time.Duration // parsed Window
+	headers bool          // emit the RateLimit fields (Limit.Headers)
 
-	// cfgKey fingerprints the strategy-shaping config (key|algorithm|rate|window).
+	// cfgKey fingerprints the strategy-shaping config
+	// (key|algorithm|rate|window|backend, plus |burst for the bucket algorithms).
 	// SetLimits carries the old strategy forward when it is unchanged, so editing
 	// a limit's message — or a sibling limit — never resets live counters. The
 	// filter is deliberately NOT part of cfgKey: it changes WHICH requests the
 	// limit applies to, not the bucket shaping, so a filter-only edit preserves
 	// live counters (a now-matching request just adds to existing buckets).
+	// Cost is left out for the same reason.
 	cfgKey string
 }
 
@@ -116,7 +132,7 @@ type set struct {
 	source      []Limit // normalized input, for introspection
 	needsIP     bool    // any limit keys on ip or carries an exclude list
 	needsCookie bool    // any limit keys on a cookie
-	needsFilter bool    // any limit carries a CEL filter (⇒ build the request snapshot)
+	needsFilter bool    // any limit carries a CEL filter or cost (⇒ build the request snapshot)
 	knownHost   func(host string) bool
 	country     func(*http.Request) string // resolver for `country` keys and filter request.country (may be nil)
 	asn         func(*http.Request) int64  // resolver for `asn` keys and filter request.asn (may be nil)
@@ -161,6 +177,10 @@ type Limiter struct {
 	// for the same reason as Country.
 	ASN func(*http.Request) int64
 
+	// Shared is the store counting `backend: shared` limits. nil makes
+	// SetLimits reject them.
+	Shared *SharedStore
+
 	// FilterCostLimit caps CEL evaluator cost per filter evaluation (0 ⇒ the
 	// parapet WAF default, defaultCostLimit). Mirrors WAF_COST_LIMIT — set it
 	// from the same knob so a limit filter is bounded exactly like a WAF rule.
@@ -195,11 +215,80 @@ func (l *Limiter) IDs() []string {
 	return ids
 }
 
+// ErrUnknownLimit is returned by Usage for an id the live set doesn't hold.
+var ErrUnknownLimit = errors.New("ratelimit: unknown limit")
+
+// Usage is one bucket's state as Limiter.Usage reports it.
+type Usage struct {
+	Limit Limit // the normalized limit
+	// Count is what the bucket has counted: requests in the window (fixed),
+	// the weighted two-window count rounded up (sliding), or tokens taken from
+	// the bucket (token-bucket, gcra).
+	Count     int
+	Remaining int           // requests the bucket admits now
+	Reset     time.Duration // until the bucket's full quota is back
+}
+
+// Usage reports the live state of limit id's bucket for one client, without
+// counting anything. values holds one value per characteristic of the limit's
+// key, in order, spelled as a request carries it: an IP address, a Host, an
+// ASN, a country code, a header or cookie value — none for a "none" key. They
+// go through the same bucketing as requests (IPv6 per /64, unserved hosts
+// collapsed).
+func (l *Limiter) Usage(id string, values []string) (Usage, error) {
+	s := l.set.Load()
+	if s == nil {
+		return Usage{}, ErrUnknownLimit
+	}
+	for i := range s.limits {
+		lim := &s.limits[i]
+		if lim.id != id {
+			continue
+		}
+		if len(values) != len(lim.keyParts) {
+			return Usage{}, fmt.Errorf("ratelimit: limit %q: want %d key values (%s), got %d",
+				id, len(lim.keyParts), strings.Join(s.source[i].Key, ", "), len(values))
+		}
+		q, ok := lim.strategy.(quotaStrategy)
+		if !ok {
+			return Usage{}, fmt.Errorf("ratelimit: limit %q: usage not available", id)
+		}
+		count, remaining, reset := q.quota(s.usageKey(lim, values))
+		return Usage{Limit: s.source[i], Count: count, Remaining: remaining, Reset: reset}, nil
+	}
+	return Usage{}, ErrUnknownLimit
+}
+
+// usageKey builds lim's bucket key from spelled-out part values, the way
+// bucketKey does from a request.
+func (s *set) usageKey(lim *compiledLimit, values []string) string {
+	parts := make([]string, len(lim.keyParts))
+	for i, p := range lim.keyParts {
+		v := values[i]
+		switch p.kind {
+		case keyIP:
+			var addr netip.Addr
+			if a, err := netip.ParseAddr(v); err == nil && a.Zone() == "" {
+				addr = a.Unmap()
+			}
+			v = ipKey(addr, v)
+		case keyHost:
+			v = hostKey(v, s.knownHost)
+		case keyHeader, keyCookie:
+			v = truncPart(v)
+		}
+		parts[i] = v
+	}
+	return strings.Join(parts, "\n")
+}
+
 // SetLimits validates and compiles the batch, then atomically swaps it in.
 // All-or-nothing: any invalid limit rejects the whole batch and the previous
 // good set stays live, so a bad ConfigMap edit can't drop enforcement.
-// Strategies whose shaping config (key, algorithm, rate, window) is unchanged
-// are carried over from the live set with their counters intact.
+// Strategies whose shaping config (key, algorithm, rate, window, burst) is
+// unchanged are carried over from the live set with their counters intact; a
+// concurrency limit with the same key is resized in place, keeping its
+// requests in flight.
 func (l *Limiter) SetLimits(limits []Limit) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
@@ -237,6 +326,10 @@ func (l *Limiter) SetLimits(limits []Limit) error {
 		}
 		for i := range compiled {
 			if o, ok := old[compiled[i].id]; ok && o.cfgKey == compiled[i].cfgKey {
+				if o.inflight != nil {
+					o.inflight.reshape(compiled[i].inflight)
+					compiled[i].inflight = o.inflight
+				}
 				compiled[i].strategy = o.strategy
 			}
 		}
@@ -256,7 +349,7 @@ func (l *Limiter) SetLimits(limits []Limit) error {
 		if len(compiled[i].exclude) > 0 {
 			s.needsIP = true
 		}
-		if compiled[i].filter != nil {
+		if compiled[i].filter != nil || compiled[i].cost != nil {
 			s.needsFilter = true
 		}
 		for _, p := range compiled[i].keyParts {
@@ -285,28 +378,31 @@ func (l *Limiter) compileLimit(lim Limit) (compiledLimit, Limit, error) {
 	errs = append(errs, keyErrs...)
 	lim.Key = normKeys
 
-	if lim.Rate <= 0 {
-		errs = append(errs, fmt.Errorf("rate must be > 0 (got %d)", lim.Rate))
-	}
-
-	var window time.Duration
-	if strings.TrimSpace(lim.Window) == "" {
-		errs = append(errs, errors.New("window is required"))
-	} else if d, err := time.ParseDuration(lim.Window); err != nil {
-		errs = append(errs, fmt.Errorf("invalid window: %w", err))
-	} else if d < minWindow || d > maxWindow {
-		errs = append(errs, fmt.Errorf("window %s out of bounds (want %s..%s)", d, minWindow, maxWindow))
+	// A concurrency limit caps requests in flight instead of counting them per
+	// window, so it has its own shape fields and none of a rate limit's.
+	concurrent := lim.Concurrency != 0 || lim.Algorithm == "concurrency"
+	var window, wait time.Duration
+	var bucket bool
+	var shapeErrs []error
+	if concurrent {
+		wait, shapeErrs = compileConcurrency(&lim)
 	} else {
-		window = d
-		lim.Window = d.String()
+		window, bucket, shapeErrs = compileRate(&lim)
 	}
+	errs = append(errs, shapeErrs...)
 
-	switch lim.Algorithm {
-	case "", "fixed":
-		lim.Algorithm = "fixed"
-	case "sliding":
+	switch lim.Backend {
+	case "", "local":
+		lim.Backend = "local"
+	case "shared":
+		if l.Shared == nil {
+			errs = append(errs, errors.New("backend shared requires the shared store (RATELIMIT_REDIS_URL)"))
+		}
+		if bucket || concurrent {
+			errs = append(errs, fmt.Errorf("backend shared supports fixed and sliding only (algorithm is %q)", lim.Algorithm))
+		}
 	default:
-		errs = append(errs, fmt.Errorf("unknown algorithm %q (want fixed|sliding)", lim.Algorithm))
+		errs = append(errs, fmt.Errorf("unknown backend %q (want local|shared)", lim.Backend))
 	}
 
 	var m mode
@@ -362,6 +458,32 @@ func (l *Limiter) compileLimit(lim Limit) (compiledLimit, Limit, error) {
 		}
 	}
 
+	// Cost compiles over the same surface and options as the filter, so a bad
+	// expression rejects the batch the same way.
+	var cost *costExpr
+	lim.Cost = strings.TrimSpace(lim.Cost)
+	if lim.Cost != "" {
+		c, err := compileCost(lim.Cost, l.filterOptions())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cost: %w", err))
+		} else {
+			cost = c
+		}
+	}
+	capacity := lim.Rate
+	if bucket {
+		capacity = lim.Burst
+	}
+	if concurrent && cost != nil {
+		errs = append(errs, errors.New("cost does not apply to a concurrency limit"))
+	}
+	if concurrent && lim.Headers {
+		errs = append(errs, errors.New("headers do not apply to a concurrency limit"))
+	}
+	if cost != nil && cost.fixed > capacity && capacity > 0 {
+		errs = append(errs, fmt.Errorf("cost %d exceeds the %d a request can take at once", cost.fixed, capacity))
+	}
+
 	if err := errors.Join(errs...); err != nil {
 		return compiledLimit{}, Limit{}, err
 	}
@@ -374,19 +496,34 @@ func (l *Limiter) compileLimit(lim Limit) (compiledLimit, Limit, error) {
 		message:  lim.Message,
 		exclude:  exclude,
 		filter:   filter,
+		cost:     cost,
+		capacity: capacity,
 		// Normalized key parts can't contain "," (header/cookie names are HTTP
 		// tokens, which exclude it), so the join is unambiguous.
-		cfgKey: strings.Join(lim.Key, ",") + "|" + lim.Algorithm + "|" + strconv.Itoa(lim.Rate) + "|" + lim.Window,
+		cfgKey:  strings.Join(lim.Key, ",") + "|" + lim.Algorithm + "|" + strconv.Itoa(lim.Rate) + "|" + lim.Window + "|" + lim.Backend,
+		rate:    lim.Rate,
+		window:  window,
+		headers: lim.Headers,
 	}
-	if lim.Algorithm == "sliding" {
+	switch lim.Algorithm {
+	case "concurrency":
+		// cfgKey holds no concurrency/queue/wait, so resizing a limit keeps its
+		// in-flight counts: SetLimits reshapes the carried strategy instead.
+		c.inflight = newConcurrency(lim.Concurrency, lim.Queue, wait)
+		c.strategy = c.inflight
+	case "token-bucket", "gcra":
+		// Appended only here, so fixed/sliding fingerprints (and the shared
+		// store keys hashed from them) are unchanged.
+		c.cfgKey += "|" + strconv.Itoa(lim.Burst)
+		c.strategy = newGCRA(lim.Rate, lim.Burst, window)
+	case "sliding":
 		c.strategy = newSlidingWindow(lim.Rate, window)
-	} else {
-		// Requires parapet >= v0.18.1: older FixedWindowStrategy.After computed
-		// the reset on time.Truncate's zero-time grid while Take buckets on the
-		// epoch grid, under-reporting Retry-After for windows that don't divide
-		// the year-1->epoch offset (fixed upstream, parapet#244). The epoch-grid
-		// canary test in limiter_test.go pins this floor.
-		c.strategy = &ratelimit.FixedWindowStrategy{Max: lim.Rate, Size: window}
+	default:
+		c.strategy = newFixedWindow(lim.Rate, window)
+	}
+	if lim.Backend == "shared" {
+		// The local strategy stays as the fallback while the store is down.
+		c.strategy = l.Shared.newWindow(l.NamePrefix+":"+lim.ID, c.cfgKey, lim.Rate, window, lim.Algorithm == "sliding", c.strategy)
 	}
 	if l.Observe != nil {
 		c.observe = l.Observe(l.NamePrefix + ":" + lim.ID)
@@ -394,6 +531,97 @@ func (l *Limiter) compileLimit(lim Limit) (compiledLimit, Limit, error) {
 	return c, lim, nil
 }
 
+// compileRate validates and normalizes a rate limit's shape: rate, window,
+// algorithm and burst.
+func compileRate(lim *Limit) (window time.Duration, bucket bool, errs []error) {
+	if lim.Queue != 0 || lim.Wait != "" {
+		errs = append(errs, errors.New("queue and wait only apply to concurrency limits"))
+	}
+
+	if lim.Rate <= 0 {
+		errs = append(errs, fmt.Errorf("rate must be > 0 (got %d)", lim.Rate))
+	}
+
+	if strings.TrimSpace(lim.Window) == "" {
+		errs = append(errs, errors.New("window is required"))
+	} else if d, err := time.ParseDuration(lim.Window); err != nil {
+		errs = append(errs, fmt.Errorf("invalid window: %w", err))
+	} else if d < minWindow || d > maxWindow {
+		errs = append(errs, fmt.Errorf("window %s out of bounds (want %s..%s)", d, minWindow, maxWindow))
+	} else {
+		window = d
+		lim.Window = d.String()
+	}
+
+	switch lim.Algorithm {
+	case "", "fixed":
+		lim.Algorithm = "fixed"
+	case "sliding":
+	case "token-bucket", "gcra":
+		bucket = true
+	default:
+		errs = append(errs, fmt.Errorf("unknown algorithm %q (want fixed|sliding|token-bucket|gcra|concurrency)", lim.Algorithm))
+	}
+
+	switch {
+	case lim.Burst < 0:
+		errs = append(errs, fmt.Errorf("burst must be >= 0 (got %d)", lim.Burst))
+	case lim.Burst > 0 && !bucket:
+		errs = append(errs, fmt.Errorf("burst only applies to token-bucket and gcra (algorithm is %q)", lim.Algorithm))
+	case bucket && lim.Burst == 0 && lim.Algorithm == "token-bucket":
+		lim.Burst = lim.Rate
+	case bucket && lim.Burst == 0:
+		lim.Burst = 1
+	}
+	// A bucket's entry lives as long as it takes to refill (Burst emission
+	// intervals), so that span gets the same bound as a window. Compared by
+	// division: Burst*interval could overflow.
+	if bucket && lim.Rate > 0 && lim.Burst > 0 && window > 0 {
+		interval := max(window/time.Duration(lim.Rate), 1)
+		if lim.Burst > int(maxWindow/interval) {
+			errs = append(errs, fmt.Errorf("burst %d takes over %s to refill at rate %d per %s", lim.Burst, maxWindow, lim.Rate, lim.Window))
+		}
+	}
+	return window, bucket, errs
+}
+
+// compileConcurrency validates and normalizes a concurrency limit's shape:
+// concurrency, queue and wait. It returns the parsed wait.
+func compileConcurrency(lim *Limit) (wait time.Duration, errs []error) {
+	switch lim.Algorithm {
+	case "", "concurrency":
+		lim.Algorithm = "concurrency"
+	default:
+		errs = append(errs, fmt.Errorf("algorithm %q does not apply to a concurrency limit", lim.Algorithm))
+	}
+	if lim.Concurrency <= 0 {
+		errs = append(errs, fmt.Errorf("concurrency must be > 0 (got %d)", lim.Concurrency))
+	}
+	if lim.Rate != 0 || lim.Window != "" || lim.Burst != 0 {
+		errs = append(errs, errors.New("rate, window and burst do not apply to a concurrency limit"))
+	}
+
+	switch {
+	case lim.Queue < 0 || lim.Queue > maxQueue:
+		errs = append(errs, fmt.Errorf("queue %d out of bounds (want 0..%d)", lim.Queue, maxQueue))
+	case lim.Queue == 0 && lim.Wait != "":
+		errs = append(errs, errors.New("wait only applies with a queue"))
+	case lim.Queue > 0 && strings.TrimSpace(lim.Wait) == "":
+		wait = defaultWait
+		lim.Wait = wait.String()
+	case lim.Queue > 0:
+		if d, err := time.ParseDuration(lim.Wait); err != nil {
+			errs = append(errs, fmt.Errorf("invalid wait: %w", err))
+		} else if d <= 0 || d > maxWait {
+			errs = append(errs, fmt.Errorf("wait %s out of bounds (want > 0, <= %s)", d, maxWait))
+		} else {
+			wait = d
+			lim.Wait = d.String()
+		}
+	}
+	return wait, errs
+}
+
 // filterOptions builds the waf.NewPredicate options from the Limiter's filter
 // knobs. Zero values leave the parapet WAF defaults (cost limit, macros on), so
 // an unconfigured Limiter compiles filters exactly like a default WAF rule.
@@ -412,7 +640,8 @@ func (l *Limiter) filterOptions() []waf.PredicateOption {
 // An empty spec defaults to ["ip"]; the "ip-host" alias expands to ip + host.
 // Returned normKeys is the canonical form (lowercased header names, alias
 // expanded) — it feeds cfgKey, so spec spellings that mean the same thing
-// carry counters over across reloads.
+// carry counters over across reloads. "none" compiles to no parts: every
+// request shares the one "" bucket.
 func (l *Limiter) compileKeys(keys Keys) (parts []keyPart, normKeys Keys, errs []error) {
 	if len(keys) == 0 {
 		keys = Keys{"ip"}
@@ -447,6 +676,14 @@ func (l *Limiter) compileKeys(keys Keys) (parts []keyPart, normKeys Keys, errs [
 			}
 		}
 		switch k {
+		case "none":
+			// One aggregate bucket; combined with anything it would silently mean
+			// that other characteristic alone.
+			if len(keys) != 1 {
+				errs = append(errs, errors.New("key none can't be combined with other key parts"))
+				continue
+			}
+			normKeys = append(normKeys, "none")
 		case "", "ip":
 			// "" mirrors the pre-list schema, which accepted an explicit empty
 			// key as the ip default.
@@ -485,7 +722,7 @@ func (l *Limiter) compileKeys(keys Keys) (parts []keyPart, normKeys Keys, errs [
 			// exactly); keep the given spelling.
 			add("cookie:"+name, keyPart{kind: keyCookie, name: name})
 		default:
-			errs = append(errs, fmt.Errorf("unknown key %q (want ip|host|asn|country|header:<name>|cookie:<name>)", k))
+			errs = append(errs, fmt.Errorf("unknown key %q (want ip|host|asn|country|header:<name>|cookie:<name>|none)", k))
 		}
 	}
 	return parts, normKeys, errs
@@ -587,9 +824,9 @@ func (s *set) serve(w http.ResponseWriter, r *http.Request, next http.Handler) {
 	}
 
 	// The filter snapshot (the WAF's request map) is built at most once per
-	// request and shared by every filtered limit, so N filters walk the request
-	// once — not N times. Built lazily on the first filter hit: a set with no
-	// filters (needsFilter false ⇒ getInput never called) pays nothing.
+	// request and shared by every filtered or costed limit, so N expressions
+	// walk the request once — not N times. Built lazily on the first hit: a set
+	// with neither (needsFilter false ⇒ getInput never called) pays nothing.
 	// request.body is "" (no body buffering this early in the chain); country/asn
 	// resolve through the same GeoIP funcs the keys use (nil ⇒ "" / 0, which a
 	// geo filter simply never matches against).
@@ -611,6 +848,17 @@ func (s *set) serve(w http.ResponseWriter, r *http.Request, next http.Handler) {
 		return input
 	}
 
+	// The RateLimit fields describe one limit: of the enforced, opted-in limits
+	// that counted this request, the one with the least left (then the longest
+	// wait for its quota) — the limit a client pacing itself must respect.
+	var (
+		tightest  *compiledLimit
+		remaining int
+		reset     time.Duration
+	)
+	// Concurrency slots taken so far; a later rejection gives them back.
+	var held []slot
+
 	for i := range s.limits {
 		lim := &s.limits[i]
 
@@ -628,10 +876,36 @@ func (s *set) serve(w http.ResponseWriter, r *http.Request, next http.Handler) {
 			}
 		}
 		key := s.bucketKey(lim, r, addr, rawIP, cookies)
-		if lim.strategy.Take(key) {
+		n := 1
+		if lim.cost != nil {
+			n = min(lim.cost.eval(r.Context(), getInput()), lim.capacity)
+		}
+		var ok bool
+		switch {
+		case lim.inflight == nil:
+			ok = takeN(lim.strategy, key, n)
+		case lim.mode == modeShadow:
+			// Never queue for a shadow limit: it must not delay what it doesn't
+			// enforce.
+			ok = lim.inflight.Take(key)
+		default:
+			ok = lim.inflight.acquire(r.Context(), key)
+		}
+		if ok {
+			if lim.inflight != nil {
+				held = append(held, slot{s: lim.inflight, key: key})
+			}
 			if lim.observe != nil {
 				lim.observe(ratelimit.Event{Name: "", Result: ratelimit.ResultAllowed})
 			}
+			if lim.headers && lim.mode == modeEnforce {
+				if q, ok := lim.strategy.(quotaStrategy); ok {
+					_, rem, rst := q.quota(key)
+					if tightest == nil || rem < remaining || (rem == remaining && rst > reset) {
+						tightest, remaining, reset = lim, rem, rst
+					}
+				}
+			}
 			continue
 		}
 		if lim.observe != nil {
@@ -640,18 +914,78 @@ func (s *set) serve(w http.ResponseWriter, r *http.Request, next http.Handler) {
 		if lim.mode == modeShadow {
 			continue
 		}
-		if after := lim.strategy.After(key); after > 0 {
+		for _, sl := range held {
+			sl.s.Put(sl.key)
+		}
+		if after := afterN(lim.strategy, key, n); after > 0 {
 			// Ceil to >= 1: truncation would emit "Retry-After: 0" for sub-second
 			// waits and a compliant client would retry into another denial.
 			secs := int64((after + time.Second - 1) / time.Second)
 			header.Set(w.Header(), header.RetryAfter, strconv.FormatInt(secs, 10))
 		}
+		if q, ok := lim.strategy.(quotaStrategy); ok && lim.headers {
+			_, rem, rst := q.quota(key)
+			setQuotaHeaders(w.Header(), lim, rem, rst)
+		}
 		http.Error(w, lim.message, lim.status)
 		return
 	}
+	if tightest != nil {
+		setQuotaHeaders(w.Header(), tightest, remaining, reset)
+	}
+	if len(held) > 0 {
+		rw := &releaseWriter{ResponseWriter: w, slots: held}
+		defer rw.release() // also when next panics or never writes
+		w = rw
+	}
 	next.ServeHTTP(w, r)
 }
 
+// quotaStrategy is a strategy that can report a key's bucket state, for the
+// RateLimit headers (draft-ietf-httpapi-ratelimit-headers) and Limiter.Usage.
+// Every strategy SetLimits builds implements it.
+type quotaStrategy interface {
+	// quota returns key's count as the strategy weighs it, the requests key may
+	// still make now, and how long until its full quota is back. It must not
+	// mutate state.
+	quota(key string) (count, remaining int, reset time.Duration)
+}
+
+// costStrategy is a strategy that can take several tokens at once, for limits
+// with a cost. Every strategy SetLimits builds implements it; n is at most the
+// limit's capacity.
+type costStrategy interface {
+	takeN(key string, n int) bool
+	// afterN is After for a request costing n. It must not mutate state.
+	afterN(key string, n int) time.Duration
+}
+
+// takeN takes n tokens for key, counting the request once on a strategy that
+// can't weigh it.
+func takeN(s ratelimit.Strategy, key string, n int) bool {
+	if c, ok := s.(costStrategy); ok {
+		return c.takeN(key, n)
+	}
+	return s.Take(key)
+}
+
+// afterN returns how long until key can take n tokens, like takeN.
+func afterN(s ratelimit.Strategy, key string, n int) time.Duration {
+	if c, ok := s.(costStrategy); ok {
+		return c.afterN(key, n)
+	}
+	return s.After(key)
+}
+
+// setQuotaHeaders sets the RateLimit-Policy and RateLimit fields for lim.
+// Seconds round up, like Retry-After.
+func setQuotaHeaders(h http.Header, lim *compiledLimit, remaining int, reset time.Duration) {
+	w := int64((lim.window + time.Second - 1) / time.Second)
+	t := int64((max(reset, 0) + time.Second - 1) / time.Second)
+	h.Set("RateLimit-Policy", strconv.Quote(lim.id)+";q="+strconv.Itoa(lim.rate)+";w="+strconv.FormatInt(w, 10))
+	h.Set("RateLimit", strconv.Quote(lim.id)+";r="+strconv.Itoa(remaining)+";t="+strconv.FormatInt(t, 10))
+}
+
 // skip reports whether the client IP is excluded from this limit. An invalid
 // (unparsable) address is never excluded — fail-closed, garbage can't bypass a
 // limit that carries excludes.
@@ -670,7 +1004,7 @@ func (lim *compiledLimit) skip(addr netip.Addr) bool {
 // bucketKey builds the strategy key for this limit by composing its parts'
 // per-request values with "\n" (see keyKind for why that is unambiguous). The
 // single-part case skips the builder — it is the common shape and stays
-// alloc-free for ip/host keys.
+// alloc-free for ip/host keys. A "none" key (no parts) is always "".
 func (s *set) bucketKey(lim *compiledLimit, r *http.Request, addr netip.Addr, rawIP string, cookies map[string]string) string {
 	if len(lim.keyParts) == 1 {
 		return s.partValue(lim.keyParts[0], r, addr, rawIP, cookies)
@@ -107,16 +107,43 @@ func TestLimiter_SetLimitsValidation(t *testing.T) {
 		{"name suffix on country", func(l *ratelimitrule.Limit) { l.Key = ratelimitrule.Keys{"country:US"} }},
 		{"name suffix on asn", func(l *ratelimitrule.Limit) { l.Key = ratelimitrule.Keys{"asn:13335"} }},
 		{"uppercase kind", func(l *ratelimitrule.Limit) { l.Key = ratelimitrule.Keys{"IP"} }},
+		{"none combined with ip", func(l *ratelimitrule.Limit) { l.Key = ratelimitrule.Keys{"none", "ip"} }},
+		{"name suffix on none", func(l *ratelimitrule.Limit) { l.Key = ratelimitrule.Keys{"none:x"} }},
 		{"zero rate", func(l *ratelimitrule.Limit) { l.Rate = 0 }},
 		{"negative rate", func(l *ratelimitrule.Limit) { l.Rate = -5 }},
 		{"missing window", func(l *ratelimitrule.Limit) { l.Window = "" }},
 		{"malformed window", func(l *ratelimitrule.Limit) { l.Window = "soon" }},
 		{"window too small", func(l *ratelimitrule.Limit) { l.Window = "500ms" }},
 		{"window too large", func(l *ratelimitrule.Limit) { l.Window = "2h" }},
-		{"unknown algorithm", func(l *ratelimitrule.Limit) { l.Algorithm = "token-bucket" }},
+		{"unknown algorithm", func(l *ratelimitrule.Limit) { l.Algorithm = "leaky-bucket" }},
+		{"burst on fixed", func(l *ratelimitrule.Limit) { l.Burst = 5 }},
+		{"burst on sliding", func(l *ratelimitrule.Limit) { l.Algorithm, l.Burst = "sliding", 5 }},
+		{"negative burst", func(l *ratelimitrule.Limit) { l.Algorithm, l.Burst = "token-bucket", -1 }},
+		{"burst refill over 1h", func(l *ratelimitrule.Limit) { l.Algorithm, l.Burst = "gcra", 3601 }},
+		{"shared token-bucket", func(l *ratelimitrule.Limit) { l.Algorithm, l.Backend = "token-bucket", "shared" }},
 		{"unknown mode", func(l *ratelimitrule.Limit) { l.Mode = "dry-run" }},
+		{"unknown backend", func(l *ratelimitrule.Limit) { l.Backend = "memcached" }},
+		{"shared backend without store", func(l *ratelimitrule.Limit) { l.Backend = "shared" }},
 		{"status not 429/503", func(l *ratelimitrule.Limit) { l.Status = 403 }},
 		{"bad exclude cidr", func(l *ratelimitrule.Limit) { l.Exclude = []string{"10.0.0.0"} }},
+		{"zero constant cost", func(l *ratelimitrule.Limit) { l.Cost = "0" }},
+		{"concurrency with rate", func(l *ratelimitrule.Limit) { l.Concurrency = 2 }},
+		{"concurrency algorithm without concurrency", func(l *ratelimitrule.Limit) { l.Rate, l.Window, l.Algorithm = 0, "", "concurrency" }},
+		{"negative concurrency", func(l *ratelimitrule.Limit) { l.Rate, l.Window, l.Concurrency = 0, "", -1 }},
+		{"concurrency with fixed", func(l *ratelimitrule.Limit) { l.Rate, l.Window, l.Concurrency, l.Algorithm = 0, "", 2, "fixed" }},
+		{"concurrency shared", func(l *ratelimitrule.Limit) { l.Rate, l.Window, l.Concurrency, l.Backend = 0, "", 2, "shared" }},
+		{"concurrency with cost", func(l *ratelimitrule.Limit) { l.Rate, l.Window, l.Concurrency, l.Cost = 0, "", 2, "1" }},
+		{"concurrency with headers", func(l *ratelimitrule.Limit) { l.Rate, l.Window, l.Concurrency, l.Headers = 0, "", 2, true }},
+		{"queue on a rate limit", func(l *ratelimitrule.Limit) { l.Queue = 5 }},
+		{"wait without queue", func(l *ratelimitrule.Limit) { l.Rate, l.Window, l.Concurrency, l.Wait = 0, "", 2, "1s" }},
+		{"queue too long", func(l *ratelimitrule.Limit) { l.Rate, l.Window, l.Concurrency, l.Queue = 0, "", 2, 10001 }},
+		{"wait too long", func(l *ratelimitrule.Limit) { l.Rate, l.Window, l.Concurrency, l.Queue, l.Wait = 0, "", 2, 5, "2m" }},
+		{"constant cost over 100", func(l *ratelimitrule.Limit) { l.Rate, l.Cost = 500, "101" }},
+		{"constant cost over rate", func(l *ratelimitrule.Limit) { l.Cost = "2" }},
+		{"constant cost over burst", func(l *ratelimitrule.Limit) { l.Algorithm, l.Rate, l.Cost = "gcra", 10, "2" }},
+		{"bool cost", func(l *ratelimitrule.Limit) { l.Cost = `request.method == "POST"` }},
+		{"string cost", func(l *ratelimitrule.Limit) { l.Cost = `"ten"` }},
+		{"malformed cost", func(l *ratelimitrule.Limit) { l.Cost = "request.content_length /" }},
 	}
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -166,6 +193,7 @@ func TestLimiter_NormalizedDefaults(t *testing.T) {
 	assert.Equal(t, ratelimitrule.Keys{"ip"}, got[0].Key)
 	assert.Equal(t, "fixed", got[0].Algorithm)
 	assert.Equal(t, "enforce", got[0].Mode)
+	assert.Equal(t, "local", got[0].Backend)
 	assert.Equal(t, http.StatusTooManyRequests, got[0].Status)
 	assert.Equal(t, "Too Many Requests", got[0].Message)
 	assert.Equal(t, "1m0s", got[0].Window, "window normalized to the parsed duration")
@@ -724,12 +752,11 @@ func TestLimiter_KeyNormalizationCarriesCountersOver(t *testing.T) {
 func TestLimiter_RetryAfterOnEpochGridForOddWindows(t *testing.T) {
 	t.Parallel()
 
-	// Dependency-floor canary (parapet >= v0.18.1, parapet#244): for a window
-	// that doesn't divide the year-1->epoch offset (7s: offset mod 7 = 4s),
-	// FixedWindowStrategy.After before the fix reported the reset on the wrong
-	// grid — up to 4s short. The serve path's Retry-After must land on the
-	// epoch grid Take buckets on. This test FAILS against parapet v0.18.0, so
-	// the removed local wrapper can't silently un-couple from the bump.
+	// For a window that doesn't divide the year-1->epoch offset (7s: offset mod
+	// 7 = 4s), a reset computed with time.Truncate lands on the wrong grid — up
+	// to 4s short (parapet's FixedWindowStrategy before v0.18.1, parapet#244,
+	// which fixedWindowStrategy mirrors). The serve path's Retry-After must land
+	// on the epoch grid Take buckets on.
 	const size = int64(7 * time.Second)
 	ceilSec := func(ns int64) int64 { return (ns + int64(time.Second) - 1) / int64(time.Second) }
 
@@ -807,3 +834,302 @@ func TestLimiter_ExcludeParityEdgeCases(t *testing.T) {
 	assert.True(t, take("11.0.0.1"))
 	assert.False(t, take("11.0.0.1"), "outside the /8: limited as usual")
 }
+
+func TestLimiter_TokenBucket(t *testing.T) {
+	t.Parallel()
+
+	l := &ratelimitrule.Limiter{}
+	lim := limit("api", 2, "1m")
+	lim.Algorithm = "token-bucket"
+	lim.Headers = true
+	require.NoError(t, l.SetLimits([]ratelimitrule.Limit{lim}))
+	assert.Equal(t, 2, l.Limits()[0].Burst, "token-bucket burst defaults to rate")
+
+	hdr := map[string]string{"X-Real-Ip": "1.2.3.4"}
+	for range 2 {
+		_, called := serve(l, http.MethodGet, "/", hdr)
+		require.True(t, called)
+	}
+	w, called := serve(l, http.MethodGet, "/", hdr)
+	require.False(t, called)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"), "one token per window/rate")
+	assert.Equal(t, `"api";q=2;w=60`, w.Header().Get("RateLimit-Policy"))
+	assert.Equal(t, `"api";r=0;t=60`, w.Header().Get("RateLimit"))
+
+	// A message edit carries the bucket over; a burst change is a reset.
+	lim.Message = "slow down"
+	require.NoError(t, l.SetLimits([]ratelimitrule.Limit{lim}))
+	_, called = serve(l, http.MethodGet, "/", hdr)
+	assert.False(t, called, "unchanged shaping config carries the bucket over")
+	lim.Burst = 3
+	require.NoError(t, l.SetLimits([]ratelimitrule.Limit{lim}))
+	_, called = serve(l, http.MethodGet, "/", hdr)
+	assert.True(t, called, "burst is part of the shaping config")
+}
+
+func TestLimiter_GCRA(t *testing.T) {
+	t.Parallel()
+
+	l := &ratelimitrule.Limiter{}
+	lim := limit("api", 60, "1h")
+	lim.Algorithm = "gcra"
+	lim.Headers = true
+	require.NoError(t, l.SetLimits([]ratelimitrule.Limit{lim}))
+	assert.Equal(t, 1, l.Limits()[0].Burst, "gcra burst defaults to 1: evenly spaced")
+
+	hdr := map[string]string{"X-Real-Ip": "1.2.3.4"}
+	_, called := serve(l, http.MethodGet, "/", hdr)
+	require.True(t, called)
+	w, called := serve(l, http.MethodGet, "/", hdr)
+	require.False(t, called, "the second request in the same minute is spaced out")
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	assert.Equal(t, `"api";r=0;t=60`, w.Header().Get("RateLimit"))
+}
+
+func TestLimiter_RateLimitHeaders(t *testing.T) {
+	t.Parallel()
+
+	l := &ratelimitrule.Limiter{}
+	quiet := limit("quiet", 1, "1m") // no headers: never reported
+	wide := limit("wide", 10, "1m")
+	wide.Headers = true
+	tight := limit("tight", 3, "1h")
+	tight.Headers = true
+	tight.Key = ratelimitrule.Keys{"host"}
+	shadow := limit("shadow", 1, "1m")
+	shadow.Headers = true
+	shadow.Mode = "shadow"
+	require.NoError(t, l.SetLimits([]ratelimitrule.Limit{wide, tight, shadow}))
+
+	hdr := map[string]string{"X-Real-Ip": "1.2.3.4"}
+	w, called := serve(l, http.MethodGet, "/", hdr)
+	require.True(t, called)
+	assert.Equal(t, `"tight";q=3;w=3600`, w.Header().Get("RateLimit-Policy"), "the limit with the least left")
+	assert.Regexp(t, `^"tight";r=2;t=\d+$`, w.Header().Get("RateLimit"))
+
+	w, _ = serve(l, http.MethodGet, "/", hdr)
+	assert.Regexp(t, `^"tight";r=1;`, w.Header().Get("RateLimit"))
+	w, _ = serve(l, http.MethodGet, "/", hdr)
+	assert.Regexp(t, `^"tight";r=0;`, w.Header().Get("RateLimit"))
+	w, called = serve(l, http.MethodGet, "/", hdr)
+	require.False(t, called)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	assert.Regexp(t, `^"tight";r=0;t=\d+$`, w.Header().Get("RateLimit"), "the rejecting limit")
+
+	// Without an opted-in limit nothing is emitted, not even on rejection —
+	// only Retry-After.
+	require.NoError(t, l.SetLimits([]ratelimitrule.Limit{quiet}))
+	serve(l, http.MethodGet, "/", hdr)
+	w, called = serve(l, http.MethodGet, "/", hdr)
+	require.False(t, called)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	assert.Empty(t, w.Header().Get("RateLimit"))
+	assert.Empty(t, w.Header().Get("RateLimit-Policy"))
+}
+
+func TestLimiter_Usage(t *testing.T) {
+	t.Parallel()
+
+	l := &ratelimitrule.Limiter{KnownHost: func(h string) bool { return h == "example.com" }}
+	perIP := limit("per-ip", 5, "1h")
+	perKey := limit("per-key", 5, "1h")
+	perKey.Key = ratelimitrule.Keys{"ip-host", "header:X-Api-Key"}
+	require.NoError(t, l.SetLimits([]ratelimitrule.Limit{perIP, perKey}))
+
+	for range 2 {
+		serve(l, http.MethodGet, "/", map[string]string{"X-Real-Ip": "2001:db8::1", "X-Api-Key": "k1"})
+	}
+
+	u, err := l.Usage("per-ip", []string{"2001:db8::2"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, u.Count, "IPv6 buckets per /64, like requests")
+	assert.Equal(t, 3, u.Remaining)
+	assert.Positive(t, u.Reset)
+	assert.Equal(t, "fixed", u.Limit.Algorithm)
+
+	// httptest requests carry Host example.com.
+	u, err = l.Usage("per-key", []string{"2001:db8::1", "example.com", "k1"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, u.Count)
+	u, err = l.Usage("per-key", []string{"2001:db8::1", "example.com", "k2"})
+	require.NoError(t, err)
+	assert.Zero(t, u.Count)
+
+	// Reading never counts.
+	u, err = l.Usage("per-ip", []string{"2001:db8::1"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, u.Count)
+
+	_, err = l.Usage("per-key", []string{"2001:db8::1"})
+	assert.Error(t, err, "one value per key characteristic")
+	_, err = l.Usage("missing", nil)
+	assert.ErrorIs(t, err, ratelimitrule.ErrUnknownLimit)
+	_, err = (&ratelimitrule.Limiter{}).Usage("per-ip", nil)
+	assert.ErrorIs(t, err, ratelimitrule.ErrUnknownLimit)
+}
+
+// concurrent is a concurrency limit of n in flight per key.
+func concurrent(id string, n int) ratelimitrule.Limit {
+	return ratelimitrule.Limit{ID: id, Concurrency: n}
+}
+
+// serveBlocking starts a request through l whose handler writes its response
+// header only when release is closed. started receives whether next ran (false
+// on a rejection); done is closed once the request has returned.
+func serveBlocking(l *ratelimitrule.Limiter, hdr map[string]string, release <-chan struct{}) (started <-chan bool, done <-chan struct{}) {
+	s, d := make(chan bool, 1), make(chan struct{})
+	go func() {
+		defer close(d)
+		r := httptest.NewRequest(http.MethodGet, "/export", nil)
+		for k, v := range hdr {
+			r.Header.Set(k, v)
+		}
+		called := false
+		l.Serve(httptest.NewRecorder(), r, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			called = true
+			s <- true
+			<-release
+			w.WriteHeader(http.StatusOK)
+			time.Sleep(time.Millisecond) // body still streaming: the slot is already free
+		}))
+		if !called {
+			s <- false
+		}
+	}()
+	return s, d
+}
+
+func TestLimiter_Concurrency(t *testing.T) {
+	t.Parallel()
+
+	l := &ratelimitrule.Limiter{}
+	lim := concurrent("exports", 1)
+	lim.Key = ratelimitrule.Keys{"header:x-api-key"}
+	require.NoError(t, l.SetLimits([]ratelimitrule.Limit{lim}))
+	got := l.Limits()[0]
+	assert.Equal(t, "concurrency", got.Algorithm)
+	assert.Zero(t, got.Queue)
+	assert.Empty(t, got.Wait)
+
+	release := make(chan struct{})
+	started, done := serveBlocking(l, map[string]string{"X-Api-Key": "k1"}, release)
+	require.True(t, <-started)
+
+	w, called := serve(l, http.MethodGet, "/", map[string]string{"X-Api-Key": "k1"})
+	assert.False(t, called, "k1 already has its one export in flight")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Empty(t, w.Header().Get("Retry-After"), "no wait is known for an in-flight cap")
+	_, called = serve(l, http.MethodGet, "/", map[string]string{"X-Api-Key": "k2"})
+	assert.True(t, called, "keys have independent slots")
+
+	u, err := l.Usage("exports", []string{"k1"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, u.Count)
+	assert.Zero(t, u.Remaining)
+
+	close(release)
+	<-done
+	_, called = serve(l, http.MethodGet, "/", map[string]string{"X-Api-Key": "k1"})
+	assert.True(t, called, "the slot is back once the response is written")
+}
+
+func TestLimiter_ConcurrencyQueue(t *testing.T) {
+	t.Parallel()
+
+	l := &ratelimitrule.Limiter{}
+	lim := concurrent("tenant", 1)
+	lim.Key = ratelimitrule.Keys{"none"}
+	lim.Queue = 1
+	require.NoError(t, l.SetLimits([]ratelimitrule.Limit{lim}))
+	assert.Equal(t, "10s", l.Limits()[0].Wait)
+
+	release := make(chan struct{})
+	started, done := serveBlocking(l, nil, release)
+	require.True(t, <-started)
+
+	// Of two more requests, whichever queues second finds the queue full.
+	b, bDone := serveBlocking(l, nil, release)
+	c, cDone := serveBlocking(l, nil, release)
+	var queued <-chan bool
+	select {
+	case ok := <-b:
+		require.False(t, ok, "a full queue rejects")
+		queued = c
+	case ok := <-c:
+		require.False(t, ok, "a full queue rejects")
+		queued = b
+	}
+
+	close(release)
+	<-done
+	assert.True(t, <-queued, "the queued request runs when the slot frees")
+	<-bDone
+	<-cDone
+}
+
+func TestLimiter_ConcurrencyReleasedOnRejection(t *testing.T) {
+	t.Parallel()
+
+	l := &ratelimitrule.Limiter{}
+	require.NoError(t, l.SetLimits([]ratelimitrule.Limit{
+		concurrent("inflight", 1),
+		limit("rate", 1, "1m"),
+	}))
+
+	_, called := serve(l, http.MethodGet, "/", nil)
+	require.True(t, called)
+	_, called = serve(l, http.MethodGet, "/", nil)
+	require.False(t, called, "the rate limit rejects")
+	u, err := l.Usage("inflight", []string{""})
+	require.NoError(t, err)
+	assert.Zero(t, u.Count, "a later rejection gives the slot back")
+}
+
+func TestLimiter_ConcurrencySurvivesReload(t *testing.T) {
+	t.Parallel()
+
+	l := &ratelimitrule.Limiter{}
+	require.NoError(t, l.SetLimits([]ratelimitrule.Limit{concurrent("c", 1)}))
+
+	release := make(chan struct{})
+	started, done := serveBlocking(l, nil, release)
+	require.True(t, <-started)
+
+	require.NoError(t, l.SetLimits([]ratelimitrule.Limit{concurrent("c", 2), limit("other", 5, "1m")}))
+	started2, done2 := serveBlocking(l, nil, release)
+	require.True(t, <-started2, "the raised capacity applies")
+	_, called := serve(l, http.MethodGet, "/", nil)
+	assert.False(t, called, "the request from before the reload still holds its slot")
+
+	close(release)
+	<-done
+	<-done2
+	u, err := l.Usage("c", []string{""})
+	require.NoError(t, err)
+	assert.Zero(t, u.Count, "slots taken before the reload are released into the live limit")
+}
+
+func TestLimiter_ConcurrencyShadowNeverWaits(t *testing.T) {
+	t.Parallel()
+
+	d := newDecisions()
+	l := &ratelimitrule.Limiter{NamePrefix: "global", Observe: d.factory}
+	lim := concurrent("c", 1)
+	lim.Mode = "shadow"
+	lim.Queue = 5
+	lim.Wait = "1m"
+	require.NoError(t, l.SetLimits([]ratelimitrule.Limit{lim}))
+
+	release := make(chan struct{})
+	started, done := serveBlocking(l, nil, release)
+	require.True(t, <-started)
+	_, called := serve(l, http.MethodGet, "/", nil)
+	assert.True(t, called, "shadow admits at once")
+	close(release)
+	<-done
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	assert.Equal(t, 1, d.allowed["global:c"])
+	assert.Equal(t, 1, d.limited["global:c"], "the would-be wait is counted as limited")
+}
@@ -60,18 +60,40 @@ type Limit struct {
 	// Key lists the characteristics composed into the bucket key (default
 	// ["ip"]): "ip" (IPv6 aggregated per /64), "host", "asn" / "country"
 	// (GeoIP; require the resolver to be wired), "header:<name>",
-	// "cookie:<name>". "ip-host" is an alias for ip + host.
+	// "cookie:<name>". "ip-host" is an alias for ip + host. "none" (alone) puts
+	// every request in one bucket: a ceiling for the whole endpoint.
 	Key Keys `yaml:"key"`
-	// Rate is the max requests admitted per Window per key. Required, > 0.
+	// Rate is the max requests admitted per Window per key. Required, > 0,
+	// except on a concurrency limit, which takes neither Rate nor Window.
 	Rate int `yaml:"rate"`
 	// Window is a Go duration string ("10s", "1m", "1h"), bounded to 1s..1h. The
 	// bound caps the per-key map's retention to today's worst opt-in exposure
 	// (the per-hour annotation limiter).
 	Window string `yaml:"window"`
 	// Algorithm is "fixed" (default; window-aligned counter, admits up to 2x Rate
-	// across a boundary) or "sliding" (weighted two-window blend, smooths the
-	// boundary burst).
+	// across a boundary), "sliding" (weighted two-window blend, smooths the
+	// boundary burst), "token-bucket" (a bucket of Burst tokens refilled at Rate
+	// per Window) or "gcra" (the same meter with Burst defaulting to 1, so
+	// requests are spaced evenly at Window/Rate). "concurrency" is implied by
+	// Concurrency.
 	Algorithm string `yaml:"algorithm"`
+	// Burst is the bucket size of a token-bucket or gcra limit: how many
+	// requests a key that has been idle may make at once (default Rate for
+	// token-bucket, 1 for gcra). Refilling a full bucket (Burst*Window/Rate)
+	// is bounded to 1h like Window. Rejected on fixed and sliding limits.
+	Burst int `yaml:"burst"`
+	// Concurrency makes this a concurrency limit: at most this many requests
+	// per key in flight at once. A request holds its slot until its response
+	// headers are written (or the connection is hijacked), like the
+	// HOST_CONCURRENT_CAPACITY limiters. Rejected with Rate, Window, Burst,
+	// Cost, Headers or the shared backend.
+	Concurrency int `yaml:"concurrency"`
+	// Queue is how many requests per key may wait for a concurrency slot
+	// (default 0: reject at once, at most 10000); Wait is how long one waits
+	// (a Go duration, default "10s", at most "1m") before it is rejected.
+	// Concurrency limits only.
+	Queue int    `yaml:"queue"`
+	Wait  string `yaml:"wait"`
 	// Mode is "enforce" (default) or "shadow": shadow takes and counts decisions
 	// (parapet_ratelimit_total{result="limited"}) but never rejects, so a limit
 	// can be sized from live traffic before it is enforced.
@@ -81,9 +103,19 @@ type Limit struct {
 	Status int `yaml:"status"`
 	// Message is the rejection body (default "Too Many Requests").
 	Message string `yaml:"message"`
+	// Headers opts the limit into the IETF RateLimit-Policy / RateLimit
+	// response fields, so clients can pace themselves. A response carries them
+	// for the most constrained opted-in limit that counted the request — the
+	// rejecting one on a rejection. Shadow limits never emit them.
+	Headers bool `yaml:"headers"`
 	// Exclude lists CIDRs whose client IP skips this limit (health checkers,
 	// trusted probes).
 	Exclude []string `yaml:"exclude"`
+	// Backend is "local" (default; counted per replica) or "shared": counted in
+	// the Limiter's SharedStore, so every replica pointed at it shares one
+	// budget per bucket. Shared counts are synced in batches and fall back to
+	// local counting while the store is unreachable.
+	Backend string `yaml:"backend"`
 	// Filter is an optional CEL expression (the WAF's expression surface — same
 	// request.* variables and helper functions, via waf.NewPredicate) that gates
 	// whether this limit applies to a request: empty means "always", otherwise
@@ -96,6 +128,15 @@ type Limit struct {
 	// at load like a country/asn KEY is. Validated and compiled by
 	// Limiter.SetLimits (a bad expression rejects the whole batch).
 	Filter string `yaml:"filter"`
+	// Cost is an optional CEL expression (the filter's surface) evaluating to
+	// the int number of tokens a request takes from its bucket (default 1), so
+	// expensive requests draw it down faster — e.g.
+	// `request.content_length / 65536 + 1`. Results are clamped to
+	// 1..min(100, bucket size: Rate, or Burst for token-bucket/gcra); an eval
+	// error costs 1. An integer literal is a constant cost and must be in
+	// 1..100 and fit the bucket. Validated and compiled by Limiter.SetLimits
+	// like Filter.
+	Cost string `yaml:"cost"`
 }
 
 // Parse parses one or more YAML limit documents (each ConfigMap data value is
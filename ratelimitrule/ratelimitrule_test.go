@@ -30,6 +30,22 @@ limits:
 		assert.Equal(t, "b", limits[1].ID)
 	})
 
+	t.Run("concurrency fields", func(t *testing.T) {
+		limits, err := ratelimitrule.Parse(`
+limits:
+  - id: exports
+    key: header:x-api-key
+    concurrency: 5
+    queue: 10
+    wait: 30s
+`)
+		require.NoError(t, err)
+		require.Len(t, limits, 1)
+		assert.Equal(t, 5, limits[0].Concurrency)
+		assert.Equal(t, 10, limits[0].Queue)
+		assert.Equal(t, "30s", limits[0].Wait)
+	})
+
 	t.Run("empty and whitespace documents are skipped", func(t *testing.T) {
 		limits, err := ratelimitrule.Parse("", "   \n\t", `
 limits:
@@ -0,0 +1,94 @@
+package ratelimitrule
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+// respConn is one connection to a Redis-protocol server, speaking just enough
+// RESP2 for the shared counters: pipelined commands of bulk-string arguments,
+// and status, error, integer, bulk and array replies. Not safe for concurrent
+// use; SharedStore hands each one to a single pipeline at a time.
+type respConn struct {
+	c  net.Conn
+	br *bufio.Reader
+	bw *bufio.Writer
+}
+
+func newRESPConn(c net.Conn) *respConn {
+	return &respConn{c: c, br: bufio.NewReader(c), bw: bufio.NewWriter(c)}
+}
+
+// respError is an error reply (-ERR ...). It is returned as a reply, not an
+// error, so the rest of a pipeline's replies can still be read.
+type respError string
+
+func (e respError) Error() string { return string(e) }
+
+// write buffers one command; flush sends the pipeline.
+func (c *respConn) write(args ...string) {
+	fmt.Fprintf(c.bw, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(c.bw, "$%d\r\n", len(a))
+		c.bw.WriteString(a)
+		c.bw.WriteString("\r\n")
+	}
+}
+
+func (c *respConn) flush() error {
+	return c.bw.Flush()
+}
+
+// read reads one reply: string (status or bulk), int64, nil (null bulk or
+// array), []any or respError.
+func (c *respConn) read() (any, error) {
+	line, err := c.br.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errors.New("ratelimit: malformed reply")
+	}
+	line = line[:len(line)-2]
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return respError(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(c.br, b); err != nil {
+			return nil, err
+		}
+		return string(b[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		xs := make([]any, n)
+		for i := range xs {
+			if xs[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return xs, nil
+	}
+	return nil, fmt.Errorf("ratelimit: unexpected reply %q", line)
+}
@@ -0,0 +1,466 @@
+package ratelimitrule
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/moonrhythm/parapet/pkg/ratelimit"
+)
+
+const (
+	// DefaultSharedPrefix prefixes every counter key in the shared store.
+	DefaultSharedPrefix = "parapet:ratelimit:"
+
+	// DefaultSharedInterval is how long admissions are batched locally before
+	// they are added to the shared counters.
+	DefaultSharedInterval = 100 * time.Millisecond
+
+	sharedTimeout = time.Second     // dial, and one pipeline round trip
+	sharedRetry   = 2 * time.Second // counting locally after a store failure
+	sharedMaxIdle = 4
+)
+
+// SharedStore is a Redis-protocol server holding the counters of `backend:
+// shared` limits, so every replica (or every edge) pointed at it draws from
+// one budget per bucket. Set Prefix and Interval before the first SetLimits.
+//
+// The request path never waits on the store: a shared limit admits against
+// the bucket's count as last read from the store plus what it admitted since,
+// and adds those admissions to the store in one pipelined batch per Interval
+// (INCRBY + PEXPIRE per bucket, reading back the new total). N replicas may
+// therefore over-admit by what they admit in one Interval before they see each
+// other's counts. While the store fails, shared limits count locally, per
+// replica, as a local limit would — fail open, never closed — and retry the
+// store after a few seconds.
+type SharedStore struct {
+	// Prefix prefixes every counter key (default DefaultSharedPrefix). Layers
+	// that both see a request (the edge and the controller) must use different
+	// prefixes, or it counts twice.
+	Prefix string
+
+	// Interval is how long admissions are batched before they are synced
+	// (default DefaultSharedInterval).
+	Interval time.Duration
+
+	addr      string
+	user      string
+	password  string
+	db        int
+	tlsConfig *tls.Config
+
+	idle chan *respConn
+
+	downUntil atomic.Int64 // unix ns until which shared limits count locally
+	failing   atomic.Bool  // the last sync failed (logged once per outage)
+}
+
+// NewSharedStore returns the store at rawURL:
+// redis://[[user]:password@]host[:port][/db], or rediss:// for TLS. No
+// connection is made until a shared limit first syncs.
+func NewSharedStore(rawURL string) (*SharedStore, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	s := &SharedStore{
+		Prefix:   DefaultSharedPrefix,
+		Interval: DefaultSharedInterval,
+		idle:     make(chan *respConn, sharedMaxIdle),
+	}
+	switch u.Scheme {
+	case "redis":
+	case "rediss":
+		s.tlsConfig = &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+	default:
+		return nil, fmt.Errorf("ratelimit: shared store url scheme %q (want redis|rediss)", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, errors.New("ratelimit: shared store url without host")
+	}
+	s.addr = u.Host
+	if u.Port() == "" {
+		s.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		s.user = u.User.Username()
+		if p, ok := u.User.Password(); ok {
+			s.password = p
+		} else {
+			// redis://secret@host: a lone userinfo is the password
+			s.user, s.password = "", s.user
+		}
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if s.db, err = strconv.Atoi(db); err != nil || s.db < 0 {
+			return nil, fmt.Errorf("ratelimit: shared store url database %q", db)
+		}
+	}
+	return s, nil
+}
+
+// down reports whether shared limits count locally for now.
+func (s *SharedStore) down() bool {
+	return time.Now().UnixNano() < s.downUntil.Load()
+}
+
+func (s *SharedStore) interval() time.Duration {
+	if s.Interval <= 0 {
+		return DefaultSharedInterval
+	}
+	return s.Interval
+}
+
+func (s *SharedStore) prefix() string {
+	if s.Prefix == "" {
+		return DefaultSharedPrefix
+	}
+	return s.Prefix
+}
+
+func (s *SharedStore) dial() (*respConn, error) {
+	d := net.Dialer{Timeout: sharedTimeout}
+	var nc net.Conn
+	var err error
+	if s.tlsConfig != nil {
+		nc, err = tls.DialWithDialer(&d, "tcp", s.addr, s.tlsConfig)
+	} else {
+		nc, err = d.Dial("tcp", s.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := newRESPConn(nc)
+
+	var setup [][]string
+	if s.password != "" {
+		if s.user != "" {
+			setup = append(setup, []string{"AUTH", s.user, s.password})
+		} else {
+			setup = append(setup, []string{"AUTH", s.password})
+		}
+	}
+	if s.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(s.db)})
+	}
+	if len(setup) > 0 {
+		if _, err := roundTrip(c, setup); err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// roundTrip sends cmds as one pipeline and reads their replies; an error
+// reply fails it.
+func roundTrip(c *respConn, cmds [][]string) ([]any, error) {
+	c.c.SetDeadline(time.Now().Add(sharedTimeout))
+	for _, cmd := range cmds {
+		c.write(cmd...)
+	}
+	if err := c.flush(); err != nil {
+		return nil, err
+	}
+	replies := make([]any, len(cmds))
+	for i := range replies {
+		v, err := c.read()
+		if err != nil {
+			return nil, err
+		}
+		if e, ok := v.(respError); ok {
+			return nil, e
+		}
+		replies[i] = v
+	}
+	return replies, nil
+}
+
+// pipeline runs cmds on an idle connection (or a new one). A failure marks
+// the store down, so shared limits count locally until sharedRetry passes.
+func (s *SharedStore) pipeline(cmds [][]string) ([]any, error) {
+	var c *respConn
+	select {
+	case c = <-s.idle:
+	default:
+	}
+	var err error
+	if c == nil {
+		c, err = s.dial()
+	}
+	var replies []any
+	if err == nil {
+		replies, err = roundTrip(c, cmds)
+		if err != nil {
+			c.c.Close()
+		}
+	}
+	if err != nil {
+		s.downUntil.Store(time.Now().Add(sharedRetry).UnixNano())
+		if !s.failing.Swap(true) {
+			slog.Warn("ratelimit: shared store unavailable, counting locally", "addr", s.addr, "error", err)
+		}
+		return nil, err
+	}
+	if s.failing.Swap(false) {
+		slog.Info("ratelimit: shared store available again", "addr", s.addr)
+	}
+	select {
+	case s.idle <- c:
+	default:
+		c.c.Close()
+	}
+	return replies, nil
+}
+
+// newWindow builds the shared strategy of one limit. Its keys are scoped by
+// name and a hash of cfgKey, so replicas share a limit's counters only while
+// they run the same shaping config — as SetLimits carries local counters over
+// only for an unchanged one.
+func (s *SharedStore) newWindow(name, cfgKey string, rate int, window time.Duration, sliding bool, local ratelimit.Strategy) *sharedWindow {
+	h := fnv.New32a()
+	h.Write([]byte(cfgKey))
+	return &sharedWindow{
+		store:   s,
+		prefix:  fmt.Sprintf("%s%s:%08x:", s.prefix(), name, h.Sum32()),
+		max:     rate,
+		size:    int64(window),
+		sliding: sliding,
+		local:   local,
+		total:   map[string]int{},
+		prev:    map[string]int{},
+		pending: map[string]int{},
+	}
+}
+
+// sharedWindow is the strategy of a `backend: shared` limit: a fixed or
+// sliding window counted in the shared store, one key per bucket per
+// epoch-aligned window (<prefix><window index>:<bucket>), expiring after two
+// windows. Like slidingWindowStrategy it runs no goroutine of its own: a sync
+// is scheduled by the first admission after the previous one, so an idle limit
+// (or one dropped by SetLimits) costs nothing.
+type sharedWindow struct {
+	store   *SharedStore
+	prefix  string
+	max     int
+	size    int64 // window size in ns
+	sliding bool
+	local   ratelimit.Strategy // counts alone while the store is down
+	now     func() int64       // test hook returning ns since epoch; nil = wall clock
+
+	mu        sync.Mutex
+	window    int64          // window index that total and pending count
+	total     map[string]int // the store's count in window, as last read
+	prev      map[string]int // the store's count in window-1 (sliding)
+	pending   map[string]int // admitted here in window, not yet synced
+	scheduled bool           // a sync is due
+}
+
+func (s *sharedWindow) nowNano() int64 {
+	if s.now != nil {
+		return s.now()
+	}
+	return time.Now().UnixNano()
+}
+
+// roll advances to currentWindow, syncing what was admitted in the closing
+// window. Caller holds mu. As in slidingWindowStrategy, a backward clock step
+// is a no-op.
+func (s *sharedWindow) roll(currentWindow int64) {
+	d := currentWindow - s.window
+	if d <= 0 {
+		return
+	}
+	closing := s.pending
+	if len(closing) > 0 {
+		s.pending = map[string]int{}
+		go s.flush(s.window, closing)
+	}
+	if d == 1 && s.sliding {
+		// The closing window's count as known here fades in as prev; its sync
+		// and the next ones' reads of it refine the figure.
+		for k, n := range closing {
+			s.total[k] += n
+		}
+		s.prev, s.total = s.total, s.prev
+		clear(s.total)
+	} else {
+		clear(s.total)
+		clear(s.prev)
+	}
+	s.window = currentWindow
+}
+
+// count is the bucket's count as the admit decision sees it.
+func (s *sharedWindow) count(key string, now int64) float64 {
+	cur := s.total[key] + s.pending[key]
+	if !s.sliding {
+		return float64(cur)
+	}
+	return weightedCount(s.prev[key], cur, now, s.size)
+}
+
+func (s *sharedWindow) Take(key string) bool { return s.takeN(key, 1) }
+
+func (s *sharedWindow) takeN(key string, n int) bool {
+	if s.store.down() {
+		return takeN(s.local, key, n)
+	}
+	now := s.nowNano()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.roll(now / s.size)
+	if s.count(key, now)+float64(n) > float64(s.max) {
+		return false
+	}
+	s.pending[key] += n
+	if !s.scheduled {
+		s.scheduled = true
+		time.AfterFunc(s.store.interval(), s.sync)
+	}
+	return true
+}
+
+// Put does nothing — this is an arrival-rate limiter, not a concurrency limiter.
+func (s *sharedWindow) Put(string) {}
+
+// After returns how long until the next request for key would be admitted,
+// by the counts known here; like the local strategies it never mutates state.
+func (s *sharedWindow) After(key string) time.Duration { return s.afterN(key, 1) }
+
+func (s *sharedWindow) afterN(key string, n int) time.Duration {
+	if s.store.down() {
+		return afterN(s.local, key, n)
+	}
+	now := s.nowNano()
+	currentWindow := now / s.size
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var prev, cur int
+	switch d := currentWindow - s.window; {
+	case d <= 0:
+		prev, cur = s.prev[key], s.total[key]+s.pending[key]
+	case d == 1:
+		prev = s.total[key] + s.pending[key]
+	}
+	if s.sliding {
+		return afterAt(s.max-n+1, prev, cur, s.size, now)
+	}
+	if cur+n <= s.max {
+		return 0
+	}
+	return time.Duration((currentWindow+1)*s.size - now)
+}
+
+// quota reports key's state by the counts known here, like After; while the
+// store is down, the local strategy's.
+func (s *sharedWindow) quota(key string) (count, remaining int, reset time.Duration) {
+	if s.store.down() {
+		if q, ok := s.local.(quotaStrategy); ok {
+			return q.quota(key)
+		}
+	}
+	now := s.nowNano()
+	currentWindow := now / s.size
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var prev, cur int
+	switch d := currentWindow - s.window; {
+	case d <= 0:
+		prev, cur = s.prev[key], s.total[key]+s.pending[key]
+	case d == 1:
+		prev = s.total[key] + s.pending[key]
+	}
+	if s.sliding {
+		return slidingQuota(s.max, prev, cur, s.size, now)
+	}
+	return cur, max(s.max-cur, 0), time.Duration((currentWindow+1)*s.size - now)
+}
+
+// sync adds the admissions pending in the current window to the store.
+func (s *sharedWindow) sync() {
+	s.mu.Lock()
+	s.scheduled = false
+	window, batch := s.window, s.pending
+	if len(batch) > 0 {
+		s.pending = map[string]int{}
+	}
+	s.mu.Unlock()
+
+	if len(batch) > 0 {
+		s.flush(window, batch)
+	}
+}
+
+// flush adds batch, admitted here in window, to the store and records the
+// totals it reads back (and, sliding, the buckets' counts in window-1). On a
+// failure the batch is lost to the store; the store is down and Take counts
+// locally meanwhile.
+func (s *sharedWindow) flush(window int64, batch map[string]int) {
+	cur := s.prefix + strconv.FormatInt(window, 10) + ":"
+	prev := s.prefix + strconv.FormatInt(window-1, 10) + ":"
+	ttl := strconv.FormatInt((2*s.size+int64(time.Second))/int64(time.Millisecond), 10)
+
+	step := 2
+	if s.sliding {
+		step = 3
+	}
+	keys := make([]string, 0, len(batch))
+	cmds := make([][]string, 0, step*len(batch))
+	for k, n := range batch {
+		keys = append(keys, k)
+		cmds = append(cmds,
+			[]string{"INCRBY", cur + k, strconv.Itoa(n)},
+			[]string{"PEXPIRE", cur + k, ttl},
+		)
+		if s.sliding {
+			cmds = append(cmds, []string{"GET", prev + k})
+		}
+	}
+	replies, err := s.store.pipeline(cmds)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Syncs of one window may overlap and a count only grows within its
+	// window, so the larger figure is the fresher one.
+	raise := func(m map[string]int, k string, n int) {
+		if n > m[k] {
+			m[k] = n
+		}
+	}
+	for i, k := range keys {
+		total, _ := replies[i*step].(int64)
+		switch s.window - window {
+		case 0:
+			raise(s.total, k, int(total))
+			if s.sliding {
+				p, _ := replies[i*step+2].(string)
+				n, _ := strconv.Atoi(p)
+				raise(s.prev, k, n)
+			}
+		case 1:
+			if s.sliding {
+				raise(s.prev, k, int(total))
+			}
+		}
+	}
+}
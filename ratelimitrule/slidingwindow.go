@@ -1,6 +1,7 @@
 package ratelimitrule
 
 import (
+	"math"
 	"sync"
 	"time"
 )
@@ -89,7 +90,10 @@ func (s *slidingWindowStrategy) roll(currentWindow int64) {
 // Take admits a request iff the weighted trailing-window count stays within
 // max. max <= 0 admits nothing (unreachable via SetLimits, which requires
 // rate > 0; kept for parity with parapet).
-func (s *slidingWindowStrategy) Take(key string) bool {
+func (s *slidingWindowStrategy) Take(key string) bool { return s.takeN(key, 1) }
+
+// takeN is Take for a request counting n (<= max).
+func (s *slidingWindowStrategy) takeN(key string, n int) bool {
 	now := s.nowNano()
 	currentWindow := now / s.size
 
@@ -98,10 +102,10 @@ func (s *slidingWindowStrategy) Take(key string) bool {
 
 	s.roll(currentWindow)
 	prev, cur := s.prev[key], s.cur[key]
-	if weightedCount(prev, cur, now, s.size)+1 > float64(s.max) {
+	if weightedCount(prev, cur, now, s.size)+float64(n) > float64(s.max) {
 		return false
 	}
-	s.cur[key] = cur + 1
+	s.cur[key] = cur + n
 	return true
 }
 
@@ -112,7 +116,11 @@ func (s *slidingWindowStrategy) Put(string) {}
 // never mutates state: the roll is computed read-only on locals. Like parapet's
 // After it can return 0 right after a blocked Take if a boundary fell between
 // the calls — the client genuinely can take now.
-func (s *slidingWindowStrategy) After(key string) time.Duration {
+func (s *slidingWindowStrategy) After(key string) time.Duration { return s.afterN(key, 1) }
+
+// afterN is After for a request counting n (<= max): room for n is room for
+// one under a budget n-1 smaller, so afterAt's math carries over unchanged.
+func (s *slidingWindowStrategy) afterN(key string, n int) time.Duration {
 	now := s.nowNano()
 	currentWindow := now / s.size
 
@@ -128,7 +136,43 @@ func (s *slidingWindowStrategy) After(key string) time.Duration {
 	default:
 		// both generations are stale; budget is free
 	}
-	return afterAt(s.max, prev, cur, s.size, now)
+	return afterAt(s.max-n+1, prev, cur, s.size, now)
+}
+
+// quota reports key's weighted count (rounded up), the requests it may still
+// make now, and how long until the count has faded to zero. It never mutates
+// state.
+func (s *slidingWindowStrategy) quota(key string) (count, remaining int, reset time.Duration) {
+	now := s.nowNano()
+	currentWindow := now / s.size
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var prev, cur int
+	switch d := currentWindow - s.window; {
+	case d <= 0:
+		prev, cur = s.prev[key], s.cur[key]
+	case d == 1:
+		prev = s.cur[key]
+	}
+	return slidingQuota(s.max, prev, cur, s.size, now)
+}
+
+// slidingQuota computes quota for a key already rolled to (prev, cur) at time
+// now (ns). remaining is the number of Takes admissible now; reset is exact
+// for the blend: prev is gone at the next boundary, cur one window later.
+func slidingQuota(maxTokens, prev, cur int, size, now int64) (count, remaining int, reset time.Duration) {
+	w := weightedCount(prev, cur, now, size)
+	count = int(math.Ceil(w))
+	remaining = max(int(math.Floor(float64(maxTokens)-w)), 0)
+	switch toBoundary := time.Duration((now/size+1)*size - now); {
+	case cur > 0:
+		reset = toBoundary + time.Duration(size)
+	case prev > 0:
+		reset = toBoundary
+	}
+	return count, remaining, reset
 }
 
 // weightedCount returns the time-weighted effective count at now (ns since
@@ -205,3 +205,42 @@ func TestSlidingWindow_BackwardClockRecovery(t *testing.T) {
 	clock.ns = 101*win + 3*win/4 // next window: prev=2 decayed to 0.5 -> admit
 	assert.True(t, s.Take("k"))
 }
+
+func TestSlidingWindow_Quota(t *testing.T) {
+	t.Parallel()
+
+	s, clock := newTestSliding(4, 100)
+	count, remaining, reset := s.quota("k")
+	assert.Zero(t, count)
+	assert.Equal(t, 4, remaining)
+	assert.Zero(t, reset)
+
+	for range 3 {
+		require.True(t, s.Take("k"))
+	}
+	clock.ns = 101*win + win/2
+	count, remaining, reset = s.quota("k")
+	assert.Equal(t, 2, count, "3 fading at half weight, rounded up")
+	assert.Equal(t, 2, remaining, "4 - 1.5 admits two more")
+	assert.Equal(t, time.Second/2, reset, "prev is gone at the boundary")
+
+	require.True(t, s.Take("k"))
+	_, _, reset = s.quota("k")
+	assert.Equal(t, 3*time.Second/2, reset, "cur fades a window after the boundary")
+}
+
+func TestSlidingWindow_TakeN(t *testing.T) {
+	t.Parallel()
+
+	s, clock := newTestSliding(4, 100)
+	require.True(t, s.takeN("k", 3))
+	assert.False(t, s.takeN("k", 2), "3+2 exceeds 4")
+	assert.True(t, s.Take("k"))
+
+	// Halfway through the next window prev (4) weighs 2: room for 2, not 3.
+	clock.ns = 101*win + win/2
+	assert.Zero(t, s.afterN("k", 2))
+	assert.Equal(t, win/4+1, int64(s.afterN("k", 3)), "prev must fade to 1: a quarter window more")
+	assert.False(t, s.takeN("k", 3))
+	assert.True(t, s.takeN("k", 2))
+}
@@ -7,13 +7,26 @@ import (
 	"log/slog"
 	"net/http"
 	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	networking "k8s.io/api/networking/v1"
+
 	"github.com/moonrhythm/parapet-ingress-controller/proxy"
 )
 
+const maxRetry = 5
+
+// retryMiddleware retries dial failures only (see SPEC.md, "Retry is
+// dial-only"); an Ingress's retry policy widens that with retryPolicy.middleware.
 func retryMiddleware(h http.Handler) http.Handler {
-	const maxRetry = 5
+	return retryHandler(h, nil)
+}
+
+func retryHandler(h http.Handler, policy *retryPolicy) http.Handler {
 
 	canRequestRetry := func(r *http.Request) bool {
 		if r.Body == nil || r.Body == http.NoBody {
@@ -56,13 +69,22 @@ func retryMiddleware(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
+		var retry proxy.RetryFunc
+		if policy != nil && policy.applies(r) {
+			retry = policy.retryFunc()
+		}
+
 		if r.Body != nil && r.Body != http.NoBody {
 			r.Body = &trackBodyRead{ReadCloser: r.Body}
 		}
 
 	retryLoop:
 		for i := 0; i < maxRetry; i++ {
-			if tryServe(w, r) {
+			attempt := r
+			if retry != nil && i < maxRetry-1 { // the last attempt's outcome is served
+				attempt = r.WithContext(proxy.WithRetry(ctx, retry))
+			}
+			if tryServe(w, attempt) {
 				return
 			}
 
@@ -98,3 +120,135 @@ func (t *trackBodyRead) Read(p []byte) (n int, err error) {
 	t.read = true
 	return t.ReadCloser.Read(p)
 }
+
+const (
+	retryOnAnnotation       = "parapet.moonrhythm.io/retry-on"
+	retryAttemptsAnnotation = "parapet.moonrhythm.io/retry-attempts"
+	retryBudgetAnnotation   = "parapet.moonrhythm.io/retry-budget"
+
+	defaultRetryAttempts = 2
+	defaultRetryBudget   = 20 // percent
+	retryBudgetReserve   = 10 // retries
+)
+
+// retryPolicy is an Ingress's opt-in retry policy (retry-on): besides dial
+// failures, an idempotent request without a body is retried when its upstream
+// breaks the connection (reset) or answers one of statuses, at most attempts
+// times and within budget.
+type retryPolicy struct {
+	reset    bool
+	statuses []int
+	attempts int
+	budget   *retryBudget
+}
+
+// ingressRetryPolicy reads an Ingress's retry annotations; nil without
+// retry-on. An unknown retry-on condition is logged and skipped, a malformed
+// attempts or budget logged and its default used.
+func ingressRetryPolicy(ing *networking.Ingress) *retryPolicy {
+	a := strings.TrimSpace(ing.Annotations[retryOnAnnotation])
+	if a == "" {
+		return nil
+	}
+	id := ing.Namespace + "/" + ing.Name
+
+	var p retryPolicy
+	for _, cond := range strings.Split(a, ",") {
+		switch cond = strings.TrimSpace(cond); cond {
+		case "reset":
+			p.reset = true
+		case "502", "503", "504":
+			code, _ := strconv.Atoi(cond)
+			p.statuses = append(p.statuses, code)
+		default:
+			slog.Error("invalid retry-on condition, ignoring", "ingress", id, "value", cond)
+		}
+	}
+	if !p.reset && len(p.statuses) == 0 {
+		return nil
+	}
+
+	p.attempts = defaultRetryAttempts
+	if a := strings.TrimSpace(ing.Annotations[retryAttemptsAnnotation]); a != "" {
+		n, err := strconv.Atoi(a)
+		if err != nil || n < 1 || n >= maxRetry {
+			slog.Error("invalid retry-attempts, using default", "ingress", id, "value", a)
+		} else {
+			p.attempts = n
+		}
+	}
+	budget := defaultRetryBudget
+	if a := strings.TrimSpace(ing.Annotations[retryBudgetAnnotation]); a != "" {
+		n, err := strconv.Atoi(a)
+		if err != nil || n < 1 || n > 100 {
+			slog.Error("invalid retry-budget, using default", "ingress", id, "value", a)
+		} else {
+			budget = n
+		}
+	}
+	p.budget = newRetryBudget(float64(budget) / 100)
+	return &p
+}
+
+// middleware is retryMiddleware applying p.
+func (p *retryPolicy) middleware(h http.Handler) http.Handler {
+	return retryHandler(h, p)
+}
+
+// applies reports whether r may be retried once its upstream responded:
+// idempotent, and without a body (which the upstream may have consumed).
+// Every request counts toward the budget.
+func (p *retryPolicy) applies(r *http.Request) bool {
+	p.budget.deposit()
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete, http.MethodTrace:
+	default:
+		return false
+	}
+	return r.Body == nil || r.Body == http.NoBody
+}
+
+// retryFunc returns the policy for one request's attempts.
+func (p *retryPolicy) retryFunc() proxy.RetryFunc {
+	var retries int
+	return func(statusCode int, _ error) bool {
+		if statusCode == 0 && !p.reset || statusCode != 0 && !slices.Contains(p.statuses, statusCode) {
+			return false
+		}
+		if retries >= p.attempts || !p.budget.withdraw() {
+			return false
+		}
+		retries++
+		return true
+	}
+}
+
+// retryBudget caps an Ingress's policy retries (per replica) at a ratio of
+// its requests: every request deposits ratio of a retry, every retry
+// withdraws one. The balance starts at, and is capped to, retryBudgetReserve:
+// the burst allowed after a quiet period.
+type retryBudget struct {
+	mu      sync.Mutex
+	ratio   float64
+	balance float64
+}
+
+func newRetryBudget(ratio float64) *retryBudget {
+	return &retryBudget{ratio: ratio, balance: retryBudgetReserve}
+}
+
+func (b *retryBudget) deposit() {
+	b.mu.Lock()
+	b.balance = min(b.balance+b.ratio, retryBudgetReserve)
+	b.mu.Unlock()
+}
+
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.balance < 1 {
+		return false
+	}
+	b.balance--
+	return true
+}
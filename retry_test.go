@@ -4,14 +4,19 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"io"
 	"log/slog"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync/atomic"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	networking "k8s.io/api/networking/v1"
+
+	"github.com/moonrhythm/parapet-ingress-controller/proxy"
 )
 
 // retryMiddleware must retry only on connection failures. An upstream that
@@ -105,3 +110,109 @@ func TestRetryMiddlewareLogsUnexpectedPanic(t *testing.T) {
 	assert.Equal(t, http.StatusBadGateway, w.Code)
 	assert.Contains(t, buf.String(), "boom", "the recovered panic must be logged")
 }
+
+// An Ingress's retry policy retries the upstream responses and connection
+// resets it names, for idempotent requests without a body, within its
+// attempts and budget.
+func TestRetryPolicy(t *testing.T) {
+	t.Parallel()
+
+	policy := func(annotations map[string]string) *retryPolicy {
+		ing := ingressToService("default", "app", "example.com", "/", networking.PathTypePrefix, "app", 80)
+		ing.Annotations = annotations
+		return ingressRetryPolicy(ing)
+	}
+	// upstream answers status for the first n requests, then 200
+	upstream := func(n int32, status int) (*httptest.Server, *atomic.Int32) {
+		var calls atomic.Int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) <= n {
+				http.Error(w, "unavailable", status)
+				return
+			}
+			w.Write([]byte("ok"))
+		}))
+		t.Cleanup(ts.Close)
+		return ts, &calls
+	}
+	serve := func(p *retryPolicy, method, target string, body io.Reader) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		p.middleware(proxy.New()).ServeHTTP(w, httptest.NewRequest(method, target, body))
+		return w
+	}
+
+	t.Run("parses the annotations", func(t *testing.T) {
+		assert.Nil(t, policy(nil))
+		assert.Nil(t, policy(map[string]string{retryOnAnnotation: "500"}), "no valid condition")
+
+		p := policy(map[string]string{retryOnAnnotation: "reset, 503,500"})
+		if assert.NotNil(t, p) {
+			assert.True(t, p.reset)
+			assert.Equal(t, []int{503}, p.statuses)
+			assert.Equal(t, defaultRetryAttempts, p.attempts)
+		}
+		p = policy(map[string]string{retryOnAnnotation: "502", retryAttemptsAnnotation: "9"})
+		assert.Equal(t, defaultRetryAttempts, p.attempts, "invalid attempts use the default")
+	})
+
+	t.Run("retries a configured status", func(t *testing.T) {
+		ts, calls := upstream(2, http.StatusServiceUnavailable)
+		w := serve(policy(map[string]string{retryOnAnnotation: "503"}), http.MethodGet, ts.URL, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "ok", w.Body.String())
+		assert.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("serves the last response after the attempts", func(t *testing.T) {
+		ts, calls := upstream(5, http.StatusServiceUnavailable)
+		w := serve(policy(map[string]string{retryOnAnnotation: "503", retryAttemptsAnnotation: "1"}), http.MethodGet, ts.URL, nil)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("does not retry another status", func(t *testing.T) {
+		ts, calls := upstream(1, http.StatusBadGateway)
+		w := serve(policy(map[string]string{retryOnAnnotation: "503"}), http.MethodGet, ts.URL, nil)
+		assert.Equal(t, http.StatusBadGateway, w.Code)
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("does not retry a non-idempotent request", func(t *testing.T) {
+		ts, calls := upstream(1, http.StatusServiceUnavailable)
+		p := policy(map[string]string{retryOnAnnotation: "503"})
+		w := serve(p, http.MethodPost, ts.URL, nil)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, int32(1), calls.Load())
+
+		w = serve(p, http.MethodPut, ts.URL, strings.NewReader("x"))
+		assert.Equal(t, http.StatusOK, w.Code, "upstream recovered")
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("retries a connection reset", func(t *testing.T) {
+		var calls atomic.Int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				conn.Close()
+				return
+			}
+			w.Write([]byte("ok"))
+		}))
+		defer ts.Close()
+
+		w := serve(policy(map[string]string{retryOnAnnotation: "reset"}), http.MethodGet, ts.URL, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("stops at the budget", func(t *testing.T) {
+		ts, calls := upstream(1000, http.StatusServiceUnavailable)
+		p := policy(map[string]string{retryOnAnnotation: "503", retryAttemptsAnnotation: "1", retryBudgetAnnotation: "10"})
+		for range 20 {
+			serve(p, http.MethodGet, ts.URL, nil)
+		}
+		// 20 requests: the reserve of 10 retries, then 1 per 10 requests
+		assert.Equal(t, int32(20+11), calls.Load())
+	})
+}
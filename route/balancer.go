@@ -0,0 +1,280 @@
+package route
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Algorithm selects one of a Service's pod IPs for a request.
+type Algorithm uint8
+
+const (
+	// RoundRobin cycles through the pod IPs (the default).
+	RoundRobin Algorithm = iota
+	// LeastRequest picks the pod IP with the fewest requests in flight through
+	// this controller, round-robin among ties.
+	LeastRequest
+	// PowerOfTwo samples two pod IPs at random and picks the one with the lower
+	// EWMA latency, weighted by its requests in flight.
+	PowerOfTwo
+	// Hash picks by consistent (rendezvous) hashing of a request key, so a key
+	// keeps its pod IP while the pod set is stable, and only the keys of a
+	// departed pod move when it changes.
+	Hash
+)
+
+var algorithmNames = [...]string{
+	RoundRobin:   "round-robin",
+	LeastRequest: "least-request",
+	PowerOfTwo:   "p2c-ewma",
+	Hash:         "hash",
+}
+
+func (a Algorithm) String() string {
+	if int(a) < len(algorithmNames) {
+		return algorithmNames[a]
+	}
+	return fmt.Sprintf("Algorithm(%d)", a)
+}
+
+// ParseAlgorithm parses an algorithm name ("round-robin", "least-request",
+// "p2c-ewma", "hash").
+func ParseAlgorithm(s string) (Algorithm, error) {
+	for a, name := range algorithmNames {
+		if s == name {
+			return Algorithm(a), nil
+		}
+	}
+	return RoundRobin, fmt.Errorf("unknown load balancing algorithm %q", s)
+}
+
+// endpointStats is the load a pod IP carries, shared by every Service (and
+// every algorithm) routing to it: a pod's capacity is the pod's, whichever
+// Service reached it.
+type endpointStats struct {
+	inflight atomic.Int64
+	ewma     atomic.Uint64 // float64 bits, request duration in seconds; 0 = no sample yet
+}
+
+// ewmaDecay is the weight of the newest sample in the latency average.
+const ewmaDecay = 0.3
+
+func (s *endpointStats) observe(d time.Duration) {
+	sample := d.Seconds()
+	for {
+		old := s.ewma.Load()
+		next := sample
+		if old != 0 {
+			next = ewmaDecay*sample + (1-ewmaDecay)*math.Float64frombits(old)
+		}
+		if s.ewma.CompareAndSwap(old, math.Float64bits(next)) {
+			return
+		}
+	}
+}
+
+// begin counts a request in flight; the returned func ends it and records its
+// duration.
+func (s *endpointStats) begin() (done func()) {
+	s.inflight.Add(1)
+	start := time.Now()
+	return func() {
+		s.inflight.Add(-1)
+		s.observe(time.Since(start))
+	}
+}
+
+// ewmaUnknown stands in for the latency of an endpoint whose first request
+// hasn't finished: optimistic, so a new pod gets traffic, but still weighted by
+// what it has in flight.
+const ewmaUnknown = 0.001
+
+// cost is the p2c-ewma score of an endpoint; lower is better.
+func (s *endpointStats) cost() float64 {
+	ewma := math.Float64frombits(s.ewma.Load())
+	if ewma == 0 {
+		ewma = ewmaUnknown
+	}
+	return ewma * float64(s.inflight.Load()+1)
+}
+
+// statsTable holds the endpointStats of every pod IP picked by a load-aware
+// algorithm. Reads are lock-free (sync.Map); stale entries are pruned by the
+// table's background job.
+type statsTable struct {
+	ips sync.Map // ip -> *endpointStats
+}
+
+func (t *statsTable) get(ip string) *endpointStats {
+	if v, ok := t.ips.Load(ip); ok {
+		return v.(*endpointStats)
+	}
+	v, _ := t.ips.LoadOrStore(ip, &endpointStats{})
+	return v.(*endpointStats)
+}
+
+// peek returns ip's stats, or nil when it has none yet (an idle endpoint).
+func (t *statsTable) peek(ip string) *endpointStats {
+	if v, ok := t.ips.Load(ip); ok {
+		return v.(*endpointStats)
+	}
+	return nil
+}
+
+// prune drops the stats of IPs not in live that have nothing in flight.
+func (t *statsTable) prune(live map[string]struct{}) {
+	t.ips.Range(func(key, value any) bool {
+		if _, ok := live[key.(string)]; !ok && value.(*endpointStats).inflight.Load() == 0 {
+			t.ips.Delete(key)
+		}
+		return true
+	})
+}
+
+// candidate reports whether ip may be picked: never a dial-bad address, and an
+// ejected one only when failing open.
+func candidate(ip string, badAddr *badAddrTable, ejected map[string]struct{}, failOpen bool) bool {
+	if badAddr.IsBad(ip) {
+		return false
+	}
+	if failOpen {
+		return true
+	}
+	_, out := ejected[ip]
+	return !out
+}
+
+// pick runs alg over lb's IPs. It first skips ejected addresses and, when that
+// leaves nothing, fails open over them (see get).
+func (lb *RRLB) pick(alg Algorithm, key string, badAddr *badAddrTable, ejected map[string]struct{}, stats *statsTable) string {
+	l := len(lb.IPs)
+	if l == 0 {
+		return ""
+	}
+	if l == 1 {
+		return lb.IPs[0]
+	}
+
+	for _, failOpen := range [...]bool{false, true} {
+		var ip string
+		switch alg {
+		case LeastRequest:
+			ip = lb.leastRequest(badAddr, ejected, failOpen, stats)
+		case PowerOfTwo:
+			ip = lb.powerOfTwo(badAddr, ejected, failOpen, stats)
+		case Hash:
+			ip = lb.hash(key, badAddr, ejected, failOpen)
+		default:
+			return lb.get(badAddr, ejected)
+		}
+		if ip != "" || len(ejected) == 0 {
+			return ip
+		}
+	}
+	return ""
+}
+
+func (lb *RRLB) leastRequest(badAddr *badAddrTable, ejected map[string]struct{}, failOpen bool, stats *statsTable) (ip string) {
+	l := len(lb.IPs)
+	// start at the round-robin position so ties rotate instead of always
+	// landing on the first IP
+	p := int(atomic.AddUint32(&lb.current, 1) % uint32(l))
+	best := int64(math.MaxInt64)
+	for k := 0; k < l; k++ {
+		cur := lb.IPs[(p+k)%l]
+		if !candidate(cur, badAddr, ejected, failOpen) {
+			continue
+		}
+		var n int64
+		if s := stats.peek(cur); s != nil {
+			n = s.inflight.Load()
+		}
+		if n < best {
+			ip, best = cur, n
+			if n == 0 {
+				return
+			}
+		}
+	}
+	return
+}
+
+func (lb *RRLB) powerOfTwo(badAddr *badAddrTable, ejected map[string]struct{}, failOpen bool, stats *statsTable) string {
+	l := len(lb.IPs)
+	// two distinct random start points; walk each to the next candidate
+	i := rand.IntN(l)
+	j := (i + 1 + rand.IntN(l-1)) % l
+	a := lb.nextCandidate(i, badAddr, ejected, failOpen)
+	if a == "" {
+		return ""
+	}
+	b := lb.nextCandidate(j, badAddr, ejected, failOpen)
+	if b == "" || b == a {
+		return a
+	}
+	var costA, costB float64
+	if s := stats.peek(a); s != nil {
+		costA = s.cost()
+	}
+	if s := stats.peek(b); s != nil {
+		costB = s.cost()
+	}
+	if costB < costA {
+		return b
+	}
+	return a
+}
+
+// nextCandidate returns the first candidate IP at or after index i, wrapping.
+func (lb *RRLB) nextCandidate(i int, badAddr *badAddrTable, ejected map[string]struct{}, failOpen bool) string {
+	l := len(lb.IPs)
+	for k := 0; k < l; k++ {
+		ip := lb.IPs[(i+k)%l]
+		if candidate(ip, badAddr, ejected, failOpen) {
+			return ip
+		}
+	}
+	return ""
+}
+
+// hash picks the candidate with the highest rendezvous score for key. The score
+// depends only on key and the IP, so every controller replica agrees.
+func (lb *RRLB) hash(key string, badAddr *badAddrTable, ejected map[string]struct{}, failOpen bool) (ip string) {
+	keyHash := fnv64a(key)
+	var best uint64
+	for _, cur := range lb.IPs {
+		if !candidate(cur, badAddr, ejected, failOpen) {
+			continue
+		}
+		if score := mix64(keyHash ^ fnv64a(cur)); ip == "" || score > best {
+			ip, best = cur, score
+		}
+	}
+	return
+}
+
+// fnv64a is FNV-1a, inlined so hashing a key doesn't allocate.
+func fnv64a(s string) uint64 {
+	const offset, prime = 14695981039346656037, 1099511628211
+	h := uint64(offset)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= prime
+	}
+	return h
+}
+
+// mix64 is the splitmix64 finalizer; it spreads the xor of two FNV hashes so
+// scores don't correlate across IPs sharing a prefix.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,157 @@
+package route
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAlgorithm(t *testing.T) {
+	t.Parallel()
+
+	for _, a := range []Algorithm{RoundRobin, LeastRequest, PowerOfTwo, Hash} {
+		got, err := ParseAlgorithm(a.String())
+		require.NoError(t, err)
+		assert.Equal(t, a, got)
+	}
+	_, err := ParseAlgorithm("random")
+	assert.Error(t, err)
+}
+
+func TestRRLBLeastRequest(t *testing.T) {
+	t.Parallel()
+
+	lb := &RRLB{IPs: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}}
+	var stats statsTable
+	stats.get("10.0.0.1").inflight.Store(3)
+	stats.get("10.0.0.2").inflight.Store(1)
+	stats.get("10.0.0.3").inflight.Store(2)
+
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, "10.0.0.2", lb.pick(LeastRequest, "", nil, nil, &stats))
+	}
+
+	t.Run("skips bad and ejected", func(t *testing.T) {
+		badAddr := badAddrTable{}
+		badAddr.MarkBad("10.0.0.2")
+		assert.Equal(t, "10.0.0.3", lb.pick(LeastRequest, "", &badAddr, nil, &stats))
+		assert.Equal(t, "10.0.0.1", lb.pick(LeastRequest, "", &badAddr, map[string]struct{}{"10.0.0.3": {}}, &stats))
+		// everything usable ejected: fails open
+		assert.Equal(t, "10.0.0.3", lb.pick(LeastRequest, "", &badAddr,
+			map[string]struct{}{"10.0.0.1": {}, "10.0.0.3": {}}, &stats))
+	})
+
+	t.Run("ties rotate", func(t *testing.T) {
+		idle := &RRLB{IPs: []string{"10.0.1.1", "10.0.1.2"}}
+		seen := map[string]bool{}
+		for i := 0; i < 4; i++ {
+			seen[idle.pick(LeastRequest, "", nil, nil, &stats)] = true
+		}
+		assert.Len(t, seen, 2)
+	})
+}
+
+func TestRRLBPowerOfTwo(t *testing.T) {
+	t.Parallel()
+
+	var stats statsTable
+	stats.get("10.0.0.1").observe(time.Second)
+	stats.get("10.0.0.2").observe(time.Millisecond)
+
+	// with two IPs both are always sampled: the cheaper one wins
+	lb := &RRLB{IPs: []string{"10.0.0.1", "10.0.0.2"}}
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, "10.0.0.2", lb.pick(PowerOfTwo, "", nil, nil, &stats))
+	}
+
+	// in-flight requests weigh in
+	stats.get("10.0.0.2").inflight.Store(5000)
+	assert.Equal(t, "10.0.0.1", lb.pick(PowerOfTwo, "", nil, nil, &stats))
+
+	badAddr := badAddrTable{}
+	badAddr.MarkBad("10.0.0.1")
+	assert.Equal(t, "10.0.0.2", lb.pick(PowerOfTwo, "", &badAddr, nil, &stats))
+}
+
+func TestRRLBHash(t *testing.T) {
+	t.Parallel()
+
+	ips := make([]string, 10)
+	for i := range ips {
+		ips[i] = "10.0.0." + strconv.Itoa(i+1)
+	}
+	lb := &RRLB{IPs: ips}
+
+	picks := map[string]string{}
+	spread := map[string]bool{}
+	for i := 0; i < 200; i++ {
+		key := "user-" + strconv.Itoa(i)
+		ip := lb.pick(Hash, key, nil, nil, nil)
+		assert.Equal(t, ip, lb.pick(Hash, key, nil, nil, nil), "a key is sticky")
+		picks[key] = ip
+		spread[ip] = true
+	}
+	assert.Len(t, spread, 10, "keys spread over every IP")
+
+	t.Run("only a departed IP's keys move", func(t *testing.T) {
+		smaller := &RRLB{IPs: ips[1:]}
+		for key, ip := range picks {
+			if ip == ips[0] {
+				continue
+			}
+			assert.Equal(t, ip, smaller.pick(Hash, key, nil, nil, nil), "key %s", key)
+		}
+	})
+
+	t.Run("a bad IP's keys fall to the next best", func(t *testing.T) {
+		badAddr := badAddrTable{}
+		badAddr.MarkBad(picks["user-1"])
+		ip := lb.pick(Hash, "user-1", &badAddr, nil, nil)
+		assert.NotEmpty(t, ip)
+		assert.NotEqual(t, picks["user-1"], ip)
+	})
+}
+
+func TestTablePick(t *testing.T) {
+	t.Parallel()
+
+	tb := Table{}
+	tb.SetHostRoutes(map[string]*RRLB{
+		"api.default.svc.cluster.local": {IPs: []string{"10.0.0.1", "10.0.0.2"}},
+	})
+	tb.SetPortRoutes(map[string]string{"api.default.svc.cluster.local:80": "8080"})
+
+	t.Run("load-aware algorithms count in-flight requests", func(t *testing.T) {
+		first, done := tb.Pick("api.default.svc.cluster.local:80", LeastRequest, "")
+		require.NotNil(t, done)
+		second, done2 := tb.Pick("api.default.svc.cluster.local:80", LeastRequest, "")
+		assert.NotEqual(t, first, second, "the busy endpoint is avoided")
+		done()
+		done2()
+		assert.Zero(t, tb.stats.peek("10.0.0.1").inflight.Load())
+		assert.NotZero(t, tb.stats.peek("10.0.0.1").ewma.Load(), "duration recorded")
+	})
+
+	t.Run("hash without a key round-robins", func(t *testing.T) {
+		seen := map[string]bool{}
+		for i := 0; i < 4; i++ {
+			target, done := tb.Pick("api.default.svc.cluster.local:80", Hash, "")
+			assert.Nil(t, done)
+			seen[target] = true
+		}
+		assert.Len(t, seen, 2)
+	})
+
+	t.Run("prune keeps live and busy endpoints", func(t *testing.T) {
+		tb.stats.get("10.9.9.9")
+		busy := tb.stats.get("10.9.9.8")
+		busy.inflight.Store(1)
+		tb.pruneStats()
+		assert.Nil(t, tb.stats.peek("10.9.9.9"))
+		assert.NotNil(t, tb.stats.peek("10.9.9.8"))
+		assert.NotNil(t, tb.stats.peek("10.0.0.1"))
+	})
+}
@@ -0,0 +1,341 @@
+package route
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HealthCheck configures the health checking of one Service's endpoints. The
+// active half probes every pod IP over HTTP; the passive half (outlier
+// detection) watches the proxied responses. Either half is off when its
+// trigger field (Path / Consecutive5xx) is zero.
+type HealthCheck struct {
+	// Path is the HTTP probe path ("" disables active probing).
+	Path string
+	// Port is the pod port probed, Scheme "http" or "https" (certificate not
+	// verified, as for proxied traffic).
+	Port   string
+	Scheme string
+	// Interval between probe rounds, and Timeout of a single probe.
+	Interval time.Duration
+	Timeout  time.Duration
+	// HealthyThreshold consecutive passing probes re-admit an ejected
+	// endpoint; UnhealthyThreshold consecutive failing probes eject it. A probe
+	// passes on a 2xx/3xx response.
+	HealthyThreshold   int
+	UnhealthyThreshold int
+
+	// Consecutive5xx proxied 5xx responses from one endpoint eject it for
+	// EjectionTime (0 disables outlier detection).
+	Consecutive5xx int
+	EjectionTime   time.Duration
+}
+
+// hostHealth is the health state of one Service host's endpoints.
+type hostHealth struct {
+	check  HealthCheck
+	cancel context.CancelFunc // stops the prober; nil when active probing is off
+
+	mu        sync.Mutex
+	endpoints map[string]*endpointHealth // pod IP -> state
+	stopped   bool
+
+	// ejected is the lock-free snapshot RRLB.get reads, rebuilt on every
+	// ejection change.
+	ejected atomic.Pointer[map[string]struct{}]
+}
+
+type endpointHealth struct {
+	passes, fails int  // consecutive active probe results
+	fivexx        int  // consecutive proxied 5xx
+	probeEjected  bool // ejected by active probing, until it passes again
+	outlierTimer  *time.Timer
+}
+
+func (e *endpointHealth) isEjected() bool {
+	return e.probeEjected || e.outlierTimer != nil
+}
+
+// SetHealthChecks sets the health check of each Service host
+// (service.namespace.svc.cluster.local). It is a full replace: a host whose
+// check is unchanged keeps its state; a new or changed check starts from every
+// endpoint healthy, and a dropped one re-admits all of its endpoints.
+func (t *Table) SetHealthChecks(checks map[string]HealthCheck) {
+	t.healthMu.Lock()
+	defer t.healthMu.Unlock()
+
+	t.health.Range(func(key, value any) bool {
+		host, hh := key.(string), value.(*hostHealth)
+		if c, ok := checks[host]; ok && c == hh.check {
+			return true
+		}
+		hh.stop()
+		t.health.Delete(host)
+		if _, ok := checks[host]; !ok {
+			t.onEjected(host, -1) // a changed check is reported below
+		}
+		return true
+	})
+
+	for host, c := range checks {
+		if _, ok := t.health.Load(host); ok {
+			continue
+		}
+		hh := &hostHealth{check: c, endpoints: map[string]*endpointHealth{}}
+		hh.ejected.Store(&map[string]struct{}{})
+		if c.Path != "" {
+			ctx, cancel := context.WithCancel(context.Background())
+			hh.cancel = cancel
+			go t.probeLoop(ctx, host, hh)
+		}
+		t.health.Store(host, hh)
+		t.onEjected(host, 0)
+	}
+	t.hasHealth.Store(len(checks) > 0)
+}
+
+// HasHealthChecks reports whether any host has a health check, so a caller can
+// skip building the host key for ObserveResponse when none does.
+func (t *Table) HasHealthChecks() bool {
+	return t.hasHealth.Load()
+}
+
+// ObserveResponse feeds a proxied response status from addr (podIP:port) of
+// host into outlier detection.
+func (t *Table) ObserveResponse(host, addr string, statusCode int) {
+	v, ok := t.health.Load(host)
+	if !ok {
+		return
+	}
+	hh := v.(*hostHealth)
+	if hh.check.Consecutive5xx <= 0 {
+		return
+	}
+	ip, _, _ := net.SplitHostPort(addr)
+	if ip == "" {
+		ip = addr
+	}
+
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+	if hh.stopped {
+		return
+	}
+	e := hh.endpoint(ip)
+	if statusCode < 500 {
+		e.fivexx = 0
+		return
+	}
+	e.fivexx++
+	if e.fivexx < hh.check.Consecutive5xx || e.outlierTimer != nil {
+		return
+	}
+	e.fivexx = 0
+	slog.Warn("route: eject outlier endpoint", "host", host, "ip", ip, "duration", hh.check.EjectionTime)
+	e.outlierTimer = time.AfterFunc(hh.check.EjectionTime, func() {
+		hh.mu.Lock()
+		defer hh.mu.Unlock()
+		if hh.stopped {
+			return
+		}
+		e.outlierTimer = nil
+		slog.Info("route: re-admit outlier endpoint", "host", host, "ip", ip)
+		t.publishEjected(host, hh)
+	})
+	t.publishEjected(host, hh)
+}
+
+// ejectedFor returns host's ejected endpoint set, or nil when host has no
+// health check.
+func (t *Table) ejectedFor(host string) map[string]struct{} {
+	v, ok := t.health.Load(host)
+	if !ok {
+		return nil
+	}
+	return *v.(*hostHealth).ejected.Load()
+}
+
+func (t *Table) onEjected(host string, n int) {
+	if t.OnEjected != nil {
+		t.OnEjected(host, n)
+	}
+}
+
+// publishEjected rebuilds hh's ejected snapshot. Caller holds hh.mu.
+func (t *Table) publishEjected(host string, hh *hostHealth) {
+	ejected := map[string]struct{}{}
+	for ip, e := range hh.endpoints {
+		if e.isEjected() {
+			ejected[ip] = struct{}{}
+		}
+	}
+	hh.ejected.Store(&ejected)
+	t.onEjected(host, len(ejected))
+}
+
+// forgetEndpoints drops the health state of host's endpoints that are no longer
+// in lb, so a departed pod's ejection isn't inherited by a new pod that reuses
+// its IP.
+func (t *Table) forgetEndpoints(host string, lb *RRLB) {
+	v, ok := t.health.Load(host)
+	if !ok {
+		return
+	}
+	hh := v.(*hostHealth)
+	current := map[string]struct{}{}
+	if lb != nil {
+		for _, ip := range lb.IPs {
+			current[ip] = struct{}{}
+		}
+	}
+
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+	if hh.stopped {
+		return
+	}
+	var changed bool
+	for ip, e := range hh.endpoints {
+		if _, ok := current[ip]; ok {
+			continue
+		}
+		if e.outlierTimer != nil {
+			e.outlierTimer.Stop()
+		}
+		delete(hh.endpoints, ip)
+		changed = true
+	}
+	if changed {
+		t.publishEjected(host, hh)
+	}
+}
+
+// endpoint returns ip's state, creating it healthy. Caller holds hh.mu.
+func (hh *hostHealth) endpoint(ip string) *endpointHealth {
+	e, ok := hh.endpoints[ip]
+	if !ok {
+		e = &endpointHealth{}
+		hh.endpoints[ip] = e
+	}
+	return e
+}
+
+func (hh *hostHealth) stop() {
+	if hh.cancel != nil {
+		hh.cancel()
+	}
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+	hh.stopped = true
+	for _, e := range hh.endpoints {
+		if e.outlierTimer != nil {
+			e.outlierTimer.Stop()
+		}
+	}
+}
+
+// probeLoop probes every current endpoint of host each interval until ctx is
+// done.
+func (t *Table) probeLoop(ctx context.Context, host string, hh *hostHealth) {
+	client := &http.Client{
+		Timeout: hh.check.Timeout,
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+		},
+		// a redirect is an answer; don't follow it
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+
+	ticker := time.NewTicker(hh.check.Interval)
+	defer ticker.Stop()
+	for {
+		t.probeRound(ctx, client, host, hh)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (t *Table) probeRound(ctx context.Context, client *http.Client, host string, hh *hostHealth) {
+	t.mu.RLock()
+	lb := t.addrToTargetHost[host]
+	t.mu.RUnlock()
+	var ips []string
+	if lb != nil {
+		ips = lb.IPs
+	}
+
+	results := make([]bool, len(ips))
+	var wg sync.WaitGroup
+	for i, ip := range ips {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = probe(ctx, client, hh.check, ip)
+		}()
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+	if hh.stopped {
+		return
+	}
+	current := make(map[string]struct{}, len(ips))
+	for i, ip := range ips {
+		current[ip] = struct{}{}
+		e := hh.endpoint(ip)
+		if results[i] {
+			e.fails = 0
+			e.passes++
+			if e.probeEjected && e.passes >= hh.check.HealthyThreshold {
+				e.probeEjected = false
+				slog.Info("route: endpoint passed health check", "host", host, "ip", ip)
+			}
+			continue
+		}
+		e.passes = 0
+		e.fails++
+		if !e.probeEjected && e.fails >= hh.check.UnhealthyThreshold {
+			e.probeEjected = true
+			slog.Warn("route: endpoint failed health check", "host", host, "ip", ip)
+		}
+	}
+	// forget endpoints no longer in the Service (see forgetEndpoints)
+	for ip, e := range hh.endpoints {
+		if _, ok := current[ip]; ok {
+			continue
+		}
+		if e.outlierTimer != nil {
+			e.outlierTimer.Stop()
+		}
+		delete(hh.endpoints, ip)
+	}
+	t.publishEjected(host, hh)
+}
+
+func probe(ctx context.Context, client *http.Client, c HealthCheck, ip string) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.Scheme+"://"+net.JoinHostPort(ip, c.Port)+c.Path, nil)
+	if err != nil {
+		return false
+	}
+	req.Header.Set("User-Agent", "parapet-health-check")
+	resp, err := client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode >= 200 && resp.StatusCode < 400
+}
@@ -0,0 +1,153 @@
+package route
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ejectedCounts records OnEjected calls.
+type ejectedCounts struct {
+	mu sync.Mutex
+	m  map[string]int
+}
+
+func (c *ejectedCounts) set(host string, n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.m == nil {
+		c.m = map[string]int{}
+	}
+	c.m[host] = n
+}
+
+func (c *ejectedCounts) get(host string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.m[host]
+}
+
+func TestTableHealthCheckActive(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/healthz", r.URL.Path)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+
+	const host = "api.default.svc.cluster.local"
+	var counts ejectedCounts
+	tb := Table{OnEjected: counts.set}
+	// 127.0.0.2 is on loopback but nothing listens there: its probes are refused
+	tb.SetHostRoutes(map[string]*RRLB{host: {IPs: []string{"127.0.0.1", "127.0.0.2"}}})
+	tb.SetPortRoutes(map[string]string{host + ":80": port})
+	tb.SetHealthChecks(map[string]HealthCheck{host: {
+		Path:               "/healthz",
+		Port:               port,
+		Scheme:             "http",
+		Interval:           10 * time.Millisecond,
+		Timeout:            time.Second,
+		HealthyThreshold:   1,
+		UnhealthyThreshold: 2,
+	}})
+	defer tb.SetHealthChecks(nil)
+
+	require.Eventually(t, func() bool { return counts.get(host) == 1 }, 5*time.Second, 10*time.Millisecond)
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, "127.0.0.1:"+port, tb.Lookup(host+":80"), "the failing endpoint is ejected")
+	}
+
+	// dropping the check re-admits it
+	tb.SetHealthChecks(nil)
+	assert.Equal(t, -1, counts.get(host), "reported dropped")
+	seen := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		seen[tb.Lookup(host+":80")] = true
+	}
+	assert.Len(t, seen, 2)
+}
+
+func TestTableHealthCheckOutlier(t *testing.T) {
+	t.Parallel()
+
+	const host = "api.default.svc.cluster.local"
+	var counts ejectedCounts
+	tb := Table{OnEjected: counts.set}
+	tb.SetHostRoutes(map[string]*RRLB{host: {IPs: []string{"10.0.0.1", "10.0.0.2"}}})
+	tb.SetPortRoutes(map[string]string{host + ":80": "8080"})
+	tb.SetHealthChecks(map[string]HealthCheck{host: {
+		Consecutive5xx: 3,
+		EjectionTime:   100 * time.Millisecond,
+	}})
+	defer tb.SetHealthChecks(nil)
+
+	assert.True(t, tb.HasHealthChecks())
+
+	// a success in between resets the streak
+	tb.ObserveResponse(host, "10.0.0.1:8080", 503)
+	tb.ObserveResponse(host, "10.0.0.1:8080", 502)
+	tb.ObserveResponse(host, "10.0.0.1:8080", 200)
+	tb.ObserveResponse(host, "10.0.0.1:8080", 500)
+	assert.Equal(t, 0, counts.get(host))
+
+	tb.ObserveResponse(host, "10.0.0.1:8080", 500)
+	tb.ObserveResponse(host, "10.0.0.1:8080", 500)
+	assert.Equal(t, 1, counts.get(host))
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, "10.0.0.2:8080", tb.Lookup(host+":80"))
+	}
+
+	// re-admitted once the ejection time is up
+	require.Eventually(t, func() bool { return counts.get(host) == 0 }, 5*time.Second, 10*time.Millisecond)
+	seen := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		seen[tb.Lookup(host+":80")] = true
+	}
+	assert.Len(t, seen, 2)
+}
+
+func TestTableHealthCheckForgetsDepartedEndpoints(t *testing.T) {
+	t.Parallel()
+
+	const host = "api.default.svc.cluster.local"
+	var counts ejectedCounts
+	tb := Table{OnEjected: counts.set}
+	tb.SetHostRoutes(map[string]*RRLB{host: {IPs: []string{"10.0.0.1", "10.0.0.2"}}})
+	tb.SetHealthChecks(map[string]HealthCheck{host: {Consecutive5xx: 1, EjectionTime: time.Hour}})
+	defer tb.SetHealthChecks(nil)
+
+	tb.ObserveResponse(host, "10.0.0.1:8080", 500)
+	assert.Equal(t, 1, counts.get(host))
+
+	// the pod leaves; a new pod reusing its IP starts healthy
+	tb.SetHostRoute(host, &RRLB{IPs: []string{"10.0.0.2"}})
+	assert.Equal(t, 0, counts.get(host))
+	assert.Empty(t, tb.ejectedFor(host))
+}
+
+func TestTableHealthCheckUnchangedKeepsState(t *testing.T) {
+	t.Parallel()
+
+	const host = "api.default.svc.cluster.local"
+	tb := Table{}
+	tb.SetHostRoutes(map[string]*RRLB{host: {IPs: []string{"10.0.0.1", "10.0.0.2"}}})
+	check := HealthCheck{Consecutive5xx: 1, EjectionTime: time.Hour}
+	tb.SetHealthChecks(map[string]HealthCheck{host: check})
+	defer tb.SetHealthChecks(nil)
+
+	tb.ObserveResponse(host, "10.0.0.1:8080", 500)
+	tb.SetHealthChecks(map[string]HealthCheck{host: check})
+	assert.Contains(t, tb.ejectedFor(host), "10.0.0.1")
+
+	check.EjectionTime = time.Minute
+	tb.SetHealthChecks(map[string]HealthCheck{host: check})
+	assert.Empty(t, tb.ejectedFor(host), "a changed check starts over")
+}
@@ -11,6 +11,14 @@ type RRLB struct {
 }
 
 func (lb *RRLB) Get(badAddr *badAddrTable) (ip string) {
+	return lb.get(badAddr, nil)
+}
+
+// get is Get that also skips the endpoints health checking ejected. Ejection
+// fails open: when every address that isn't bad is ejected, they are used
+// anyway, so a probe that fails everywhere (a wrong path, say) degrades to no
+// health checking instead of taking the Service down.
+func (lb *RRLB) get(badAddr *badAddrTable, ejected map[string]struct{}) (ip string) {
 	l := len(lb.IPs)
 	if l == 0 {
 		return ""
@@ -22,12 +30,31 @@ func (lb *RRLB) Get(badAddr *badAddrTable) (ip string) {
 	// take the modulo in uint32 space: int(uint32) can be negative on 32-bit
 	// platforms once current exceeds MaxInt32, which would yield a negative index.
 	p := int(atomic.AddUint32(&lb.current, 1) % uint32(l))
+	fallback := ""
 	for k := 0; k < l; k++ { // try gets not bad address
 		i := (p + k) % l
 		ip = lb.IPs[i]
-		if !badAddr.IsBad(ip) {
+		if badAddr.IsBad(ip) {
+			continue
+		}
+		if _, ok := ejected[ip]; !ok {
 			return
 		}
+		if fallback == "" {
+			fallback = ip
+		}
+	}
+	// all bad, return empty, prevent requests from stuck up in the queue; or
+	// all usable ones ejected, fail open
+	return fallback
+}
+
+// has reports whether ip is one of lb's IPs.
+func (lb *RRLB) has(ip string) bool {
+	for _, x := range lb.IPs {
+		if x == ip {
+			return true
+		}
 	}
-	return "" // all bad, return empty, prevent requests from stuck up in the queue
+	return false
 }
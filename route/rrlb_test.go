@@ -74,4 +74,32 @@ func TestRRLB(t *testing.T) {
 		assert.Equal(t, "", lb.Get(&badAddr))
 		assert.Equal(t, "", lb.Get(&badAddr))
 	})
+
+	t.Run("Ejected", func(t *testing.T) {
+		lb := &RRLB{
+			IPs: []string{
+				"192.168.1.1",
+				"192.168.1.2",
+				"192.168.1.3",
+			},
+		}
+		ejected := map[string]struct{}{"192.168.1.2": {}}
+		assert.Equal(t, "192.168.1.3", lb.get(nil, ejected)) // 2 is ejected so 3 is returned
+		assert.Equal(t, "192.168.1.3", lb.get(nil, ejected))
+		assert.Equal(t, "192.168.1.1", lb.get(nil, ejected))
+	})
+
+	t.Run("All Ejected Fails Open", func(t *testing.T) {
+		lb := &RRLB{
+			IPs: []string{
+				"192.168.1.1",
+				"192.168.1.2",
+			},
+		}
+		badAddr := badAddrTable{}
+		badAddr.MarkBad("192.168.1.1")
+		ejected := map[string]struct{}{"192.168.1.1": {}, "192.168.1.2": {}}
+		assert.Equal(t, "192.168.1.2", lb.get(&badAddr, ejected)) // ejected, but not bad
+		assert.Equal(t, "192.168.1.2", lb.get(&badAddr, ejected))
+	})
 }
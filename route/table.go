@@ -4,6 +4,8 @@ import (
 	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Table struct {
@@ -13,20 +15,77 @@ type Table struct {
 	addrToTargetPort   map[string]string
 	addrToExternalName map[string]string
 	badAddr            badAddrTable
+	stats              statsTable
+
+	// health holds the per-Service health state (host -> *hostHealth) of
+	// hosts with a HealthCheck; healthMu serializes SetHealthChecks.
+	health    sync.Map
+	healthMu  sync.Mutex
+	hasHealth atomic.Bool
+
+	// OnEjected, when set, is called with a host's ejected endpoint count
+	// whenever its health checking ejects or re-admits an endpoint, with 0
+	// when its health check is set, and with -1 when it is dropped.
+	OnEjected func(host string, ejected int)
 }
 
 func (t *Table) runBackgroundJob() {
 	go t.badAddr.clearLoop()
+	go t.pruneStatsLoop()
+}
+
+// pruneStatsLoop drops the load stats of pod IPs no Service routes to anymore.
+func (t *Table) pruneStatsLoop() {
+	const pruneDuration = 10 * time.Minute
+
+	for {
+		time.Sleep(pruneDuration)
+		t.pruneStats()
+	}
+}
+
+func (t *Table) pruneStats() {
+	live := map[string]struct{}{}
+	t.mu.RLock()
+	for _, lb := range t.addrToTargetHost {
+		for _, ip := range lb.IPs {
+			live[ip] = struct{}{}
+		}
+	}
+	t.mu.RUnlock()
+	t.stats.prune(live)
 }
 
 // Lookup returns the target pod's addr to connect to.
 // If the target pod's addr is not found in the table, it will return an empty string
 func (t *Table) Lookup(addr string) string {
+	target, _ := t.Pick(addr, RoundRobin, "")
+	return target
+}
+
+// Pick is Lookup with a load balancing algorithm; key is the request key the
+// Hash algorithm hashes ("" falls back to round-robin). done, when non-nil,
+// must be called once the request to target has finished: the load-aware
+// algorithms (LeastRequest, PowerOfTwo) count the request in flight until then
+// and record its duration.
+func (t *Table) Pick(addr string, alg Algorithm, key string) (target string, done func()) {
+	return t.pick(addr, "", alg, key)
+}
+
+// PickPinned is Pick for a sticky session pinned to a pod IP: the pinned IP is
+// used while it is still one of the Service's pod IPs and neither bad nor
+// ejected; otherwise (or with pinned "") a pod is picked as Pick does. The
+// caller re-pins to the IP of the returned target when it differs.
+func (t *Table) PickPinned(addr, pinned string, alg Algorithm, key string) (target string, done func()) {
+	return t.pick(addr, pinned, alg, key)
+}
+
+func (t *Table) pick(addr, pinned string, alg Algorithm, key string) (target string, done func()) {
 	// addr only in dns name service.namespace.svc.cluster.local:port
 	i := strings.LastIndex(addr, ":")
 	if i < 0 {
 		// invalid format
-		return ""
+		return "", nil
 	}
 	host := addr[:i]
 
@@ -38,30 +97,42 @@ func (t *Table) Lookup(addr string) string {
 
 	if !okPort {
 		// port not found in table
-		return ""
+		return "", nil
 	}
 
 	if okHost {
-		// pod-backed service: round-robin a healthy pod IP.
-		hostIP := targetHost.Get(&t.badAddr)
+		// pod-backed service: pick a healthy pod IP.
+		if alg == Hash && key == "" {
+			alg = RoundRobin
+		}
+		ejected := t.ejectedFor(host)
+		var hostIP string
+		if pinned != "" && targetHost.has(pinned) && candidate(pinned, &t.badAddr, ejected, false) {
+			hostIP = pinned
+		} else {
+			hostIP = targetHost.pick(alg, key, &t.badAddr, ejected, &t.stats)
+		}
 		if hostIP == "" {
 			// not found any pod
-			return ""
+			return "", nil
+		}
+		if alg == LeastRequest || alg == PowerOfTwo {
+			done = t.stats.get(hostIP).begin()
 		}
 		// JoinHostPort brackets IPv6 literals (EndpointSlices surface IPv6 pod IPs
 		// on dual-stack services); for IPv4/hostnames it is a plain host:port join.
-		return net.JoinHostPort(hostIP, targetPort)
+		return net.JoinHostPort(hostIP, targetPort), done
 	}
 
 	if okExt {
 		// ExternalName service: dial the external DNS name directly — the dialer's
 		// net.Resolver resolves it at connect time. No RRLB/badAddr: there is a
 		// single target, and transient failures are handled by the retry path.
-		return net.JoinHostPort(externalName, targetPort)
+		return net.JoinHostPort(externalName, targetPort), nil
 	}
 
 	// neither a pod route nor an externalName route for this host
-	return ""
+	return "", nil
 }
 
 // SetHostRoutes sets route from host to RRLB (IPs)
@@ -74,6 +145,11 @@ func (t *Table) SetHostRoutes(routes map[string]*RRLB) {
 	t.mu.Lock()
 	t.addrToTargetHost = routes
 	t.mu.Unlock()
+
+	t.health.Range(func(key, _ any) bool {
+		t.forgetEndpoints(key.(string), routes[key.(string)])
+		return true
+	})
 }
 
 func (t *Table) SetHostRoute(host string, lb *RRLB) {
@@ -89,6 +165,7 @@ func (t *Table) SetHostRoute(host string, lb *RRLB) {
 	} else {
 		delete(t.addrToTargetHost, host)
 	}
+	t.forgetEndpoints(host, lb)
 }
 
 // SetPortRoutes sets route from service's addr to pod's port
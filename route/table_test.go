@@ -2,6 +2,7 @@ package route
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -199,3 +200,43 @@ func TestTableIncrementalMatchesRebuild(t *testing.T) {
 			"incremental state diverged from full rebuild at step %d", i)
 	}
 }
+
+func TestTablePickPinned(t *testing.T) {
+	t.Parallel()
+
+	const host = "api.default.svc.cluster.local"
+	tb := Table{}
+	tb.SetHostRoutes(map[string]*RRLB{host: {IPs: []string{"10.0.0.1", "10.0.0.2"}}})
+	tb.SetPortRoutes(map[string]string{host + ":80": "8080"})
+
+	pick := func(pinned string) string {
+		target, _ := tb.PickPinned(host+":80", pinned, RoundRobin, "")
+		return target
+	}
+
+	t.Run("pinned endpoint is kept", func(t *testing.T) {
+		for i := 0; i < 4; i++ {
+			assert.Equal(t, "10.0.0.2:8080", pick("10.0.0.2"))
+		}
+	})
+
+	t.Run("departed endpoint is re-picked", func(t *testing.T) {
+		assert.Contains(t, []string{"10.0.0.1:8080", "10.0.0.2:8080"}, pick("10.0.0.9"))
+	})
+
+	t.Run("ejected endpoint is re-picked", func(t *testing.T) {
+		tb.SetHealthChecks(map[string]HealthCheck{host: {Consecutive5xx: 1, EjectionTime: time.Hour}})
+		defer tb.SetHealthChecks(nil)
+		tb.ObserveResponse(host, "10.0.0.1:8080", 503)
+		for i := 0; i < 4; i++ {
+			assert.Equal(t, "10.0.0.2:8080", pick("10.0.0.1"))
+		}
+	})
+
+	t.Run("bad endpoint is re-picked", func(t *testing.T) {
+		tb.MarkBad("10.0.0.2")
+		for i := 0; i < 4; i++ {
+			assert.Equal(t, "10.0.0.1:8080", pick("10.0.0.2"))
+		}
+	})
+}
@@ -0,0 +1,298 @@
+// Package tlspolicy resolves the per-Ingress TLS policy annotations — a named
+// profile (modern/intermediate) and its custom overrides — into the minimum
+// version, TLS 1.2 cipher suites and ALPN protocols a host is served with. It
+// is shared by the in-cluster controller, which applies a policy per SNI, and
+// the edge control plane, which distributes it with the host's certificate so
+// the edge enforces the same one. See SPEC.md (ssl-policy) and EDGE.md.
+package tlspolicy
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+const (
+	PolicyAnnotation     = "parapet.moonrhythm.io/ssl-policy"
+	MinVersionAnnotation = "parapet.moonrhythm.io/ssl-min-version"
+	CiphersAnnotation    = "parapet.moonrhythm.io/ssl-ciphers"
+	ALPNAnnotation       = "parapet.moonrhythm.io/ssl-alpn"
+)
+
+// Policy is how a host's handshakes are served. The zero value is the
+// listener's default: TLS 1.2 and up, Go's cipher suites, h2 and http/1.1.
+type Policy struct {
+	MinVersion   uint16   // 0: TLS 1.2
+	CipherSuites []uint16 // TLS 1.2 suites, in preference order; nil: Go's defaults
+	ALPN         []string // nil: h2 and http/1.1
+}
+
+// profiles are the named policies, after Mozilla's server side TLS
+// recommendations.
+var profiles = map[string]Policy{
+	// modern is TLS 1.3 only, its suites are not configurable.
+	"modern": {MinVersion: tls.VersionTLS13},
+	// intermediate is TLS 1.2 and up, with forward secret AEAD suites only.
+	"intermediate": {
+		MinVersion: tls.VersionTLS12,
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		},
+	},
+}
+
+var versions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// FromAnnotations reads an Ingress's policy: the profile named by ssl-policy
+// ("custom" or none for the listener's default), then ssl-min-version
+// ("1.2", "1.3"), ssl-ciphers (comma separated TLS 1.2 suite names) and
+// ssl-alpn (comma separated, of h2 and http/1.1) on top of it. nil when it
+// sets none of them.
+func FromAnnotations(annotations map[string]string) (*Policy, error) {
+	get := func(k string) string { return strings.TrimSpace(annotations[k]) }
+	profile := strings.ToLower(get(PolicyAnnotation))
+	minVersion, ciphers, alpn := get(MinVersionAnnotation), get(CiphersAnnotation), get(ALPNAnnotation)
+	if profile == "" && minVersion == "" && ciphers == "" && alpn == "" {
+		return nil, nil
+	}
+
+	var p Policy
+	if profile != "" && profile != "custom" {
+		base, ok := profiles[profile]
+		if !ok {
+			return nil, fmt.Errorf("unknown ssl-policy %q", profile)
+		}
+		p = base
+	}
+	if minVersion != "" {
+		v, ok := versions[minVersion]
+		if !ok {
+			return nil, fmt.Errorf("invalid ssl-min-version %q", minVersion)
+		}
+		p.MinVersion = v
+		if v == tls.VersionTLS13 {
+			p.CipherSuites = nil
+		}
+	}
+	if ciphers != "" {
+		suites, err := parseCipherSuites(splitList(ciphers))
+		if err != nil {
+			return nil, err
+		}
+		p.CipherSuites = suites
+	}
+	if alpn != "" {
+		protos, err := parseALPN(splitList(alpn))
+		if err != nil {
+			return nil, err
+		}
+		p.ALPN = protos
+	}
+	if p.MinVersion == tls.VersionTLS13 && p.CipherSuites != nil {
+		return nil, fmt.Errorf("ssl-ciphers do not apply to TLS 1.3")
+	}
+	return &p, nil
+}
+
+func splitList(s string) []string {
+	var xs []string
+	for _, x := range strings.Split(s, ",") {
+		if x = strings.TrimSpace(x); x != "" {
+			xs = append(xs, x)
+		}
+	}
+	return xs
+}
+
+func parseCipherSuites(names []string) ([]uint16, error) {
+	suites := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := cipherSuiteID(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown or unsupported TLS 1.2 cipher suite %q", name)
+		}
+		if !slices.Contains(suites, id) {
+			suites = append(suites, id)
+		}
+	}
+	return suites, nil
+}
+
+// cipherSuiteID looks up a TLS 1.2 suite Go considers secure by its IANA name.
+func cipherSuiteID(name string) (uint16, bool) {
+	for _, s := range tls.CipherSuites() {
+		if s.Name == name && slices.Contains(s.SupportedVersions, tls.VersionTLS12) {
+			return s.ID, true
+		}
+	}
+	return 0, false
+}
+
+func parseALPN(protos []string) ([]string, error) {
+	var out []string
+	for _, proto := range protos {
+		if proto != "h2" && proto != "http/1.1" {
+			return nil, fmt.Errorf("unsupported ssl-alpn protocol %q", proto)
+		}
+		if !slices.Contains(out, proto) {
+			out = append(out, proto)
+		}
+	}
+	return out, nil
+}
+
+// Apply sets p on c, a config of its own (a clone).
+func (p *Policy) Apply(c *tls.Config) {
+	if p.MinVersion != 0 {
+		c.MinVersion = p.MinVersion
+	}
+	if p.CipherSuites != nil {
+		c.CipherSuites = p.CipherSuites
+	}
+	if p.ALPN != nil {
+		c.NextProtos = p.ALPN
+	}
+}
+
+// String is p's canonical form, e.g. "min=1.2 ciphers=A:B alpn=h2"; equal
+// policies have the same one.
+func (p *Policy) String() string {
+	var b strings.Builder
+	b.WriteString("min=")
+	b.WriteString(versionName(p.MinVersion))
+	if p.CipherSuites != nil {
+		b.WriteString(" ciphers=")
+		for i, id := range p.CipherSuites {
+			if i > 0 {
+				b.WriteByte(':')
+			}
+			b.WriteString(tls.CipherSuiteName(id))
+		}
+	}
+	if p.ALPN != nil {
+		b.WriteString(" alpn=")
+		b.WriteString(strings.Join(p.ALPN, ","))
+	}
+	return b.String()
+}
+
+func versionName(v uint16) string {
+	if v == tls.VersionTLS13 {
+		return "1.3"
+	}
+	return "1.2"
+}
+
+// wirePolicy is Policy as the edge control plane serves it, by name.
+type wirePolicy struct {
+	MinVersion   string   `json:"min_version"`
+	CipherSuites []string `json:"cipher_suites,omitempty"`
+	ALPN         []string `json:"alpn,omitempty"`
+}
+
+func (p Policy) MarshalJSON() ([]byte, error) {
+	w := wirePolicy{MinVersion: versionName(p.MinVersion), ALPN: p.ALPN}
+	for _, id := range p.CipherSuites {
+		w.CipherSuites = append(w.CipherSuites, tls.CipherSuiteName(id))
+	}
+	return json.Marshal(w)
+}
+
+// UnmarshalJSON validates like FromAnnotations, so an edge never applies a
+// policy it doesn't understand.
+func (p *Policy) UnmarshalJSON(b []byte) error {
+	var w wirePolicy
+	if err := json.Unmarshal(b, &w); err != nil {
+		return err
+	}
+	v, ok := versions[w.MinVersion]
+	if !ok {
+		return fmt.Errorf("invalid min_version %q", w.MinVersion)
+	}
+	np := Policy{MinVersion: v}
+	if w.CipherSuites != nil {
+		suites, err := parseCipherSuites(w.CipherSuites)
+		if err != nil {
+			return err
+		}
+		np.CipherSuites = suites
+	}
+	if w.ALPN != nil {
+		protos, err := parseALPN(w.ALPN)
+		if err != nil {
+			return err
+		}
+		np.ALPN = protos
+	}
+	*p = np
+	return nil
+}
+
+// Hosts are the policies by host (lowercase, a wildcard host literal).
+type Hosts map[string]*Policy
+
+// Lookup returns the policy of the host a TLS client names, on its exact
+// host, else on the wildcard host covering it; nil for the default.
+func (hosts Hosts) Lookup(serverName string) *Policy {
+	if len(hosts) == 0 {
+		return nil
+	}
+	host := strings.TrimSuffix(strings.ToLower(serverName), ".")
+	if p, ok := hosts[host]; ok {
+		return p
+	}
+	if i := strings.IndexByte(host, '.'); i > 0 {
+		return hosts["*"+host[i:]]
+	}
+	return nil
+}
+
+// Builder collects Hosts from Ingresses. A host's Ingresses that disagree
+// resolve to the policy of the first by "namespace/name", whatever order
+// they are added in, so the controller and the edge pick the same one.
+type Builder struct {
+	hosts  Hosts
+	source map[string]string
+}
+
+// Add records p, the policy of the Ingress source ("namespace/name"), for
+// host. A nil p is skipped: an Ingress without a policy doesn't unset
+// another's.
+func (b *Builder) Add(source, host string, p *Policy) {
+	if p == nil {
+		return
+	}
+	host = strings.ToLower(host)
+	if b.hosts == nil {
+		b.hosts = make(Hosts)
+		b.source = make(map[string]string)
+	}
+	if prev, ok := b.hosts[host]; ok {
+		if prev.String() != p.String() {
+			first, other := b.source[host], source
+			if source < first {
+				first, other = source, first
+			}
+			slog.Warn("conflicting ssl-policy on host, using the first ingress's", "host", host, "ingress", first, "ignored", other)
+		}
+		if b.source[host] <= source {
+			return
+		}
+	}
+	b.hosts[host] = p
+	b.source[host] = source
+}
+
+// Hosts returns the policies collected so far.
+func (b *Builder) Hosts() Hosts { return b.hosts }
@@ -0,0 +1,115 @@
+package tlspolicy_test
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/moonrhythm/parapet-ingress-controller/tlspolicy"
+)
+
+func TestFromAnnotations(t *testing.T) {
+	t.Parallel()
+
+	parse := func(a map[string]string) *tlspolicy.Policy {
+		t.Helper()
+		p, err := tlspolicy.FromAnnotations(a)
+		require.NoError(t, err)
+		return p
+	}
+
+	assert.Nil(t, parse(nil))
+	assert.Nil(t, parse(map[string]string{"other": "x"}))
+
+	p := parse(map[string]string{tlspolicy.PolicyAnnotation: "Modern"})
+	assert.Equal(t, "min=1.3", p.String())
+
+	p = parse(map[string]string{tlspolicy.PolicyAnnotation: "intermediate"})
+	assert.EqualValues(t, tls.VersionTLS12, p.MinVersion)
+	assert.Contains(t, p.CipherSuites, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256)
+	assert.NotContains(t, p.CipherSuites, tls.TLS_RSA_WITH_AES_128_GCM_SHA256)
+
+	p = parse(map[string]string{
+		tlspolicy.PolicyAnnotation:  "intermediate",
+		tlspolicy.CiphersAnnotation: "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384, TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+		tlspolicy.ALPNAnnotation:    "http/1.1",
+	})
+	assert.Equal(t, "min=1.2 ciphers=TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384:TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 alpn=http/1.1", p.String())
+
+	p = parse(map[string]string{tlspolicy.PolicyAnnotation: "intermediate", tlspolicy.MinVersionAnnotation: "1.3"})
+	assert.Equal(t, "min=1.3", p.String(), "the profile's suites don't apply to TLS 1.3")
+
+	p = parse(map[string]string{tlspolicy.PolicyAnnotation: "custom", tlspolicy.ALPNAnnotation: "h2,h2"})
+	assert.Equal(t, "min=1.2 alpn=h2", p.String())
+
+	for _, a := range []map[string]string{
+		{tlspolicy.PolicyAnnotation: "old"},
+		{tlspolicy.MinVersionAnnotation: "1.1"},
+		{tlspolicy.CiphersAnnotation: "TLS_AES_128_GCM_SHA256"},
+		{tlspolicy.CiphersAnnotation: "TLS_ECDHE_RSA_WITH_RC4_128_SHA"},
+		{tlspolicy.PolicyAnnotation: "modern", tlspolicy.CiphersAnnotation: "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+		{tlspolicy.ALPNAnnotation: "spdy/3"},
+	} {
+		_, err := tlspolicy.FromAnnotations(a)
+		assert.Error(t, err, "%v", a)
+	}
+}
+
+func TestPolicyJSON(t *testing.T) {
+	t.Parallel()
+
+	p, err := tlspolicy.FromAnnotations(map[string]string{
+		tlspolicy.PolicyAnnotation: "intermediate",
+		tlspolicy.ALPNAnnotation:   "http/1.1",
+	})
+	require.NoError(t, err)
+	b, err := json.Marshal(p)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), `"min_version":"1.2"`)
+	assert.Contains(t, string(b), `"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256"`)
+
+	var got tlspolicy.Policy
+	require.NoError(t, json.Unmarshal(b, &got))
+	assert.Equal(t, p.String(), got.String())
+
+	assert.Error(t, json.Unmarshal([]byte(`{"min_version":"1.0"}`), &got))
+	assert.Error(t, json.Unmarshal([]byte(`{"min_version":"1.2","cipher_suites":["NOPE"]}`), &got))
+}
+
+func TestApply(t *testing.T) {
+	t.Parallel()
+
+	c := &tls.Config{MinVersion: tls.VersionTLS12, NextProtos: []string{"h2", "http/1.1"}}
+	(&tlspolicy.Policy{MinVersion: tls.VersionTLS13}).Apply(c)
+	assert.EqualValues(t, tls.VersionTLS13, c.MinVersion)
+	assert.Nil(t, c.CipherSuites)
+	assert.Equal(t, []string{"h2", "http/1.1"}, c.NextProtos, "kept when unset")
+
+	(&tlspolicy.Policy{ALPN: []string{"http/1.1"}}).Apply(c)
+	assert.Equal(t, []string{"http/1.1"}, c.NextProtos)
+}
+
+func TestHosts(t *testing.T) {
+	t.Parallel()
+
+	modern := &tlspolicy.Policy{MinVersion: tls.VersionTLS13}
+	legacy := &tlspolicy.Policy{MinVersion: tls.VersionTLS12}
+
+	var b tlspolicy.Builder
+	b.Add("default/b", "App.example.com", legacy)
+	b.Add("default/a", "app.example.com", modern)
+	b.Add("default/c", "app.example.com", legacy)
+	b.Add("default/c", "*.example.com", legacy)
+	b.Add("default/d", "plain.example.com", nil)
+	hosts := b.Hosts()
+
+	assert.Same(t, modern, hosts.Lookup("APP.example.com."), "the first ingress by name wins, whatever the order")
+	assert.Same(t, legacy, hosts.Lookup("www.example.com"), "the wildcard host covers a subdomain")
+	assert.Same(t, legacy, hosts.Lookup("plain.example.com"), "an ingress without a policy doesn't unset one")
+	assert.Nil(t, hosts.Lookup("a.b.example.com"))
+	assert.Nil(t, hosts.Lookup(""))
+	assert.Nil(t, tlspolicy.Hosts(nil).Lookup("app.example.com"))
+}